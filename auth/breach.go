@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// BreachChecker looks a password up in a breach dataset. Implementations never send or
+// store the password itself.
+type BreachChecker interface {
+	Check(ctx context.Context, pw string) (HIBPResult, error)
+}
+
+// OnlineChecker queries the Have I Been Pwned range API (see CheckHIBP).
+type OnlineChecker struct{}
+
+// Check implements BreachChecker.
+func (OnlineChecker) Check(ctx context.Context, pw string) (HIBPResult, error) {
+	return CheckHIBP(ctx, pw)
+}
+
+// FileChecker searches a local copy of the Pwned Passwords SHA-1 list, in the
+// "ordered by hash" form published by HIBP: one "HASH:COUNT" line per password,
+// upper-case hex, sorted by hash. The file is binary-searched in place and never loaded
+// into memory.
+type FileChecker struct {
+	Path string
+}
+
+// hibpLineMax bounds one "HASH:COUNT" line; real lines are under 60 bytes.
+const hibpLineMax = 128
+
+// ErrBreachDataset indicates a local breach file or filter that cannot be read as one.
+var ErrBreachDataset = errors.New("malformed breach dataset")
+
+// Check implements BreachChecker.
+//
+// Behavior:
+//  1. Hashes pw with SHA-1 and searches for the hex digest by byte offset: each probe
+//     seeks to the middle of the remaining range, skips to the next line start and
+//     compares that line's hash.
+//  2. Needs about log2(file size) reads of at most 256 bytes each.
+func (c FileChecker) Check(ctx context.Context, pw string) (HIBPResult, error) {
+	f, err := os.Open(c.Path)
+	if err != nil {
+		return HIBPResult{}, fmt.Errorf("open breach file: %w", err)
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return HIBPResult{}, fmt.Errorf("stat breach file: %w", err)
+	}
+
+	sum := sha1.Sum([]byte(pw))
+	target := []byte(strings.ToUpper(hex.EncodeToString(sum[:])))
+
+	buf := make([]byte, 2*hibpLineMax)
+	lo, hi := int64(0), st.Size()
+	for lo < hi {
+		if err := ctx.Err(); err != nil {
+			return HIBPResult{}, err
+		}
+		mid := lo + (hi-lo)/2
+
+		// Find the first line that starts at or after mid.
+		start := mid
+		if mid > 0 {
+			n, err := f.ReadAt(buf[:hibpLineMax], mid-1)
+			if n == 0 && err != nil {
+				return HIBPResult{}, fmt.Errorf("read breach file: %w", err)
+			}
+			i := bytes.IndexByte(buf[:n], '\n')
+			if i < 0 {
+				if errors.Is(err, io.EOF) {
+					// mid is inside the last line and the file has no final newline:
+					// no line starts at or after mid.
+					hi = mid
+					continue
+				}
+				return HIBPResult{}, fmt.Errorf("%w: line longer than %d bytes", ErrBreachDataset, hibpLineMax)
+			}
+			start = mid + int64(i)
+		}
+		if start >= hi {
+			hi = mid
+			continue
+		}
+
+		n, err := f.ReadAt(buf[:hibpLineMax], start)
+		if n == 0 && err != nil {
+			return HIBPResult{}, fmt.Errorf("read breach file: %w", err)
+		}
+		line := buf[:n]
+		end := start + int64(n)
+		if i := bytes.IndexByte(line, '\n'); i >= 0 {
+			line = line[:i]
+			end = start + int64(i) + 1
+		}
+		line = bytes.TrimRight(line, "\r")
+		hash, count, ok := bytes.Cut(line, []byte(":"))
+		if !ok || len(hash) != len(target) {
+			return HIBPResult{}, fmt.Errorf("%w: line at offset %d is not HASH:COUNT", ErrBreachDataset, start)
+		}
+
+		switch bytes.Compare(bytes.ToUpper(hash), target) {
+		case 0:
+			n, err := strconv.Atoi(string(bytes.TrimSpace(count)))
+			if err != nil {
+				return HIBPResult{}, fmt.Errorf("%w: bad count at offset %d", ErrBreachDataset, start)
+			}
+			return HIBPResult{Found: true, Count: n}, nil
+		case -1:
+			lo = end
+		default:
+			hi = mid
+		}
+	}
+	return HIBPResult{}, nil
+}
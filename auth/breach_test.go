@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeBreachList writes n passwords "pw-<i>" as a sorted HASH:COUNT list, with count
+// i+1, and returns its path.
+func writeBreachList(t *testing.T, n int, trailingNewline bool) string {
+	t.Helper()
+	lines := make([]string, n)
+	for i := range lines {
+		sum := sha1.Sum([]byte(fmt.Sprintf("pw-%d", i)))
+		lines[i] = fmt.Sprintf("%s:%d", strings.ToUpper(hex.EncodeToString(sum[:])), i+1)
+	}
+	sort.Strings(lines)
+	data := strings.Join(lines, "\r\n")
+	if trailingNewline {
+		data += "\r\n"
+	}
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFileCheckerFindsEveryLine(t *testing.T) {
+	for _, trailing := range []bool{true, false} {
+		t.Run(fmt.Sprintf("trailing newline %v", trailing), func(t *testing.T) {
+			const n = 200
+			checker := FileChecker{Path: writeBreachList(t, n, trailing)}
+			ctx := context.Background()
+			for i := 0; i < n; i++ {
+				res, err := checker.Check(ctx, fmt.Sprintf("pw-%d", i))
+				if err != nil {
+					t.Fatalf("pw-%d: %v", i, err)
+				}
+				if !res.Found || res.Count != i+1 {
+					t.Fatalf("pw-%d: got %+v, want found with count %d", i, res, i+1)
+				}
+			}
+			for i := n; i < n+100; i++ {
+				res, err := checker.Check(ctx, fmt.Sprintf("pw-%d", i))
+				if err != nil {
+					t.Fatalf("pw-%d: %v", i, err)
+				}
+				if res.Found {
+					t.Fatalf("pw-%d: reported breached but not in the list", i)
+				}
+			}
+		})
+	}
+}
+
+func TestFileCheckerRejectsMalformedList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.txt")
+	if err := os.WriteFile(path, []byte("not a hash list\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (FileChecker{Path: path}).Check(context.Background(), "x"); err == nil {
+		t.Fatal("expected an error for a malformed list")
+	}
+}
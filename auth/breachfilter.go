@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// Bloom filter file layout, little-endian:
+//
+//	magic "PMBLOOM1" | k uint32 | reserved uint32 | m uint64 (bits) | n uint64 (hashes) | m/8 bytes of bits
+//
+// The SHA-1 digests are already uniform, so the k bit positions come straight from the
+// digest by double hashing (Kirsch-Mitzenmacher) instead of from further hash functions.
+var bloomMagic = [8]byte{'P', 'M', 'B', 'L', 'O', 'O', 'M', '1'}
+
+const bloomHeaderLen = 32
+
+// DefaultFilterFalsePositiveRate costs about 14.4 bits, under 2 bytes, per password.
+const DefaultFilterFalsePositiveRate = 0.001
+
+// FilterChecker tests passwords against a Bloom filter built by BuildBreachFilter. It is
+// a fraction of the size of the SHA-1 list but answers "probably breached": a hit has
+// Count 0, and about one password in 1/rate is reported breached when it is not. A miss
+// is always right.
+type FilterChecker struct {
+	Path string
+}
+
+type bloomHeader struct {
+	k uint32
+	m uint64
+	n uint64
+}
+
+// Check implements BreachChecker. It reads the header and the k bytes holding the
+// password's bits, not the whole filter.
+func (c FilterChecker) Check(ctx context.Context, pw string) (HIBPResult, error) {
+	f, err := os.Open(c.Path)
+	if err != nil {
+		return HIBPResult{}, fmt.Errorf("open breach filter: %w", err)
+	}
+	defer f.Close()
+
+	var raw [bloomHeaderLen]byte
+	if _, err := io.ReadFull(f, raw[:]); err != nil {
+		return HIBPResult{}, fmt.Errorf("%w: breach filter header: %v", ErrBreachDataset, err)
+	}
+	h, err := parseBloomHeader(raw[:])
+	if err != nil {
+		return HIBPResult{}, err
+	}
+
+	sum := sha1.Sum([]byte(pw))
+	var b [1]byte
+	for _, bit := range bloomBits(sum[:], h.k, h.m) {
+		if err := ctx.Err(); err != nil {
+			return HIBPResult{}, err
+		}
+		if _, err := f.ReadAt(b[:], bloomHeaderLen+int64(bit/8)); err != nil {
+			return HIBPResult{}, fmt.Errorf("%w: breach filter truncated", ErrBreachDataset)
+		}
+		if b[0]&(1<<(bit%8)) == 0 {
+			return HIBPResult{}, nil
+		}
+	}
+	return HIBPResult{Found: true}, nil
+}
+
+// BuildBreachFilter builds a Bloom filter file at dst from src, a Pwned Passwords SHA-1
+// list ("HASH:COUNT" lines; order does not matter).
+//
+// Args:
+//
+//	src: path of the SHA-1 list; it is read twice, once to count and once to fill.
+//	dst: path of the filter to write; it is replaced only when the build succeeds.
+//	rate: target false-positive rate, between 0 and 0.5; 0 means DefaultFilterFalsePositiveRate.
+//
+// Returns:
+//
+//	uint64: number of hashes added.
+//	error: non-nil when src cannot be read or holds a malformed line.
+//
+// Behavior:
+//  1. Sizes the filter for the counted hashes: m = -n ln(rate) / ln(2)^2 bits and
+//     k = (m/n) ln 2 probes. The whole bit array is held in memory while building.
+//  2. Writes to dst.tmp and renames it over dst.
+func BuildBreachFilter(src, dst string, rate float64) (uint64, error) {
+	if rate == 0 {
+		rate = DefaultFilterFalsePositiveRate
+	}
+	if rate <= 0 || rate >= 0.5 {
+		return 0, fmt.Errorf("false-positive rate must be between 0 and 0.5")
+	}
+
+	var n uint64
+	if err := eachBreachHash(src, func([]byte) { n++ }); err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("%w: %s holds no hashes", ErrBreachDataset, src)
+	}
+
+	bitsPerHash := -math.Log(rate) / (math.Ln2 * math.Ln2)
+	m := uint64(math.Ceil(float64(n)*bitsPerHash/64)) * 64
+	k := uint32(math.Max(1, math.Round(bitsPerHash*math.Ln2)))
+	bits := make([]byte, m/8)
+	if err := eachBreachHash(src, func(sum []byte) {
+		for _, bit := range bloomBits(sum, k, m) {
+			bits[bit/8] |= 1 << (bit % 8)
+		}
+	}); err != nil {
+		return 0, err
+	}
+
+	var hdr [bloomHeaderLen]byte
+	copy(hdr[:8], bloomMagic[:])
+	binary.LittleEndian.PutUint32(hdr[8:], k)
+	binary.LittleEndian.PutUint64(hdr[16:], m)
+	binary.LittleEndian.PutUint64(hdr[24:], n)
+
+	tmp := dst + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return 0, fmt.Errorf("create breach filter: %w", err)
+	}
+	if _, err := out.Write(hdr[:]); err == nil {
+		_, err = out.Write(bits)
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, fmt.Errorf("write breach filter: %w", err)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return 0, fmt.Errorf("install breach filter: %w", err)
+	}
+	return n, nil
+}
+
+// eachBreachHash calls fn with the 20-byte digest of every line of a SHA-1 list.
+func eachBreachHash(path string, fn func(sum []byte)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open breach file: %w", err)
+	}
+	defer f.Close()
+
+	sum := make([]byte, sha1.Size)
+	sc := bufio.NewScanner(f)
+	line := 0
+	for sc.Scan() {
+		line++
+		text := bytes.TrimSpace(sc.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		hash, _, _ := bytes.Cut(text, []byte(":"))
+		if len(hash) != 2*sha1.Size {
+			return fmt.Errorf("%w: line %d is not HASH:COUNT", ErrBreachDataset, line)
+		}
+		if _, err := hex.Decode(sum, hash); err != nil {
+			return fmt.Errorf("%w: line %d: %v", ErrBreachDataset, line, err)
+		}
+		fn(sum)
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("read breach file: %w", err)
+	}
+	return nil
+}
+
+func parseBloomHeader(raw []byte) (bloomHeader, error) {
+	if !bytes.Equal(raw[:8], bloomMagic[:]) {
+		return bloomHeader{}, fmt.Errorf("%w: not a breach filter", ErrBreachDataset)
+	}
+	h := bloomHeader{
+		k: binary.LittleEndian.Uint32(raw[8:]),
+		m: binary.LittleEndian.Uint64(raw[16:]),
+		n: binary.LittleEndian.Uint64(raw[24:]),
+	}
+	if h.k == 0 || h.k > 64 || h.m == 0 || h.m%64 != 0 {
+		return bloomHeader{}, fmt.Errorf("%w: breach filter header is corrupt", ErrBreachDataset)
+	}
+	return h, nil
+}
+
+// bloomBits returns the k bit positions of a SHA-1 digest in an m-bit filter.
+func bloomBits(sum []byte, k uint32, m uint64) []uint64 {
+	h1 := binary.LittleEndian.Uint64(sum[0:8])
+	h2 := binary.LittleEndian.Uint64(sum[8:16]) | 1
+	out := make([]uint64, k)
+	for i := range out {
+		out[i] = (h1 + uint64(i)*h2) % m
+	}
+	return out
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBreachFilterRoundTrip(t *testing.T) {
+	const n = 2000
+	src := writeBreachList(t, n, false)
+	dst := filepath.Join(t.TempDir(), "pwned.bloom")
+
+	added, err := BuildBreachFilter(src, dst, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != n {
+		t.Fatalf("added %d hashes, want %d", added, n)
+	}
+
+	checker := FilterChecker{Path: dst}
+	ctx := context.Background()
+	for i := 0; i < n; i++ {
+		res, err := checker.Check(ctx, fmt.Sprintf("pw-%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Found {
+			t.Fatalf("pw-%d: a listed password was missed", i)
+		}
+	}
+
+	falsePositives := 0
+	for i := n; i < 2*n; i++ {
+		res, err := checker.Check(ctx, fmt.Sprintf("pw-%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Found {
+			falsePositives++
+		}
+	}
+	// Expect about 20 at a rate of 0.01; allow plenty of slack.
+	if falsePositives > 60 {
+		t.Fatalf("%d false positives in %d lookups at rate 0.01", falsePositives, n)
+	}
+}
+
+func TestFilterCheckerRejectsOtherFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "not.bloom")
+	if err := os.WriteFile(path, make([]byte, bloomHeaderLen+8), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := (FilterChecker{Path: path}).Check(context.Background(), "x")
+	if !errors.Is(err, ErrBreachDataset) {
+		t.Fatalf("got %v, want ErrBreachDataset", err)
+	}
+}
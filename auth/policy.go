@@ -2,12 +2,14 @@ package auth
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/nbutton23/zxcvbn-go"
+
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
 )
 
 const specialChars = "!\"#$%&'()*+,-./:;<=>?@[\\]^_{|}~`"
@@ -17,9 +19,55 @@ var hibpLookupFn = CheckHIBP
 // ValidateOptions configures password policy requirements.
 type ValidateOptions struct {
 	EnableHIBP     bool
-	MinZXCVBNScore int
-	MinLength      int
+	MinZXCVBNScore int // 0 means the default; negative turns the score check off
+	MinLength      int // 0 means the default
 	RequireLUDS    bool
+	// RequireClasses lists the character classes that must appear; RequireLUDS adds all four.
+	RequireClasses krypto.CharClass
+	// BannedWords may not appear in the password, ignoring case. Words shorter than
+	// three characters are skipped.
+	BannedWords []string
+	// UserInputs are words zxcvbn treats as easy to guess, such as the username.
+	UserInputs []string
+	// Breach is the dataset EnableHIBP checks; nil means the online range API.
+	Breach BreachChecker
+	// BreachFailOpen accepts the password when the breach check itself fails (offline,
+	// missing dataset) instead of refusing it.
+	BreachFailOpen bool
+	// BreachWarnOnly reports a breached password as a warning instead of a violation.
+	BreachWarnOnly bool
+}
+
+// Violation is one policy rule a password does not meet.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Policy rules reported in Violation.Rule.
+const (
+	RuleMinLength   = "min_length"
+	RuleLower       = "lower"
+	RuleUpper       = "upper"
+	RuleDigit       = "digit"
+	RuleSpecial     = "special"
+	RuleBannedWord  = "banned_word"
+	RuleScore       = "score"
+	RuleBreached    = "breached"
+	RuleBreachCheck = "breach_check"
+)
+
+// PolicyError lists every rule a password failed.
+type PolicyError struct {
+	Violations []Violation
+}
+
+func (e *PolicyError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.Message
+	}
+	return strings.Join(msgs, "; ")
 }
 
 // DefaultValidateOptions returns the standard validation policy.
@@ -52,59 +100,114 @@ func ValidateMasterPassword(pw string) error {
 // Args:
 //   ctx: controls cancellation, deadlines, and metadata for downstream checks such as HIBP.
 //   pw: password candidate to check.
-//   opts: validation policy; zero values are filled with DefaultValidateOptions.
+//   opts: validation policy; see CheckPassword.
 //
 // Returns:
-//   error: nil when the password satisfies the policy; descriptive error otherwise.
+//   error: nil when the password satisfies the policy; otherwise a *PolicyError listing
+//          every violation. Warnings are dropped; use CheckPassword to see them.
+func ValidateMasterPasswordAdvanced(ctx context.Context, pw string, opts ValidateOptions) error {
+	if violations, _ := CheckPassword(ctx, pw, opts); len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// CheckPassword checks pw against every rule in opts.
+//
+// Args:
+//   ctx: controls cancellation of the breach lookup.
+//   pw: password candidate to check.
+//   opts: validation policy; a zero MinLength or MinZXCVBNScore takes the default.
+//
+// Returns:
+//   violations: every rule pw fails, in a fixed order; nil when it passes.
+//   warnings: findings that do not fail pw: a breach hit under BreachWarnOnly and a
+//             failed lookup under BreachFailOpen.
 //
 // Behavior:
-//   1) Normalizes opts to ensure sensible minimums.
-//   2) Verifies length, optional LUDS composition, and zxcvbn score.
-//   3) Optionally performs a Have I Been Pwned lookup via the provided context.
-//   4) Surfaces actionable, non-leaking error messages for each failing condition.
-func ValidateMasterPasswordAdvanced(ctx context.Context, pw string, opts ValidateOptions) error {
+//   1) Checks length, the required classes, banned words and the zxcvbn score, which
+//      counts opts.UserInputs as guessable.
+//   2) Looks the password up in a breach dataset (opts.Breach, by default the online
+//      HIBP API) only when the other rules pass, so a rejected password is not sent.
+//   3) Messages never include the password.
+func CheckPassword(ctx context.Context, pw string, opts ValidateOptions) (violations, warnings []Violation) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
 
 	defaults := DefaultValidateOptions()
-	opts.MinLength = defaults.MinLength
-	opts.MinZXCVBNScore = defaults.MinZXCVBNScore
+	if opts.MinLength <= 0 {
+		opts.MinLength = defaults.MinLength
+	}
+	if opts.MinZXCVBNScore == 0 {
+		opts.MinZXCVBNScore = defaults.MinZXCVBNScore
+	}
 	if opts.MinZXCVBNScore > 4 {
 		opts.MinZXCVBNScore = 4
 	}
+	required := opts.RequireClasses
+	if opts.RequireLUDS {
+		required = krypto.AllClasses
+	}
 
-	if len(pw) < opts.MinLength {
-		return errors.New("password too short")
+	fail := func(rule, msg string) {
+		violations = append(violations, Violation{Rule: rule, Message: msg})
 	}
-	if opts.RequireLUDS {
-		if !hasUpper(pw) {
-			return errors.New("password must include an uppercase letter")
-		}
-		if !hasDigit(pw) {
-			return errors.New("password must include a digit")
-		}
-		if !hasSpecial(pw) {
-			return errors.New("password must include a special character")
+	if utf8.RuneCountInString(pw) < opts.MinLength {
+		fail(RuleMinLength, fmt.Sprintf("password too short (at least %d characters)", opts.MinLength))
+	}
+	if required&krypto.ClassLower != 0 && !hasLower(pw) {
+		fail(RuleLower, "password must include a lowercase letter")
+	}
+	if required&krypto.ClassUpper != 0 && !hasUpper(pw) {
+		fail(RuleUpper, "password must include an uppercase letter")
+	}
+	if required&krypto.ClassDigit != 0 && !hasDigit(pw) {
+		fail(RuleDigit, "password must include a digit")
+	}
+	if required&krypto.ClassSymbol != 0 && !hasSpecial(pw) {
+		fail(RuleSpecial, "password must include a special character")
+	}
+	lower := strings.ToLower(pw)
+	for _, word := range opts.BannedWords {
+		word = strings.ToLower(strings.TrimSpace(word))
+		if utf8.RuneCountInString(word) >= 3 && strings.Contains(lower, word) {
+			fail(RuleBannedWord, fmt.Sprintf("password must not contain %q", word))
 		}
 	}
-
-	strength := zxcvbn.PasswordStrength(pw, nil)
-	if strength.Score < opts.MinZXCVBNScore {
-		return errors.New("password too weak")
+	if opts.MinZXCVBNScore > 0 {
+		if strength := zxcvbn.PasswordStrength(pw, opts.UserInputs); strength.Score < opts.MinZXCVBNScore {
+			fail(RuleScore, "password too weak")
+		}
 	}
 
-	if opts.EnableHIBP {
-		res, err := hibpLookupFn(ctx, pw)
-		if err != nil {
-			return fmt.Errorf("hibp lookup failed: %w", err)
+	if opts.EnableHIBP && len(violations) == 0 {
+		lookup := hibpLookupFn
+		if opts.Breach != nil {
+			lookup = opts.Breach.Check
 		}
-		if res.Found {
-			return errors.New("password appears in known breach lists")
+		res, err := lookup(ctx, pw)
+		switch {
+		case err != nil && opts.BreachFailOpen:
+			warnings = append(warnings, Violation{Rule: RuleBreachCheck, Message: fmt.Sprintf("breach check skipped: %v", err)})
+		case err != nil:
+			fail(RuleBreachCheck, fmt.Sprintf("hibp lookup failed: %v", err))
+		case res.Found && opts.BreachWarnOnly:
+			warnings = append(warnings, Violation{Rule: RuleBreached, Message: "password appears in known breach lists"})
+		case res.Found:
+			fail(RuleBreached, "password appears in known breach lists")
 		}
 	}
+	return violations, warnings
+}
 
-	return nil
+func hasLower(s string) bool {
+	for _, r := range s {
+		if unicode.IsLower(r) {
+			return true
+		}
+	}
+	return false
 }
 
 func hasUpper(s string) bool {
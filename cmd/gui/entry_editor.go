@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	pmsvc "github.com/Hussein-Mazeh/PasswordManager/internal/service"
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+)
+
+var fieldTypeOptions = []string{string(vault.FieldText), string(vault.FieldHidden), string(vault.FieldBoolean)}
+
+// matchDefaultOption stands for vault.MatchDefault in the match mode select.
+const matchDefaultOption = "default"
+
+var matchModeOptions = []string{
+	matchDefaultOption,
+	string(vault.MatchBaseDomain),
+	string(vault.MatchHost),
+	string(vault.MatchHostPort),
+	string(vault.MatchPrefix),
+	string(vault.MatchExact),
+	string(vault.MatchRegex),
+	string(vault.MatchNever),
+}
+
+// fieldRow is one editable custom field in the entry editor.
+type fieldRow struct {
+	name  *widget.Entry
+	typ   *widget.Select
+	value *widget.Entry
+	check *widget.Check
+	row   *fyne.Container
+}
+
+func (r *fieldRow) field() vault.CustomField {
+	f := vault.CustomField{
+		Name:  strings.TrimSpace(r.name.Text),
+		Type:  vault.FieldType(r.typ.Selected),
+		Value: r.value.Text,
+	}
+	if f.Type == vault.FieldBoolean {
+		f.Value = fmt.Sprintf("%t", r.check.Checked)
+	}
+	return f
+}
+
+// showEntryEditor opens a dialog for every part of an entry: website, username, type,
+// password, folder, URLs and their match mode, tags, notes and custom fields. When editing, website and
+// username identify the row and cannot change. onSave receives the edited entry; if it
+// returns an error the error is shown and the editor reopens with the user's input.
+func showEntryEditor(w fyne.Window, title string, entry pmsvc.Entry, editing bool, onSave func(pmsvc.Entry) error) {
+	site := widget.NewEntry()
+	site.SetPlaceHolder("example.com")
+	site.SetText(entry.Website)
+	user := widget.NewEntry()
+	user.SetPlaceHolder("username")
+	user.SetText(entry.Username)
+	if editing {
+		site.Disable()
+		user.Disable()
+	}
+
+	typ := widget.NewEntry()
+	typ.SetPlaceHolder("password")
+	typ.SetText(entry.Type)
+
+	pass := widget.NewPasswordEntry()
+	pass.SetPlaceHolder("password / secret")
+	pass.SetText(entry.Payload.Password)
+
+	folder := widget.NewEntry()
+	folder.SetPlaceHolder("(optional) e.g. work/email")
+	folder.SetText(entry.Payload.Folder)
+
+	urls := widget.NewMultiLineEntry()
+	urls.SetPlaceHolder("one URL per line")
+	urls.SetText(strings.Join(entry.Payload.URLs, "\n"))
+	urls.SetMinRowsVisible(2)
+
+	match := widget.NewSelect(matchModeOptions, nil)
+	match.SetSelected(matchDefaultOption)
+	if entry.Payload.Match != vault.MatchDefault {
+		match.SetSelected(string(entry.Payload.Match))
+	}
+
+	tags := widget.NewEntry()
+	tags.SetPlaceHolder("comma separated, e.g. finance, 2fa")
+	tags.SetText(strings.Join(entry.Payload.Tags, ", "))
+
+	notes := widget.NewMultiLineEntry()
+	notes.SetPlaceHolder("notes, security questions, ...")
+	notes.SetText(entry.Payload.Notes)
+	notes.SetMinRowsVisible(3)
+
+	var rows []*fieldRow
+	fieldsBox := container.NewVBox()
+
+	var addRow func(f vault.CustomField)
+	addRow = func(f vault.CustomField) {
+		r := &fieldRow{
+			name:  widget.NewEntry(),
+			value: widget.NewEntry(),
+			check: widget.NewCheck("", nil),
+		}
+		r.name.SetPlaceHolder("name")
+		r.name.SetText(f.Name)
+		r.value.SetPlaceHolder("value")
+		r.value.SetText(f.Value)
+		r.check.SetChecked(f.Value == "true")
+
+		r.typ = widget.NewSelect(fieldTypeOptions, func(sel string) {
+			switch vault.FieldType(sel) {
+			case vault.FieldBoolean:
+				r.value.Hide()
+				r.check.Show()
+			default:
+				r.value.Password = vault.FieldType(sel) == vault.FieldHidden
+				r.value.Refresh()
+				r.check.Hide()
+				r.value.Show()
+			}
+		})
+		if f.Type == "" {
+			f.Type = vault.FieldText
+		}
+		r.typ.SetSelected(string(f.Type))
+
+		remove := widget.NewButtonWithIcon("", theme.DeleteIcon(), nil)
+		r.row = container.NewBorder(nil, nil,
+			container.NewGridWrap(fyne.NewSize(240, r.name.MinSize().Height), container.NewGridWithColumns(2, r.name, r.typ)),
+			remove,
+			container.NewStack(r.value, r.check),
+		)
+		remove.OnTapped = func() {
+			for i := range rows {
+				if rows[i] == r {
+					rows = append(rows[:i], rows[i+1:]...)
+					break
+				}
+			}
+			fieldsBox.Remove(r.row)
+		}
+
+		rows = append(rows, r)
+		fieldsBox.Add(r.row)
+	}
+	for _, f := range entry.Payload.Fields {
+		addRow(f)
+	}
+	addField := widget.NewButtonWithIcon("Add Field", theme.ContentAddIcon(), func() {
+		addRow(vault.CustomField{Type: vault.FieldText})
+	})
+
+	form := widget.NewForm(
+		widget.NewFormItem("Website", site),
+		widget.NewFormItem("Username", user),
+		widget.NewFormItem("Type", typ),
+		widget.NewFormItem("Password", pass),
+		widget.NewFormItem("Folder", folder),
+		widget.NewFormItem("URLs", urls),
+		widget.NewFormItem("Autofill match", match),
+		widget.NewFormItem("Tags", tags),
+		widget.NewFormItem("Notes", notes),
+	)
+
+	content := container.NewVScroll(container.NewVBox(
+		form,
+		widget.NewLabel("Custom fields:"),
+		fieldsBox,
+		container.NewHBox(layout.NewSpacer(), addField),
+	))
+	content.SetMinSize(fyne.NewSize(560, 460))
+
+	var d dialog.Dialog
+	d = dialog.NewCustomConfirm(title, "Save", "Cancel", content, func(ok bool) {
+		if !ok {
+			return
+		}
+
+		out := pmsvc.Entry{
+			ID:       entry.ID,
+			Website:  strings.TrimSpace(site.Text),
+			Username: strings.TrimSpace(user.Text),
+			Type:     strings.TrimSpace(typ.Text),
+			Payload: vault.EntryPayload{
+				Password: pass.Text,
+				Notes:    notes.Text,
+				URLs:     strings.Split(urls.Text, "\n"),
+				Tags:     strings.Split(tags.Text, ","),
+				Folder:   folder.Text,
+			},
+		}
+		if match.Selected != matchDefaultOption {
+			out.Payload.Match = vault.MatchMode(match.Selected)
+		}
+		for _, r := range rows {
+			out.Payload.Fields = append(out.Payload.Fields, r.field())
+		}
+
+		if out.Website == "" || out.Username == "" {
+			dialog.ShowInformation(title, "Fill website and username", w)
+			d.Show()
+			return
+		}
+		if err := onSave(out); err != nil {
+			dialog.ShowError(err, w)
+			d.Show()
+			return
+		}
+		pass.SetText("") // don’t keep secrets in the field
+	}, w)
+	d.Show()
+}
+
+// entryDetails lays out a decrypted entry for the Get / Reveal dialog. Hidden custom
+// fields stay masked; each one gets a Copy button that goes through the clipboard timer.
+func entryDetails(w fyne.Window, entry pmsvc.Entry) fyne.CanvasObject {
+	p := entry.Payload
+	form := widget.NewForm()
+	if p.Folder != "" {
+		form.Append("Folder", widget.NewLabel(p.Folder))
+	}
+	if len(p.URLs) > 0 {
+		form.Append("URLs", widget.NewLabel(strings.Join(p.URLs, "\n")))
+	}
+	if p.Match != vault.MatchDefault {
+		form.Append("Autofill match", widget.NewLabel(string(p.Match)))
+	}
+	if len(p.Tags) > 0 {
+		form.Append("Tags", widget.NewLabel(strings.Join(p.Tags, ", ")))
+	}
+	for _, f := range p.Fields {
+		f := f
+		text := f.Value
+		if f.Type == vault.FieldHidden {
+			text = "••••••••"
+		}
+		copyBtn := widget.NewButtonWithIcon("", theme.ContentCopyIcon(), func() {
+			w.Clipboard().SetContent(f.Value)
+			scheduleClipboardClear(w)
+		})
+		form.Append(f.Name, container.NewBorder(nil, nil, nil, copyBtn, widget.NewLabel(text)))
+	}
+	if p.Notes != "" {
+		notes := widget.NewLabel(p.Notes)
+		notes.Wrapping = fyne.TextWrapWord
+		form.Append("Notes", notes)
+	}
+	return form
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	pmsvc "github.com/Hussein-Mazeh/PasswordManager/internal/service"
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+)
+
+const (
+	modePassword   = "Password"
+	modePassphrase = "Passphrase"
+)
+
+// showGenerator opens the password/passphrase generator. When site has a rule in
+// site-rules.json, or the password policy covers entries, the password options are
+// narrowed to it. onUse receives the secret when the user accepts it.
+func showGenerator(w fyne.Window, svc *pmsvc.Service, site string, onUse func(secret string)) {
+	var rule *krypto.SiteRule
+	r, ok, err := svc.SiteRule(strings.TrimSpace(site))
+	if err != nil {
+		dialog.ShowError(fmt.Errorf("site rules: %w", err), w)
+		return
+	}
+	if ok {
+		rule = &r
+	}
+
+	out := widget.NewEntry()
+	entropy := widget.NewLabel("")
+
+	length := widget.NewSlider(krypto.MinPasswordLength, 64)
+	length.Step = 1
+	length.SetValue(float64(krypto.DefaultPasswordOptions().Length))
+	lengthLabel := widget.NewLabel("")
+	lower := widget.NewCheck("a-z", nil)
+	upper := widget.NewCheck("A-Z", nil)
+	digits := widget.NewCheck("0-9", nil)
+	symbols := widget.NewCheck("Symbols", nil)
+	for _, c := range []*widget.Check{lower, upper, digits, symbols} {
+		c.SetChecked(true)
+	}
+	ambiguous := widget.NewCheck("Avoid ambiguous characters (0O1lI|)", nil)
+
+	words := widget.NewSlider(krypto.MinPassphraseWords, 12)
+	words.Step = 1
+	words.SetValue(float64(krypto.DefaultPassphraseOptions().Words))
+	wordsLabel := widget.NewLabel("")
+	separator := widget.NewEntry()
+	separator.SetText(krypto.DefaultPassphraseOptions().Separator)
+	capitalize := widget.NewCheck("Capitalize words", nil)
+
+	passwordBox := container.NewVBox(
+		container.NewBorder(nil, nil, widget.NewLabel("Length"), lengthLabel, length),
+		container.NewHBox(lower, upper, digits, symbols),
+		ambiguous,
+	)
+	passphraseBox := container.NewVBox(
+		container.NewBorder(nil, nil, widget.NewLabel("Words"), wordsLabel, words),
+		container.NewBorder(nil, nil, widget.NewLabel("Separator"), nil, separator),
+		capitalize,
+	)
+
+	mode := widget.NewRadioGroup([]string{modePassword, modePassphrase}, nil)
+	mode.Horizontal = true
+
+	regenerate := func() {
+		lengthLabel.SetText(fmt.Sprintf("%d", int(length.Value)))
+		wordsLabel.SetText(fmt.Sprintf("%d", int(words.Value)))
+
+		var gen krypto.Generated
+		var err error
+		if mode.Selected == modePassphrase {
+			passwordBox.Hide()
+			passphraseBox.Show()
+			gen, err = krypto.GeneratePassphrase(krypto.PassphraseOptions{
+				Words:      int(words.Value),
+				Separator:  separator.Text,
+				Capitalize: capitalize.Checked,
+			})
+			if err == nil && rule != nil && rule.MaxLength > 0 && len(gen.Secret) > rule.MaxLength {
+				err = fmt.Errorf("%s accepts at most %d characters; use fewer words or a password", site, rule.MaxLength)
+			}
+		} else {
+			passphraseBox.Hide()
+			passwordBox.Show()
+			opts := krypto.PasswordOptions{Length: int(length.Value), ExcludeAmbiguous: ambiguous.Checked}
+			for c, class := range map[*widget.Check]krypto.CharClass{
+				lower:   krypto.ClassLower,
+				upper:   krypto.ClassUpper,
+				digits:  krypto.ClassDigit,
+				symbols: krypto.ClassSymbol,
+			} {
+				if c.Checked {
+					opts.Classes |= class
+				}
+			}
+			opts.Required = opts.Classes
+			if rule != nil {
+				opts = opts.Apply(*rule)
+			}
+			gen, err = krypto.GeneratePassword(opts)
+		}
+		if err != nil {
+			out.SetText("")
+			entropy.SetText(err.Error())
+			return
+		}
+		out.SetText(gen.Secret)
+		entropy.SetText(fmt.Sprintf("Entropy: %.0f bits", gen.EntropyBits))
+	}
+
+	mode.OnChanged = func(string) { regenerate() }
+	length.OnChangeEnded = func(float64) { regenerate() }
+	words.OnChangeEnded = func(float64) { regenerate() }
+	separator.OnChanged = func(string) { regenerate() }
+	for _, c := range []*widget.Check{lower, upper, digits, symbols, ambiguous, capitalize} {
+		c.OnChanged = func(bool) { regenerate() }
+	}
+	mode.SetSelected(modePassword)
+
+	items := []fyne.CanvasObject{mode, passwordBox, passphraseBox}
+	if rule != nil {
+		note := widget.NewLabel(fmt.Sprintf("Narrowed to the rule for %s in site-rules.json.", site))
+		note.Wrapping = fyne.TextWrapWord
+		items = append(items, note)
+	}
+	items = append(items,
+		widget.NewSeparator(),
+		container.NewBorder(nil, nil, nil, widget.NewButton("Regenerate", regenerate), out),
+		entropy,
+	)
+
+	d := dialog.NewCustomConfirm("Generate Password", "Use", "Cancel", container.NewVBox(items...), func(ok bool) {
+		if ok && out.Text != "" {
+			onUse(out.Text)
+		}
+	}, w)
+	d.Resize(fyne.NewSize(520, 0))
+	d.Show()
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+
+	pmsvc "github.com/Hussein-Mazeh/PasswordManager/internal/service"
+)
+
+// showHistory lists the previous versions of an entry with the password masked. Each
+// version can be revealed, copied, or restored; onRestore runs after a successful restore.
+func showHistory(w fyne.Window, svc *pmsvc.Service, site, user string, onRestore func()) {
+	items, err := svc.History(site, user)
+	if err != nil {
+		dialog.ShowError(fmt.Errorf("history: %w", err), w)
+		return
+	}
+	if len(items) == 0 {
+		dialog.ShowInformation("History", fmt.Sprintf("No previous versions for %s / %s", site, user), w)
+		return
+	}
+
+	var d dialog.Dialog
+	rows := container.NewVBox()
+	for _, it := range items {
+		it := it
+		pwd := widget.NewLabel("••••••••")
+		revealed := false
+
+		revealBtn := widget.NewButton("Reveal", nil)
+		revealBtn.OnTapped = func() {
+			revealed = !revealed
+			if revealed {
+				pwd.SetText(it.Payload.Password)
+				revealBtn.SetText("Hide")
+			} else {
+				pwd.SetText("••••••••")
+				revealBtn.SetText("Reveal")
+			}
+		}
+		copyBtn := widget.NewButton("Copy", func() {
+			w.Clipboard().SetContent(it.Payload.Password)
+			scheduleClipboardClear(w)
+		})
+		restoreBtn := makePrimary(widget.NewButton("Restore", func() {
+			dialog.NewConfirm(
+				"Restore",
+				fmt.Sprintf("Make version %d of %s / %s current again?\nThe current version is kept in history.", it.Version, site, user),
+				func(ok bool) {
+					if !ok {
+						return
+					}
+					if err := svc.RestoreVersion(site, user, it.Version); err != nil {
+						dialog.ShowError(fmt.Errorf("restore: %w", err), w)
+						return
+					}
+					d.Hide()
+					dialog.ShowInformation("Restore", fmt.Sprintf("Version %d restored", it.Version), w)
+					if onRestore != nil {
+						onRestore()
+					}
+				},
+				w,
+			).Show()
+		}))
+
+		header := widget.NewLabelWithStyle(
+			fmt.Sprintf("Version %d — set %s, replaced %s", it.Version, it.UpdatedAt, it.ArchivedAt),
+			fyne.TextAlignLeading, fyne.TextStyle{Bold: true},
+		)
+		rows.Add(container.NewVBox(
+			header,
+			container.NewHBox(pwd, layout.NewSpacer(), revealBtn, copyBtn, restoreBtn),
+			widget.NewSeparator(),
+		))
+	}
+
+	scroll := container.NewVScroll(rows)
+	scroll.SetMinSize(fyne.NewSize(560, 360))
+	d = dialog.NewCustom(fmt.Sprintf("History — %s / %s", site, user), "Close", scroll, w)
+	d.Show()
+}
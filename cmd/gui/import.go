@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/Hussein-Mazeh/PasswordManager/internal/importer"
+	pmsvc "github.com/Hussein-Mazeh/PasswordManager/internal/service"
+)
+
+var importFormatLabels = map[importer.Format]string{
+	importer.ChromeCSV:     "Chrome / Edge (CSV)",
+	importer.FirefoxCSV:    "Firefox (CSV)",
+	importer.BitwardenJSON: "Bitwarden (unencrypted JSON)",
+	importer.KeePassXML:    "KeePass 2 (XML)",
+	importer.OnePUX:        "1Password (.1pux)",
+	importer.PMArchive:     "pm export archive",
+}
+
+// showImportWizard walks through an import in two steps: pick the format and file, then
+// review a dry-run preview and confirm. A pm export archive also asks for its export
+// passphrase. onDone runs after credentials were imported.
+func showImportWizard(w fyne.Window, svc *pmsvc.Service, onDone func()) {
+	var labels []string
+	byLabel := make(map[string]importer.Format)
+	for _, f := range importer.Formats() {
+		labels = append(labels, importFormatLabels[f])
+		byLabel[importFormatLabels[f]] = f
+	}
+	passEntry := widget.NewPasswordEntry()
+	passEntry.SetPlaceHolder("Export passphrase")
+	formatSel := widget.NewSelect(labels, func(label string) {
+		if byLabel[label] == importer.PMArchive {
+			passEntry.Enable()
+		} else {
+			passEntry.Disable()
+		}
+	})
+	formatSel.SetSelected(labels[0])
+
+	var data []byte
+	fileLbl := widget.NewLabel("No file chosen")
+	browse := widget.NewButton("Choose File…", func() {
+		dialog.ShowFileOpen(func(rc fyne.URIReadCloser, err error) {
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("choose file: %w", err), w)
+				return
+			}
+			if rc == nil {
+				return
+			}
+			defer rc.Close()
+			b, err := io.ReadAll(rc)
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("read file: %w", err), w)
+				return
+			}
+			data = b
+			fileLbl.SetText(rc.URI().Name())
+		}, w)
+	})
+
+	form := widget.NewForm(
+		widget.NewFormItem("Export from", formatSel),
+		widget.NewFormItem("File", container.NewBorder(nil, nil, nil, browse, fileLbl)),
+		widget.NewFormItem("Passphrase", passEntry),
+	)
+	help := widget.NewLabel("Websites are stored as their registrable domain (eTLD+1). Entries that already exist are left untouched.")
+	help.Wrapping = fyne.TextWrapWord
+
+	dialog.ShowCustomConfirm("Import (1/2): Choose Export", "Preview", "Cancel", container.NewVBox(form, help), func(ok bool) {
+		if !ok {
+			return
+		}
+		if data == nil {
+			dialog.ShowInformation("Import", "Choose an export file first", w)
+			return
+		}
+		format := byLabel[formatSel.Selected]
+		run := func(dryRun bool) ([]importer.Result, error) {
+			return svc.Import(format, data, dryRun)
+		}
+		if format == importer.PMArchive {
+			pass := []byte(passEntry.Text)
+			run = func(dryRun bool) ([]importer.Result, error) {
+				return svc.ImportArchive(data, pass, dryRun)
+			}
+		}
+		preview, err := run(true)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("import: %w", err), w)
+			return
+		}
+		showImportPreview(w, run, preview, onDone)
+	}, w)
+}
+
+// showImportPreview lists the dry-run results and performs the import on confirmation
+// by calling run without dryRun.
+func showImportPreview(w fyne.Window, run func(dryRun bool) ([]importer.Result, error), preview []importer.Result, onDone func()) {
+	rows := container.NewVBox()
+	for _, r := range preview {
+		status := string(r.Status)
+		if r.Status == importer.StatusImported {
+			status = "new"
+		}
+		note := r.Reason
+		if note == "" {
+			note = r.Source
+		}
+		rows.Add(container.NewHBox(
+			widget.NewLabelWithStyle(status, fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+			widget.NewLabel(fmt.Sprintf("%s / %s", r.Website, r.Username)),
+			layout.NewSpacer(),
+			widget.NewLabel(note),
+		))
+	}
+	counts := importer.Summary(preview)
+	summary := widget.NewLabel(fmt.Sprintf("%d new, %d duplicates, %d in trash, %d skipped",
+		counts[importer.StatusImported], counts[importer.StatusDuplicate], counts[importer.StatusInTrash], counts[importer.StatusSkipped]))
+
+	scroll := container.NewVScroll(rows)
+	scroll.SetMinSize(fyne.NewSize(620, 320))
+
+	var d dialog.Dialog
+	d = dialog.NewCustomConfirm("Import (2/2): Review", "Import", "Cancel",
+		container.NewBorder(summary, nil, nil, nil, scroll),
+		func(ok bool) {
+			if !ok {
+				return
+			}
+			results, err := run(false)
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("import: %w", err), w)
+				return
+			}
+			if onDone != nil {
+				onDone()
+			}
+			done := importer.Summary(results)
+			dialog.ShowInformation("Import", fmt.Sprintf("Imported %d credentials (%d duplicates, %d skipped, %d failed)",
+				done[importer.StatusImported], done[importer.StatusDuplicate], done[importer.StatusSkipped]+done[importer.StatusInTrash], done[importer.StatusFailed]), w)
+		}, w)
+	if counts[importer.StatusImported] == 0 {
+		d = dialog.NewCustom("Import (2/2): Review", "Close", container.NewBorder(summary, nil, nil, nil, scroll), w)
+	}
+	d.Show()
+}
@@ -24,6 +24,7 @@ import (
 
 	"github.com/Hussein-Mazeh/PasswordManager/internal/bio/toggle"
 	pmsvc "github.com/Hussein-Mazeh/PasswordManager/internal/service"
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
 )
 
 func hasVault(dir string) bool {
@@ -166,6 +167,9 @@ func main() {
 	var showLogin func()
 	var showVault func()
 
+	// keyfilePath remembers the keyfile used at login so Change Master keeps requiring it.
+	var keyfilePath string
+
 	showSetup = func() {
 		stopAutoLock()
 		svc.Close()
@@ -185,6 +189,11 @@ func main() {
 		confirm := widget.NewPasswordEntry()
 		confirm.SetPlaceHolder("Confirm master password")
 
+		setupKeyfile, setupKeyfileRow := keyfilePicker(w)
+
+		recoveryCheck := widget.NewCheck("Generate a printable recovery code", nil)
+		recoveryCheck.SetChecked(true)
+
 		btnInit := makePrimary(widget.NewButton("Set Master Password", func() {
 			username := strings.TrimSpace(userEntry.Text)
 			pw := pass.Text
@@ -214,7 +223,13 @@ func main() {
 				return
 			}
 
-			if err := svc.SetMaster(username, pw); err != nil {
+			var code string
+			if recoveryCheck.Checked {
+				code, err = svc.SetMasterWithRecovery(username, pw, setupKeyfile.Text)
+			} else {
+				err = svc.SetMaster(username, pw, setupKeyfile.Text)
+			}
+			if err != nil {
 				dialog.ShowError(fmt.Errorf("set master: %w", err), w)
 				return
 			}
@@ -222,6 +237,10 @@ func main() {
 			pass.SetText("")
 			confirm.SetText("")
 
+			if code != "" {
+				showRecoveryCode(w, code, showLogin)
+				return
+			}
 			dialog.ShowInformation("Vault Ready", "Master password saved. Please log in.", w)
 			showLogin()
 		}))
@@ -230,6 +249,8 @@ func main() {
 			widget.NewFormItem("Username", userEntry),
 			widget.NewFormItem("Master Password", pass),
 			widget.NewFormItem("Confirm Password", confirm),
+			widget.NewFormItem("Keyfile", setupKeyfileRow),
+			widget.NewFormItem("", recoveryCheck),
 		)
 
 		setupCard := widget.NewCard(
@@ -268,12 +289,24 @@ func main() {
 		pass := widget.NewPasswordEntry()
 		pass.SetPlaceHolder("Enter master password")
 
+		loginKeyfile, loginKeyfileRow := keyfilePicker(w)
+		loginKeyfile.SetText(keyfilePath)
+
 		btnUnlock := widget.NewButton("Unlock", func() {
 			pw := strings.TrimSpace(pass.Text)
-			if err := svc.Unlock(pw); err != nil {
+			if err := svc.Unlock(pw, loginKeyfile.Text); err != nil {
+				if errors.Is(err, pmsvc.ErrHeaderTampered) {
+					dialog.ShowError(errors.New("the vault header failed its integrity check; header.json may have been modified outside the password manager"), w)
+					return
+				}
+				if errors.Is(err, pmsvc.ErrKeyfileRequired) {
+					dialog.ShowInformation("Unlock", "This vault requires a keyfile. Choose it and try again.", w)
+					return
+				}
 				dialog.ShowError(fmt.Errorf("unlock failed: %w", err), w)
 				return
 			}
+			keyfilePath = loginKeyfile.Text
 			pass.SetText("")
 			if resetIdleTimer != nil {
 				resetIdleTimer()
@@ -281,10 +314,25 @@ func main() {
 			showVault()
 		})
 
+		loginBox := container.NewVBox(pass, loginKeyfileRow, btnUnlock)
+		if svc.AgentUnlocked() {
+			loginBox.Add(widget.NewButton("Unlock with pm agent", func() {
+				if err := svc.UnlockWithAgent(); err != nil {
+					dialog.ShowError(fmt.Errorf("agent unlock failed: %w", err), w)
+					return
+				}
+				pass.SetText("")
+				if resetIdleTimer != nil {
+					resetIdleTimer()
+				}
+				showVault()
+			}))
+		}
+
 		loginCard := widget.NewCard(
 			"Vault Locked",
 			"Please enter your master password",
-			container.NewVBox(pass, btnUnlock),
+			loginBox,
 		)
 		root.Objects = []fyne.CanvasObject{
 			container.NewCenter(container.NewMax(container.NewPadded(loginCard))),
@@ -348,7 +396,7 @@ func main() {
 				dialog.ShowInformation("Change Master", "New passwords do not match", w)
 				return
 			}
-			if err := svc.ChangeMaster(oldTxt, newTxt); err != nil {
+			if err := svc.ChangeMaster(oldTxt, newTxt, keyfilePath, keyfilePath); err != nil {
 				dialog.ShowError(fmt.Errorf("change master: %w", err), w)
 				return
 			}
@@ -477,19 +525,48 @@ func main() {
 				dialog.ShowInformation("Add", "Fill website, username, and password", w)
 				return
 			}
-			if err := svc.Add(site.Text, user.Text, pass.Text); err != nil {
+			warnings, err := svc.Add(site.Text, user.Text, pass.Text)
+			if err != nil {
 				dialog.ShowError(fmt.Errorf("add: %w", err), w)
 				return
 			}
 			site.SetText("")
 			user.SetText("")
 			pass.SetText("")
-			dialog.ShowInformation("Add", "Credential saved", w)
+			dialog.ShowInformation("Add", savedMessage("Credential saved", warnings), w)
 		})))
 
+		btnAddGenerate := widget.NewButton("Generate…", withIdleReset(func() {
+			showGenerator(w, svc, site.Text, func(secret string) { pass.SetText(secret) })
+		}))
+
+		btnAddEditor := widget.NewButton("More Fields…", withIdleReset(func() {
+			draft := pmsvc.Entry{
+				Website:  strings.TrimSpace(site.Text),
+				Username: strings.TrimSpace(user.Text),
+				Type:     "password",
+				Payload:  vault.EntryPayload{Password: pass.Text},
+			}
+			showEntryEditor(w, "New Entry", draft, false, func(e pmsvc.Entry) error {
+				if resetIdleTimer != nil {
+					resetIdleTimer()
+				}
+				warnings, err := svc.AddEntry(e.Website, e.Username, e.Type, e.Payload)
+				if err != nil {
+					return fmt.Errorf("add: %w", err)
+				}
+				site.SetText("")
+				user.SetText("")
+				pass.SetText("")
+				dialog.ShowInformation("Add", savedMessage("Credential saved", warnings), w)
+				refreshList(table, svc, w)
+				return nil
+			})
+		}))
+
 		addCard := sectionCard(
 			"Add Credential",
-			container.NewVBox(addForm, container.NewHBox(layout.NewSpacer(), btnAdd)),
+			container.NewVBox(addForm, container.NewHBox(layout.NewSpacer(), btnAddGenerate, btnAddEditor, btnAdd)),
 		)
 
 		// --- Table (with widths + footer refresh button) ---
@@ -555,7 +632,11 @@ func main() {
 		}()
 
 		btnRefresh := widget.NewButton("Refresh", withIdleReset(func() { refreshList(table, svc, w) }))
-		controls := container.NewHBox(layout.NewSpacer(), btnRefresh)
+		btnImport := widget.NewButton("Import…", withIdleReset(func() {
+			showImportWizard(w, svc, func() { refreshList(table, svc, w) })
+		}))
+		btnSecurity := widget.NewButton("Security…", withIdleReset(func() { showSecurity(w, svc) }))
+		controls := container.NewHBox(layout.NewSpacer(), btnSecurity, btnImport, btnRefresh)
 
 		listCard := widget.NewCard(
 			"Credentials", "",
@@ -584,12 +665,34 @@ func main() {
 			widget.NewFormItem("Website", gSite),
 			widget.NewFormItem("Username", gUser),
 		)
+		// editEntry loads an entry into the editor and saves the whole payload back.
+		editEntry := func(site, user string) {
+			entry, err := svc.GetEntry(site, user)
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("get: %w", err), w)
+				return
+			}
+			showEntryEditor(w, "Edit Entry", entry, true, func(e pmsvc.Entry) error {
+				if resetIdleTimer != nil {
+					resetIdleTimer()
+				}
+				warnings, err := svc.UpdateEntry(e.Website, e.Username, e.Type, e.Payload)
+				if err != nil {
+					return fmt.Errorf("update: %w", err)
+				}
+				dialog.ShowInformation("Update", savedMessage("Credential updated", warnings), w)
+				refreshList(table, svc, w)
+				return nil
+			})
+		}
+
 		btnGet := makePrimary(widget.NewButton("Get / Reveal", withIdleReset(func() {
-			p, err := svc.Get(gSite.Text, gUser.Text)
+			entry, err := svc.GetEntry(gSite.Text, gUser.Text)
 			if err != nil {
 				dialog.ShowError(fmt.Errorf("get: %w", err), w)
 				return
 			}
+			p := entry.Payload.Password
 
 			pwdLbl := widget.NewLabel(p) // regular black text
 
@@ -599,15 +702,30 @@ func main() {
 				scheduleClipboardClear(w)
 			})))
 
-			dialog.NewCustom(
+			var d dialog.Dialog
+			editBtn := widget.NewButton("Edit…", withIdleReset(func() {
+				d.Hide()
+				editEntry(entry.Website, entry.Username)
+			}))
+			historyBtn := widget.NewButton("History…", withIdleReset(func() {
+				d.Hide()
+				showHistory(w, svc, entry.Website, entry.Username, func() { refreshList(table, svc, w) })
+			}))
+
+			totp, stopTOTP := totpSection(w, svc, entry.Website, entry.Username)
+			d = dialog.NewCustom(
 				"Password", "Close",
 				container.NewVBox(
 					widget.NewLabel("Password:"),
 					pwdLbl,
-					container.NewHBox(layout.NewSpacer(), copyBtn),
+					container.NewHBox(layout.NewSpacer(), historyBtn, editBtn, copyBtn),
+					totp,
+					entryDetails(w, entry),
 				),
 				w,
-			).Show()
+			)
+			d.SetOnClosed(stopTOTP)
+			d.Show()
 		})))
 
 		getCard := sectionCard(
@@ -662,23 +780,39 @@ func main() {
 				dialog.ShowInformation("Update", "Fill website, username, and new password (type is optional)", w)
 				return
 			}
-			if err := svc.Update(site, user, typ, pwd); err != nil {
+			warnings, err := svc.Update(site, user, typ, pwd)
+			if err != nil {
 				dialog.ShowError(fmt.Errorf("update: %w", err), w)
 				return
 			}
 			uPass.SetText("") // don’t keep secrets in the field
-			dialog.ShowInformation("Update", "Credential updated", w)
+			dialog.ShowInformation("Update", savedMessage("Credential updated", warnings), w)
 			refreshList(table, svc, w)
 		})))
 
-		updateHint := widget.NewLabel(`Leave "New Type" blank to keep the current type.`)
+		btnUpdateGenerate := widget.NewButton("Generate…", withIdleReset(func() {
+			showGenerator(w, svc, uSite.Text, func(secret string) { uPass.SetText(secret) })
+		}))
+
+		btnEdit := widget.NewButton("Edit Entry…", withIdleReset(func() {
+			site := strings.TrimSpace(uSite.Text)
+			user := strings.TrimSpace(uUser.Text)
+			if site == "" || user == "" {
+				dialog.ShowInformation("Update", "Fill website and username", w)
+				return
+			}
+			editEntry(site, user)
+		}))
+
+		updateHint := widget.NewLabel(`Leave "New Type" blank to keep the current type. Use "Edit Entry…" for notes, URLs, tags, folder and custom fields.`)
+		updateHint.Wrapping = fyne.TextWrapWord
 
 		updateCard := sectionCard(
 			"Update Credential",
 			container.NewVBox(
 				updateForm,
 				updateHint,
-				container.NewHBox(layout.NewSpacer(), btnUpdate),
+				container.NewHBox(layout.NewSpacer(), btnUpdateGenerate, btnEdit, btnUpdate),
 			),
 		)
 
@@ -712,7 +846,7 @@ func main() {
 			}
 			dialog.NewConfirm(
 				"Delete",
-				fmt.Sprintf("Delete %s / %s ?", site, user),
+				fmt.Sprintf("Move %s / %s to the trash?", site, user),
 				func(ok bool) {
 					if !ok {
 						return
@@ -724,18 +858,22 @@ func main() {
 						dialog.ShowError(fmt.Errorf("delete: %w", err), w)
 						return
 					}
-					dialog.ShowInformation("Delete", "Credential deleted", w)
+					dialog.ShowInformation("Delete", "Credential moved to the trash", w)
 					refreshList(table, svc, w)
 				},
 				w,
 			).Show()
 		}))
 
+		btnTrash := widget.NewButton("Trash…", withIdleReset(func() {
+			showTrash(w, svc, func() { refreshList(table, svc, w) })
+		}))
+
 		deleteCard := sectionCard(
 			"Delete Credential",
 			container.NewVBox(
 				delForm,
-				container.NewHBox(layout.NewSpacer(), btnDelete),
+				container.NewHBox(layout.NewSpacer(), btnTrash, btnDelete),
 			),
 		)
 
@@ -804,6 +942,69 @@ func main() {
 
 var table *widget.Table
 
+// showRecoveryCode displays a freshly generated recovery code once, with options to copy
+// it or save it to a file, and calls onClose after the dialog is dismissed.
+// keyfilePicker returns an entry holding an optional keyfile path and a row that pairs
+// it with a file chooser.
+func keyfilePicker(w fyne.Window) (*widget.Entry, fyne.CanvasObject) {
+	entry := widget.NewEntry()
+	entry.SetPlaceHolder("Optional keyfile")
+
+	browse := widget.NewButton("Browse…", func() {
+		dialog.ShowFileOpen(func(rc fyne.URIReadCloser, err error) {
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("choose keyfile: %w", err), w)
+				return
+			}
+			if rc == nil {
+				return
+			}
+			defer rc.Close()
+			entry.SetText(rc.URI().Path())
+		}, w)
+	})
+
+	return entry, container.NewBorder(nil, nil, nil, browse, entry)
+}
+
+func showRecoveryCode(w fyne.Window, code string, onClose func()) {
+	codeLbl := widget.NewLabelWithStyle(code, fyne.TextAlignCenter, fyne.TextStyle{Monospace: true, Bold: true})
+
+	copyBtn := widget.NewButton("Copy", func() {
+		w.Clipboard().SetContent(code)
+		scheduleClipboardClear(w)
+	})
+	saveBtn := makePrimary(widget.NewButton("Save to File…", func() {
+		dialog.ShowFileSave(func(wc fyne.URIWriteCloser, err error) {
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("save recovery code: %w", err), w)
+				return
+			}
+			if wc == nil {
+				return
+			}
+			defer wc.Close()
+			if _, err := fmt.Fprintf(wc, "PasswordManager recovery code\n\n%s\n", code); err != nil {
+				dialog.ShowError(fmt.Errorf("save recovery code: %w", err), w)
+				return
+			}
+			dialog.ShowInformation("Recovery Code", "Recovery code saved. Keep the file offline.", w)
+		}, w)
+	}))
+
+	d := dialog.NewCustom(
+		"Recovery Code", "I have stored it",
+		container.NewVBox(
+			widget.NewLabel("Master password saved. This recovery code is shown only once;\nanyone holding it can reset the master password with pm recovery reset."),
+			codeLbl,
+			container.NewHBox(layout.NewSpacer(), copyBtn, saveBtn),
+		),
+		w,
+	)
+	d.SetOnClosed(onClose)
+	d.Show()
+}
+
 func scheduleClipboardClear(w fyne.Window) {
 	clipboardMu.Lock()
 	if clipboardTimer != nil {
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/Hussein-Mazeh/PasswordManager/auth"
+)
+
+// savedMessage appends the password policy warnings returned by a save to its
+// confirmation message.
+func savedMessage(msg string, warnings []auth.Violation) string {
+	if len(warnings) == 0 {
+		return msg
+	}
+	var b strings.Builder
+	b.WriteString(msg)
+	b.WriteString("\n\nPassword policy:")
+	for _, w := range warnings {
+		b.WriteString("\n• ")
+		b.WriteString(w.Message)
+	}
+	return b.String()
+}
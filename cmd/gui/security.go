@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/Hussein-Mazeh/PasswordManager/internal/audit"
+	pmsvc "github.com/Hussein-Mazeh/PasswordManager/internal/service"
+)
+
+// showSecurity opens the Security dashboard: counts of reused, weak, old and breached
+// passwords, and the entries behind them. The audit runs in the background; the breach
+// check is opt-in because, unless hibp.json selects a local dataset, it contacts Have I
+// Been Pwned.
+func showSecurity(w fyne.Window, svc *pmsvc.Service) {
+	summary := widget.NewLabel("")
+	rows := container.NewVBox()
+	hibp := widget.NewCheck("Check breaches", nil)
+	progress := widget.NewProgressBarInfinite()
+	progress.Hide()
+
+	var runBtn *widget.Button
+	run := func() {
+		runBtn.Disable()
+		progress.Show()
+		progress.Start()
+		opts := audit.Options{HIBP: hibp.Checked}
+		go func() {
+			report, err := svc.Audit(context.Background(), opts)
+			fyne.Do(func() {
+				progress.Stop()
+				progress.Hide()
+				runBtn.Enable()
+				if err != nil {
+					dialog.ShowError(fmt.Errorf("audit: %w", err), w)
+					return
+				}
+				showAuditReport(report, summary, rows)
+			})
+		}()
+	}
+	runBtn = makePrimary(widget.NewButton("Run Audit", run))
+
+	scroll := container.NewVScroll(rows)
+	scroll.SetMinSize(fyne.NewSize(640, 320))
+	d := dialog.NewCustom("Security", "Close",
+		container.NewBorder(
+			container.NewVBox(summary, progress),
+			container.NewHBox(hibp, layout.NewSpacer(), runBtn),
+			nil, nil, scroll,
+		),
+		w,
+	)
+	d.Show()
+	run()
+}
+
+// showAuditReport fills the dashboard with one report.
+func showAuditReport(r audit.Report, summary *widget.Label, rows *fyne.Container) {
+	breached := "not checked"
+	if r.HIBPChecked {
+		breached = fmt.Sprintf("%d", r.Breached)
+	}
+	summary.SetText(fmt.Sprintf("%d passwords checked — reused: %d   weak: %d   older than a year: %d   breached: %s",
+		r.Checked, r.Reused, r.Weak, r.Old, breached))
+
+	rows.Objects = nil
+	if r.Clean() {
+		rows.Add(widget.NewLabel("No issues found."))
+	}
+	for _, f := range r.Findings {
+		issues := make([]string, len(f.Issues))
+		for i, issue := range f.Issues {
+			issues[i] = string(issue)
+		}
+		var detail []string
+		if f.BreachCount > 0 {
+			detail = append(detail, fmt.Sprintf("seen %d times in breaches", f.BreachCount))
+		} else if f.Has(audit.IssueBreached) {
+			detail = append(detail, "matched the breach filter")
+		}
+		if len(f.ReusedWith) > 0 {
+			detail = append(detail, "also used by "+strings.Join(f.ReusedWith, ", "))
+		}
+		detail = append(detail, fmt.Sprintf("score %d/4, changed %d days ago", f.Score, f.AgeDays))
+
+		title := widget.NewLabel(fmt.Sprintf("%s / %s", f.Website, f.Username))
+		title.TextStyle = fyne.TextStyle{Bold: true}
+		info := widget.NewLabel(strings.Join(detail, "; "))
+		info.Wrapping = fyne.TextWrapWord
+		rows.Add(container.NewVBox(
+			container.NewHBox(title, layout.NewSpacer(), widget.NewLabel(strings.Join(issues, ", "))),
+			info,
+			widget.NewSeparator(),
+		))
+	}
+	for _, e := range r.Errors {
+		rows.Add(widget.NewLabel("Warning: " + e))
+	}
+	rows.Refresh()
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+
+	pmsvc "github.com/Hussein-Mazeh/PasswordManager/internal/service"
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+)
+
+// totpSection is the two-factor part of the Get / Reveal dialog: the current code with a
+// countdown bar when (site, user) has a TOTP key, or a button to add one. stop ends the
+// countdown and must be called when the dialog closes.
+func totpSection(w fyne.Window, svc *pmsvc.Service, site, user string) (obj fyne.CanvasObject, stop func()) {
+	box := container.NewVBox()
+	done := make(chan struct{})
+	var once sync.Once
+	stop = func() { once.Do(func() { close(done) }) }
+
+	var showKey func(key krypto.TOTP)
+	showAdd := func() {
+		addBtn := widget.NewButton("Add 2FA Key…", func() {
+			showAddTOTP(w, svc, site, user, func() {
+				key, err := svc.TOTP(site, user)
+				if err != nil {
+					dialog.ShowError(fmt.Errorf("2FA: %w", err), w)
+					return
+				}
+				showKey(key)
+			})
+		})
+		box.Objects = []fyne.CanvasObject{container.NewHBox(widget.NewLabel("No 2FA key stored"), layout.NewSpacer(), addBtn)}
+		box.Refresh()
+	}
+
+	showKey = func(key krypto.TOTP) {
+		code := widget.NewLabel("")
+		code.TextStyle = fyne.TextStyle{Bold: true, Monospace: true}
+		bar := widget.NewProgressBar()
+		bar.Max = float64(key.Period)
+		bar.TextFormatter = func() string { return fmt.Sprintf("%.0fs", bar.Value) }
+
+		var current string
+		update := func() {
+			now := time.Now()
+			c, err := key.Code(now)
+			if err != nil {
+				code.SetText("invalid key")
+				return
+			}
+			current = c
+			code.SetText(c)
+			bar.SetValue(key.Remaining(now).Seconds())
+		}
+		update()
+
+		copyBtn := widget.NewButton("Copy Code", func() {
+			w.Clipboard().SetContent(current)
+			scheduleClipboardClear(w)
+		})
+		box.Objects = []fyne.CanvasObject{
+			widget.NewLabel("2FA code:"),
+			container.NewBorder(nil, nil, code, copyBtn, bar),
+		}
+		box.Refresh()
+
+		go func() {
+			t := time.NewTicker(time.Second)
+			defer t.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-t.C:
+					fyne.Do(update)
+				}
+			}
+		}()
+	}
+
+	key, err := svc.TOTP(site, user)
+	switch {
+	case err == nil:
+		showKey(key)
+	case err.Error() == "not found":
+		showAdd()
+	default:
+		box.Add(widget.NewLabel(fmt.Sprintf("2FA: %v", err)))
+	}
+	return box, stop
+}
+
+// showAddTOTP asks for the otpauth:// URI or Base32 secret that a site's 2FA setup page
+// shows and stores it for (site, user). onAdded runs once the key is saved.
+func showAddTOTP(w fyne.Window, svc *pmsvc.Service, site, user string, onAdded func()) {
+	input := widget.NewPasswordEntry()
+	input.SetPlaceHolder("otpauth://totp/… or JBSW Y3DP …")
+
+	form := []*widget.FormItem{widget.NewFormItem("Key", input)}
+	dialog.ShowForm(fmt.Sprintf("2FA key for %s / %s", site, user), "Save", "Cancel", form, func(ok bool) {
+		if !ok {
+			return
+		}
+		if err := svc.AddTOTP(site, user, input.Text); err != nil {
+			dialog.ShowError(fmt.Errorf("2FA: %w", err), w)
+			return
+		}
+		onAdded()
+	}, w)
+}
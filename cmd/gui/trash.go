@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	pmsvc "github.com/Hussein-Mazeh/PasswordManager/internal/service"
+)
+
+const trashPurgeAge = 30 * 24 * time.Hour
+
+// showTrash lists trashed entries with a Restore button each, plus buttons to purge
+// entries older than 30 days or empty the trash. onChange runs after any restore or purge.
+func showTrash(w fyne.Window, svc *pmsvc.Service, onChange func()) {
+	items, err := svc.Trash()
+	if err != nil {
+		dialog.ShowError(fmt.Errorf("trash: %w", err), w)
+		return
+	}
+
+	var d dialog.Dialog
+	reopen := func() {
+		d.Hide()
+		if onChange != nil {
+			onChange()
+		}
+		showTrash(w, svc, onChange)
+	}
+
+	purge := func(age time.Duration, prompt string) {
+		dialog.NewConfirm("Purge Trash", prompt, func(ok bool) {
+			if !ok {
+				return
+			}
+			n, err := svc.PurgeTrash(age)
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("purge: %w", err), w)
+				return
+			}
+			reopen()
+			dialog.ShowInformation("Purge Trash", fmt.Sprintf("%d credentials permanently removed", n), w)
+		}, w).Show()
+	}
+
+	rows := container.NewVBox()
+	if len(items) == 0 {
+		rows.Add(widget.NewLabel("The trash is empty."))
+	}
+	for _, it := range items {
+		it := it
+		restoreBtn := widget.NewButtonWithIcon("Restore", theme.ContentUndoIcon(), func() {
+			if err := svc.RestoreFromTrash(it.Website, it.Username); err != nil {
+				dialog.ShowError(fmt.Errorf("restore: %w", err), w)
+				return
+			}
+			reopen()
+		})
+		rows.Add(container.NewHBox(
+			widget.NewLabel(fmt.Sprintf("%s / %s", it.Website, it.Username)),
+			layout.NewSpacer(),
+			widget.NewLabel(it.DeletedAt),
+			restoreBtn,
+		))
+	}
+
+	purgeOld := widget.NewButton("Purge Older Than 30 Days", func() {
+		purge(trashPurgeAge, "Permanently remove credentials deleted more than 30 days ago?")
+	})
+	emptyBtn := widget.NewButtonWithIcon("Empty Trash", theme.DeleteIcon(), func() {
+		purge(0, "Permanently remove every credential in the trash? This cannot be undone.")
+	})
+	if len(items) == 0 {
+		purgeOld.Disable()
+		emptyBtn.Disable()
+	}
+
+	scroll := container.NewVScroll(rows)
+	scroll.SetMinSize(fyne.NewSize(560, 300))
+	d = dialog.NewCustom("Trash", "Close",
+		container.NewBorder(nil, container.NewHBox(layout.NewSpacer(), purgeOld, emptyBtn), nil, nil, scroll),
+		w,
+	)
+	d.Show()
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Hussein-Mazeh/PasswordManager/internal/agent"
+)
+
+// runAgent dispatches the pm agent subcommands.
+func runAgent(args []string) error {
+	if len(args) == 0 {
+		return userError{msg: "missing agent subcommand (start, unlock, status, lock, stop, serve)"}
+	}
+
+	switch args[0] {
+	case "start":
+		return runAgentStart(args[1:])
+	case "unlock":
+		return runAgentUnlock(args[1:])
+	case "serve":
+		return runAgentServe(args[1:])
+	case "status":
+		return runAgentStatus(args[1:])
+	case "lock":
+		return runAgentSignal(args[1:], "lock")
+	case "stop":
+		return runAgentSignal(args[1:], "stop")
+	default:
+		return userError{msg: "unknown agent subcommand"}
+	}
+}
+
+// runAgentStart makes sure an agent is running and unlocks it for a vault.
+//
+// Args:
+//
+//	args: CLI arguments slice. Supported flags:
+//	  --dir         (string, required): Vault directory path.
+//	  --keyfile     (string, optional): Keyfile for vaults that require one.
+//	  --password-fd (int, optional): Read the master password from this descriptor.
+//	  --idle        (duration, default 10m): Lock after this long without a request.
+//	  --socket      (string, optional): Socket path; defaults to $PM_AGENT_SOCK or a
+//	                per-user runtime path.
+//
+// Behavior:
+//  1. Unlocks the vault here, so a wrong password is reported before anything is spawned.
+//  2. Starts `pm agent serve` as a detached background process if no agent answers on the
+//     socket, and waits for it to listen.
+//  3. Hands the agent the MEK and prints shell commands exporting PM_AGENT_SOCK, in the
+//     style of ssh-agent, so `eval "$(pm agent start ...)"` works.
+func runAgentStart(args []string) error {
+	fs := flag.NewFlagSet("agent start", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var uf unlockFlags
+	var idle time.Duration
+	var socket string
+	fs.StringVar(&uf.dir, "dir", "", "vault directory")
+	fs.StringVar(&uf.keyfilePath, "keyfile", "", "keyfile for vaults that require one")
+	fs.IntVar(&uf.passwordFD, "password-fd", -1, "read the master password from this file descriptor")
+	fs.DurationVar(&idle, "idle", agent.DefaultIdleTimeout, "lock after this long without a request")
+	fs.StringVar(&socket, "socket", "", "agent socket path")
+
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid arguments"}
+	}
+	if uf.dir == "" {
+		return userError{msg: "missing required flag: --dir"}
+	}
+	if fs.NArg() != 0 {
+		return userError{msg: "unexpected positional arguments"}
+	}
+	if idle <= 0 {
+		return userError{msg: "--idle must be positive"}
+	}
+	if socket == "" {
+		socket = agent.DefaultSocketPath()
+	}
+
+	u, err := unlockWithPassword(uf)
+	if err != nil {
+		return err
+	}
+	defer u.Close()
+
+	client := agent.NewClient(socket)
+	st, err := client.Status()
+	if errors.Is(err, agent.ErrNotRunning) {
+		if st, err = spawnAgent(socket, idle); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return fmt.Errorf("query agent: %w", err)
+	}
+
+	ttl, err := client.Load(uf.dir, u.mek)
+	if err != nil {
+		return fmt.Errorf("unlock agent: %w", err)
+	}
+
+	fmt.Printf("%s=%s; export %s;\n", agent.SocketEnv, shellQuote(socket), agent.SocketEnv)
+	fmt.Printf("# pm agent pid %d unlocked; locks after %s idle\n", st.PID, ttl)
+	return nil
+}
+
+// runAgentUnlock loads the MEK into an agent that is already running, e.g. after
+// `pm agent lock` or an idle timeout.
+func runAgentUnlock(args []string) error {
+	fs := flag.NewFlagSet("agent unlock", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var uf unlockFlags
+	var socket string
+	fs.StringVar(&uf.dir, "dir", "", "vault directory")
+	fs.StringVar(&uf.keyfilePath, "keyfile", "", "keyfile for vaults that require one")
+	fs.IntVar(&uf.passwordFD, "password-fd", -1, "read the master password from this file descriptor")
+	fs.StringVar(&socket, "socket", "", "agent socket path")
+
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid arguments"}
+	}
+	if uf.dir == "" {
+		return userError{msg: "missing required flag: --dir"}
+	}
+	if fs.NArg() != 0 {
+		return userError{msg: "unexpected positional arguments"}
+	}
+
+	client := agent.NewClient(socket)
+	if _, err := client.Status(); err != nil {
+		return agentError(err)
+	}
+
+	u, err := unlockWithPassword(uf)
+	if err != nil {
+		return err
+	}
+	defer u.Close()
+
+	ttl, err := client.Load(uf.dir, u.mek)
+	if err != nil {
+		return agentError(err)
+	}
+	fmt.Printf("agent unlocked; locks after %s idle\n", ttl)
+	return nil
+}
+
+// runAgentServe runs the agent in the foreground, starting locked. `pm agent start` runs
+// it in the background; it can also be run directly under a service manager.
+func runAgentServe(args []string) error {
+	fs := flag.NewFlagSet("agent serve", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var idle time.Duration
+	var socket string
+	fs.DurationVar(&idle, "idle", agent.DefaultIdleTimeout, "lock after this long without a request")
+	fs.StringVar(&socket, "socket", "", "agent socket path")
+
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid arguments"}
+	}
+	if fs.NArg() != 0 {
+		return userError{msg: "unexpected positional arguments"}
+	}
+	if idle <= 0 {
+		return userError{msg: "--idle must be positive"}
+	}
+
+	srv, err := agent.Listen(socket, idle)
+	if err != nil {
+		return userError{msg: err.Error()}
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		<-sigCh
+		srv.Close()
+	}()
+
+	return srv.Serve()
+}
+
+// runAgentStatus reports whether an agent is running and unlocked. It exits with
+// exitLocked when the agent is locked or not running, so scripts can test for it.
+func runAgentStatus(args []string) error {
+	fs := flag.NewFlagSet("agent status", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var socket string
+	fs.StringVar(&socket, "socket", "", "agent socket path")
+
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid arguments"}
+	}
+	if fs.NArg() != 0 {
+		return userError{msg: "unexpected positional arguments"}
+	}
+
+	st, err := agent.NewClient(socket).Status()
+	if err != nil {
+		return agentError(err)
+	}
+	if !st.Unlocked {
+		return userError{msg: fmt.Sprintf("pm agent pid %d is locked", st.PID), code: exitLocked}
+	}
+	fmt.Printf("pm agent pid %d unlocked for %s; locks in %s\n", st.PID, st.Dir, st.Idle)
+	return nil
+}
+
+// runAgentSignal sends a lock or stop request.
+func runAgentSignal(args []string, action string) error {
+	fs := flag.NewFlagSet("agent "+action, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var socket string
+	fs.StringVar(&socket, "socket", "", "agent socket path")
+
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid arguments"}
+	}
+	if fs.NArg() != 0 {
+		return userError{msg: "unexpected positional arguments"}
+	}
+
+	client := agent.NewClient(socket)
+	var err error
+	if action == "lock" {
+		err = client.Lock()
+	} else {
+		err = client.Stop()
+	}
+	if err != nil {
+		return agentError(err)
+	}
+	if action == "lock" {
+		fmt.Println("agent locked")
+	} else {
+		fmt.Println("agent stopped")
+	}
+	return nil
+}
+
+// unlockWithPassword opens the vault from the master password, never from the agent.
+func unlockWithPassword(uf unlockFlags) (*unlockedVault, error) {
+	keyfile, err := readKeyfile(uf.keyfilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(keyfile)
+
+	if err := requireBiometric(uf.dir); err != nil {
+		return nil, err
+	}
+
+	pw, err := readMasterPassword(uf.passwordFD)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(pw)
+
+	return openUnlockedVault(uf.dir, pw, keyfile)
+}
+
+// spawnAgent starts `pm agent serve` detached from this terminal and waits until it answers.
+func spawnAgent(socket string, idle time.Duration) (agent.Status, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return agent.Status{}, fmt.Errorf("locate pm executable: %w", err)
+	}
+	cmd := exec.Command(exe, "agent", "serve", "--socket", socket, "--idle", idle.String())
+	cmd.Dir = os.TempDir()
+	cmd.SysProcAttr = detachedProcAttr()
+	if err := cmd.Start(); err != nil {
+		return agent.Status{}, fmt.Errorf("start agent: %w", err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	client := agent.NewClient(socket)
+	deadline := time.After(5 * time.Second)
+	for {
+		if st, err := client.Status(); err == nil {
+			cmd.Process.Release()
+			return st, nil
+		}
+		select {
+		case err := <-exited:
+			return agent.Status{}, userError{msg: fmt.Sprintf("agent exited during startup (%v); run `pm agent serve --socket %s` to see why", err, socket)}
+		case <-deadline:
+			return agent.Status{}, fmt.Errorf("agent did not start listening on %s", socket)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+// agentError turns agent client errors into user-facing ones with the locked exit code.
+func agentError(err error) error {
+	switch {
+	case errors.Is(err, agent.ErrNotRunning):
+		return userError{msg: "pm agent is not running; start it with pm agent start", code: exitLocked}
+	case errors.Is(err, agent.ErrLocked):
+		return userError{msg: "pm agent is locked", code: exitLocked}
+	}
+	return err
+}
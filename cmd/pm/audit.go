@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Hussein-Mazeh/PasswordManager/internal/audit"
+	"github.com/Hussein-Mazeh/PasswordManager/store"
+)
+
+// runAudit reports reused, weak, old and (optionally) breached entry passwords.
+//
+// Args:
+//
+//	args: CLI arguments slice. Supported flags:
+//	  --dir         (string, required): Vault directory path.
+//	  --min-score   (int, default from the policy): zxcvbn score below which a password is weak.
+//	  --max-age     (string, default from the policy): Age after which a password is old; 0 turns the check off.
+//	  --hibp        (bool): Look each distinct password up in the breach dataset.
+//	  --format      (string, default text): text or json.
+//	  --keyfile     (string, optional): Keyfile for vaults that require one.
+//	  --password-fd (int, optional): Read the master password from this descriptor.
+//
+// Behavior:
+//  1. Unlocks (a running pm agent is used) and decrypts every live entry in memory;
+//     nothing is written back.
+//  2. --hibp uses the checker hibp.json selects; the online one sends only the first
+//     five hex digits of each password's SHA-1.
+//  3. Exits with exitProblems when any entry has an issue, so scripts can gate on it.
+func runAudit(args []string) error {
+	fs := flag.NewFlagSet("audit", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var uf unlockFlags
+	var minScore int
+	var maxAge, format string
+	var hibp bool
+	uf.register(fs)
+	fs.IntVar(&minScore, "min-score", audit.DefaultMinScore, "zxcvbn score (0-4) below which a password is weak")
+	fs.StringVar(&maxAge, "max-age", "365d", "age after which a password is old, e.g. 180d; 0 turns the check off")
+	fs.BoolVar(&hibp, "hibp", false, "check passwords against the breach dataset")
+	fs.StringVar(&format, "format", formatText, "output format: text or json")
+
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid arguments"}
+	}
+	if fs.NArg() != 0 {
+		return userError{msg: "unexpected positional arguments"}
+	}
+	if err := checkFormat(format, formatText, formatJSON); err != nil {
+		return err
+	}
+	set := setFlags(fs)
+	if set["min-score"] && (minScore < 1 || minScore > 4) {
+		return userError{msg: "--min-score must be between 1 and 4"}
+	}
+	age, err := store.ParseAge(maxAge)
+	if err != nil {
+		return userError{msg: fmt.Sprintf("invalid --max-age: %v", err)}
+	}
+	if age == 0 {
+		age = -1
+	}
+
+	u, err := uf.unlock()
+	if err != nil {
+		return err
+	}
+	defer u.Close()
+
+	pol, err := store.LoadPolicy(store.Paths{Dir: uf.dir})
+	if err != nil {
+		return userError{msg: err.Error()}
+	}
+	opts := audit.FromPolicy(pol)
+	opts.HIBP = hibp
+	if set["min-score"] {
+		opts.MinScore = minScore
+	}
+	if set["max-age"] {
+		opts.MaxAge = age
+	}
+	if hibp {
+		cfg, err := store.LoadHIBPConfig(store.Paths{Dir: uf.dir})
+		if err != nil {
+			return userError{msg: err.Error()}
+		}
+		checker := cfg.BreachChecker()
+		if checker == nil {
+			return userError{msg: "--hibp: breach checking is turned off in hibp.json"}
+		}
+		opts.Lookup = checker.Check
+	}
+
+	report, err := audit.Run(context.Background(), u.database, u.keys, u.mek, opts)
+	if err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+
+	if format == formatJSON {
+		if err := writeJSON(report); err != nil {
+			return err
+		}
+	} else if err := printAuditReport(report); err != nil {
+		return err
+	}
+
+	if !report.Clean() {
+		return userError{msg: fmt.Sprintf("audit found issues with %d of %d passwords", len(report.Findings), report.Checked), code: exitProblems}
+	}
+	return nil
+}
+
+func printAuditReport(r audit.Report) error {
+	if len(r.Findings) > 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "WEBSITE\tUSERNAME\tISSUES\tSCORE\tAGE\tDETAIL")
+		for _, f := range r.Findings {
+			issues := make([]string, len(f.Issues))
+			for i, issue := range f.Issues {
+				issues[i] = string(issue)
+			}
+			var detail []string
+			if f.BreachCount > 0 {
+				detail = append(detail, fmt.Sprintf("seen %d times in breaches", f.BreachCount))
+			} else if f.Has(audit.IssueBreached) {
+				detail = append(detail, "matched the breach filter")
+			}
+			if len(f.ReusedWith) > 0 {
+				detail = append(detail, "also used by "+strings.Join(f.ReusedWith, ", "))
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%dd\t%s\n", f.Website, f.Username, strings.Join(issues, ","), f.Score, f.AgeDays, strings.Join(detail, "; "))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	for _, e := range r.Errors {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", e)
+	}
+	hibp := "not checked"
+	if r.HIBPChecked {
+		hibp = fmt.Sprintf("%d", r.Breached)
+	}
+	fmt.Printf("%d passwords checked (%d skipped): %d reused, %d weak, %d old, breached: %s\n",
+		r.Checked, r.Skipped, r.Reused, r.Weak, r.Old, hibp)
+	return nil
+}
@@ -0,0 +1,518 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"golang.org/x/term"
+
+	dbpkg "github.com/Hussein-Mazeh/PasswordManager/internal/db"
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+)
+
+// Output formats for the non-interactive commands.
+const (
+	formatText = "text"
+	formatJSON = "json"
+	formatEnv  = "env"
+)
+
+// unlockFlags are shared by every non-interactive command that needs the MEK.
+type unlockFlags struct {
+	dir         string
+	keyfilePath string
+	passwordFD  int
+}
+
+func (f *unlockFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.dir, "dir", "", "vault directory")
+	fs.StringVar(&f.keyfilePath, "keyfile", "", "keyfile for vaults that require one")
+	fs.IntVar(&f.passwordFD, "password-fd", -1, "read the master password from this file descriptor")
+}
+
+// unlock opens the vault with the key cached by a running pm agent or, failing that,
+// with the master password from --password-fd or the terminal. An explicit --password-fd
+// skips the agent. The caller must Close the result.
+func (f *unlockFlags) unlock() (*unlockedVault, error) {
+	if f.dir == "" {
+		return nil, userError{msg: "missing required flag: --dir"}
+	}
+
+	if f.passwordFD < 0 {
+		u, err := openAgentVault(f.dir)
+		if err == nil {
+			return u, nil
+		}
+		if !agentUnavailable(err) {
+			return nil, err
+		}
+	}
+
+	keyfile, err := readKeyfile(f.keyfilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(keyfile)
+
+	if err := requireBiometric(f.dir); err != nil {
+		return nil, err
+	}
+
+	pw, err := readMasterPassword(f.passwordFD)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(pw)
+
+	return openUnlockedVault(f.dir, pw, keyfile)
+}
+
+func checkFormat(format string, allowed ...string) error {
+	for _, a := range allowed {
+		if format == a {
+			return nil
+		}
+	}
+	return userError{msg: fmt.Sprintf("unsupported --format %q (use %s)", format, strings.Join(allowed, ", "))}
+}
+
+// entryJSON is the JSON shape of a decrypted entry.
+type entryJSON struct {
+	Website   string              `json:"website"`
+	Username  string              `json:"username"`
+	Type      string              `json:"type"`
+	Password  string              `json:"password"`
+	Notes     string              `json:"notes,omitempty"`
+	URLs      []string            `json:"urls,omitempty"`
+	Match     vault.MatchMode     `json:"match,omitempty"`
+	Tags      []string            `json:"tags,omitempty"`
+	Folder    string              `json:"folder,omitempty"`
+	Fields    []vault.CustomField `json:"fields,omitempty"`
+	CreatedAt string              `json:"created_at"`
+	UpdatedAt string              `json:"updated_at"`
+}
+
+func newEntryJSON(row dbpkg.EntryRow, p vault.EntryPayload) entryJSON {
+	return entryJSON{
+		Website:   row.Website,
+		Username:  row.Username,
+		Type:      row.Type,
+		Password:  p.Password,
+		Notes:     p.Notes,
+		URLs:      p.URLs,
+		Match:     p.Match,
+		Tags:      p.Tags,
+		Folder:    p.Folder,
+		Fields:    p.Fields,
+		CreatedAt: row.CreatedAt,
+		UpdatedAt: row.UpdatedAt,
+	}
+}
+
+func writeJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// entryValue returns one part of an entry for `pm get --field`.
+func entryValue(row dbpkg.EntryRow, p vault.EntryPayload, field string) (string, error) {
+	switch field {
+	case "", "password":
+		return p.Password, nil
+	case "username":
+		return row.Username, nil
+	case "notes":
+		return p.Notes, nil
+	case "folder":
+		return p.Folder, nil
+	case "urls":
+		return strings.Join(p.URLs, "\n"), nil
+	case "match":
+		return string(p.Match), nil
+	case "tags":
+		return strings.Join(p.Tags, ","), nil
+	}
+	if f, ok := p.Field(field); ok {
+		return f.Value, nil
+	}
+	return "", userError{msg: fmt.Sprintf("%s/%s has no field %q", row.Website, row.Username, field), code: exitNotFound}
+}
+
+// envName turns a custom field name into an environment variable suffix.
+func envName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(name) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// shellQuote wraps s in single quotes for POSIX shells and dotenv loaders.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func writeEnv(prefix string, row dbpkg.EntryRow, p vault.EntryPayload) {
+	vars := [][2]string{
+		{"WEBSITE", row.Website},
+		{"USERNAME", row.Username},
+		{"PASSWORD", p.Password},
+	}
+	if len(p.URLs) > 0 {
+		vars = append(vars, [2]string{"URL", p.URLs[0]})
+	}
+	if p.Notes != "" {
+		vars = append(vars, [2]string{"NOTES", p.Notes})
+	}
+	for _, f := range p.Fields {
+		vars = append(vars, [2]string{"FIELD_" + envName(f.Name), f.Value})
+	}
+	for _, v := range vars {
+		fmt.Printf("%s%s=%s\n", prefix, v[0], shellQuote(v[1]))
+	}
+}
+
+// runGet prints decrypted credentials without entering the session REPL.
+//
+// Args:
+//
+//	args: CLI arguments slice. Supported flags:
+//	  --dir         (string, required): Vault directory path.
+//	  --site        (string, required): Website; without --user every account on its eTLD+1.
+//	  --user        (string, optional): Username.
+//	  --field       (string, optional): password (default), username, notes, folder, urls,
+//	                tags, or a custom field name. Text format only.
+//	  --format      (string, default text): text, json, or env (single entry only).
+//	  --env-prefix  (string, default PM_): Variable prefix for --format env.
+//	  --keyfile     (string, optional): Keyfile for vaults that require one.
+//	  --password-fd (int, optional): Read the master password from this descriptor.
+//
+// Behavior:
+//   - Text output for one entry is the bare value, suitable for $(pm get ...). Several
+//     entries print as "username<TAB>value" lines.
+//   - Exits with exitNotFound when nothing matches.
+func runGet(args []string) error {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var uf unlockFlags
+	var site, user, field, format, envPrefix string
+	uf.register(fs)
+	fs.StringVar(&site, "site", "", "website identifier")
+	fs.StringVar(&user, "user", "", "username")
+	fs.StringVar(&field, "field", "", "value to print in text format")
+	fs.StringVar(&format, "format", formatText, "output format: text, json or env")
+	fs.StringVar(&envPrefix, "env-prefix", "PM_", "variable prefix for --format env")
+
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid arguments"}
+	}
+	if site == "" {
+		return userError{msg: "missing required flag: --site"}
+	}
+	if fs.NArg() != 0 {
+		return userError{msg: "unexpected positional arguments"}
+	}
+	if err := checkFormat(format, formatText, formatJSON, formatEnv); err != nil {
+		return err
+	}
+
+	u, err := uf.unlock()
+	if err != nil {
+		return err
+	}
+	defer u.Close()
+
+	var rows []dbpkg.EntryRow
+	if user != "" {
+		row, err := dbpkg.GetEntryBySiteAndUser(u.database, u.keys, site, user)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return userError{msg: fmt.Sprintf("no credential found for %s/%s", site, user), code: exitNotFound}
+			}
+			return fmt.Errorf("fetch credential: %w", err)
+		}
+		rows = []dbpkg.EntryRow{*row}
+	} else {
+		rows, err = dbpkg.GetEntryByWebsite(u.database, u.keys, site)
+		if err != nil {
+			return fmt.Errorf("fetch credentials: %w", err)
+		}
+		if len(rows) == 0 {
+			return userError{msg: fmt.Sprintf("no credentials found for %s", site), code: exitNotFound}
+		}
+	}
+	if format == formatEnv && len(rows) > 1 {
+		return userError{msg: fmt.Sprintf("%d accounts match %s; pass --user for --format env", len(rows), site)}
+	}
+
+	payloads := make([]vault.EntryPayload, len(rows))
+	for i := range rows {
+		if payloads[i], err = openSessionEntry(u.database, u.mek, &rows[i]); err != nil {
+			return err
+		}
+	}
+
+	switch format {
+	case formatJSON:
+		out := make([]entryJSON, len(rows))
+		for i := range rows {
+			out[i] = newEntryJSON(rows[i], payloads[i])
+		}
+		if user != "" {
+			return writeJSON(out[0])
+		}
+		return writeJSON(out)
+	case formatEnv:
+		writeEnv(envPrefix, rows[0], payloads[0])
+		return nil
+	}
+
+	for i := range rows {
+		value, err := entryValue(rows[i], payloads[i], field)
+		if err != nil {
+			return err
+		}
+		if len(rows) == 1 {
+			fmt.Println(value)
+		} else {
+			fmt.Printf("%s\t%s\n", rows[i].Username, value)
+		}
+	}
+	return nil
+}
+
+// listItemJSON is the JSON shape of `pm list`; it never contains secrets.
+type listItemJSON struct {
+	ID        int64  `json:"id"`
+	Website   string `json:"website"`
+	Username  string `json:"username"`
+	Type      string `json:"type"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// runList prints the website, username and type of every entry (optionally one site's),
+// TOTP keys included, without decrypting any password.
+func runList(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var uf unlockFlags
+	var site, format string
+	uf.register(fs)
+	fs.StringVar(&site, "site", "", "only entries on this website's eTLD+1")
+	fs.StringVar(&format, "format", formatText, "output format: text or json")
+
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid arguments"}
+	}
+	if fs.NArg() != 0 {
+		return userError{msg: "unexpected positional arguments"}
+	}
+	if err := checkFormat(format, formatText, formatJSON); err != nil {
+		return err
+	}
+
+	u, err := uf.unlock()
+	if err != nil {
+		return err
+	}
+	defer u.Close()
+
+	var rows []dbpkg.EntryRow
+	if site != "" {
+		rows, err = dbpkg.GetEntryByWebsite(u.database, u.keys, site)
+		if err == nil {
+			var totp []dbpkg.EntryRow
+			totp, err = dbpkg.GetTOTPByWebsite(u.database, u.keys, site)
+			rows = append(rows, totp...)
+		}
+	} else {
+		rows, err = dbpkg.ListEntries(u.database, u.keys)
+	}
+	if err != nil {
+		return fmt.Errorf("list credentials: %w", err)
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Website < rows[j].Website })
+
+	if format == formatJSON {
+		out := make([]listItemJSON, 0, len(rows))
+		for _, r := range rows {
+			out = append(out, listItemJSON{ID: r.ID, Website: r.Website, Username: r.Username, Type: r.Type, CreatedAt: r.CreatedAt, UpdatedAt: r.UpdatedAt})
+		}
+		return writeJSON(out)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "WEBSITE\tUSERNAME\tTYPE\tUPDATED")
+	for _, r := range rows {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Website, r.Username, r.Type, r.UpdatedAt)
+	}
+	return w.Flush()
+}
+
+// readEntrySecret gets the secret for add/update from --secret-fd or, on a terminal,
+// from a prompt. confirm asks twice; allowEmpty lets update keep the current secret.
+func readEntrySecret(fd int, prompt string, confirm bool) ([]byte, error) {
+	if fd >= 0 {
+		return readSecretFD(fd, "--secret-fd")
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, nil
+	}
+	secret, err := promptPassword(prompt)
+	if err != nil {
+		return nil, fmt.Errorf("read secret: %w", err)
+	}
+	if confirm {
+		again, err := promptPassword("Confirm: ")
+		if err != nil {
+			zeroBytes(secret)
+			return nil, fmt.Errorf("read confirmation: %w", err)
+		}
+		defer zeroBytes(again)
+		if !bytes.Equal(secret, again) {
+			zeroBytes(secret)
+			return nil, userError{msg: "secrets do not match"}
+		}
+	}
+	return secret, nil
+}
+
+// writeResult reports a completed change as text or JSON.
+func writeResult(format, action string, row dbpkg.EntryRow, text string) error {
+	if format == formatJSON {
+		return writeJSON(map[string]any{"ok": true, "action": action, "id": row.ID, "website": row.Website, "username": row.Username})
+	}
+	fmt.Println(text)
+	return nil
+}
+
+// runAdd stores a new credential. The secret comes from --secret-fd, a terminal prompt or,
+// with --generate, the generator; it may be empty when the entry has notes or custom
+// fields. Entry and generator flags match session add.
+func runAdd(args []string) error {
+	fs := flag.NewFlagSet("add", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var uf unlockFlags
+	var e entryEdit
+	var format string
+	uf.register(fs)
+	e.register(fs, false)
+	fs.IntVar(&e.secretFD, "secret-fd", -1, "read the entry secret from this file descriptor")
+	fs.StringVar(&format, "format", formatText, "output format: text or json")
+
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	if err := checkFormat(format, formatText, formatJSON); err != nil {
+		return err
+	}
+
+	u, err := uf.unlock()
+	if err != nil {
+		return err
+	}
+	defer u.Close()
+
+	row, generated, err := addEntry(uf.dir, u, &e, fs)
+	if err != nil {
+		return err
+	}
+	return writeResult(format, "add", row, fmt.Sprintf("stored credential for %s/%s (id=%d)%s", row.Website, row.Username, row.ID, generated))
+}
+
+// runUpdate edits an existing credential with the same entry flags as session update.
+// The secret is replaced only when one is supplied through --secret-fd or the prompt.
+func runUpdate(args []string) error {
+	fs := flag.NewFlagSet("update", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var uf unlockFlags
+	var e entryEdit
+	var format string
+	uf.register(fs)
+	e.register(fs, true)
+	fs.IntVar(&e.secretFD, "secret-fd", -1, "read the new entry secret from this file descriptor")
+	fs.StringVar(&format, "format", formatText, "output format: text or json")
+
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	if err := checkFormat(format, formatText, formatJSON); err != nil {
+		return err
+	}
+
+	u, err := uf.unlock()
+	if err != nil {
+		return err
+	}
+	defer u.Close()
+
+	row, generated, err := updateEntry(uf.dir, u, &e, fs)
+	if err != nil {
+		return err
+	}
+	return writeResult(format, "update", row, fmt.Sprintf("updated credential for %s/%s%s", row.Website, row.Username, generated))
+}
+
+// runDelete moves a credential to the trash, exactly like session delete.
+func runDelete(args []string) error {
+	fs := flag.NewFlagSet("delete", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var uf unlockFlags
+	var site, user, format string
+	uf.register(fs)
+	fs.StringVar(&site, "site", "", "website identifier")
+	fs.StringVar(&user, "user", "", "username")
+	fs.StringVar(&format, "format", formatText, "output format: text or json")
+
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid arguments"}
+	}
+	if site == "" || user == "" {
+		return userError{msg: "missing required flags: --site and --user"}
+	}
+	if fs.NArg() != 0 {
+		return userError{msg: "unexpected positional arguments"}
+	}
+	if err := checkFormat(format, formatText, formatJSON); err != nil {
+		return err
+	}
+
+	u, err := uf.unlock()
+	if err != nil {
+		return err
+	}
+	defer u.Close()
+
+	row, err := dbpkg.GetEntryBySiteAndUser(u.database, u.keys, site, user)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return userError{msg: fmt.Sprintf("no credential found for %s/%s", site, user), code: exitNotFound}
+		}
+		return fmt.Errorf("fetch credential: %w", err)
+	}
+	if err := dbpkg.DeleteEntryBySiteAndUser(u.database, u.keys, site, user); err != nil {
+		return fmt.Errorf("delete credential: %w", err)
+	}
+
+	return writeResult(format, "delete", *row, fmt.Sprintf("moved %s/%s to the trash", site, user))
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	dbpkg "github.com/Hussein-Mazeh/PasswordManager/internal/db"
+	"github.com/Hussein-Mazeh/PasswordManager/internal/doctor"
+)
+
+// runDoctor verifies the vault and reports every problem it finds.
+//
+// Args:
+//
+//	args: CLI arguments slice. Supported flags:
+//	  --dir         (string, required): Vault directory path.
+//	  --repair      (bool): Fix recoverable problems (permissions, stale blind indexes,
+//	                orphaned history rows).
+//	  --format      (string, default text): text or json.
+//	  --keyfile     (string, optional): Keyfile for vaults that require one.
+//	  --password-fd (int, optional): Read the master password from this descriptor.
+//
+// Behavior:
+//  1. Checks permissions and the header without unlocking.
+//  2. Runs PRAGMA integrity_check; a damaged file stops here, before any migration runs.
+//  3. Unlocks (a running pm agent is used), verifies the header MAC and trial-decrypts
+//     every entry and history version.
+//  4. Exits with exitProblems when unrepaired errors remain.
+func runDoctor(args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var uf unlockFlags
+	var repair bool
+	var format string
+	uf.register(fs)
+	fs.BoolVar(&repair, "repair", false, "fix recoverable problems")
+	fs.StringVar(&format, "format", formatText, "output format: text or json")
+
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid arguments"}
+	}
+	if fs.NArg() != 0 {
+		return userError{msg: "unexpected positional arguments"}
+	}
+	if uf.dir == "" {
+		return userError{msg: "missing required flag: --dir"}
+	}
+	if err := checkFormat(format, formatText, formatJSON); err != nil {
+		return err
+	}
+
+	report := doctor.Report{Dir: uf.dir}
+	report.Add(doctor.Files(uf.dir, repair)...)
+	report.Add(doctor.Header(uf.dir)...)
+
+	dbOK := false
+	if _, err := os.Stat(filepath.Join(uf.dir, "vault.db")); err == nil {
+		database, err := dbpkg.Open(filepath.Join(uf.dir, "vault.db"))
+		if err != nil {
+			report.Add(doctor.Finding{Check: doctor.CheckDatabase, Severity: doctor.SeverityError, Message: err.Error()})
+		} else {
+			var findings []doctor.Finding
+			findings, dbOK = doctor.Database(database, repair)
+			report.Add(findings...)
+			dbpkg.Close(database)
+		}
+	}
+
+	if dbOK {
+		u, err := uf.unlock()
+		if err != nil {
+			report.Add(doctor.Finding{Check: doctor.CheckUnlock, Severity: doctor.SeverityError, Message: err.Error()})
+		} else {
+			report.Add(doctor.HeaderMAC(uf.dir, u.database, u.mek)...)
+			findings, n, err := doctor.Entries(u.database, u.keys, u.mek, repair)
+			if err != nil {
+				findings = append(findings, doctor.Finding{Check: doctor.CheckEntries, Severity: doctor.SeverityError, Message: err.Error()})
+			}
+			report.Entries = n
+			report.Add(findings...)
+			u.Close()
+		}
+	} else {
+		report.Add(doctor.Finding{Check: doctor.CheckEntries, Severity: doctor.SeverityWarning,
+			Message: "skipped: the database could not be opened safely"})
+	}
+
+	if format == formatJSON {
+		if err := writeJSON(report); err != nil {
+			return err
+		}
+	} else if err := printDoctorReport(report); err != nil {
+		return err
+	}
+
+	if !report.Healthy() {
+		return userError{msg: fmt.Sprintf("doctor found %d error(s)", report.Errors), code: exitProblems}
+	}
+	return nil
+}
+
+func printDoctorReport(r doctor.Report) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SEVERITY\tCHECK\tSUBJECT\tMESSAGE")
+	for _, f := range r.Findings {
+		severity := string(f.Severity)
+		msg := f.Message
+		switch {
+		case f.Repaired:
+			severity = "repaired"
+		case f.Repairable:
+			msg += " (--repair fixes this)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", severity, f.Check, f.Subject, msg)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("%d entries checked: %d error(s), %d warning(s), %d repaired\n", r.Entries, r.Errors, r.Warnings, r.Repaired)
+	return nil
+}
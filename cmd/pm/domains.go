@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Hussein-Mazeh/PasswordManager/store"
+)
+
+func runDomains(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "list":
+			return runDomainsList(args[1:])
+		case "add":
+			return runDomainsAdd(args[1:])
+		case "remove":
+			return runDomainsRemove(args[1:])
+		}
+	}
+	return userError{msg: "usage: pm domains list|add|remove [flags]"}
+}
+
+// runDomainsList prints the equivalent-domain groups used for autofill.
+//
+// Args:
+//
+//	args: CLI arguments slice. Supported flags:
+//	  --custom (bool, optional): Only the groups added with pm domains add.
+//	  --format (string, default text): text or json.
+//
+// Behavior:
+//  1. Text output is one "name<TAB>domains" line per group, built-in groups marked with
+//     "(built-in)".
+func runDomainsList(args []string) error {
+	fs := flag.NewFlagSet("domains list", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var custom bool
+	var format string
+	fs.BoolVar(&custom, "custom", false, "only custom groups")
+	fs.StringVar(&format, "format", formatText, "output format: text or json")
+
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid arguments"}
+	}
+	if fs.NArg() != 0 {
+		return userError{msg: "unexpected positional arguments"}
+	}
+	if err := checkFormat(format, formatText, formatJSON); err != nil {
+		return err
+	}
+
+	groups, err := store.LoadDomainGroups()
+	if err != nil {
+		return userError{msg: err.Error()}
+	}
+	type groupJSON struct {
+		Name    string   `json:"name"`
+		Domains []string `json:"domains"`
+		Builtin bool     `json:"builtin"`
+	}
+	out := make([]groupJSON, 0, len(groups))
+	for _, g := range groups {
+		if custom && g.Builtin {
+			continue
+		}
+		out = append(out, groupJSON{g.Name, g.Domains, g.Builtin})
+	}
+
+	if format == formatJSON {
+		return writeJSON(out)
+	}
+	for _, g := range out {
+		name := g.Name
+		if g.Builtin {
+			name += " (built-in)"
+		}
+		fmt.Printf("%s\t%s\n", name, strings.Join(g.Domains, ", "))
+	}
+	return nil
+}
+
+// runDomainsAdd creates a custom equivalent-domain group or extends one.
+//
+// Args:
+//
+//	args: CLI arguments slice. Supported flags:
+//	  --name   (string, required): Group name.
+//	  --domain (string, repeatable): Domain to add; reduced to its eTLD+1.
+//
+// Behavior:
+//  1. A new group needs at least two domains; an existing custom group takes any number.
+//  2. Built-in group names are refused.
+func runDomainsAdd(args []string) error {
+	fs := flag.NewFlagSet("domains add", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var name string
+	var domains stringList
+	fs.StringVar(&name, "name", "", "group name")
+	fs.Var(&domains, "domain", "domain in the group (repeatable)")
+
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid arguments"}
+	}
+	if name == "" || len(domains) == 0 {
+		return userError{msg: "missing required flags: --name and --domain"}
+	}
+	if fs.NArg() != 0 {
+		return userError{msg: "unexpected positional arguments"}
+	}
+
+	g, err := store.AddDomainGroup(name, domains)
+	if err != nil {
+		return userError{msg: err.Error()}
+	}
+	fmt.Printf("domain group %s: %s\n", g.Name, strings.Join(g.Domains, ", "))
+	return nil
+}
+
+// runDomainsRemove deletes a custom equivalent-domain group, or some of its domains.
+//
+// Args:
+//
+//	args: CLI arguments slice. Supported flags:
+//	  --name   (string, required): Group name.
+//	  --domain (string, repeatable, optional): Remove only these domains.
+//
+// Behavior:
+//  1. A group left with fewer than two domains is deleted.
+//  2. Built-in groups cannot be removed.
+func runDomainsRemove(args []string) error {
+	fs := flag.NewFlagSet("domains remove", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var name string
+	var domains stringList
+	fs.StringVar(&name, "name", "", "group name")
+	fs.Var(&domains, "domain", "domain to remove (repeatable)")
+
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid arguments"}
+	}
+	if name == "" {
+		return userError{msg: "missing required flag: --name"}
+	}
+	if fs.NArg() != 0 {
+		return userError{msg: "unexpected positional arguments"}
+	}
+
+	kept, err := store.RemoveDomainGroup(name, domains)
+	if err != nil {
+		if errors.Is(err, store.ErrDomainGroupNotFound) {
+			return userError{msg: fmt.Sprintf("no custom domain group named %q", name), code: exitNotFound}
+		}
+		return userError{msg: err.Error()}
+	}
+	if kept {
+		fmt.Printf("removed %s from domain group %s\n", strings.Join(domains, ", "), name)
+	} else {
+		fmt.Printf("removed domain group %s\n", name)
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+)
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// payloadFlags holds the session flags that edit an entry payload.
+type payloadFlags struct {
+	notes        string
+	folder       string
+	match        string
+	urls         stringList
+	tags         stringList
+	fields       stringList
+	hidden       stringList
+	bools        stringList
+	removeURLs   stringList
+	removeTags   stringList
+	removeFields stringList
+}
+
+// register adds the payload flags to fs; the remove flags only make sense for update.
+func (f *payloadFlags) register(fs *flag.FlagSet, withRemove bool) {
+	fs.StringVar(&f.notes, "notes", "", "free-form notes")
+	fs.StringVar(&f.folder, "folder", "", "folder path, e.g. work/email")
+	fs.Var(&f.urls, "url", "additional URL (repeatable)")
+	fs.StringVar(&f.match, "match", "", "autofill match mode: base-domain, host, host-port, prefix, exact, regex, never or default")
+	fs.Var(&f.tags, "tag", "tag (repeatable)")
+	fs.Var(&f.fields, "field", "text field name=value (repeatable)")
+	fs.Var(&f.hidden, "hidden", "hidden field name; the value is prompted (repeatable)")
+	fs.Var(&f.bools, "bool", "boolean field name=true|false (repeatable)")
+	if withRemove {
+		fs.Var(&f.removeURLs, "remove-url", "URL to remove (repeatable)")
+		fs.Var(&f.removeTags, "remove-tag", "tag to remove (repeatable)")
+		fs.Var(&f.removeFields, "remove-field", "custom field to remove (repeatable)")
+	}
+}
+
+// apply edits p according to the flags. set reports which flags were given so that
+// --notes "" and --folder "" clear the value on update.
+func (f *payloadFlags) apply(p *vault.EntryPayload, set map[string]bool) error {
+	if set["notes"] {
+		p.Notes = f.notes
+	}
+	if set["folder"] {
+		p.Folder = f.folder
+	}
+
+	p.URLs = removeAll(append(p.URLs, f.urls...), f.removeURLs)
+	if set["match"] {
+		mode, err := vault.ParseMatchMode(f.match)
+		if err != nil {
+			return userError{msg: err.Error()}
+		}
+		p.Match = mode
+	}
+	p.Tags = removeAll(append(p.Tags, f.tags...), f.removeTags)
+
+	for _, name := range f.removeFields {
+		if !p.RemoveField(name) {
+			return userError{msg: fmt.Sprintf("no custom field named %q", name)}
+		}
+	}
+	for _, kv := range f.fields {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return userError{msg: "--field expects name=value"}
+		}
+		p.SetField(vault.CustomField{Name: strings.TrimSpace(name), Type: vault.FieldText, Value: value})
+	}
+	for _, kv := range f.bools {
+		name, value, ok := strings.Cut(kv, "=")
+		value = strings.ToLower(strings.TrimSpace(value))
+		if !ok || strings.TrimSpace(name) == "" || (value != "true" && value != "false") {
+			return userError{msg: "--bool expects name=true or name=false"}
+		}
+		p.SetField(vault.CustomField{Name: strings.TrimSpace(name), Type: vault.FieldBoolean, Value: value})
+	}
+	for _, name := range f.hidden {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return userError{msg: "--hidden expects a field name"}
+		}
+		value, err := promptPassword(fmt.Sprintf("Value for %s: ", name))
+		if err != nil {
+			return fmt.Errorf("read %s: %w", name, err)
+		}
+		p.SetField(vault.CustomField{Name: name, Type: vault.FieldHidden, Value: string(value)})
+		zeroBytes(value)
+	}
+	return nil
+}
+
+// setFlags returns the names of the flags given on the command line.
+func setFlags(fs *flag.FlagSet) map[string]bool {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set
+}
+
+func removeAll(list, drop []string) []string {
+	if len(drop) == 0 {
+		return list
+	}
+	out := list[:0]
+	for _, v := range list {
+		keep := true
+		for _, d := range drop {
+			if v == d {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// printEntry writes one decrypted entry. Hidden custom fields are masked unless reveal is set.
+func printEntry(website, username string, p vault.EntryPayload, reveal bool) {
+	fmt.Printf("%s %s: %s\n", website, username, p.Password)
+	if p.Folder != "" {
+		fmt.Printf("  folder: %s\n", p.Folder)
+	}
+	for _, u := range p.URLs {
+		fmt.Printf("  url:    %s\n", u)
+	}
+	if p.Match != vault.MatchDefault {
+		fmt.Printf("  match:  %s\n", p.Match)
+	}
+	if len(p.Tags) > 0 {
+		fmt.Printf("  tags:   %s\n", strings.Join(p.Tags, ", "))
+	}
+	for _, f := range p.Fields {
+		value := f.Value
+		if f.Type == vault.FieldHidden && !reveal {
+			value = "********"
+		}
+		fmt.Printf("  %s (%s): %s\n", f.Name, f.Type, value)
+	}
+	if p.Notes != "" {
+		fmt.Println("  notes:")
+		for _, line := range strings.Split(p.Notes, "\n") {
+			fmt.Printf("    %s\n", line)
+		}
+	}
+}
+
+// splitCommandLine splits a session line into words like a shell would for the simple
+// cases: whitespace separates words, single and double quotes group them, and a
+// backslash escapes the next character outside single quotes.
+func splitCommandLine(line string) ([]string, error) {
+	var (
+		words   []string
+		cur     strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range line {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errors.New("unterminated quote or escape")
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+
+	dbpkg "github.com/Hussein-Mazeh/PasswordManager/internal/db"
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+)
+
+// entryEdit holds the flags add and update share, as scripting commands and in pm session.
+type entryEdit struct {
+	site     string
+	user     string
+	typ      string
+	generate bool
+	secretFD int // -1 prompts; only the scripting commands register --secret-fd
+	pf       payloadFlags
+	gf       generatorFlags
+}
+
+// register adds --site, --user, --type, --generate and the payload and generator flags
+// to fs. For update, --type defaults to the entry's current type and the remove flags
+// are added.
+func (e *entryEdit) register(fs *flag.FlagSet, update bool) {
+	typ := vault.TypePassword
+	if update {
+		typ = ""
+	}
+	e.secretFD = -1
+	fs.StringVar(&e.site, "site", "", "website identifier")
+	fs.StringVar(&e.user, "user", "", "username")
+	fs.StringVar(&e.typ, "type", typ, "credential type")
+	fs.BoolVar(&e.generate, "generate", false, "generate the secret instead of prompting for it")
+	e.pf.register(fs, update)
+	e.gf.register(fs)
+}
+
+// parse parses args into e and checks the flags every add and update needs.
+func (e *entryEdit) parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid arguments"}
+	}
+	if e.site == "" || e.user == "" {
+		return userError{msg: "missing required flags: --site and --user"}
+	}
+	if fs.NArg() != 0 {
+		return userError{msg: "unexpected positional arguments"}
+	}
+	if e.generate && e.secretFD >= 0 {
+		return userError{msg: "--generate and --secret-fd are mutually exclusive"}
+	}
+	return nil
+}
+
+// addEntry stores a new entry built from e.
+//
+// Args:
+//
+//	dir: vault directory, for site-rules.json and the password policy.
+//	u: unlocked vault to write to.
+//	e: parsed add flags.
+//	fs: the flag set e was parsed with, to tell which payload flags were given.
+//
+// Returns:
+//
+//	dbpkg.EntryRow: the new row's ID, website and username.
+//	string: a note about the generated secret, or "".
+//	error: userError for bad input, a TOTP type, a policy violation, an existing entry or
+//	       an entry in the trash.
+func addEntry(dir string, u *unlockedVault, e *entryEdit, fs *flag.FlagSet) (dbpkg.EntryRow, string, error) {
+	if e.typ == vault.TypeTOTP {
+		return dbpkg.EntryRow{}, "", userError{msg: "store TOTP keys with totp add"}
+	}
+
+	var payload vault.EntryPayload
+	if err := e.pf.apply(&payload, setFlags(fs)); err != nil {
+		return dbpkg.EntryRow{}, "", err
+	}
+	generated, err := e.fillSecret(dir, &payload, false)
+	if err != nil {
+		return dbpkg.EntryRow{}, "", err
+	}
+
+	plain, format, err := vault.EncodePayload(payload)
+	if err != nil {
+		return dbpkg.EntryRow{}, "", userError{msg: err.Error()}
+	}
+	salt, blob, err := vault.EncryptEntryPassword(u.mek, u.suite, e.site, e.user, e.typ, plain)
+	if err != nil {
+		return dbpkg.EntryRow{}, "", fmt.Errorf("encrypt credential: %w", err)
+	}
+	id, err := dbpkg.InsertEntry(u.database, u.keys, e.site, e.user, e.typ, u.suite, format, salt, blob)
+	if err != nil {
+		if errors.Is(err, dbpkg.ErrEntryInTrash) {
+			return dbpkg.EntryRow{}, "", userError{msg: fmt.Sprintf("%s/%s is in the trash; restore or purge it first", e.site, e.user)}
+		}
+		if errors.Is(err, dbpkg.ErrEntryExists) {
+			return dbpkg.EntryRow{}, "", userError{msg: fmt.Sprintf("%s/%s already exists; use update to change it", e.site, e.user)}
+		}
+		return dbpkg.EntryRow{}, "", fmt.Errorf("store credential: %w", err)
+	}
+	return dbpkg.EntryRow{ID: id, Website: e.site, Username: e.user}, generated, nil
+}
+
+// updateEntry edits an existing entry with e. Arguments and results are those of
+// addEntry; the secret is replaced only when one is generated or supplied, and a missing
+// entry is a userError with exitNotFound.
+func updateEntry(dir string, u *unlockedVault, e *entryEdit, fs *flag.FlagSet) (dbpkg.EntryRow, string, error) {
+	row, err := dbpkg.GetEntryBySiteAndUser(u.database, u.keys, e.site, e.user)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return dbpkg.EntryRow{}, "", userError{msg: fmt.Sprintf("no credential found for %s/%s", e.site, e.user), code: exitNotFound}
+		}
+		return dbpkg.EntryRow{}, "", fmt.Errorf("fetch credential: %w", err)
+	}
+	typ := e.typ
+	if typ == "" {
+		typ = row.Type
+	}
+
+	payload, err := openSessionEntry(u.database, u.mek, row)
+	if err != nil {
+		return dbpkg.EntryRow{}, "", err
+	}
+	if err := e.pf.apply(&payload, setFlags(fs)); err != nil {
+		return dbpkg.EntryRow{}, "", err
+	}
+	generated, err := e.fillSecret(dir, &payload, true)
+	if err != nil {
+		return dbpkg.EntryRow{}, "", err
+	}
+
+	plain, format, err := vault.EncodePayload(payload)
+	if err != nil {
+		return dbpkg.EntryRow{}, "", userError{msg: err.Error()}
+	}
+	salt, blob, err := vault.EncryptEntryPassword(u.mek, u.suite, e.site, e.user, typ, plain)
+	if err != nil {
+		return dbpkg.EntryRow{}, "", fmt.Errorf("encrypt credential: %w", err)
+	}
+	if err := dbpkg.ReplaceEntry(u.database, row.ID, typ, u.suite, format, salt, blob); err != nil {
+		if errors.Is(err, dbpkg.ErrTOTPTypeChange) {
+			return dbpkg.EntryRow{}, "", userError{msg: err.Error()}
+		}
+		return dbpkg.EntryRow{}, "", fmt.Errorf("update credential: %w", err)
+	}
+	return *row, generated, nil
+}
+
+// fillSecret sets payload.Password from the generator or from --secret-fd or a prompt,
+// then holds a changed password to the password policy. add confirms the prompt; on
+// update an empty secret keeps the current password.
+func (e *entryEdit) fillSecret(dir string, payload *vault.EntryPayload, update bool) (string, error) {
+	current := payload.Password
+	prompt, confirm := "Secret: ", true
+	if update {
+		prompt, confirm = "New secret (empty keeps the current one): ", false
+	}
+
+	var generated string
+	if e.generate {
+		gen, err := generateEntrySecret(dir, e.site, &e.gf)
+		if err != nil {
+			return "", err
+		}
+		payload.Password = gen.Secret
+		generated = fmt.Sprintf("; generated a %.0f-bit secret", gen.EntropyBits)
+	} else {
+		secret, err := readEntrySecret(e.secretFD, prompt, confirm)
+		if err != nil {
+			return "", err
+		}
+		if len(secret) > 0 {
+			payload.Password = string(secret)
+		}
+		zeroBytes(secret)
+	}
+	if payload.Password != "" && payload.Password != current {
+		if err := checkEntryPassword(dir, e.site, e.user, payload.Password); err != nil {
+			return "", err
+		}
+	}
+	return generated, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"flag"
+	"io"
+	"path/filepath"
+	"testing"
+
+	dbpkg "github.com/Hussein-Mazeh/PasswordManager/internal/db"
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+)
+
+// testVault returns an unlocked vault over a new database with a random MEK.
+func testVault(t *testing.T, dir string) *unlockedVault {
+	t.Helper()
+	d, err := dbpkg.Open(filepath.Join(dir, "vault.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dbpkg.Migrate(d); err != nil {
+		t.Fatal(err)
+	}
+	mek := make([]byte, 32)
+	if _, err := rand.Read(mek); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := vault.DeriveMetaKeys(mek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &unlockedVault{database: d, mek: mek, keys: keys, suite: krypto.DefaultSuite}
+	t.Cleanup(u.Close)
+	return u
+}
+
+func TestAddEntryDuplicateIsUserError(t *testing.T) {
+	t.Setenv("PM_POLICY", filepath.Join(t.TempDir(), "policy.json"))
+	dir := t.TempDir()
+	u := testVault(t, dir)
+
+	add := func() error {
+		var e entryEdit
+		fs := flag.NewFlagSet("add", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		e.register(fs, false)
+		if err := e.parse(fs, []string{"--site", "example.com", "--user", "alice", "--generate"}); err != nil {
+			t.Fatal(err)
+		}
+		_, _, err := addEntry(dir, u, &e, fs)
+		return err
+	}
+	if err := add(); err != nil {
+		t.Fatalf("first add: %v", err)
+	}
+
+	err := add()
+	var uerr userError
+	if !errors.As(err, &uerr) {
+		t.Fatalf("second add: err = %v, want a userError", err)
+	}
+	if code := uerr.exitCode(); code != exitUserError {
+		t.Fatalf("second add: exit code %d, want %d", code, exitUserError)
+	}
+	if want := "example.com/alice already exists; use update to change it"; uerr.msg != want {
+		t.Fatalf("second add: message %q, want %q", uerr.msg, want)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Hussein-Mazeh/PasswordManager/auth"
+	"github.com/Hussein-Mazeh/PasswordManager/internal/exporter"
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+)
+
+// runExport writes every entry to a file, encrypted under a separate export passphrase
+// or, when explicitly requested, as plaintext.
+//
+// Args:
+//
+//	args: CLI arguments slice. Supported flags:
+//	  --dir               (string, required): Vault directory path.
+//	  --out               (string, required): File to create; existing files are never overwritten.
+//	  --passphrase-fd     (int, optional): Read the export passphrase from this descriptor.
+//	  --include-trash     (bool): Also export entries in the trash.
+//	  --plaintext         (bool): Write unencrypted CSV or JSON instead of an archive.
+//	  --format            (string): csv or json for --plaintext (default json).
+//	  --confirm-plaintext (bool): Required with --plaintext.
+//	  --keyfile           (string, optional): Keyfile for vaults that require one.
+//	  --password-fd       (int, optional): Read the master password from this descriptor.
+//
+// Behavior:
+//   - Archive mode may use a running pm agent; the passphrase is checked for strength
+//     and the archive is decrypted again before the command reports success.
+//   - Plaintext mode always asks for the master password, even when an agent holds the key.
+//   - The output file is created with mode 0600.
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var (
+		uf               unlockFlags
+		out              string
+		passphraseFD     int
+		includeTrash     bool
+		plaintext        bool
+		format           string
+		confirmPlaintext bool
+	)
+	uf.register(fs)
+	fs.StringVar(&out, "out", "", "file to create")
+	fs.IntVar(&passphraseFD, "passphrase-fd", -1, "read the export passphrase from this file descriptor")
+	fs.BoolVar(&includeTrash, "include-trash", false, "also export trashed entries")
+	fs.BoolVar(&plaintext, "plaintext", false, "write unencrypted CSV or JSON")
+	fs.StringVar(&format, "format", formatJSON, "plaintext format: csv or json")
+	fs.BoolVar(&confirmPlaintext, "confirm-plaintext", false, "acknowledge that the file will not be encrypted")
+
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid arguments"}
+	}
+	if fs.NArg() != 0 {
+		return userError{msg: "unexpected arguments"}
+	}
+	if out == "" {
+		return userError{msg: "missing required flag: --out"}
+	}
+	if plaintext {
+		if err := checkFormat(format, "csv", formatJSON); err != nil {
+			return err
+		}
+		if !confirmPlaintext {
+			return userError{msg: "--plaintext writes every password unencrypted; add --confirm-plaintext to proceed"}
+		}
+	} else if setFlags(fs)["format"] || confirmPlaintext {
+		return userError{msg: "--format and --confirm-plaintext only apply with --plaintext"}
+	}
+	if _, err := os.Lstat(out); err == nil {
+		return userError{msg: fmt.Sprintf("%s already exists; choose a new file", out)}
+	}
+
+	var (
+		u   *unlockedVault
+		err error
+	)
+	if plaintext {
+		if uf.dir == "" {
+			return userError{msg: "missing required flag: --dir"}
+		}
+		u, err = unlockWithPassword(uf)
+	} else {
+		u, err = uf.unlock()
+	}
+	if err != nil {
+		return err
+	}
+	defer u.Close()
+
+	doc, err := exporter.Collect(u.database, u.keys, u.mek, includeTrash)
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+
+	var buf bytes.Buffer
+	defer func() { zeroBytes(buf.Bytes()) }()
+	switch {
+	case plaintext && format == "csv":
+		err = exporter.WriteCSV(&buf, doc)
+	case plaintext:
+		err = exporter.WriteJSON(&buf, doc)
+	default:
+		err = sealExport(&buf, doc, passphraseFD, u.suite)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := writeNewFile(out, buf.Bytes()); err != nil {
+		return err
+	}
+	if plaintext {
+		fmt.Fprintf(os.Stderr, "warning: %s holds every password in plaintext; delete it once it has been used\n", out)
+		fmt.Printf("exported %d entries to %s (plaintext %s)\n", len(doc.Entries), out, format)
+		return nil
+	}
+	fmt.Printf("exported %d entries to %s (argon2id + %s)\n", len(doc.Entries), out, u.suite)
+	return nil
+}
+
+// sealExport reads and checks the export passphrase, writes the archive to w, and opens
+// it again so a typo cannot leave an archive nobody can decrypt.
+func sealExport(w *bytes.Buffer, doc exporter.Document, passphraseFD int, suite krypto.Suite) error {
+	var (
+		pass []byte
+		err  error
+	)
+	if passphraseFD >= 0 {
+		pass, err = readSecretFD(passphraseFD, "--passphrase-fd")
+	} else {
+		pass, err = readEntrySecret(-1, "Export passphrase: ", true)
+		if err == nil && pass == nil {
+			err = userError{msg: "no terminal for the export passphrase; use --passphrase-fd"}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(pass)
+
+	// A passphrase rather than a password: length and zxcvbn strength, no composition
+	// rules, and no HIBP lookup so exports work offline.
+	opts := auth.ValidateOptions{MinZXCVBNScore: 3}
+	if err := auth.ValidateMasterPasswordAdvanced(context.Background(), string(pass), opts); err != nil {
+		return userError{msg: "export passphrase: " + err.Error()}
+	}
+
+	data, err := exporter.Seal(doc, pass, krypto.DefaultArgon2Params(), suite)
+	if err != nil {
+		return fmt.Errorf("seal export: %w", err)
+	}
+	if _, err := exporter.Open(data, pass); err != nil {
+		return fmt.Errorf("verify export: %w", err)
+	}
+	w.Write(data)
+	return nil
+}
+
+// writeNewFile creates path with mode 0600, failing if it already exists, and removes
+// it again if the write does not complete.
+func writeNewFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return userError{msg: fmt.Sprintf("%s already exists; choose a new file", path)}
+		}
+		return userError{msg: fmt.Sprintf("cannot create %s: %v", path, err)}
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(path)
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(path)
+		return fmt.Errorf("sync %s: %w", path, err)
+	}
+	return f.Close()
+}
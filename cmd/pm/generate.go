@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+	"github.com/Hussein-Mazeh/PasswordManager/store"
+)
+
+// generatorFlags holds the options shared by pm generate and the --generate flag of
+// add and update.
+type generatorFlags struct {
+	length      int
+	noLower     bool
+	noUpper     bool
+	noDigits    bool
+	noSymbols   bool
+	symbols     string
+	noAmbiguous bool
+	exclude     string
+	rules       string
+	passphrase  bool
+	words       int
+	separator   string
+	capitalize  bool
+}
+
+func (f *generatorFlags) register(fs *flag.FlagSet) {
+	fs.IntVar(&f.length, "length", krypto.DefaultPasswordOptions().Length, "password length")
+	fs.BoolVar(&f.noLower, "no-lower", false, "leave out lowercase letters")
+	fs.BoolVar(&f.noUpper, "no-upper", false, "leave out uppercase letters")
+	fs.BoolVar(&f.noDigits, "no-digits", false, "leave out digits")
+	fs.BoolVar(&f.noSymbols, "no-symbols", false, "leave out symbols")
+	fs.StringVar(&f.symbols, "symbols", "", "symbol set to draw from")
+	fs.BoolVar(&f.noAmbiguous, "no-ambiguous", false, "leave out characters that are easily misread (0O1lI|)")
+	fs.StringVar(&f.exclude, "exclude", "", "characters never to use")
+	fs.StringVar(&f.rules, "rules", "", "site rules in passwordrules syntax")
+	fs.BoolVar(&f.passphrase, "passphrase", false, "generate a diceware passphrase instead")
+	fs.IntVar(&f.words, "words", krypto.DefaultPassphraseOptions().Words, "passphrase word count")
+	fs.StringVar(&f.separator, "separator", krypto.DefaultPassphraseOptions().Separator, "passphrase word separator")
+	fs.BoolVar(&f.capitalize, "capitalize", false, "capitalize passphrase words")
+}
+
+// generate produces a secret from the flags. siteRule, from site-rules.json, and --rules
+// narrow the password options; a passphrase is only checked against their maximum length.
+func (f *generatorFlags) generate(siteRule *krypto.SiteRule) (krypto.Generated, error) {
+	var rules []krypto.SiteRule
+	if siteRule != nil {
+		rules = append(rules, *siteRule)
+	}
+	if f.rules != "" {
+		r, err := krypto.ParsePasswordRules(f.rules)
+		if err != nil {
+			return krypto.Generated{}, userError{msg: err.Error()}
+		}
+		rules = append(rules, r)
+	}
+
+	var gen krypto.Generated
+	var err error
+	if f.passphrase {
+		gen, err = krypto.GeneratePassphrase(krypto.PassphraseOptions{Words: f.words, Separator: f.separator, Capitalize: f.capitalize})
+		if err == nil {
+			for _, r := range rules {
+				if r.MaxLength > 0 && len(gen.Secret) > r.MaxLength {
+					return krypto.Generated{}, userError{msg: fmt.Sprintf("a %d-word passphrase is longer than the site's maximum of %d characters", f.words, r.MaxLength)}
+				}
+			}
+		}
+	} else {
+		opts := krypto.PasswordOptions{
+			Length:           f.length,
+			Classes:          krypto.AllClasses,
+			Symbols:          f.symbols,
+			ExcludeAmbiguous: f.noAmbiguous,
+			Exclude:          f.exclude,
+		}
+		if f.noLower {
+			opts.Classes &^= krypto.ClassLower
+		}
+		if f.noUpper {
+			opts.Classes &^= krypto.ClassUpper
+		}
+		if f.noDigits {
+			opts.Classes &^= krypto.ClassDigit
+		}
+		if f.noSymbols {
+			opts.Classes &^= krypto.ClassSymbol
+		}
+		opts.Required = opts.Classes
+		for _, r := range rules {
+			opts = opts.Apply(r)
+		}
+		gen, err = krypto.GeneratePassword(opts)
+	}
+	if err != nil {
+		if errors.Is(err, krypto.ErrGeneratorOptions) {
+			return krypto.Generated{}, userError{msg: err.Error()}
+		}
+		return krypto.Generated{}, err
+	}
+	return gen, nil
+}
+
+// siteRule returns the generator rule for site: its site-rules.json rule in the vault
+// dir combined with the password policy, or nil when neither applies.
+func siteRule(dir, site string) (*krypto.SiteRule, error) {
+	r, ok, err := store.GeneratorRule(store.Paths{Dir: dir}, site)
+	if err != nil {
+		return nil, userError{msg: err.Error()}
+	}
+	if !ok {
+		return nil, nil
+	}
+	return &r, nil
+}
+
+// generateEntrySecret generates the secret for add and update --generate, narrowed by
+// the site-rules.json rule for site and the password policy.
+func generateEntrySecret(dir, site string, gf *generatorFlags) (krypto.Generated, error) {
+	rule, err := siteRule(dir, site)
+	if err != nil {
+		return krypto.Generated{}, err
+	}
+	return gf.generate(rule)
+}
+
+// runGenerate prints a random password or passphrase.
+//
+// Args:
+//
+//	args: CLI arguments slice. Supported flags:
+//	  --length       (int, default 20): Password length.
+//	  --no-lower, --no-upper, --no-digits, --no-symbols (bool): Leave out a class.
+//	  --symbols      (string, optional): Symbol set to draw from.
+//	  --no-ambiguous (bool): Leave out 0O1lI|.
+//	  --exclude      (string, optional): Characters never to use.
+//	  --rules        (string, optional): Site rules in passwordrules syntax.
+//	  --site         (string, optional): Apply the rule for this site from site-rules.json.
+//	  --dir          (string, required with --site): Vault directory holding site-rules.json
+//	                 and policy.json.
+//	  --passphrase   (bool): Diceware passphrase from the EFF large wordlist.
+//	  --words        (int, default 6), --separator (string, default -), --capitalize (bool).
+//	  --format       (string, default text): text or json.
+//
+// Behavior:
+//  1. Needs no unlock; the vault directory is only read for site-rules.json and
+//     policy.json. A policy whose entries mode is not off raises the length and
+//     required classes of generated passwords.
+//  2. Prints the secret alone on stdout and its entropy on stderr, or both as JSON.
+func runGenerate(args []string) error {
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var gf generatorFlags
+	var dir, site, format string
+	gf.register(fs)
+	fs.StringVar(&dir, "dir", "", "vault directory holding site-rules.json")
+	fs.StringVar(&site, "site", "", "apply the site-rules.json rule for this site")
+	fs.StringVar(&format, "format", formatText, "output format: text or json")
+
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid arguments"}
+	}
+	if fs.NArg() != 0 {
+		return userError{msg: "unexpected positional arguments"}
+	}
+	if err := checkFormat(format, formatText, formatJSON); err != nil {
+		return err
+	}
+
+	if site != "" && dir == "" {
+		return userError{msg: "--site needs --dir to find site-rules.json"}
+	}
+	rule, err := siteRule(dir, site)
+	if err != nil {
+		return err
+	}
+
+	gen, err := gf.generate(rule)
+	if err != nil {
+		return err
+	}
+
+	if format == formatJSON {
+		mode := "password"
+		if gf.passphrase {
+			mode = "passphrase"
+		}
+		return writeJSON(map[string]any{"secret": gen.Secret, "mode": mode, "entropy_bits": gen.EntropyBits})
+	}
+	fmt.Println(gen.Secret)
+	fmt.Fprintf(os.Stderr, "entropy: %.1f bits\n", gen.EntropyBits)
+	return nil
+}
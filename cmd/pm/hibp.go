@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/Hussein-Mazeh/PasswordManager/auth"
+)
+
+func runHIBP(args []string) error {
+	if len(args) == 0 || args[0] != "build-filter" {
+		return userError{msg: "usage: pm hibp build-filter --in <sha1-file> --out <filter> [--fp-rate 0.001]"}
+	}
+	return runHIBPBuildFilter(args[1:])
+}
+
+// runHIBPBuildFilter turns a Pwned Passwords SHA-1 list into a Bloom filter for the
+// "filter" breach checker.
+//
+// Args:
+//
+//	args: CLI arguments slice. Supported flags:
+//	  --in      (string, required): SHA-1 list, one "HASH:COUNT" line per password.
+//	  --out     (string, required): Filter file to write.
+//	  --fp-rate (float, default 0.001): Target false-positive rate.
+//	  --format  (string, default text): text or json.
+//
+// Behavior:
+//  1. Reads --in twice and needs memory for the whole filter, about 1.8 bytes per
+//     password at the default rate.
+//  2. Leaves an existing --out untouched when the build fails.
+func runHIBPBuildFilter(args []string) error {
+	fs := flag.NewFlagSet("hibp build-filter", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var in, out, format string
+	var rate float64
+	fs.StringVar(&in, "in", "", "SHA-1 list (HASH:COUNT lines)")
+	fs.StringVar(&out, "out", "", "filter file to write")
+	fs.Float64Var(&rate, "fp-rate", auth.DefaultFilterFalsePositiveRate, "target false-positive rate")
+	fs.StringVar(&format, "format", formatText, "output format: text or json")
+
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid arguments"}
+	}
+	if in == "" || out == "" {
+		return userError{msg: "missing required flags: --in and --out"}
+	}
+	if fs.NArg() != 0 {
+		return userError{msg: "unexpected positional arguments"}
+	}
+	if rate <= 0 || rate >= 0.5 {
+		return userError{msg: "--fp-rate must be between 0 and 0.5"}
+	}
+	if err := checkFormat(format, formatText, formatJSON); err != nil {
+		return err
+	}
+
+	n, err := auth.BuildBreachFilter(in, out, rate)
+	if err != nil {
+		return userError{msg: fmt.Sprintf("build filter: %v", err)}
+	}
+
+	if format == formatJSON {
+		return writeJSON(struct {
+			Path   string  `json:"path"`
+			Hashes uint64  `json:"hashes"`
+			FPRate float64 `json:"fp_rate"`
+		}{out, n, rate})
+	}
+	fmt.Printf("wrote %s: %d hashes, false-positive rate %g\n", out, n, rate)
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	dbpkg "github.com/Hussein-Mazeh/PasswordManager/internal/db"
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+)
+
+// sessionHistoryEntry resolves --site/--user to an entry and its previous versions, newest first.
+func sessionHistoryEntry(database *dbpkg.DB, keys *vault.MetaKeys, site, user string) (*dbpkg.EntryRow, []dbpkg.HistoryRow, error) {
+	row, err := dbpkg.GetEntryBySiteAndUser(database, keys, site, user)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, userError{msg: "credential not found"}
+		}
+		return nil, nil, fmt.Errorf("fetch credential: %w", err)
+	}
+	history, err := dbpkg.ListHistory(database, row.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetch history: %w", err)
+	}
+	return row, history, nil
+}
+
+// sessionHistory lists the previous versions of an entry. Version 1 is the most recently
+// replaced one. Passwords are masked unless --reveal is given.
+func sessionHistory(database *dbpkg.DB, mek []byte, keys *vault.MetaKeys, args []string) error {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var site string
+	var user string
+	var reveal bool
+	fs.StringVar(&site, "site", "", "website identifier")
+	fs.StringVar(&user, "user", "", "username")
+	fs.BoolVar(&reveal, "reveal", false, "show previous passwords")
+
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid history arguments"}
+	}
+	if site == "" || user == "" {
+		return userError{msg: "history requires --site and --user"}
+	}
+	if fs.NArg() != 0 {
+		return userError{msg: "unexpected positional arguments"}
+	}
+
+	row, history, err := sessionHistoryEntry(database, keys, site, user)
+	if err != nil {
+		return err
+	}
+	if len(history) == 0 {
+		fmt.Printf("no previous versions for %s/%s\n", row.Website, row.Username)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tSET\tREPLACED\tTYPE\tPASSWORD")
+	for i, h := range history {
+		password := "********"
+		plaintext, _, _, err := vault.DecryptEntryPassword(mek, h.Suite, row.Website, row.Username, h.Type, h.Salt, h.EncryptedPass)
+		if err != nil {
+			password = "(cannot decrypt)"
+		} else if reveal {
+			payload, err := vault.DecodePayload(h.Format, plaintext)
+			if err != nil {
+				password = "(cannot decode)"
+			} else {
+				password = payload.Password
+			}
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", i+1, h.UpdatedAt, h.ArchivedAt, h.Type, password)
+	}
+	return w.Flush()
+}
+
+// sessionRestore makes a previous version current again; the replaced version is kept
+// in history so the restore can be undone.
+func sessionRestore(database *dbpkg.DB, mek []byte, keys *vault.MetaKeys, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var site string
+	var user string
+	var version int
+	fs.StringVar(&site, "site", "", "website identifier")
+	fs.StringVar(&user, "user", "", "username")
+	fs.IntVar(&version, "version", 0, "version number from history")
+
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid restore arguments"}
+	}
+	if site == "" || user == "" || version < 1 {
+		return userError{msg: "restore requires --site, --user and --version"}
+	}
+	if fs.NArg() != 0 {
+		return userError{msg: "unexpected positional arguments"}
+	}
+
+	row, history, err := sessionHistoryEntry(database, keys, site, user)
+	if err != nil {
+		return err
+	}
+	if version > len(history) {
+		return userError{msg: fmt.Sprintf("no version %d; %s/%s has %d previous versions", version, row.Website, row.Username, len(history))}
+	}
+	h := history[version-1]
+
+	if _, _, _, err := vault.DecryptEntryPassword(mek, h.Suite, row.Website, row.Username, h.Type, h.Salt, h.EncryptedPass); err != nil {
+		return userError{msg: fmt.Sprintf("version %d does not decrypt for this entry", version)}
+	}
+
+	if err := dbpkg.RestoreHistory(database, row.ID, h.ID); err != nil {
+		return fmt.Errorf("restore credential: %w", err)
+	}
+
+	fmt.Printf("restored version %d of %s/%s\n", version, row.Website, row.Username)
+	return nil
+}
+
+// sessionRetention shows or sets how many previous versions are kept per entry.
+func sessionRetention(database *dbpkg.DB, args []string) error {
+	fs := flag.NewFlagSet("retention", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var keep int
+	fs.IntVar(&keep, "keep", -1, "previous versions to keep per entry (0 disables history)")
+
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid retention arguments"}
+	}
+	if fs.NArg() != 0 {
+		return userError{msg: "unexpected positional arguments"}
+	}
+
+	if keep < 0 {
+		n, err := dbpkg.HistoryRetention(database)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("keeping %d previous versions per entry\n", n)
+		return nil
+	}
+
+	if err := dbpkg.SetHistoryRetention(database, keep); err != nil {
+		return fmt.Errorf("set history retention: %w", err)
+	}
+	fmt.Printf("keeping %d previous versions per entry\n", keep)
+	return nil
+}
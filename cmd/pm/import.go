@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Hussein-Mazeh/PasswordManager/internal/exporter"
+	"github.com/Hussein-Mazeh/PasswordManager/internal/importer"
+)
+
+// runImport adds credentials from another password manager's export file.
+//
+// Args:
+//
+//	args: CLI arguments slice. Supported flags, followed by the export file path:
+//	  --dir         (string, required): Vault directory path.
+//	  --format      (string, required): chrome-csv, firefox-csv, bitwarden-json,
+//	                keepass-xml, 1pux or pm-archive.
+//	  --dry-run     (bool): Show what would be imported without writing.
+//	  --passphrase-fd (int, optional): Read the pm-archive export passphrase from this
+//	                descriptor instead of prompting.
+//	  --keyfile     (string, optional): Keyfile for vaults that require one.
+//	  --password-fd (int, optional): Read the master password from this descriptor.
+//
+// Behavior:
+//   - Websites are reduced to their eTLD+1; the full URLs are kept in the entry.
+//   - Items whose website and username are already in the vault are reported as
+//     duplicates and left untouched, as are items repeated within the file.
+//   - A pm-archive is decrypted before the vault is unlocked; entries that were in its
+//     trash are skipped and its password history is not imported.
+//   - Prints one line per item and a summary; per-item problems do not fail the command.
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var uf unlockFlags
+	var formatName string
+	var dryRun bool
+	var passphraseFD int
+	uf.register(fs)
+	fs.StringVar(&formatName, "format", "", "export format")
+	fs.BoolVar(&dryRun, "dry-run", false, "preview without writing")
+	fs.IntVar(&passphraseFD, "passphrase-fd", -1, "read the pm-archive passphrase from this file descriptor")
+
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid arguments"}
+	}
+	if formatName == "" {
+		return userError{msg: "missing required flag: --format"}
+	}
+	if fs.NArg() != 1 {
+		return userError{msg: "expected exactly one export file"}
+	}
+	format, err := importer.ParseFormat(formatName)
+	if err != nil {
+		return userError{msg: err.Error()}
+	}
+	if format != importer.PMArchive && passphraseFD >= 0 {
+		return userError{msg: "--passphrase-fd only applies to --format pm-archive"}
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return userError{msg: fmt.Sprintf("cannot read %s: %v", fs.Arg(0), err)}
+	}
+	defer zeroBytes(data)
+
+	var records []importer.Record
+	var skipped []importer.Result
+	if format == importer.PMArchive {
+		records, skipped, err = parseArchive(data, passphraseFD)
+	} else if records, skipped, err = importer.Parse(format, data); err != nil {
+		err = userError{msg: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+
+	u, err := uf.unlock()
+	if err != nil {
+		return err
+	}
+	defer u.Close()
+
+	results, err := importer.Apply(u.database, u.keys, u.mek, u.suite, records, dryRun)
+	if err != nil {
+		return fmt.Errorf("import: %w", err)
+	}
+	results = append(results, skipped...)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tWEBSITE\tUSERNAME\tSOURCE\tNOTE")
+	for _, r := range results {
+		status := string(r.Status)
+		if dryRun && r.Status == importer.StatusImported {
+			status = "new"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", status, r.Website, r.Username, r.Source, r.Reason)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	counts := importer.Summary(results)
+	verb := "imported"
+	if dryRun {
+		verb = "would import"
+	}
+	fmt.Printf("%s %d, duplicates %d, in trash %d, skipped %d, failed %d\n", verb,
+		counts[importer.StatusImported], counts[importer.StatusDuplicate], counts[importer.StatusInTrash],
+		counts[importer.StatusSkipped], counts[importer.StatusFailed])
+	return nil
+}
+
+// parseArchive reads the export passphrase and decrypts a pm-archive export.
+func parseArchive(data []byte, passphraseFD int) ([]importer.Record, []importer.Result, error) {
+	var (
+		pass []byte
+		err  error
+	)
+	if passphraseFD >= 0 {
+		pass, err = readSecretFD(passphraseFD, "--passphrase-fd")
+	} else {
+		pass, err = readEntrySecret(-1, "Export passphrase: ", false)
+		if err == nil && pass == nil {
+			err = userError{msg: "no terminal for the export passphrase; use --passphrase-fd"}
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer zeroBytes(pass)
+
+	records, skipped, err := importer.ParseArchive(data, pass)
+	if err != nil {
+		if errors.Is(err, exporter.ErrBadPassphrase) {
+			return nil, nil, userError{msg: err.Error(), code: exitAuthFailed}
+		}
+		return nil, nil, userError{msg: err.Error()}
+	}
+	return records, skipped, nil
+}
@@ -3,24 +3,18 @@ package main
 import (
 	"bufio"
 	"bytes"
-	"context"
 	"crypto/rand"
 	"database/sql"
-	"encoding/base64"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
 	"strings"
 	"syscall"
-	"time"
 
 	"golang.org/x/term"
 
-	"github.com/Hussein-Mazeh/PasswordManager/auth"
-	"github.com/Hussein-Mazeh/PasswordManager/internal/bio/toggle"
 	dbpkg "github.com/Hussein-Mazeh/PasswordManager/internal/db"
 	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
 	"github.com/Hussein-Mazeh/PasswordManager/krypto"
@@ -29,12 +23,30 @@ import (
 
 const cliVersion = "0.1.0"
 
+// Exit codes. They are part of the scripting interface, so existing values never change.
+const (
+	exitUserError  = 1 // bad arguments or a refused operation
+	exitInternal   = 2 // unexpected failure
+	exitNotFound   = 3 // no matching credential
+	exitLocked     = 4 // no way to obtain the master password non-interactively
+	exitAuthFailed = 5 // wrong password, missing keyfile, or failed biometric check
+	exitProblems   = 6 // pm doctor found errors it could not repair, or pm audit found issues
+)
+
 type userError struct {
-	msg string
+	msg  string
+	code int // exit code; zero means exitUserError
 }
 
 func (e userError) Error() string { return e.msg }
 
+func (e userError) exitCode() int {
+	if e.code == 0 {
+		return exitUserError
+	}
+	return e.code
+}
+
 func main() {
 	if len(os.Args) < 2 {
 		printUsage()
@@ -58,14 +70,98 @@ func main() {
 			if err := runMasterChange(os.Args[3:]); err != nil {
 				handleError(err)
 			}
+		case "slot":
+			if err := runMasterSlot(os.Args[3:]); err != nil {
+				handleError(err)
+			}
+		case "tune":
+			if err := runMasterTune(os.Args[3:]); err != nil {
+				handleError(err)
+			}
+		case "rotate-key":
+			if err := runMasterRotateKey(os.Args[3:]); err != nil {
+				handleError(err)
+			}
 		default:
 			printMasterUsage()
 			os.Exit(1)
 		}
+	case "recovery":
+		if err := runRecovery(os.Args[2:]); err != nil {
+			handleError(err)
+		}
+	case "migrate":
+		if err := runMigrate(os.Args[2:]); err != nil {
+			handleError(err)
+		}
 	case "session":
 		if err := runSession(os.Args[2:]); err != nil {
 			handleError(err)
 		}
+	case "get":
+		if err := runGet(os.Args[2:]); err != nil {
+			handleError(err)
+		}
+	case "list":
+		if err := runList(os.Args[2:]); err != nil {
+			handleError(err)
+		}
+	case "add":
+		if err := runAdd(os.Args[2:]); err != nil {
+			handleError(err)
+		}
+	case "update":
+		if err := runUpdate(os.Args[2:]); err != nil {
+			handleError(err)
+		}
+	case "delete":
+		if err := runDelete(os.Args[2:]); err != nil {
+			handleError(err)
+		}
+	case "import":
+		if err := runImport(os.Args[2:]); err != nil {
+			handleError(err)
+		}
+	case "export":
+		if err := runExport(os.Args[2:]); err != nil {
+			handleError(err)
+		}
+	case "backup":
+		if err := runBackup(os.Args[2:]); err != nil {
+			handleError(err)
+		}
+	case "restore":
+		if err := runRestore(os.Args[2:]); err != nil {
+			handleError(err)
+		}
+	case "doctor":
+		if err := runDoctor(os.Args[2:]); err != nil {
+			handleError(err)
+		}
+	case "audit":
+		if err := runAudit(os.Args[2:]); err != nil {
+			handleError(err)
+		}
+	case "generate":
+		if err := runGenerate(os.Args[2:]); err != nil {
+			handleError(err)
+		}
+	case "totp":
+		if err := runTOTP(os.Args[2:]); err != nil {
+			handleError(err)
+		}
+	case "hibp":
+		if err := runHIBP(os.Args[2:]); err != nil {
+			handleError(err)
+		}
+	case "domains":
+		if err := runDomains(os.Args[2:]); err != nil {
+			handleError(err)
+		}
+	case "agent":
+		if err := runAgent(os.Args[2:]); err != nil {
+			handleError(err)
+		}
 	case "bio":
 		if err := runBio(os.Args[2:]); err != nil {
 			handleError(err)
@@ -84,11 +180,11 @@ func handleError(err error) {
 	var uerr userError
 	if errors.As(err, &uerr) {
 		fmt.Fprintln(os.Stderr, uerr.Error())
-		os.Exit(1)
+		os.Exit(uerr.exitCode())
 	}
 
 	fmt.Fprintf(os.Stderr, "unexpected error: %v\n", err)
-	os.Exit(2)
+	os.Exit(exitInternal)
 }
 
 func runMasterSet(args []string) error {
@@ -97,8 +193,12 @@ func runMasterSet(args []string) error {
 
 	var dir string
 	var user string
+	var keyfilePath string
+	var withRecovery bool
 	fs.StringVar(&dir, "dir", "", "vault directory")
 	fs.StringVar(&user, "user", "", "vault username")
+	fs.StringVar(&keyfilePath, "keyfile", "", "keyfile required in addition to the password")
+	fs.BoolVar(&withRecovery, "recovery", false, "generate a printable recovery code")
 
 	if err := fs.Parse(args); err != nil {
 		return userError{msg: "invalid arguments"}
@@ -110,6 +210,12 @@ func runMasterSet(args []string) error {
 		return userError{msg: "unexpected positional arguments"}
 	}
 
+	keyfile, err := readKeyfile(keyfilePath)
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(keyfile)
+
 	pw, err := promptPassword("Enter master password: ")
 	if err != nil {
 		return fmt.Errorf("read master password: %w", err)
@@ -126,73 +232,33 @@ func runMasterSet(args []string) error {
 		return userError{msg: "passwords do not match"}
 	}
 
-	ctx := context.Background()
-	opts := auth.DefaultValidateOptions()
-	opts.EnableHIBP = true
-	opts.MinZXCVBNScore = 3
+	paths := store.Paths{Dir: dir}
 
-	if err := auth.ValidateMasterPasswordAdvanced(ctx, string(pw), opts); err != nil {
-		return userError{msg: err.Error()}
+	if err := checkMasterPassword(paths, user, pw); err != nil {
+		return err
 	}
 
-	paths := store.Paths{Dir: dir}
-
 	params := krypto.DefaultArgon2Params()
 	params.SaltLen = krypto.SaltLengthBytes
 	hdr, err := store.LoadVaultHeader(paths)
-	headerExists := err == nil
-	saltReplaced := false
 	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			hdr = vault.VaultHeader{}
-			headerExists = false
-		} else {
+		if !errors.Is(err, os.ErrNotExist) {
 			return fmt.Errorf("load header: %w", err)
 		}
+		hdr = vault.VaultHeader{}
 	}
 
-	var salt []byte
-	if hdr.Salt != "" {
-		salt, err = base64.StdEncoding.DecodeString(hdr.Salt)
-		if err != nil {
-			return fmt.Errorf("decode header salt: %w", err)
-		}
-		if len(salt) != krypto.SaltLengthBytes {
-			saltReplaced = true
-		}
-	} else {
-		salt, err = krypto.NewRandomSalt(params.SaltLen)
-		if err != nil {
-			return fmt.Errorf("generate salt: %w", err)
-		}
-		hdr.Salt = base64.StdEncoding.EncodeToString(salt)
-	}
-
-	if saltReplaced {
-		salt, err = krypto.NewRandomSalt(krypto.SaltLengthBytes)
-		if err != nil {
-			return fmt.Errorf("regenerate salt: %w", err)
-		}
-		hdr.Salt = base64.StdEncoding.EncodeToString(salt)
-	}
-
-	pdk, err := krypto.DeriveKeyArgon2id(pw, salt, params)
-	if err != nil {
-		return fmt.Errorf("derive key: %w", err)
-	}
-	defer zeroBytes(pdk)
-
+	// Re-running set with the current password refreshes that slot in place;
+	// any other password must go through "master change" or "master slot add".
+	slotID := -1
 	var mek []byte
-	if headerExists && !saltReplaced && hdr.Version == 1 && hdr.KDF.Name == "argon2id" {
-		existingMEK, loadedHdr, err := store.LoadAndUnwrapMEK(paths, pdk)
+	if len(hdr.KeySlots) > 0 {
+		existingMEK, loadedHdr, id, err := store.UnlockMEK(paths, pw, keyfile)
 		switch {
 		case err == nil:
-			mek = existingMEK
-			hdr = loadedHdr
-		case errors.Is(err, store.ErrMEKNotWrapped):
-			// No wrapped MEK yet; generate below.
-		case errors.Is(err, os.ErrNotExist):
-			headerExists = false
+			mek, hdr, slotID = existingMEK, loadedHdr, id
+		case errors.Is(err, store.ErrNoMatchingSlot), errors.Is(err, store.ErrKeyfileRequired):
+			return userError{msg: "vault already has a master password; use pm master change"}
 		default:
 			return fmt.Errorf("load existing mek: %w", err)
 		}
@@ -206,28 +272,41 @@ func runMasterSet(args []string) error {
 	}
 	defer zeroBytes(mek)
 
-	hdr.Version = 1
-	hdr.User = user
-	hdr.KDF = vault.KDFConfig{
-		Name:        "argon2id",
-		MemoryMB:    params.MemoryMB,
-		Time:        params.Time,
-		Parallelism: params.Parallelism,
-		SaltLen:     krypto.SaltLengthBytes,
-		KeyLen:      params.KeyLen,
+	salt, err := krypto.NewRandomSalt(params.SaltLen)
+	if err != nil {
+		return fmt.Errorf("generate salt: %w", err)
 	}
 
-	now := time.Now().UTC()
-	if hdr.CreatedAt.IsZero() {
-		hdr.CreatedAt = now
+	kdf := vault.NewArgon2KDFConfig(params)
+	kdf.Keyfile = keyfile != nil
+
+	pdk, err := store.DerivePassphraseKey(kdf, pw, salt, keyfile)
+	if err != nil {
+		return fmt.Errorf("derive key: %w", err)
 	}
-	hdr.UpdatedAt = now
+	defer zeroBytes(pdk)
+
+	hdr.Version = vault.HeaderVersion
+	hdr.User = user
 
-	if err := store.WrapAndSaveMEK(paths, hdr, pdk, mek); err != nil {
+	if slotID >= 0 {
+		hdr, err = store.RewrapKeySlot(paths, hdr, slotID, kdf, salt, pdk, mek)
+	} else {
+		var slot vault.KeySlot
+		slot, err = store.WrapKeySlot(store.MasterSlotLabel, kdf, salt, pdk, mek)
+		if err == nil {
+			hdr, _, err = store.AddKeySlot(paths, hdr, slot, mek)
+		}
+	}
+	if err != nil {
 		return fmt.Errorf("persist header: %w", err)
 	}
 
 	fmt.Printf("master password set for user %s; MEK is wrapped\n", user)
+
+	if withRecovery {
+		return issueRecoveryCode(paths, hdr, mek)
+	}
 	return nil
 }
 
@@ -236,7 +315,9 @@ func runSession(args []string) error {
 	fs.SetOutput(io.Discard)
 
 	var dir string
+	var keyfilePath string
 	fs.StringVar(&dir, "dir", "", "vault directory")
+	fs.StringVar(&keyfilePath, "keyfile", "", "keyfile for vaults that require one")
 
 	if err := fs.Parse(args); err != nil {
 		return userError{msg: "invalid arguments"}
@@ -248,82 +329,43 @@ func runSession(args []string) error {
 		return userError{msg: "unexpected positional arguments"}
 	}
 
-	paths := store.Paths{Dir: dir}
-	hdr, err := store.LoadVaultHeader(paths)
+	u, err := openAgentVault(dir)
 	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return userError{msg: "vault header not found; run pm master set first"}
+		if !agentUnavailable(err) {
+			return err
 		}
-		return fmt.Errorf("load header: %w", err)
-	}
-	if hdr.KDF.Name != "argon2id" || hdr.Salt == "" {
-		return userError{msg: "vault header missing required fields"}
-	}
-
-	salt, err := base64.StdEncoding.DecodeString(hdr.Salt)
-	if err != nil {
-		return fmt.Errorf("decode header salt: %w", err)
-	}
-
-	params := krypto.Argon2Params{
-		MemoryMB:    hdr.KDF.MemoryMB,
-		Time:        hdr.KDF.Time,
-		Parallelism: hdr.KDF.Parallelism,
-		SaltLen:     hdr.KDF.SaltLen,
-		KeyLen:      hdr.KDF.KeyLen,
-	}
-
-	bioStatus, err := toggle.Status(dir)
-	if err != nil && !errors.Is(err, toggle.ErrUnsupported) {
-		return fmt.Errorf("biometric status: %w", err)
-	}
-	if err == nil && bioStatus.Enabled {
-		if err := toggle.Authenticate("Touch ID to unlock the vault"); err != nil {
-			if errors.Is(err, toggle.ErrUnsupported) {
-				// ignore; treat as disabled if unsupported at runtime
-			} else {
-				return userError{msg: "biometric authentication failed"}
-			}
+		if u, err = unlockInteractive(dir, keyfilePath); err != nil {
+			return err
 		}
 	}
+	defer u.Close()
 
-	pw, err := promptPassword("Enter master password: ")
-	if err != nil {
-		return fmt.Errorf("read master password: %w", err)
-	}
-	defer zeroBytes(pw)
+	fmt.Println("session unlocked; type 'help' for commands")
+	return sessionLoop(dir, u)
+}
 
-	pdk, err := krypto.DeriveKeyArgon2id(pw, salt, params)
+// unlockInteractive prompts for the master password and opens the vault.
+func unlockInteractive(dir, keyfilePath string) (*unlockedVault, error) {
+	keyfile, err := readKeyfile(keyfilePath)
 	if err != nil {
-		return userError{msg: "failed to unlock vault"}
+		return nil, err
 	}
-	defer zeroBytes(pdk)
+	defer zeroBytes(keyfile)
 
-	mek, _, err := store.LoadAndUnwrapMEK(paths, pdk)
-	if err != nil {
-		if errors.Is(err, store.ErrMEKNotWrapped) {
-			return userError{msg: "vault is not initialised with a master key"}
-		}
-		return userError{msg: "failed to unlock vault"}
+	if err := requireBiometric(dir); err != nil {
+		return nil, err
 	}
-	defer zeroBytes(mek)
 
-	dbPath := filepath.Join(dir, "vault.db")
-	database, err := dbpkg.Open(dbPath)
+	pw, err := promptPassword("Enter master password: ")
 	if err != nil {
-		return fmt.Errorf("open vault database: %w", err)
-	}
-	defer dbpkg.Close(database)
-
-	if err := dbpkg.Migrate(database); err != nil {
-		return fmt.Errorf("initialise vault database: %w", err)
+		return nil, fmt.Errorf("read master password: %w", err)
 	}
+	defer zeroBytes(pw)
 
-	fmt.Println("session unlocked; type 'help' for commands")
-	return sessionLoop(database, mek)
+	return openUnlockedVault(dir, pw, keyfile)
 }
 
-func sessionLoop(database *dbpkg.DB, mek []byte) error {
+func sessionLoop(dir string, u *unlockedVault) error {
 	scanner := bufio.NewScanner(os.Stdin)
 
 	for {
@@ -341,7 +383,14 @@ func sessionLoop(database *dbpkg.DB, mek []byte) error {
 			continue
 		}
 
-		fields := strings.Fields(line)
+		fields, err := splitCommandLine(line)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			continue
+		}
+		if len(fields) == 0 {
+			continue
+		}
 		cmd := fields[0]
 		args := fields[1:]
 
@@ -349,19 +398,39 @@ func sessionLoop(database *dbpkg.DB, mek []byte) error {
 		case "help":
 			printSessionHelp()
 		case "add":
-			if err := sessionAdd(database, mek, args); err != nil {
+			if err := sessionAdd(dir, u, args); err != nil {
 				handleSessionError(err)
 			}
 		case "get":
-			if err := sessionGet(database, mek, args); err != nil {
+			if err := sessionGet(u.database, u.mek, u.keys, args); err != nil {
 				handleSessionError(err)
 			}
 		case "update":
-			if err := sessionUpdate(database, mek, args); err != nil {
+			if err := sessionUpdate(dir, u, args); err != nil {
 				handleSessionError(err)
 			}
 		case "delete":
-			if err := sessionDelete(database, args); err != nil {
+			if err := sessionDelete(u.database, u.keys, args); err != nil {
+				handleSessionError(err)
+			}
+		case "totp":
+			if err := sessionTOTP(u.database, u.mek, u.keys, u.suite, args); err != nil {
+				handleSessionError(err)
+			}
+		case "history":
+			if err := sessionHistory(u.database, u.mek, u.keys, args); err != nil {
+				handleSessionError(err)
+			}
+		case "restore":
+			if err := sessionRestore(u.database, u.mek, u.keys, args); err != nil {
+				handleSessionError(err)
+			}
+		case "trash":
+			if err := sessionTrash(u.database, u.keys, args); err != nil {
+				handleSessionError(err)
+			}
+		case "retention":
+			if err := sessionRetention(u.database, args); err != nil {
 				handleSessionError(err)
 			}
 		case "exit", "quit":
@@ -372,65 +441,46 @@ func sessionLoop(database *dbpkg.DB, mek []byte) error {
 	}
 }
 
-func sessionAdd(database *dbpkg.DB, mek []byte, args []string) error {
+func sessionAdd(dir string, u *unlockedVault, args []string) error {
 	fs := flag.NewFlagSet("add", flag.ContinueOnError)
 	fs.SetOutput(io.Discard)
 
-	var site string
-	var user string
-	var typ string
-	fs.StringVar(&site, "site", "", "website identifier")
-	fs.StringVar(&user, "user", "", "username")
-	fs.StringVar(&typ, "type", "password", "credential type")
-
-	if err := fs.Parse(args); err != nil {
-		return userError{msg: "invalid add arguments"}
-	}
-	if site == "" || user == "" {
-		return userError{msg: "add requires --site and --user"}
-	}
-	if fs.NArg() != 0 {
-		return userError{msg: "unexpected positional arguments"}
-	}
-
-	secret, err := promptPassword("Secret: ")
-	if err != nil {
-		return fmt.Errorf("read secret: %w", err)
+	var e entryEdit
+	e.register(fs, false)
+	if err := e.parse(fs, args); err != nil {
+		return err
 	}
-	defer zeroBytes(secret)
 
-	confirm, err := promptPassword("Confirm: ")
+	row, generated, err := addEntry(dir, u, &e, fs)
 	if err != nil {
-		return fmt.Errorf("read confirmation: %w", err)
-	}
-	defer zeroBytes(confirm)
-
-	if !bytes.Equal(secret, confirm) {
-		return userError{msg: "secrets do not match"}
+		return err
 	}
+	fmt.Printf("stored credential for %s/%s (id=%d)%s\n", row.Website, row.Username, row.ID, generated)
+	return nil
+}
 
-	entrySalt, blob, err := vault.EncryptEntryPassword(mek, site, user, typ, string(secret))
+// openSessionEntry decrypts a row's payload and persists the refreshed ciphertext.
+func openSessionEntry(database *dbpkg.DB, mek []byte, row *dbpkg.EntryRow) (vault.EntryPayload, error) {
+	plaintext, newSalt, newBlob, err := vault.DecryptEntryPassword(mek, row.Suite, row.Website, row.Username, row.Type, row.Salt, row.EncryptedPass)
 	if err != nil {
-		return fmt.Errorf("encrypt credential: %w", err)
+		return vault.EntryPayload{}, fmt.Errorf("failed to decrypt credential for %s/%s; run pm doctor to check the vault", row.Website, row.Username)
 	}
-
-	id, err := dbpkg.InsertEntry(database, site, user, typ, entrySalt, blob)
-	if err != nil {
-		return fmt.Errorf("store credential: %w", err)
+	if err := dbpkg.UpdateEntryCipher(database, row.ID, row.Type, row.Suite, row.Format, newSalt, newBlob); err != nil {
+		return vault.EntryPayload{}, fmt.Errorf("failed to refresh credential for %s/%s: %w", row.Website, row.Username, err)
 	}
-
-	fmt.Printf("stored credential for %s/%s (id=%d)\n", site, user, id)
-	return nil
+	return vault.DecodePayload(row.Format, plaintext)
 }
 
-func sessionGet(database *dbpkg.DB, mek []byte, args []string) error {
+func sessionGet(database *dbpkg.DB, mek []byte, keys *vault.MetaKeys, args []string) error {
 	fs := flag.NewFlagSet("get", flag.ContinueOnError)
 	fs.SetOutput(io.Discard)
 
 	var site string
 	var user string
+	var reveal bool
 	fs.StringVar(&site, "site", "", "website identifier")
 	fs.StringVar(&user, "user", "", "username")
+	fs.BoolVar(&reveal, "reveal", false, "show hidden custom fields")
 
 	if err := fs.Parse(args); err != nil {
 		return userError{msg: "invalid get arguments"}
@@ -443,7 +493,7 @@ func sessionGet(database *dbpkg.DB, mek []byte, args []string) error {
 	}
 
 	if user != "" {
-		row, err := dbpkg.GetEntryBySiteAndUser(database, site, user)
+		row, err := dbpkg.GetEntryBySiteAndUser(database, keys, site, user)
 		if err != nil {
 			if errors.Is(err, sql.ErrNoRows) {
 				fmt.Fprintf(os.Stderr, "no credential found for %s/%s\n", site, user)
@@ -451,19 +501,16 @@ func sessionGet(database *dbpkg.DB, mek []byte, args []string) error {
 			}
 			return fmt.Errorf("fetch credential: %w", err)
 		}
-		plaintext, newSalt, newBlob, err := vault.DecryptEntryPassword(mek, row.Website, row.Username, row.Type, row.Salt, row.EncryptedPass)
+		payload, err := openSessionEntry(database, mek, row)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "failed to decrypt credential for %s/%s\n", row.Website, row.Username)
+			fmt.Fprintln(os.Stderr, err)
 			return nil
 		}
-		if err := dbpkg.UpdateEntryCipher(database, row.ID, row.Type, newSalt, newBlob); err != nil {
-			return fmt.Errorf("refresh credential: %w", err)
-		}
-		fmt.Printf("%s %s: %s\n", row.Website, row.Username, plaintext)
+		printEntry(row.Website, row.Username, payload, reveal)
 		return nil
 	}
 
-	rows, err := dbpkg.GetEntryByWebsite(database, site)
+	rows, err := dbpkg.GetEntryByWebsite(database, keys, site)
 	if err != nil {
 		return fmt.Errorf("fetch credentials: %w", err)
 	}
@@ -471,78 +518,36 @@ func sessionGet(database *dbpkg.DB, mek []byte, args []string) error {
 		fmt.Fprintf(os.Stderr, "no credentials found for %s\n", site)
 		return nil
 	}
-	for _, row := range rows {
-		plaintext, newSalt, newBlob, err := vault.DecryptEntryPassword(mek, row.Website, row.Username, row.Type, row.Salt, row.EncryptedPass)
+	for i := range rows {
+		payload, err := openSessionEntry(database, mek, &rows[i])
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "failed to decrypt credential for %s/%s\n", row.Website, row.Username)
-			continue
-		}
-		if err := dbpkg.UpdateEntryCipher(database, row.ID, row.Type, newSalt, newBlob); err != nil {
-			fmt.Fprintf(os.Stderr, "failed to refresh credential for %s/%s: %v\n", row.Website, row.Username, err)
+			fmt.Fprintln(os.Stderr, err)
 			continue
 		}
-		fmt.Printf("%s %s: %s\n", row.Website, row.Username, plaintext)
+		printEntry(rows[i].Website, rows[i].Username, payload, reveal)
 	}
 	return nil
 }
 
-func sessionUpdate(database *dbpkg.DB, mek []byte, args []string) error {
+func sessionUpdate(dir string, u *unlockedVault, args []string) error {
 	fs := flag.NewFlagSet("update", flag.ContinueOnError)
 	fs.SetOutput(io.Discard)
 
-	var site string
-	var user string
-	var typ string
-	fs.StringVar(&site, "site", "", "website identifier")
-	fs.StringVar(&user, "user", "", "username")
-	fs.StringVar(&typ, "type", "", "credential type")
-
-	if err := fs.Parse(args); err != nil {
-		return userError{msg: "invalid update arguments"}
-	}
-	if site == "" || user == "" {
-		return userError{msg: "update requires --site and --user"}
-	}
-	if fs.NArg() != 0 {
-		return userError{msg: "unexpected positional arguments"}
-	}
-
-	row, err := dbpkg.GetEntryBySiteAndUser(database, site, user)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return userError{msg: "credential not found"}
-		}
-		return fmt.Errorf("fetch credential: %w", err)
+	var e entryEdit
+	e.register(fs, true)
+	if err := e.parse(fs, args); err != nil {
+		return err
 	}
 
-	if typ == "" {
-		typ = row.Type
-	}
-
-	secret, err := promptPassword("New secret: ")
+	row, generated, err := updateEntry(dir, u, &e, fs)
 	if err != nil {
-		return fmt.Errorf("read secret: %w", err)
-	}
-	defer zeroBytes(secret)
-
-	if len(secret) == 0 {
-		return userError{msg: "secret cannot be empty"}
+		return err
 	}
-
-	entrySalt, blob, err := vault.EncryptEntryPassword(mek, site, user, typ, string(secret))
-	if err != nil {
-		return fmt.Errorf("encrypt credential: %w", err)
-	}
-
-	if err := dbpkg.UpdateEntryCipher(database, row.ID, typ, entrySalt, blob); err != nil {
-		return fmt.Errorf("update credential: %w", err)
-	}
-
-	fmt.Printf("updated credential for %s/%s\n", site, user)
+	fmt.Printf("updated credential for %s/%s%s\n", row.Website, row.Username, generated)
 	return nil
 }
 
-func sessionDelete(database *dbpkg.DB, args []string) error {
+func sessionDelete(database *dbpkg.DB, keys *vault.MetaKeys, args []string) error {
 	fs := flag.NewFlagSet("delete", flag.ContinueOnError)
 	fs.SetOutput(io.Discard)
 
@@ -561,7 +566,7 @@ func sessionDelete(database *dbpkg.DB, args []string) error {
 		return userError{msg: "unexpected positional arguments"}
 	}
 
-	if err := dbpkg.DeleteEntryBySiteAndUser(database, site, user); err != nil {
+	if err := dbpkg.DeleteEntryBySiteAndUser(database, keys, site, user); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			fmt.Fprintf(os.Stderr, "no credential found for %s/%s\n", site, user)
 			return nil
@@ -569,7 +574,7 @@ func sessionDelete(database *dbpkg.DB, args []string) error {
 		return fmt.Errorf("delete credential: %w", err)
 	}
 
-	fmt.Printf("deleted credential for %s/%s\n", site, user)
+	fmt.Printf("moved %s/%s to the trash; 'trash restore --site %s --user %s' undoes this\n", site, user, site, user)
 	return nil
 }
 
@@ -587,6 +592,44 @@ func handleSessionError(err error) {
 	fmt.Fprintf(os.Stderr, "error: %v\n", err)
 }
 
+// unlockError maps store unlock failures onto user-facing messages; failMsg is used
+// when the secret simply did not open any key slot.
+func unlockError(err error, failMsg string) error {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return userError{msg: "vault header not found; run pm master set first"}
+	case errors.Is(err, store.ErrMEKNotWrapped):
+		return userError{msg: "vault is not initialised with a master key"}
+	case errors.Is(err, store.ErrNoMatchingSlot):
+		return userError{msg: failMsg, code: exitAuthFailed}
+	case errors.Is(err, store.ErrKeyfileRequired):
+		return userError{msg: "this vault requires a keyfile; pass --keyfile <path>", code: exitAuthFailed}
+	case errors.Is(err, store.ErrRotationPending):
+		return userError{msg: "a key rotation is in progress; unlock with the password used to rotate to finish it", code: exitAuthFailed}
+	case errors.Is(err, store.ErrMEKMismatch):
+		return userError{msg: "vault database does not match the vault header key"}
+	case errors.Is(err, store.ErrHeaderTampered):
+		return userError{msg: "vault header failed its integrity check; header.json may have been tampered with"}
+	default:
+		return fmt.Errorf("unlock vault: %w", err)
+	}
+}
+
+// readKeyfile hashes the keyfile named by a --keyfile flag; an empty path means none.
+func readKeyfile(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	digest, err := krypto.HashKeyfile(path)
+	if err != nil {
+		if errors.Is(err, krypto.ErrInvalidKeyfile) {
+			return nil, userError{msg: "keyfile is empty or larger than 64 MB"}
+		}
+		return nil, userError{msg: fmt.Sprintf("cannot read keyfile: %v", err)}
+	}
+	return digest, nil
+}
+
 func promptPassword(prompt string) ([]byte, error) {
 	fmt.Fprint(os.Stderr, prompt)
 	pw, err := term.ReadPassword(int(syscall.Stdin))
@@ -607,22 +650,70 @@ func printUsage() {
 	fmt.Fprintln(os.Stderr, "Usage: pm <command>")
 	fmt.Fprintln(os.Stderr, "Commands:")
 	fmt.Fprintln(os.Stderr, "  version")
-	fmt.Fprintln(os.Stderr, "  master set --dir <vault-dir> --user <username>")
-	fmt.Fprintln(os.Stderr, "  master change --dir <vault-dir> --user <username>")
-	fmt.Fprintln(os.Stderr, "  session --dir <vault-dir>")
+	fmt.Fprintln(os.Stderr, "  master set --dir <vault-dir> --user <username> [--keyfile <path>] [--recovery]")
+	fmt.Fprintln(os.Stderr, "  master change --dir <vault-dir> --user <username> [--keyfile <path>] [--old-keyfile <path>]")
+	fmt.Fprintln(os.Stderr, "  master tune [--target 750ms] [--max-memory <MB>] [--dir <vault-dir> [--keyfile <path>]]")
+	fmt.Fprintln(os.Stderr, "  master rotate-key --dir <vault-dir> [--keyfile <path>] [--remove-slots]")
+	fmt.Fprintln(os.Stderr, "  master slot list --dir <vault-dir>")
+	fmt.Fprintln(os.Stderr, "  master slot add --dir <vault-dir> --label <label> [--keyfile <path>]")
+	fmt.Fprintln(os.Stderr, "  master slot revoke --dir <vault-dir> --id <slot-id> [--keyfile <path>]")
+	fmt.Fprintln(os.Stderr, "  recovery reset --dir <vault-dir>")
+	fmt.Fprintln(os.Stderr, "  migrate cipher --dir <vault-dir> [--to xchacha20-poly1305|aes-256-gcm] [--keyfile <path>]")
+	fmt.Fprintln(os.Stderr, "  session --dir <vault-dir> [--keyfile <path>]")
+	fmt.Fprintln(os.Stderr, "  get --dir <vault-dir> --site <website> [--user <username>] [--field <name>] [--format text|json|env]")
+	fmt.Fprintln(os.Stderr, "  list --dir <vault-dir> [--site <website>] [--format text|json]")
+	fmt.Fprintln(os.Stderr, "  add --dir <vault-dir> --site <website> --user <username> [--secret-fd <fd> | --generate [generator flags]] [entry flags] [--format text|json]")
+	fmt.Fprintln(os.Stderr, "  update --dir <vault-dir> --site <website> --user <username> [--secret-fd <fd> | --generate [generator flags]] [entry flags] [--format text|json]")
+	fmt.Fprintln(os.Stderr, "  delete --dir <vault-dir> --site <website> --user <username> [--format text|json]")
+	fmt.Fprintln(os.Stderr, "  (get/list/add/update/delete also take [--keyfile <path>] [--password-fd <fd>])")
+	fmt.Fprintln(os.Stderr, "  import --dir <vault-dir> --format chrome-csv|firefox-csv|bitwarden-json|keepass-xml|1pux|pm-archive [--dry-run] [--passphrase-fd N] <file>")
+	fmt.Fprintln(os.Stderr, "  export --dir <vault-dir> --out <file> [--passphrase-fd <fd>] [--include-trash]")
+	fmt.Fprintln(os.Stderr, "  export --dir <vault-dir> --out <file> --plaintext --confirm-plaintext [--format csv|json] [--include-trash]")
+	fmt.Fprintln(os.Stderr, "  backup --dir <vault-dir> --out <file> | --to <backup-dir> [--keep <n>]")
+	fmt.Fprintln(os.Stderr, "  restore --dir <vault-dir> [--check] [--force] <file>")
+	fmt.Fprintln(os.Stderr, "  doctor --dir <vault-dir> [--repair] [--format text|json] [--keyfile <path>] [--password-fd <fd>]")
+	fmt.Fprintln(os.Stderr, "  audit --dir <vault-dir> [--min-score <n>] [--max-age 365d] [--hibp] [--format text|json]")
+	fmt.Fprintln(os.Stderr, "  generate [--length <n>] [--no-lower|--no-upper|--no-digits|--no-symbols] [--no-ambiguous] [--rules <passwordrules>]")
+	fmt.Fprintln(os.Stderr, "           [--site <website> --dir <vault-dir>] [--passphrase [--words <n>] [--separator <s>]] [--format text|json]")
+	fmt.Fprintln(os.Stderr, "  totp --dir <vault-dir> --site <website> [--user <username>] [--format text|json]")
+	fmt.Fprintln(os.Stderr, "  totp add|delete --dir <vault-dir> --site <website> --user <username> [--uri-fd <fd>]")
+	fmt.Fprintln(os.Stderr, "  hibp build-filter --in <sha1-file> --out <filter> [--fp-rate 0.001] [--format text|json]")
+	fmt.Fprintln(os.Stderr, "  domains list [--custom] [--format text|json]")
+	fmt.Fprintln(os.Stderr, "  domains add --name <group> --domain <domain> [--domain <domain>...]")
+	fmt.Fprintln(os.Stderr, "  domains remove --name <group> [--domain <domain>...]")
+	fmt.Fprintln(os.Stderr, "  agent start --dir <vault-dir> [--keyfile <path>] [--password-fd <fd>] [--idle 10m] [--socket <path>]")
+	fmt.Fprintln(os.Stderr, "  agent unlock|status|lock|stop|serve [--socket <path>]")
 }
 
 func printMasterUsage() {
-	fmt.Fprintln(os.Stderr, "Usage: pm master <set|change> --dir <vault-dir> --user <username>")
+	fmt.Fprintln(os.Stderr, "Usage: pm master <set|change> --dir <vault-dir> --user <username> [--keyfile <path>]")
+	fmt.Fprintln(os.Stderr, "       pm master tune [--target 750ms] [--max-memory <MB>] [--dir <vault-dir> [--keyfile <path>]]")
+	fmt.Fprintln(os.Stderr, "       pm master rotate-key --dir <vault-dir> [--keyfile <path>] [--remove-slots]")
+	fmt.Fprintln(os.Stderr, "       pm master slot <list|add|revoke> --dir <vault-dir> [--label <label>] [--id <slot-id>] [--keyfile <path>]")
 }
 
 func printSessionHelp() {
 	fmt.Println("Commands:")
-	fmt.Println("  add --site <website> --user <username> [--type password]")
-	fmt.Println("  get --site <website> [--user <username>]")
-	fmt.Println("  update --site <website> --user <username> [--type password]")
+	fmt.Println("  add --site <website> --user <username> [--type password] [--generate [generator flags]] [entry flags]")
+	fmt.Println("  get --site <website> [--user <username>] [--reveal]")
+	fmt.Println("  update --site <website> --user <username> [--type password] [--generate [generator flags]] [entry flags]")
+	fmt.Println("       [--remove-url <url>] [--remove-tag <tag>] [--remove-field <name>]")
 	fmt.Println("  delete --site <website> --user <username>")
+	fmt.Println("  totp --site <website> [--user <username>]")
+	fmt.Println("  totp add|delete --site <website> --user <username>")
+	fmt.Println("  history --site <website> --user <username> [--reveal]")
+	fmt.Println("  restore --site <website> --user <username> --version <n>")
+	fmt.Println("  retention [--keep <n>]")
+	fmt.Println("  trash list")
+	fmt.Println("  trash restore --site <website> --user <username>")
+	fmt.Println("  trash purge [--older-than 30d] [--yes]")
 	fmt.Println("  exit | quit")
+	fmt.Println("Entry flags (repeatable unless noted; quote values with spaces):")
+	fmt.Println("  --notes <text> (once)  --folder <path> (once)  --url <url>  --tag <tag>")
+	fmt.Println("  --field name=value  --hidden <name> (value prompted)  --bool name=true|false")
+	fmt.Println("Generator flags (as for pm generate):")
+	fmt.Println("  --length <n>  --no-lower  --no-upper  --no-digits  --no-symbols  --no-ambiguous")
+	fmt.Println("  --rules <passwordrules>  --passphrase  --words <n>  --separator <s>  --capitalize")
 }
 
 func runMasterChange(args []string) error {
@@ -631,8 +722,12 @@ func runMasterChange(args []string) error {
 
 	var dir string
 	var user string
+	var keyfilePath string
+	var oldKeyfilePath string
 	fs.StringVar(&dir, "dir", "", "vault directory")
 	fs.StringVar(&user, "user", "", "vault username")
+	fs.StringVar(&keyfilePath, "keyfile", "", "keyfile required with the new password")
+	fs.StringVar(&oldKeyfilePath, "old-keyfile", "", "keyfile currently required (defaults to --keyfile)")
 
 	if err := fs.Parse(args); err != nil {
 		return userError{msg: "invalid arguments"}
@@ -643,31 +738,22 @@ func runMasterChange(args []string) error {
 	if fs.NArg() != 0 {
 		return userError{msg: "unexpected positional arguments"}
 	}
+	if oldKeyfilePath == "" {
+		oldKeyfilePath = keyfilePath
+	}
 
 	paths := store.Paths{Dir: dir}
-	hdr, err := store.LoadVaultHeader(paths)
-	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return userError{msg: "vault header not found; run pm master set first"}
-		}
-		return fmt.Errorf("load header: %w", err)
-	}
-	if hdr.KDF.Name != "argon2id" || hdr.Salt == "" {
-		return userError{msg: "vault header missing required fields"}
-	}
 
-	oldSalt, err := base64.StdEncoding.DecodeString(hdr.Salt)
+	oldKeyfile, err := readKeyfile(oldKeyfilePath)
 	if err != nil {
-		return fmt.Errorf("decode header salt: %w", err)
+		return err
 	}
-
-	params := krypto.Argon2Params{
-		MemoryMB:    hdr.KDF.MemoryMB,
-		Time:        hdr.KDF.Time,
-		Parallelism: hdr.KDF.Parallelism,
-		SaltLen:     hdr.KDF.SaltLen,
-		KeyLen:      hdr.KDF.KeyLen,
+	defer zeroBytes(oldKeyfile)
+	newKeyfile, err := readKeyfile(keyfilePath)
+	if err != nil {
+		return err
 	}
+	defer zeroBytes(newKeyfile)
 
 	oldPw, err := promptPassword("Old master password: ")
 	if err != nil {
@@ -675,21 +761,15 @@ func runMasterChange(args []string) error {
 	}
 	defer zeroBytes(oldPw)
 
-	oldPDK, err := krypto.DeriveKeyArgon2id(oldPw, oldSalt, params)
+	mek, hdrCurrent, slotID, err := store.UnlockMEK(paths, oldPw, oldKeyfile)
 	if err != nil {
-		return userError{msg: "failed to verify existing password"}
-	}
-	defer zeroBytes(oldPDK)
-
-	mek, hdrCurrent, err := store.LoadAndUnwrapMEK(paths, oldPDK)
-	if err != nil {
-		if errors.Is(err, store.ErrMEKNotWrapped) {
-			return userError{msg: "vault is not initialised with a master key"}
-		}
-		return userError{msg: "failed to verify existing password"}
+		return unlockError(err, "failed to verify existing password")
 	}
 	defer zeroBytes(mek)
 
+	slot, _ := hdrCurrent.Slot(slotID)
+	params := slot.KDF.Argon2Params()
+
 	newPw, err := promptPassword("New master password: ")
 	if err != nil {
 		return fmt.Errorf("read new master password: %w", err)
@@ -706,13 +786,8 @@ func runMasterChange(args []string) error {
 		return userError{msg: "passwords do not match"}
 	}
 
-	ctx := context.Background()
-	opts := auth.DefaultValidateOptions()
-	opts.EnableHIBP = true
-	opts.MinZXCVBNScore = 3
-
-	if err := auth.ValidateMasterPasswordAdvanced(ctx, string(newPw), opts); err != nil {
-		return userError{msg: err.Error()}
+	if err := checkMasterPassword(paths, user, newPw); err != nil {
+		return err
 	}
 
 	newSalt, err := krypto.NewRandomSalt(params.SaltLen)
@@ -720,16 +795,16 @@ func runMasterChange(args []string) error {
 		return fmt.Errorf("generate new salt: %w", err)
 	}
 
-	newPDK, err := krypto.DeriveKeyArgon2id(newPw, newSalt, params)
+	kdf := vault.NewArgon2KDFConfig(params)
+	kdf.Keyfile = newKeyfile != nil
+
+	newPDK, err := store.DerivePassphraseKey(kdf, newPw, newSalt, newKeyfile)
 	if err != nil {
 		return fmt.Errorf("derive new key: %w", err)
 	}
 	defer zeroBytes(newPDK)
 
-	hdrCurrent.Salt = base64.StdEncoding.EncodeToString(newSalt)
-	hdrCurrent.KDF.Name = "argon2id"
-
-	if err := store.RewrapMEK(paths, hdrCurrent, newPDK, mek); err != nil {
+	if _, err := store.RewrapKeySlot(paths, hdrCurrent, slotID, kdf, newSalt, newPDK, mek); err != nil {
 		return fmt.Errorf("rewrap mek: %w", err)
 	}
 
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Hussein-Mazeh/PasswordManager/auth"
+	"github.com/Hussein-Mazeh/PasswordManager/store"
+)
+
+// checkMasterPassword holds a new master password to the vault's password policy and
+// prints the warnings that do not refuse it.
+func checkMasterPassword(paths store.Paths, user string, pw []byte) error {
+	_, opts, err := store.PasswordOptions(paths, user, "")
+	if err != nil {
+		return userError{msg: err.Error()}
+	}
+	violations, warnings := auth.CheckPassword(context.Background(), string(pw), opts)
+	printPolicyWarnings(warnings)
+	if len(violations) > 0 {
+		return userError{msg: (&auth.PolicyError{Violations: violations}).Error()}
+	}
+	return nil
+}
+
+// checkEntryPassword holds an entry password to the policy's entries mode, printing
+// warnings and refusing the password under block.
+func checkEntryPassword(dir, site, user, pw string) error {
+	warnings, err := store.CheckEntryPassword(context.Background(), store.Paths{Dir: dir}, site, user, pw)
+	printPolicyWarnings(warnings)
+	if err != nil {
+		var perr *auth.PolicyError
+		if errors.As(err, &perr) {
+			return userError{msg: "password policy: " + perr.Error()}
+		}
+		return userError{msg: err.Error()}
+	}
+	return nil
+}
+
+func printPolicyWarnings(warnings []auth.Violation) {
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w.Message)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+	"github.com/Hussein-Mazeh/PasswordManager/store"
+)
+
+func runRecovery(args []string) error {
+	if len(args) == 0 {
+		return userError{msg: "missing recovery subcommand"}
+	}
+
+	switch args[0] {
+	case "reset":
+		return runRecoveryReset(args[1:])
+	default:
+		return userError{msg: "unknown recovery subcommand"}
+	}
+}
+
+// issueRecoveryCode generates a recovery code, wraps the MEK under it, and prints it once.
+// Any previous recovery code stops working.
+func issueRecoveryCode(paths store.Paths, hdr vault.VaultHeader, mek []byte) error {
+	code, entropy, err := krypto.NewRecoveryCode()
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(entropy)
+
+	slot, err := store.WrapRecoverySlot(entropy, mek)
+	if err != nil {
+		return fmt.Errorf("wrap recovery slot: %w", err)
+	}
+	if _, err := store.SetRecoverySlot(paths, hdr, slot, mek); err != nil {
+		return fmt.Errorf("persist recovery slot: %w", err)
+	}
+
+	fmt.Println()
+	fmt.Println("Recovery code (shown once; print it or store it offline):")
+	fmt.Println()
+	fmt.Printf("    %s\n", code)
+	fmt.Println()
+	fmt.Println("Anyone holding this code can reset the master password.")
+	return nil
+}
+
+// runRecoveryReset sets a new master password using the printable recovery code.
+//
+// Args:
+//
+//	args: CLI arguments slice. Supported flags:
+//	  --dir (string, required): Vault directory path.
+//
+// Behavior:
+//   - Reads the recovery code from the terminal and unwraps the MEK from the recovery slot.
+//   - Prompts for and validates a new master password with the master password policy.
+//   - Rewraps the master password slot (re-creating it if it was revoked); other slots
+//     and the recovery code itself remain valid.
+func runRecoveryReset(args []string) error {
+	fs := flag.NewFlagSet("recovery reset", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var dir string
+	fs.StringVar(&dir, "dir", "", "vault directory")
+
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid arguments"}
+	}
+	if dir == "" {
+		return userError{msg: "missing required flag: --dir"}
+	}
+	if fs.NArg() != 0 {
+		return userError{msg: "unexpected positional arguments"}
+	}
+
+	paths := store.Paths{Dir: dir}
+
+	fmt.Fprint(os.Stderr, "Recovery code: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("read recovery code: %w", err)
+	}
+
+	mek, hdr, err := store.UnlockRecovery(paths, strings.TrimSpace(line))
+	if err != nil {
+		switch {
+		case errors.Is(err, krypto.ErrInvalidRecoveryCode):
+			return userError{msg: "recovery code is malformed; check for typos"}
+		case errors.Is(err, store.ErrNoRecovery):
+			return userError{msg: "this vault has no recovery code"}
+		default:
+			return unlockError(err, "recovery code does not match this vault")
+		}
+	}
+	defer zeroBytes(mek)
+
+	newPw, err := promptPassword("New master password: ")
+	if err != nil {
+		return fmt.Errorf("read new master password: %w", err)
+	}
+	defer zeroBytes(newPw)
+
+	confirmPw, err := promptPassword("Confirm new master password: ")
+	if err != nil {
+		return fmt.Errorf("read confirmation password: %w", err)
+	}
+	defer zeroBytes(confirmPw)
+
+	if !bytes.Equal(newPw, confirmPw) {
+		return userError{msg: "passwords do not match"}
+	}
+
+	if err := checkMasterPassword(paths, hdr.User, newPw); err != nil {
+		return err
+	}
+
+	params := krypto.DefaultArgon2Params()
+	params.SaltLen = krypto.SaltLengthBytes
+
+	salt, err := krypto.NewRandomSalt(params.SaltLen)
+	if err != nil {
+		return fmt.Errorf("generate salt: %w", err)
+	}
+
+	pdk, err := krypto.DeriveKeyArgon2id(newPw, salt, params)
+	if err != nil {
+		return fmt.Errorf("derive key: %w", err)
+	}
+	defer zeroBytes(pdk)
+
+	if _, err := store.ReplaceMasterSlot(paths, hdr, vault.NewArgon2KDFConfig(params), salt, pdk, mek); err != nil {
+		return fmt.Errorf("rewrap mek: %w", err)
+	}
+
+	fmt.Println("master password reset; the recovery code remains valid")
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	pmsvc "github.com/Hussein-Mazeh/PasswordManager/internal/service"
+)
+
+// runMasterRotateKey replaces the vault MEK and re-encrypts every entry under it.
+//
+// Args:
+//
+//	args: CLI arguments slice. Supported flags:
+//	  --dir (string, required): Vault directory path.
+//	  --keyfile (string, optional): Keyfile for vaults that require one; it stays required.
+//	  --remove-slots (bool, optional): Agree to removing the other key slots.
+//
+// Behavior:
+//   - Prompts for the master password (or any slot passphrase) and delegates to
+//     Service.RotateMEK, which stages the new key, re-encrypts rows in one transaction,
+//     and swaps the header last.
+//   - Other key slots wrap the old MEK and are removed. Without --remove-slots they are
+//     listed and nothing changes; with it, the removed slots are listed afterwards.
+//   - A vault with a recovery code gets a new one, printed once; the old code stops working.
+func runMasterRotateKey(args []string) error {
+	fs := flag.NewFlagSet("master rotate-key", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var dir string
+	var keyfilePath string
+	var removeSlots bool
+	fs.StringVar(&dir, "dir", "", "vault directory")
+	fs.StringVar(&keyfilePath, "keyfile", "", "keyfile for vaults that require one")
+	fs.BoolVar(&removeSlots, "remove-slots", false, "agree to removing the other key slots")
+
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid arguments"}
+	}
+	if dir == "" {
+		return userError{msg: "missing required flag: --dir"}
+	}
+	if fs.NArg() != 0 {
+		return userError{msg: "unexpected positional arguments"}
+	}
+	if err := ensureVaultDir(dir); err != nil {
+		return err
+	}
+	// Read the keyfile up front so a bad path is reported before the password prompt.
+	if _, err := readKeyfile(keyfilePath); err != nil {
+		return err
+	}
+
+	pw, err := promptPassword("Enter master password: ")
+	if err != nil {
+		return fmt.Errorf("read master password: %w", err)
+	}
+	defer zeroBytes(pw)
+
+	svc, err := pmsvc.New(dir)
+	if err != nil {
+		return fmt.Errorf("open vault: %w", err)
+	}
+	defer svc.Close()
+
+	result, err := svc.RotateMEK(string(pw), keyfilePath, removeSlots)
+	if err != nil {
+		var slotsErr *pmsvc.RotationRemovesSlotsError
+		if errors.As(err, &slotsErr) {
+			return userError{msg: slotsErr.Error() + ", which wrap the old key; nothing was changed. Re-run with --remove-slots to rotate anyway"}
+		}
+		var uerr userError
+		if errors.As(unlockError(err, "failed to verify master password"), &uerr) {
+			return uerr
+		}
+		return fmt.Errorf("rotate key: %w", err)
+	}
+
+	fmt.Println("MEK rotated; all entries re-encrypted")
+	for _, slot := range result.RemovedSlots {
+		fmt.Printf("removed key slot %d (%s); re-create it with pm master slot add\n", slot.ID, slot.Label)
+	}
+	if result.RecoveryCode != "" {
+		fmt.Println()
+		fmt.Println("The old recovery code no longer works. New recovery code (shown once; print it or store it offline):")
+		fmt.Println()
+		fmt.Printf("    %s\n", result.RecoveryCode)
+		fmt.Println()
+		fmt.Println("Anyone holding this code can reset the master password.")
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+	"github.com/Hussein-Mazeh/PasswordManager/store"
+)
+
+func runMasterSlot(args []string) error {
+	if len(args) == 0 {
+		return userError{msg: "missing slot subcommand"}
+	}
+
+	switch args[0] {
+	case "list":
+		return runSlotList(args[1:])
+	case "add":
+		return runSlotAdd(args[1:])
+	case "revoke":
+		return runSlotRevoke(args[1:])
+	default:
+		return userError{msg: "unknown slot subcommand"}
+	}
+}
+
+func runSlotList(args []string) error {
+	fs := flag.NewFlagSet("master slot list", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var dir string
+	fs.StringVar(&dir, "dir", "", "vault directory")
+
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid arguments"}
+	}
+	if dir == "" {
+		return userError{msg: "missing required flag: --dir"}
+	}
+	if fs.NArg() != 0 {
+		return userError{msg: "unexpected positional arguments"}
+	}
+
+	slots, err := store.ListKeySlots(store.Paths{Dir: dir})
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return userError{msg: "vault header not found; run pm master set first"}
+		}
+		return fmt.Errorf("load header: %w", err)
+	}
+	if len(slots) == 0 {
+		fmt.Println("no key slots")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tLABEL\tCREATED\tKDF")
+	for _, slot := range slots {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s m=%dMB t=%d p=%d\n",
+			slot.ID, slot.Label, slot.CreatedAt.Format("2006-01-02 15:04"),
+			slot.KDF.Name, slot.KDF.MemoryMB, slot.KDF.Time, slot.KDF.Parallelism)
+	}
+	return w.Flush()
+}
+
+// runSlotAdd wraps the vault MEK under an additional passphrase.
+//
+// Args:
+//
+//	args: CLI arguments slice. Supported flags:
+//	  --dir   (string, required): Vault directory path.
+//	  --label (string, required): Human-readable name for the new slot.
+//	  --keyfile (string, optional): Keyfile for unlocking the existing slot. The new slot
+//	            does not require a keyfile.
+//
+// Behavior:
+//   - Unlocks the MEK with any existing secret; the new passphrase never sees the old one.
+//   - Validates the new passphrase with the master password policy.
+//   - Derives a PDK with a fresh salt and default Argon2id parameters and appends the slot.
+func runSlotAdd(args []string) error {
+	fs := flag.NewFlagSet("master slot add", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var dir string
+	var label string
+	var keyfilePath string
+	fs.StringVar(&dir, "dir", "", "vault directory")
+	fs.StringVar(&label, "label", "", "slot label")
+	fs.StringVar(&keyfilePath, "keyfile", "", "keyfile for the existing slot")
+
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid arguments"}
+	}
+	if dir == "" || label == "" {
+		return userError{msg: "missing required flags: --dir and --label"}
+	}
+	if fs.NArg() != 0 {
+		return userError{msg: "unexpected positional arguments"}
+	}
+
+	paths := store.Paths{Dir: dir}
+
+	keyfile, err := readKeyfile(keyfilePath)
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(keyfile)
+
+	current, err := promptPassword("Existing master password or passphrase: ")
+	if err != nil {
+		return fmt.Errorf("read existing password: %w", err)
+	}
+	defer zeroBytes(current)
+
+	mek, hdr, _, err := store.UnlockMEK(paths, current, keyfile)
+	if err != nil {
+		return unlockError(err, "failed to verify existing password")
+	}
+	defer zeroBytes(mek)
+
+	pw, err := promptPassword("New passphrase: ")
+	if err != nil {
+		return fmt.Errorf("read new passphrase: %w", err)
+	}
+	defer zeroBytes(pw)
+
+	confirm, err := promptPassword("Confirm new passphrase: ")
+	if err != nil {
+		return fmt.Errorf("read confirmation passphrase: %w", err)
+	}
+	defer zeroBytes(confirm)
+
+	if !bytes.Equal(pw, confirm) {
+		return userError{msg: "passwords do not match"}
+	}
+
+	if err := checkMasterPassword(paths, hdr.User, pw); err != nil {
+		return err
+	}
+
+	params := krypto.DefaultArgon2Params()
+	params.SaltLen = krypto.SaltLengthBytes
+
+	salt, err := krypto.NewRandomSalt(params.SaltLen)
+	if err != nil {
+		return fmt.Errorf("generate salt: %w", err)
+	}
+
+	pdk, err := krypto.DeriveKeyArgon2id(pw, salt, params)
+	if err != nil {
+		return fmt.Errorf("derive key: %w", err)
+	}
+	defer zeroBytes(pdk)
+
+	slot, err := store.WrapKeySlot(label, vault.NewArgon2KDFConfig(params), salt, pdk, mek)
+	if err != nil {
+		return fmt.Errorf("wrap mek: %w", err)
+	}
+
+	_, id, err := store.AddKeySlot(paths, hdr, slot, mek)
+	if err != nil {
+		return fmt.Errorf("add key slot: %w", err)
+	}
+
+	fmt.Printf("added key slot %d (%s)\n", id, label)
+	return nil
+}
+
+func runSlotRevoke(args []string) error {
+	fs := flag.NewFlagSet("master slot revoke", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var dir string
+	var id int
+	var keyfilePath string
+	fs.StringVar(&dir, "dir", "", "vault directory")
+	fs.IntVar(&id, "id", -1, "slot ID to revoke")
+	fs.StringVar(&keyfilePath, "keyfile", "", "keyfile for the existing slot")
+
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid arguments"}
+	}
+	if dir == "" || id < 0 {
+		return userError{msg: "missing required flags: --dir and --id"}
+	}
+	if fs.NArg() != 0 {
+		return userError{msg: "unexpected positional arguments"}
+	}
+
+	paths := store.Paths{Dir: dir}
+
+	keyfile, err := readKeyfile(keyfilePath)
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(keyfile)
+
+	current, err := promptPassword("Existing master password or passphrase: ")
+	if err != nil {
+		return fmt.Errorf("read existing password: %w", err)
+	}
+	defer zeroBytes(current)
+
+	mek, hdr, _, err := store.UnlockMEK(paths, current, keyfile)
+	if err != nil {
+		return unlockError(err, "failed to verify existing password")
+	}
+	defer zeroBytes(mek)
+
+	if _, err := store.RevokeKeySlot(paths, hdr, id, mek); err != nil {
+		switch {
+		case errors.Is(err, store.ErrSlotNotFound):
+			return userError{msg: fmt.Sprintf("no key slot with id %d", id)}
+		case errors.Is(err, store.ErrLastSlot):
+			return userError{msg: "cannot revoke the last key slot"}
+		default:
+			return fmt.Errorf("revoke key slot: %w", err)
+		}
+	}
+
+	fmt.Printf("revoked key slot %d\n", id)
+	return nil
+}
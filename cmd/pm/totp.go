@@ -0,0 +1,348 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	dbpkg "github.com/Hussein-Mazeh/PasswordManager/internal/db"
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+)
+
+// totpCode is one account's current one-time code.
+type totpCode struct {
+	Website          string `json:"website"`
+	Username         string `json:"username"`
+	Code             string `json:"code"`
+	Digits           int    `json:"digits"`
+	Period           int    `json:"period"`
+	RemainingSeconds int    `json:"remaining_seconds"`
+}
+
+// openTOTP decrypts a TOTP entry and parses the otpauth URI it holds.
+func openTOTP(database *dbpkg.DB, mek []byte, row *dbpkg.EntryRow) (krypto.TOTP, error) {
+	payload, err := openSessionEntry(database, mek, row)
+	if err != nil {
+		return krypto.TOTP{}, err
+	}
+	key, err := krypto.ParseOTPAuthURI(payload.Password)
+	if err != nil {
+		return krypto.TOTP{}, fmt.Errorf("stored TOTP key for %s/%s: %w", row.Website, row.Username, err)
+	}
+	return key, nil
+}
+
+// totpCodes returns the current codes for site, or for one account when user is set.
+func totpCodes(database *dbpkg.DB, mek []byte, keys *vault.MetaKeys, site, user string) ([]totpCode, error) {
+	var rows []dbpkg.EntryRow
+	if user != "" {
+		row, err := dbpkg.GetTOTPBySiteAndUser(database, keys, site, user)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, userError{msg: fmt.Sprintf("no TOTP key stored for %s/%s", site, user), code: exitNotFound}
+			}
+			return nil, fmt.Errorf("fetch TOTP key: %w", err)
+		}
+		rows = []dbpkg.EntryRow{*row}
+	} else {
+		var err error
+		if rows, err = dbpkg.GetTOTPByWebsite(database, keys, site); err != nil {
+			return nil, fmt.Errorf("fetch TOTP keys: %w", err)
+		}
+		if len(rows) == 0 {
+			return nil, userError{msg: fmt.Sprintf("no TOTP keys stored for %s", site), code: exitNotFound}
+		}
+	}
+
+	now := time.Now()
+	out := make([]totpCode, 0, len(rows))
+	for i := range rows {
+		key, err := openTOTP(database, mek, &rows[i])
+		if err != nil {
+			return nil, err
+		}
+		code, err := key.Code(now)
+		if err != nil {
+			return nil, fmt.Errorf("TOTP for %s/%s: %w", rows[i].Website, rows[i].Username, err)
+		}
+		out = append(out, totpCode{
+			Website:          rows[i].Website,
+			Username:         rows[i].Username,
+			Code:             code,
+			Digits:           key.Digits,
+			Period:           key.Period,
+			RemainingSeconds: int(key.Remaining(now).Round(time.Second) / time.Second),
+		})
+	}
+	return out, nil
+}
+
+// storeTOTP saves input, an otpauth URI or a bare Base32 secret, as the TOTP entry of
+// site/user. The key is stored as a normalized otpauth URI so every client reads it back
+// the same way.
+func storeTOTP(database *dbpkg.DB, mek []byte, keys *vault.MetaKeys, suite krypto.Suite, site, user string, input []byte) (int64, error) {
+	key, err := krypto.ParseOTPKey(string(input), site, user)
+	if err != nil {
+		return 0, userError{msg: err.Error()}
+	}
+	if _, err := dbpkg.GetTOTPBySiteAndUser(database, keys, site, user); err == nil {
+		return 0, userError{msg: fmt.Sprintf("%s/%s already has a TOTP key; delete it first", site, user)}
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("fetch TOTP key: %w", err)
+	}
+
+	plain, format, err := vault.EncodePayload(vault.EntryPayload{Password: key.URI()})
+	if err != nil {
+		return 0, userError{msg: err.Error()}
+	}
+	salt, blob, err := vault.EncryptEntryPassword(mek, suite, site, user, vault.TypeTOTP, plain)
+	if err != nil {
+		return 0, fmt.Errorf("encrypt TOTP key: %w", err)
+	}
+	id, err := dbpkg.InsertEntry(database, keys, site, user, vault.TypeTOTP, suite, format, salt, blob)
+	if err != nil {
+		if errors.Is(err, dbpkg.ErrEntryInTrash) {
+			return 0, userError{msg: fmt.Sprintf("the TOTP key for %s/%s is in the trash; restore or purge it first", site, user)}
+		}
+		return 0, fmt.Errorf("store TOTP key: %w", err)
+	}
+	return id, nil
+}
+
+// runTOTP prints one-time codes or, with add and delete, manages the stored TOTP keys.
+//
+// Args:
+//
+//	args: CLI arguments slice. Forms:
+//	  totp --dir --site [--user] [--format text|json]
+//	  totp add --dir --site --user [--uri-fd <fd>] [--format text|json]
+//	  totp delete --dir --site --user [--format text|json]
+//	  (all take --keyfile and --password-fd as well)
+//
+// Behavior:
+//  1. A TOTP key is an entry of type totp beside the account's password entry; its
+//     payload is the otpauth:// URI, encrypted like any other secret.
+//  2. Text output for one account is the bare code on stdout, with the seconds it stays
+//     valid on stderr, so $(pm totp ...) works in scripts.
+//  3. Exits with exitNotFound when no key is stored.
+func runTOTP(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "add":
+			return runTOTPAdd(args[1:])
+		case "delete":
+			return runTOTPDelete(args[1:])
+		}
+	}
+
+	fs := flag.NewFlagSet("totp", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var uf unlockFlags
+	var site, user, format string
+	uf.register(fs)
+	fs.StringVar(&site, "site", "", "website identifier")
+	fs.StringVar(&user, "user", "", "username")
+	fs.StringVar(&format, "format", formatText, "output format: text or json")
+
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid arguments"}
+	}
+	if site == "" {
+		return userError{msg: "missing required flag: --site"}
+	}
+	if fs.NArg() != 0 {
+		return userError{msg: "unexpected positional arguments"}
+	}
+	if err := checkFormat(format, formatText, formatJSON); err != nil {
+		return err
+	}
+
+	u, err := uf.unlock()
+	if err != nil {
+		return err
+	}
+	defer u.Close()
+
+	codes, err := totpCodes(u.database, u.mek, u.keys, site, user)
+	if err != nil {
+		return err
+	}
+	if format == formatJSON {
+		if user != "" {
+			return writeJSON(codes[0])
+		}
+		return writeJSON(codes)
+	}
+	if len(codes) == 1 {
+		fmt.Println(codes[0].Code)
+		fmt.Fprintf(os.Stderr, "valid for %ds\n", codes[0].RemainingSeconds)
+		return nil
+	}
+	for _, c := range codes {
+		fmt.Printf("%s\t%s\t%ds\n", c.Username, c.Code, c.RemainingSeconds)
+	}
+	return nil
+}
+
+// runTOTPAdd stores a TOTP key read from --uri-fd or a terminal prompt.
+func runTOTPAdd(args []string) error {
+	fs := flag.NewFlagSet("totp add", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var uf unlockFlags
+	var site, user, format string
+	var uriFD int
+	uf.register(fs)
+	fs.StringVar(&site, "site", "", "website identifier")
+	fs.StringVar(&user, "user", "", "username")
+	fs.IntVar(&uriFD, "uri-fd", -1, "read the otpauth URI or Base32 secret from this file descriptor")
+	fs.StringVar(&format, "format", formatText, "output format: text or json")
+
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid arguments"}
+	}
+	if site == "" || user == "" {
+		return userError{msg: "missing required flags: --site and --user"}
+	}
+	if fs.NArg() != 0 {
+		return userError{msg: "unexpected positional arguments"}
+	}
+	if err := checkFormat(format, formatText, formatJSON); err != nil {
+		return err
+	}
+
+	u, err := uf.unlock()
+	if err != nil {
+		return err
+	}
+	defer u.Close()
+
+	var input []byte
+	if uriFD >= 0 {
+		input, err = readSecretFD(uriFD, "--uri-fd")
+	} else {
+		input, err = readEntrySecret(-1, "otpauth URI or secret: ", false)
+	}
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(input)
+	if len(input) == 0 {
+		return userError{msg: "no TOTP key given; pass --uri-fd or run on a terminal"}
+	}
+
+	id, err := storeTOTP(u.database, u.mek, u.keys, u.suite, site, user, input)
+	if err != nil {
+		return err
+	}
+	row := dbpkg.EntryRow{ID: id, Website: site, Username: user}
+	return writeResult(format, "totp add", row, fmt.Sprintf("stored TOTP key for %s/%s (id=%d)", site, user, id))
+}
+
+// runTOTPDelete moves a TOTP key to the trash, leaving the account's password alone.
+func runTOTPDelete(args []string) error {
+	fs := flag.NewFlagSet("totp delete", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var uf unlockFlags
+	var site, user, format string
+	uf.register(fs)
+	fs.StringVar(&site, "site", "", "website identifier")
+	fs.StringVar(&user, "user", "", "username")
+	fs.StringVar(&format, "format", formatText, "output format: text or json")
+
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid arguments"}
+	}
+	if site == "" || user == "" {
+		return userError{msg: "missing required flags: --site and --user"}
+	}
+	if fs.NArg() != 0 {
+		return userError{msg: "unexpected positional arguments"}
+	}
+	if err := checkFormat(format, formatText, formatJSON); err != nil {
+		return err
+	}
+
+	u, err := uf.unlock()
+	if err != nil {
+		return err
+	}
+	defer u.Close()
+
+	row, err := dbpkg.GetTOTPBySiteAndUser(u.database, u.keys, site, user)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return userError{msg: fmt.Sprintf("no TOTP key stored for %s/%s", site, user), code: exitNotFound}
+		}
+		return fmt.Errorf("fetch TOTP key: %w", err)
+	}
+	if err := dbpkg.DeleteTOTP(u.database, u.keys, site, user); err != nil {
+		return fmt.Errorf("delete TOTP key: %w", err)
+	}
+	return writeResult(format, "totp delete", *row, fmt.Sprintf("moved the TOTP key for %s/%s to the trash", site, user))
+}
+
+// sessionTOTP is the session form of pm totp: "totp --site [--user]" prints codes,
+// "totp add" prompts for the key and "totp delete" trashes it.
+func sessionTOTP(database *dbpkg.DB, mek []byte, keys *vault.MetaKeys, suite krypto.Suite, args []string) error {
+	action := "code"
+	if len(args) > 0 && (args[0] == "add" || args[0] == "delete") {
+		action, args = args[0], args[1:]
+	}
+
+	fs := flag.NewFlagSet("totp", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var site, user string
+	fs.StringVar(&site, "site", "", "website identifier")
+	fs.StringVar(&user, "user", "", "username")
+
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid totp arguments"}
+	}
+	if site == "" || (action != "code" && user == "") {
+		return userError{msg: "totp requires --site (and --user for add and delete)"}
+	}
+	if fs.NArg() != 0 {
+		return userError{msg: "unexpected positional arguments"}
+	}
+
+	switch action {
+	case "add":
+		input, err := promptPassword("otpauth URI or secret: ")
+		if err != nil {
+			return fmt.Errorf("read TOTP key: %w", err)
+		}
+		defer zeroBytes(input)
+		id, err := storeTOTP(database, mek, keys, suite, site, user, input)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("stored TOTP key for %s/%s (id=%d)\n", site, user, id)
+	case "delete":
+		if err := dbpkg.DeleteTOTP(database, keys, site, user); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				fmt.Fprintf(os.Stderr, "no TOTP key stored for %s/%s\n", site, user)
+				return nil
+			}
+			return fmt.Errorf("delete TOTP key: %w", err)
+		}
+		fmt.Printf("moved the TOTP key for %s/%s to the trash\n", site, user)
+	default:
+		codes, err := totpCodes(database, mek, keys, site, user)
+		if err != nil {
+			return err
+		}
+		for _, c := range codes {
+			fmt.Printf("%s\t%s\t(%ds left)\n", c.Username, c.Code, c.RemainingSeconds)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	dbpkg "github.com/Hussein-Mazeh/PasswordManager/internal/db"
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+	"github.com/Hussein-Mazeh/PasswordManager/store"
+)
+
+func sessionTrash(database *dbpkg.DB, keys *vault.MetaKeys, args []string) error {
+	if len(args) == 0 {
+		return userError{msg: "missing trash subcommand (list, restore, purge)"}
+	}
+
+	switch args[0] {
+	case "list":
+		return sessionTrashList(database, keys, args[1:])
+	case "restore":
+		return sessionTrashRestore(database, keys, args[1:])
+	case "purge":
+		return sessionTrashPurge(database, keys, args[1:])
+	default:
+		return userError{msg: "unknown trash subcommand"}
+	}
+}
+
+func sessionTrashList(database *dbpkg.DB, keys *vault.MetaKeys, args []string) error {
+	if len(args) != 0 {
+		return userError{msg: "unexpected arguments"}
+	}
+
+	rows, err := dbpkg.ListTrash(database, keys)
+	if err != nil {
+		return fmt.Errorf("list trash: %w", err)
+	}
+	if len(rows) == 0 {
+		fmt.Println("trash is empty")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "WEBSITE\tUSERNAME\tDELETED")
+	for _, r := range rows {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r.Website, r.Username, r.DeletedAt)
+	}
+	return w.Flush()
+}
+
+func sessionTrashRestore(database *dbpkg.DB, keys *vault.MetaKeys, args []string) error {
+	fs := flag.NewFlagSet("trash restore", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var site string
+	var user string
+	fs.StringVar(&site, "site", "", "website identifier")
+	fs.StringVar(&user, "user", "", "username")
+
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid trash restore arguments"}
+	}
+	if site == "" || user == "" {
+		return userError{msg: "trash restore requires --site and --user"}
+	}
+	if fs.NArg() != 0 {
+		return userError{msg: "unexpected positional arguments"}
+	}
+
+	if err := dbpkg.RestoreTrashed(database, keys, site, user); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return userError{msg: fmt.Sprintf("no trashed credential for %s/%s", site, user)}
+		}
+		return fmt.Errorf("restore credential: %w", err)
+	}
+
+	fmt.Printf("restored %s/%s from the trash\n", site, user)
+	return nil
+}
+
+// sessionTrashPurge permanently removes trashed entries. Without --yes it only reports
+// what would be removed, since a purge cannot be undone.
+func sessionTrashPurge(database *dbpkg.DB, keys *vault.MetaKeys, args []string) error {
+	fs := flag.NewFlagSet("trash purge", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var olderThan string
+	var yes bool
+	fs.StringVar(&olderThan, "older-than", "30d", "minimum time in the trash, e.g. 30d, 12h, 0")
+	fs.BoolVar(&yes, "yes", false, "purge without asking")
+
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid trash purge arguments"}
+	}
+	if fs.NArg() != 0 {
+		return userError{msg: "unexpected positional arguments"}
+	}
+
+	age, err := store.ParseAge(olderThan)
+	if err != nil {
+		return userError{msg: fmt.Sprintf("invalid --older-than: %v", err)}
+	}
+
+	if !yes {
+		rows, err := dbpkg.ListTrash(database, keys)
+		if err != nil {
+			return fmt.Errorf("list trash: %w", err)
+		}
+		cutoff := time.Now().Add(-age)
+		n := 0
+		for _, r := range rows {
+			if t, err := time.Parse(time.RFC3339, r.DeletedAt); err != nil || !t.After(cutoff) {
+				n++
+			}
+		}
+		fmt.Printf("%d trashed credentials would be permanently removed; re-run with --yes to purge\n", n)
+		return nil
+	}
+
+	n, err := dbpkg.PurgeTrash(database, age)
+	if err != nil {
+		return fmt.Errorf("purge trash: %w", err)
+	}
+	fmt.Printf("purged %d credentials from the trash\n", n)
+	return nil
+}
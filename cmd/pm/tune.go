@@ -0,0 +1,119 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+	"github.com/Hussein-Mazeh/PasswordManager/store"
+)
+
+// runMasterTune benchmarks Argon2id on this machine and optionally rewraps a key slot
+// with the calibrated parameters.
+//
+// Args:
+//
+//	args: CLI arguments slice. Supported flags:
+//	  --target     (duration, default 750ms): Desired unlock time.
+//	  --max-memory (MB, default 1024): Upper bound on Argon2id memory.
+//	  --dir        (string, optional): Vault directory; when set, the slot opened by the
+//	               entered password is rewrapped with the calibrated parameters, which
+//	               also become the vault's KDF floor. Parameters weaker than the current
+//	               floor are raised to it, so tuning on a slower machine never lowers it.
+//	  --keyfile    (string, optional): Keyfile for slots that require one; it stays required.
+//
+// Behavior:
+//   - Other slots below the floor are rewrapped the next time they unlock, from the CLI,
+//     GUI or native host.
+func runMasterTune(args []string) error {
+	fs := flag.NewFlagSet("master tune", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var dir string
+	var keyfilePath string
+	var target time.Duration
+	var maxMemory uint
+	fs.StringVar(&dir, "dir", "", "vault directory")
+	fs.StringVar(&keyfilePath, "keyfile", "", "keyfile for vaults that require one")
+	fs.DurationVar(&target, "target", 750*time.Millisecond, "target unlock time")
+	fs.UintVar(&maxMemory, "max-memory", 1024, "maximum Argon2id memory in MB")
+
+	if err := fs.Parse(args); err != nil {
+		return userError{msg: "invalid arguments"}
+	}
+	if fs.NArg() != 0 {
+		return userError{msg: "unexpected positional arguments"}
+	}
+	if target <= 0 {
+		return userError{msg: "--target must be positive"}
+	}
+
+	fmt.Fprintf(os.Stderr, "calibrating Argon2id for %s...\n", target)
+	params, elapsed, err := krypto.CalibrateArgon2(target, uint32(maxMemory))
+	if err != nil {
+		return fmt.Errorf("calibrate argon2id: %w", err)
+	}
+	fmt.Printf("memory=%dMB time=%d parallelism=%d (measured %s)\n",
+		params.MemoryMB, params.Time, params.Parallelism, elapsed.Round(time.Millisecond))
+
+	if dir == "" {
+		return nil
+	}
+
+	paths := store.Paths{Dir: dir}
+
+	keyfile, err := readKeyfile(keyfilePath)
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(keyfile)
+
+	pw, err := promptPassword("Enter master password: ")
+	if err != nil {
+		return fmt.Errorf("read master password: %w", err)
+	}
+	defer zeroBytes(pw)
+
+	mek, hdr, slotID, err := store.UnlockMEK(paths, pw, keyfile)
+	if err != nil {
+		return unlockError(err, "failed to unlock vault")
+	}
+	defer zeroBytes(mek)
+
+	if floor := hdr.Argon2Floor(); params.Below(floor) || params.Parallelism < floor.Parallelism {
+		params = params.Stronger(floor)
+		fmt.Printf("raised to the vault KDF floor: memory=%dMB time=%d parallelism=%d\n",
+			params.MemoryMB, params.Time, params.Parallelism)
+	}
+
+	slot, _ := hdr.Slot(slotID)
+	kdf := vault.NewArgon2KDFConfig(params)
+	kdf.Keyfile = slot.KDF.Keyfile
+
+	salt, err := krypto.NewRandomSalt(params.SaltLen)
+	if err != nil {
+		return fmt.Errorf("generate salt: %w", err)
+	}
+
+	pdk, err := store.DerivePassphraseKey(kdf, pw, salt, keyfile)
+	if err != nil {
+		return fmt.Errorf("derive key: %w", err)
+	}
+	defer zeroBytes(pdk)
+
+	hdr, err = store.RewrapKeySlot(paths, hdr, slotID, kdf, salt, pdk, mek)
+	if err != nil {
+		return fmt.Errorf("rewrap mek: %w", err)
+	}
+	fmt.Printf("key slot %d rewrapped with calibrated parameters\n", slotID)
+
+	if _, err := store.SetKDFFloor(paths, hdr, params, mek); err != nil {
+		return fmt.Errorf("record kdf floor: %w", err)
+	}
+	fmt.Println("vault KDF floor raised; weaker slots are rewrapped when they next unlock")
+	return nil
+}
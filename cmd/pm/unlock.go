@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/Hussein-Mazeh/PasswordManager/internal/agent"
+	"github.com/Hussein-Mazeh/PasswordManager/internal/bio/toggle"
+	dbpkg "github.com/Hussein-Mazeh/PasswordManager/internal/db"
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+	"github.com/Hussein-Mazeh/PasswordManager/store"
+)
+
+// unlockedVault is an open vault.db together with the keys from one unlock.
+type unlockedVault struct {
+	database *dbpkg.DB
+	mek      []byte
+	keys     *vault.MetaKeys
+	suite    krypto.Suite
+}
+
+// Close wipes the keys and closes the database.
+func (u *unlockedVault) Close() {
+	if u == nil {
+		return
+	}
+	u.keys.Wipe()
+	zeroBytes(u.mek)
+	dbpkg.Close(u.database)
+}
+
+// requireBiometric asks for Touch ID when biometric unlock is enabled for dir.
+func requireBiometric(dir string) error {
+	bioStatus, err := toggle.Status(dir)
+	if err != nil && !errors.Is(err, toggle.ErrUnsupported) {
+		return fmt.Errorf("biometric status: %w", err)
+	}
+	if err == nil && bioStatus.Enabled {
+		if err := toggle.Authenticate("Touch ID to unlock the vault"); err != nil {
+			if errors.Is(err, toggle.ErrUnsupported) {
+				// ignore; treat as disabled if unsupported at runtime
+			} else {
+				return userError{msg: "biometric authentication failed", code: exitAuthFailed}
+			}
+		}
+	}
+	return nil
+}
+
+// openUnlockedVault unwraps the MEK with pw (and keyfile, when the slot needs one), opens
+// and migrates vault.db, finishes any interrupted key rotation, rewraps the slot when it
+// is below the vault's KDF floor, and converts legacy plaintext metadata. The caller owns the result and must Close it.
+func openUnlockedVault(dir string, pw, keyfile []byte) (*unlockedVault, error) {
+	paths := store.Paths{Dir: dir}
+
+	mek, hdr, slotID, err := store.UnlockMEK(paths, pw, keyfile)
+	if err != nil {
+		return nil, unlockError(err, "failed to unlock vault")
+	}
+
+	dbPath := filepath.Join(dir, "vault.db")
+	database, err := dbpkg.Open(dbPath)
+	if err != nil {
+		zeroBytes(mek)
+		return nil, fmt.Errorf("open vault database: %w", err)
+	}
+	u := &unlockedVault{database: database}
+
+	if err := dbpkg.Migrate(database); err != nil {
+		zeroBytes(mek)
+		u.Close()
+		if errors.Is(err, dbpkg.ErrSchemaTooNew) {
+			return nil, userError{msg: "vault database was created by a newer version of pm; upgrade pm to open it"}
+		}
+		return nil, fmt.Errorf("initialise vault database: %w", err)
+	}
+
+	resolved, hdr, err := store.ResolveRotation(paths, hdr, pw, keyfile, mek, func(m []byte) (bool, error) {
+		return dbpkg.MEKCheck(database, m)
+	})
+	if err != nil {
+		zeroBytes(mek)
+		u.Close()
+		return nil, unlockError(err, "failed to unlock vault")
+	}
+	u.mek = resolved
+	// Best effort: a failed upgrade leaves the old slot in place and the vault usable.
+	if upgraded, err := store.UpgradeSlotKDF(paths, hdr, slotID, pw, keyfile, resolved); err == nil {
+		hdr = upgraded
+	}
+	u.suite = hdr.EntrySuite()
+
+	if err := u.deriveKeys(); err != nil {
+		u.Close()
+		return nil, err
+	}
+	return u, nil
+}
+
+// openAgentVault opens the vault in dir with the MEK cached by a running pm agent. It
+// returns agent.ErrNotRunning or agent.ErrLocked (possibly wrapped) when the agent cannot
+// help, and errAgentKeyStale when the agent's key no longer opens this vault, so the
+// caller can fall back to the master password.
+func openAgentVault(dir string) (*unlockedVault, error) {
+	mek, err := agent.NewClient("").Key(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	hdr, err := store.LoadHeaderForMEK(store.Paths{Dir: dir}, mek)
+	if err != nil {
+		zeroBytes(mek)
+		return nil, errAgentKeyStale
+	}
+
+	database, err := dbpkg.Open(filepath.Join(dir, "vault.db"))
+	if err != nil {
+		zeroBytes(mek)
+		return nil, fmt.Errorf("open vault database: %w", err)
+	}
+	u := &unlockedVault{database: database, mek: mek, suite: hdr.EntrySuite()}
+
+	if err := dbpkg.Migrate(database); err != nil {
+		u.Close()
+		if errors.Is(err, dbpkg.ErrSchemaTooNew) {
+			return nil, userError{msg: "vault database was created by a newer version of pm; upgrade pm to open it"}
+		}
+		return nil, fmt.Errorf("initialise vault database: %w", err)
+	}
+	if ok, err := dbpkg.MEKCheck(database, mek); err != nil || !ok {
+		u.Close()
+		return nil, errAgentKeyStale
+	}
+
+	if err := u.deriveKeys(); err != nil {
+		u.Close()
+		return nil, err
+	}
+	return u, nil
+}
+
+// errAgentKeyStale means the agent holds a key that no longer matches the vault, for
+// example after pm master rotate-key.
+var errAgentKeyStale = errors.New("pm agent key does not open this vault")
+
+// deriveKeys derives the metadata keys from u.mek and converts legacy plaintext metadata.
+func (u *unlockedVault) deriveKeys() error {
+	keys, err := vault.DeriveMetaKeys(u.mek)
+	if err != nil {
+		return fmt.Errorf("derive metadata keys: %w", err)
+	}
+	u.keys = keys
+
+	if err := dbpkg.MigrateMetadata(u.database, keys); err != nil {
+		return fmt.Errorf("encrypt legacy metadata: %w", err)
+	}
+	return nil
+}
+
+// agentUnavailable reports whether err from openAgentVault only means the agent cannot
+// supply the key, as opposed to a real failure opening the vault.
+func agentUnavailable(err error) bool {
+	return errors.Is(err, agent.ErrNotRunning) || errors.Is(err, agent.ErrLocked) ||
+		errors.Is(err, agent.ErrWrongVault) || errors.Is(err, errAgentKeyStale)
+}
+
+// readMasterPassword gets the master password for a non-interactive command: from file
+// descriptor fd when it is not negative, otherwise from the terminal. Without either the
+// vault counts as locked. A running pm agent is tried before this is called.
+func readMasterPassword(fd int) ([]byte, error) {
+	if fd >= 0 {
+		return readSecretFD(fd, "--password-fd")
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, userError{msg: "vault is locked: start pm agent, or pass --password-fd", code: exitLocked}
+	}
+	pw, err := promptPassword("Enter master password: ")
+	if err != nil {
+		return nil, fmt.Errorf("read master password: %w", err)
+	}
+	return pw, nil
+}
+
+// readSecretFD reads one secret from an inherited file descriptor, such as
+// `--password-fd 3 3<secret.txt`. A single trailing newline is dropped.
+func readSecretFD(fd int, flagName string) ([]byte, error) {
+	f := os.NewFile(uintptr(fd), flagName+" "+strconv.Itoa(fd))
+	if f == nil {
+		return nil, userError{msg: fmt.Sprintf("%s %d is not an open file descriptor", flagName, fd)}
+	}
+	defer f.Close()
+
+	// Cap the read; secrets are short and fd may be a pipe that never closes.
+	b, err := io.ReadAll(io.LimitReader(f, 64*1024))
+	if err != nil {
+		return nil, userError{msg: fmt.Sprintf("cannot read %s %d: %v", flagName, fd, err)}
+	}
+	s := strings.TrimSuffix(strings.TrimSuffix(string(b), "\n"), "\r")
+	zeroBytes(b)
+	return []byte(s), nil
+}
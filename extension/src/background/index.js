@@ -309,7 +309,10 @@ chrome.runtime.onMessage.addListener((message, sender, sendResponse) => {
                         sendResponse({ ok: false, code: "SAFE_BROWSING_REQUIRED" });
                         return;
                     }
-                    const verdict = await phishing.evaluatePageForAutofill(url, undefined, pageUrl.hostname);
+                    const verdict = await phishing.evaluatePageForAutofill(url, undefined, pageUrl.hostname, {
+                        username: usernameHint,
+                        requireExactHost: settings.requireExactHost,
+                    });
                     if (!verdict.ok) {
                         console.warn("PassMan REQUEST_FILL → phishing verdict blocked", {
                             tabId,
@@ -325,7 +328,7 @@ chrome.runtime.onMessage.addListener((message, sender, sendResponse) => {
                         sendResponse({ ok: false, code: "ETLD_INVALID" });
                         return;
                     }
-                    const data = await nmGet(verdict.etld1, pageUrl.hostname, usernameHint, settings.requireExactHost);
+                    const data = await nmGet(verdict.etld1, pageUrl.hostname, usernameHint, settings.requireExactHost, pageUrl.href);
                     if (!data.items || data.items.length === 0) {
                         sendResponse({ ok: false, code: "NO_CREDENTIALS" });
                         return;
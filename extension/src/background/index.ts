@@ -355,7 +355,10 @@ chrome.runtime.onMessage.addListener((message, sender, sendResponse) => {
             return;
           }
 
-          const verdict = await phishing.evaluatePageForAutofill(url, undefined, pageUrl.hostname);
+          const verdict = await phishing.evaluatePageForAutofill(url, undefined, pageUrl.hostname, {
+            username: usernameHint,
+            requireExactHost: settings.requireExactHost,
+          });
           if (!verdict.ok) {
             console.warn("PassMan REQUEST_FILL → phishing verdict blocked", {
               tabId,
@@ -372,7 +375,7 @@ chrome.runtime.onMessage.addListener((message, sender, sendResponse) => {
             return;
           }
 
-          const data = await nmGet(verdict.etld1, pageUrl.hostname, usernameHint, settings.requireExactHost);
+          const data = await nmGet(verdict.etld1, pageUrl.hostname, usernameHint, settings.requireExactHost, pageUrl.href);
           if (!data.items || data.items.length === 0) {
             sendResponse({ ok: false, code: "NO_CREDENTIALS" });
             return;
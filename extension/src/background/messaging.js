@@ -221,11 +221,14 @@ function assertOk(response) {
     }
     return (response.data ?? {});
 }
-export async function nmUnlock(dir, masterPassword) {
+export async function nmUnlock(dir, masterPassword, keyfilePath) {
     const payload = { type: "unlock", dir };
     if (masterPassword) {
         payload.masterPassword = masterPassword;
     }
+    if (keyfilePath) {
+        payload.keyfilePath = keyfilePath;
+    }
     const response = await sendNative(payload);
     return assertOk(response);
 }
@@ -248,7 +251,7 @@ export async function nmLock() {
         throw err;
     }
 }
-export async function nmPhishingCheck(url, savedEtld1, exactHost) {
+export async function nmPhishingCheck(url, savedEtld1, exactHost, entry) {
     const payload = { type: "phishingCheck", url };
     if (savedEtld1) {
         payload.savedEtld1 = savedEtld1;
@@ -256,10 +259,22 @@ export async function nmPhishingCheck(url, savedEtld1, exactHost) {
     if (exactHost) {
         payload.exactHost = exactHost;
     }
-    const response = await sendNative(payload, { transient: true });
+    const token = entry ? getToken() : null;
+    if (!token) {
+        const response = await sendNative(payload, { transient: true });
+        return assertOk(response);
+    }
+    // Match modes need the unlocked session, which only the persistent host holds.
+    payload.sessionToken = token;
+    payload.nonce = generateNonce();
+    payload.requireExactHost = !!entry?.requireExactHost;
+    if (entry?.username) {
+        payload.username = entry.username;
+    }
+    const response = await sendNative(payload);
     return assertOk(response);
 }
-export async function nmGet(domainEtld1, exactHost, username, requireExactHost) {
+export async function nmGet(domainEtld1, exactHost, username, requireExactHost, url) {
     const token = requireSessionToken();
     const payload = {
         type: "getCredentials",
@@ -272,6 +287,10 @@ export async function nmGet(domainEtld1, exactHost, username, requireExactHost)
     if (username) {
         payload.username = username;
     }
+    if (url) {
+        // Entries matched by URL prefix, exact URL or regex need the full page URL.
+        payload.url = url;
+    }
     const response = await sendNative(payload);
     return assertOk(response);
 }
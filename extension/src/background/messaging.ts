@@ -15,6 +15,12 @@ export type NativePhishingVerdict = {
   etld1?: string | null;
 };
 
+// The account being filled; with it the host also applies the stored entries' match modes.
+export type PhishingEntryContext = {
+  username?: string;
+  requireExactHost?: boolean;
+};
+
 type SendOptions = {
   transient?: boolean;
   closeAfter?: boolean;
@@ -260,11 +266,14 @@ function assertOk<T>(response: NativeResponse<T>): T {
   return (response.data ?? {}) as T;
 }
 
-export async function nmUnlock(dir: string, masterPassword?: string): Promise<{ token: string; ttlSeconds: number }> {
+export async function nmUnlock(dir: string, masterPassword?: string, keyfilePath?: string): Promise<{ token: string; ttlSeconds: number }> {
   const payload: Record<string, unknown> = { type: "unlock", dir };
   if (masterPassword) {
     payload.masterPassword = masterPassword;
   }
+  if (keyfilePath) {
+    payload.keyfilePath = keyfilePath;
+  }
   const response = await sendNative<{ token: string; ttlSeconds: number }>(payload);
   return assertOk(response);
 }
@@ -291,7 +300,8 @@ export async function nmLock(): Promise<void> {
 export async function nmPhishingCheck(
   url: string,
   savedEtld1?: string | null,
-  exactHost?: string
+  exactHost?: string,
+  entry?: PhishingEntryContext
 ): Promise<NativePhishingVerdict> {
   const payload: Record<string, unknown> = { type: "phishingCheck", url };
   if (savedEtld1) {
@@ -300,7 +310,19 @@ export async function nmPhishingCheck(
   if (exactHost) {
     payload.exactHost = exactHost;
   }
-  const response = await sendNative<NativePhishingVerdict>(payload, { transient: true });
+  const token = entry ? getToken() : null;
+  if (!token) {
+    const response = await sendNative<NativePhishingVerdict>(payload, { transient: true });
+    return assertOk(response);
+  }
+  // Match modes need the unlocked session, which only the persistent host holds.
+  payload.sessionToken = token;
+  payload.nonce = generateNonce();
+  payload.requireExactHost = !!entry?.requireExactHost;
+  if (entry?.username) {
+    payload.username = entry.username;
+  }
+  const response = await sendNative<NativePhishingVerdict>(payload);
   return assertOk(response);
 }
 
@@ -308,7 +330,8 @@ export async function nmGet(
   domainEtld1: string,
   exactHost: string,
   username?: string,
-  requireExactHost?: boolean
+  requireExactHost?: boolean,
+  url?: string
 ): Promise<{ items: { username: string; password: string }[] }> {
   const token = requireSessionToken();
   const payload: Record<string, unknown> = {
@@ -322,6 +345,10 @@ export async function nmGet(
   if (username) {
     payload.username = username;
   }
+  if (url) {
+    // Entries matched by URL prefix, exact URL or regex need the full page URL.
+    payload.url = url;
+  }
   const response = await sendNative<{ items: { username: string; password: string }[] }>(payload);
   return assertOk(response);
 }
@@ -20,14 +20,14 @@ export async function isTopLevelFrame() {
     const frameId = currentFrameContext.frameId ?? 0;
     return frameId === 0;
 }
-export async function evaluatePageForAutofill(url, savedEtld1, exactHost) {
+export async function evaluatePageForAutofill(url, savedEtld1, exactHost, entry) {
     const frameReasons = [];
     if (!(await isTopLevelFrame())) {
         frameReasons.push("IFRAME");
     }
     let baseVerdict;
     try {
-        baseVerdict = await nmPhishingCheck(url, savedEtld1 ?? null, exactHost);
+        baseVerdict = await nmPhishingCheck(url, savedEtld1 ?? null, exactHost, entry);
     }
     catch (err) {
         console.error("PassMan phishing → native check failed", {
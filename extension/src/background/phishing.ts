@@ -1,4 +1,4 @@
-import { nmPhishingCheck, NativePhishingVerdict } from "./messaging.js";
+import { nmPhishingCheck, NativePhishingVerdict, PhishingEntryContext } from "./messaging.js";
 
 type FrameContext = {
   tabId?: number;
@@ -39,7 +39,8 @@ export async function isTopLevelFrame(): Promise<boolean> {
 export async function evaluatePageForAutofill(
   url: string,
   savedEtld1?: string | null,
-  exactHost?: string
+  exactHost?: string,
+  entry?: PhishingEntryContext
 ): Promise<PhishingVerdict> {
   const frameReasons: string[] = [];
   if (!(await isTopLevelFrame())) {
@@ -48,7 +49,7 @@ export async function evaluatePageForAutofill(
 
   let baseVerdict: NativePhishingVerdict;
   try {
-    baseVerdict = await nmPhishingCheck(url, savedEtld1 ?? null, exactHost);
+    baseVerdict = await nmPhishingCheck(url, savedEtld1 ?? null, exactHost, entry);
   } catch (err) {
     console.error("PassMan phishing → native check failed", {
       url,
@@ -1,5 +1,5 @@
 import { nmLock, nmUnlock, resetNativeConnection } from "./messaging.js";
-import { DEFAULT_VAULT_DIR } from "../config/defaults.js";
+import { DEFAULT_KEYFILE_PATH, DEFAULT_VAULT_DIR } from "../config/defaults.js";
 
 let sessionToken: string | null = null;
 let expiresAt: number | null = null;
@@ -48,7 +48,7 @@ export async function unlock(dir?: string, masterPassword?: string): Promise<voi
   const inputPassword = masterPassword ?? "";
 
   try {
-    const { token, ttlSeconds: ttl } = await nmUnlock(payloadDir, inputPassword);
+    const { token, ttlSeconds: ttl } = await nmUnlock(payloadDir, inputPassword, DEFAULT_KEYFILE_PATH);
     ttlSeconds = Number.isFinite(ttl) && ttl > 0 ? ttl : 600;
     sessionToken = token;
     expiresAt = Date.now() + ttlSeconds * 1000;
@@ -1 +1,3 @@
 export const DEFAULT_VAULT_DIR = "/Users/husseinmazeh/Desktop/Sixth Semester/CMPS 297AD - Applied Crypto/PasswordManager/vault";
+// Keyfile sent with unlock for vaults set up with `pm master set --keyfile`; leave empty otherwise.
+export const DEFAULT_KEYFILE_PATH = "";
@@ -1,4 +1,6 @@
 export const DEFAULT_VAULT_DIR = "Path/to/vault";
+// Keyfile sent with unlock for vaults set up with `pm master set --keyfile`; leave empty otherwise.
+export const DEFAULT_KEYFILE_PATH = "";
 
 //example
 //export const DEFAULT_VAULT_DIR = "/Users/husseinmazeh/Desktop/Sixth Semester/CMPS 297AD - Applied Crypto/PasswordManager/vault";
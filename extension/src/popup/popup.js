@@ -8,6 +8,18 @@
             statusEl.textContent = text;
         }
     }
+    function unlockFailureText(code) {
+        switch (code) {
+            case "HEADER_TAMPERED":
+                return "Vault header tampered";
+            case "KEYFILE_REQUIRED":
+                return "Keyfile required";
+            case "KEYFILE_INVALID":
+                return "Keyfile unreadable";
+            default:
+                return "Unlock failed";
+        }
+    }
     async function refreshLockState() {
         try {
             const response = await chrome.runtime.sendMessage({ type: "LOCK_STATE" });
@@ -39,7 +51,7 @@
                 }
                 else {
                     console.log("PassMan popup → UNLOCK response", res);
-                    setStatus("Unlock failed");
+                    setStatus(unlockFailureText(res?.code));
                 }
             }
             catch {
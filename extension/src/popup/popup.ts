@@ -10,6 +10,19 @@
     }
   }
 
+  function unlockFailureText(code?: string): string {
+    switch (code) {
+      case "HEADER_TAMPERED":
+        return "Vault header tampered";
+      case "KEYFILE_REQUIRED":
+        return "Keyfile required";
+      case "KEYFILE_INVALID":
+        return "Keyfile unreadable";
+      default:
+        return "Unlock failed";
+    }
+  }
+
   async function refreshLockState(): Promise<void> {
     try {
       const response = await chrome.runtime.sendMessage({ type: "LOCK_STATE" });
@@ -39,7 +52,7 @@
           await refreshLockState();
         } else {
           console.log("PassMan popup → UNLOCK response", res);
-          setStatus("Unlock failed");
+          setStatus(unlockFailureText(res?.code));
         }
       } catch {
         setStatus("Unlock failed");
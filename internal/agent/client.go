@@ -0,0 +1,213 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotRunning indicates no agent is listening on the socket.
+	ErrNotRunning = errors.New("pm agent is not running")
+	// ErrLocked indicates the agent is running but holds no key.
+	ErrLocked = errors.New("pm agent is locked")
+	// ErrWrongVault indicates the agent is unlocked for a different vault directory.
+	ErrWrongVault = errors.New("pm agent is unlocked for a different vault")
+	// ErrUntrustedAgent indicates the socket's directory, or the process listening on it,
+	// belongs to another user. Nothing is sent to it and nothing it says is believed.
+	ErrUntrustedAgent = errors.New("pm agent socket is not owned by the current user")
+)
+
+// Status describes a running agent.
+type Status struct {
+	PID      int
+	Unlocked bool
+	Dir      string
+	Idle     time.Duration // time left before the agent locks itself
+}
+
+// Client talks to the agent listening on Socket.
+type Client struct {
+	Socket string
+}
+
+// NewClient returns a client for socket, or for DefaultSocketPath when socket is empty.
+func NewClient(socket string) *Client {
+	if socket == "" {
+		socket = DefaultSocketPath()
+	}
+	return &Client{Socket: socket}
+}
+
+// dial connects to the agent after checking, like the server's prepareSocketDir, that the
+// socket directory belongs to the caller and is closed to everyone else, and that the
+// peer process runs as the caller. A missing socket is ErrNotRunning; an untrusted one is
+// ErrUntrustedAgent.
+func (c *Client) dial(timeout time.Duration) (*net.UnixConn, error) {
+	if _, err := os.Lstat(c.Socket); err != nil {
+		return nil, ErrNotRunning
+	}
+	uid := os.Getuid()
+	if err := checkSocketDir(filepath.Dir(c.Socket), uid); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUntrustedAgent, err)
+	}
+	conn, err := net.DialTimeout("unix", c.Socket, timeout)
+	if err != nil {
+		return nil, ErrNotRunning
+	}
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		conn.Close()
+		return nil, ErrNotRunning
+	}
+	if err := verifyPeer(uc, uid); err != nil {
+		uc.Close()
+		return nil, err
+	}
+	return uc, nil
+}
+
+// verifyPeer checks that the process on the other end of conn runs as uid.
+func verifyPeer(conn *net.UnixConn, uid int) error {
+	peer, err := peerUID(conn)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUntrustedAgent, err)
+	}
+	if peer != uid {
+		return fmt.Errorf("%w: the agent runs as uid %d", ErrUntrustedAgent, peer)
+	}
+	return nil
+}
+
+func (c *Client) do(req Request) (Response, error) {
+	defer zeroize(req.MEK)
+
+	conn, err := c.dial(2 * time.Second)
+	if err != nil {
+		return Response{}, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(connDeadline))
+
+	b, err := json.Marshal(req)
+	if err != nil {
+		return Response{}, fmt.Errorf("encode agent request: %w", err)
+	}
+	_, err = conn.Write(append(b, '\n'))
+	zeroize(b)
+	if err != nil {
+		return Response{}, fmt.Errorf("send agent request: %w", err)
+	}
+
+	line, err := bufio.NewReaderSize(conn, maxRequestSize).ReadSlice('\n')
+	if err != nil {
+		return Response{}, fmt.Errorf("read agent response: %w", err)
+	}
+	var resp Response
+	err = json.Unmarshal(line, &resp)
+	zeroize(line)
+	if err != nil {
+		return Response{}, fmt.Errorf("decode agent response: %w", err)
+	}
+	if !resp.OK {
+		return resp, responseError(resp)
+	}
+	return resp, nil
+}
+
+func responseError(resp Response) error {
+	switch resp.Code {
+	case CodeLocked:
+		return ErrLocked
+	case CodeWrongVault:
+		return fmt.Errorf("%w (%s)", ErrWrongVault, resp.Dir)
+	case CodeUnauthorized:
+		return fmt.Errorf("agent refused the request: %s", resp.Message)
+	default:
+		return fmt.Errorf("agent error %s: %s", resp.Code, resp.Message)
+	}
+}
+
+// Status asks the agent whether it is unlocked and for which vault.
+func (c *Client) Status() (Status, error) {
+	resp, err := c.do(Request{Type: RequestStatus})
+	if errors.Is(err, ErrLocked) {
+		return Status{PID: resp.PID}, nil
+	}
+	if err != nil {
+		return Status{}, err
+	}
+	return Status{
+		PID:      resp.PID,
+		Unlocked: true,
+		Dir:      resp.Dir,
+		Idle:     time.Duration(resp.TTLSeconds) * time.Second,
+	}, nil
+}
+
+// Key returns a copy of the MEK for the vault in dir; the caller must zeroize it. The
+// agent's token is read from the file next to the socket and each call uses a new nonce.
+func (c *Client) Key(dir string) ([]byte, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("resolve vault directory: %w", err)
+	}
+	raw, err := os.ReadFile(tokenPath(c.Socket))
+	if err != nil {
+		conn, dialErr := c.dial(time.Second)
+		if dialErr != nil {
+			return nil, dialErr
+		}
+		conn.Close()
+		return nil, ErrLocked
+	}
+	nonce, err := NewNonce()
+	if err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+
+	resp, err := c.do(Request{Type: RequestKey, Token: strings.TrimSpace(string(raw)), Nonce: nonce, Dir: abs})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.MEK) != 32 {
+		zeroize(resp.MEK)
+		return nil, errors.New("agent returned an invalid key")
+	}
+	return resp.MEK, nil
+}
+
+// Load gives the agent a MEK for the vault in dir, replacing whatever it held, and
+// returns the idle timeout it will apply.
+func (c *Client) Load(dir string, mek []byte) (time.Duration, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return 0, fmt.Errorf("resolve vault directory: %w", err)
+	}
+	mekCopy := make([]byte, len(mek))
+	copy(mekCopy, mek)
+
+	resp, err := c.do(Request{Type: RequestLoad, Dir: abs, MEK: mekCopy})
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(resp.TTLSeconds) * time.Second, nil
+}
+
+// Lock makes the agent wipe its key.
+func (c *Client) Lock() error {
+	_, err := c.do(Request{Type: RequestLock})
+	return err
+}
+
+// Stop makes the agent wipe its key and exit.
+func (c *Client) Stop() error {
+	_, err := c.do(Request{Type: RequestStop})
+	return err
+}
@@ -0,0 +1,115 @@
+//go:build linux || darwin
+
+package agent
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeAgent listens on path and reports whether anyone connected before the test ended.
+func fakeAgent(t *testing.T, path string) <-chan bool {
+	t.Helper()
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	connected := make(chan bool, 1)
+	go func() {
+		ln.SetDeadline(time.Now().Add(500 * time.Millisecond))
+		conn, err := ln.AcceptUnix()
+		if err == nil {
+			conn.Close()
+		}
+		connected <- err == nil
+	}()
+	return connected
+}
+
+func TestClientLoadAndKey(t *testing.T) {
+	srv, err := Listen(filepath.Join(t.TempDir(), "agent", "agent.sock"), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	go srv.Serve()
+
+	c := NewClient(srv.Path())
+	mek := bytes.Repeat([]byte{7}, 32)
+	dir := t.TempDir()
+	if _, err := c.Load(dir, mek); err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.Key(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, mek) {
+		t.Fatal("Key returned a different MEK")
+	}
+}
+
+func TestClientRefusesLooseSocketDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "agent.sock")
+	connected := fakeAgent(t, path)
+
+	_, err := NewClient(path).Load(t.TempDir(), bytes.Repeat([]byte{7}, 32))
+	if !errors.Is(err, ErrUntrustedAgent) {
+		t.Fatalf("Load: err = %v, want ErrUntrustedAgent", err)
+	}
+	if <-connected {
+		t.Fatal("client connected to a socket in a directory other users can enter")
+	}
+}
+
+func TestClientRefusesSocketDirOfAnotherUser(t *testing.T) {
+	dir := t.TempDir()
+	if err := checkSocketDir(dir, os.Getuid()+1); err == nil {
+		t.Fatal("checkSocketDir accepted a directory owned by another user")
+	}
+
+	// Only root can hand a directory to another user for the end-to-end check.
+	if os.Getuid() != 0 {
+		return
+	}
+	if err := os.Chown(dir, 65534, 65534); err != nil {
+		t.Skip("chown:", err)
+	}
+	path := filepath.Join(dir, "agent.sock")
+	connected := fakeAgent(t, path)
+
+	_, err := NewClient(path).Load(t.TempDir(), bytes.Repeat([]byte{7}, 32))
+	if !errors.Is(err, ErrUntrustedAgent) {
+		t.Fatalf("Load: err = %v, want ErrUntrustedAgent", err)
+	}
+	if <-connected {
+		t.Fatal("client connected to a socket in another user's directory")
+	}
+}
+
+func TestVerifyPeerRejectsAnotherUser(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.sock")
+	fakeAgent(t, path)
+	conn, err := net.DialUnix("unix", nil, &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := verifyPeer(conn, os.Getuid()); err != nil {
+		t.Fatalf("own agent refused: %v", err)
+	}
+	if err := verifyPeer(conn, os.Getuid()+1); !errors.Is(err, ErrUntrustedAgent) {
+		t.Fatalf("agent of another user: err = %v, want ErrUntrustedAgent", err)
+	}
+}
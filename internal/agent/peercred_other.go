@@ -0,0 +1,18 @@
+//go:build !linux && !darwin
+
+package agent
+
+import (
+	"errors"
+	"net"
+	"os"
+)
+
+// peerUID is unavailable here, so the agent refuses every connection.
+func peerUID(conn *net.UnixConn) (int, error) {
+	return -1, errors.New("peer credentials are not supported on this platform")
+}
+
+func fileOwner(info os.FileInfo) (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// SocketEnv names the environment variable that points clients at a running agent.
+const SocketEnv = "PM_AGENT_SOCK"
+
+// Request types understood by the agent. Each connection carries one request line and
+// one response line, both JSON.
+const (
+	// RequestStatus reports whether the agent is unlocked and for which vault.
+	RequestStatus = "status"
+	// RequestKey returns a copy of the MEK; it needs the session token and a fresh nonce.
+	RequestKey = "key"
+	// RequestLoad hands the agent a MEK unlocked by the client and starts a new session.
+	RequestLoad = "load"
+	// RequestLock wipes the MEK; the agent keeps running.
+	RequestLock = "lock"
+	// RequestStop wipes the MEK and shuts the agent down.
+	RequestStop = "stop"
+)
+
+// Response codes for failed requests.
+const (
+	CodeLocked       = "LOCKED"
+	CodeWrongVault   = "WRONG_VAULT"
+	CodeUnauthorized = "UNAUTHORIZED"
+	CodeBadRequest   = "BAD_REQUEST"
+	CodeInternal     = "INTERNAL"
+)
+
+// Request is one message from a client.
+type Request struct {
+	Type  string `json:"type"`
+	Token string `json:"token,omitempty"`
+	Nonce string `json:"nonce,omitempty"`
+	Dir   string `json:"dir,omitempty"`
+	MEK   []byte `json:"mek,omitempty"`
+}
+
+// Response is the agent's answer to one Request.
+type Response struct {
+	OK         bool   `json:"ok"`
+	Code       string `json:"code,omitempty"`
+	Message    string `json:"message,omitempty"`
+	Dir        string `json:"dir,omitempty"`
+	MEK        []byte `json:"mek,omitempty"`
+	TTLSeconds int    `json:"ttlSeconds,omitempty"`
+	PID        int    `json:"pid,omitempty"`
+}
+
+// DefaultSocketPath returns $PM_AGENT_SOCK when set, otherwise a per-user path under
+// $XDG_RUNTIME_DIR or the temp directory.
+func DefaultSocketPath() string {
+	if p := os.Getenv(SocketEnv); p != "" {
+		return p
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "pm-agent", "agent.sock")
+	}
+	return filepath.Join(os.TempDir(), "pm-agent-"+strconv.Itoa(os.Getuid()), "agent.sock")
+}
+
+// tokenPath is where the agent publishes its session token for clients of the same user.
+func tokenPath(socket string) string {
+	return socket + ".token"
+}
+
+// prepareSocketDir creates the socket's directory with mode 0700, or checks that an
+// existing one is a real directory owned by the caller that nobody else can enter.
+func prepareSocketDir(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("create agent directory: %w", err)
+	}
+	return checkSocketDir(dir, os.Getuid())
+}
+
+// checkSocketDir checks that dir is a real directory owned by uid with no access for
+// group or others. Clients run it too, so a directory another user created first in a
+// shared temp directory is never trusted with a key.
+func checkSocketDir(dir string, uid int) error {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return fmt.Errorf("stat agent directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("agent directory %s is not a directory", dir)
+	}
+	if info.Mode().Perm()&0o077 != 0 {
+		return fmt.Errorf("agent directory %s is accessible to other users", dir)
+	}
+	if owner, ok := fileOwner(info); ok && owner != uid {
+		return errors.New("agent directory is owned by another user")
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	maxRequestSize = 1 << 16
+	connDeadline   = 5 * time.Second
+	sweepInterval  = 15 * time.Second
+)
+
+// Server is the pm agent daemon: a Session served over a 0600 Unix domain socket that
+// only accepts connections from processes running as the same user.
+type Server struct {
+	Session Session
+
+	path     string
+	ln       *net.UnixListener
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// Listen creates the socket at path (DefaultSocketPath when empty). A stale socket left
+// by a crashed agent is replaced; a live one makes Listen fail.
+func Listen(path string, idle time.Duration) (*Server, error) {
+	if path == "" {
+		path = DefaultSocketPath()
+	}
+	if err := prepareSocketDir(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Lstat(path); err == nil {
+		if c, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			c.Close()
+			return nil, fmt.Errorf("an agent is already listening on %s", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("remove stale socket: %w", err)
+		}
+	}
+
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s: %w", path, err)
+	}
+	ln.SetUnlinkOnClose(true)
+	if err := os.Chmod(path, 0o600); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("restrict socket: %w", err)
+	}
+
+	return &Server{
+		Session: Session{IdleTimeout: idle},
+		path:    path,
+		ln:      ln,
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// Path returns the socket path.
+func (s *Server) Path() string { return s.path }
+
+// Load starts a session for the vault in dir with mek and publishes the new token.
+func (s *Server) Load(dir string, mek []byte) (int, error) {
+	token, ttl, err := s.Session.Establish(dir, mek)
+	if err != nil {
+		return 0, err
+	}
+	if err := writeToken(tokenPath(s.path), token); err != nil {
+		s.lock()
+		return 0, err
+	}
+	return ttl, nil
+}
+
+// Serve accepts connections until Close or a stop request. It also wipes the session as
+// soon as the idle timeout passes, not only when the next request arrives.
+func (s *Server) Serve() error {
+	go s.sweep()
+
+	for {
+		conn, err := s.ln.AcceptUnix()
+		if err != nil {
+			select {
+			case <-s.done:
+				return nil
+			default:
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return fmt.Errorf("accept: %w", err)
+		}
+		go s.handleConn(conn)
+	}
+}
+
+// Close wipes the session, removes the socket and token file, and stops Serve.
+func (s *Server) Close() {
+	s.stopOnce.Do(func() {
+		close(s.done)
+		s.lock()
+		s.ln.Close()
+	})
+}
+
+func (s *Server) lock() {
+	s.Session.Clear()
+	os.Remove(tokenPath(s.path))
+}
+
+func (s *Server) sweep() {
+	t := time.NewTicker(sweepInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-t.C:
+			if _, _, ok := s.Session.Status(); !ok {
+				os.Remove(tokenPath(s.path))
+			}
+		}
+	}
+}
+
+func (s *Server) handleConn(conn *net.UnixConn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(connDeadline))
+
+	uid, err := peerUID(conn)
+	if err != nil || uid != os.Getuid() {
+		writeResponse(conn, Response{Code: CodeUnauthorized, Message: "peer is not the agent owner"})
+		return
+	}
+
+	line, err := bufio.NewReaderSize(conn, maxRequestSize).ReadSlice('\n')
+	if err != nil {
+		writeResponse(conn, Response{Code: CodeBadRequest, Message: "request must be one JSON line"})
+		return
+	}
+	var req Request
+	if err := json.Unmarshal(line, &req); err != nil {
+		writeResponse(conn, Response{Code: CodeBadRequest, Message: "invalid json"})
+		return
+	}
+	defer zeroize(req.MEK)
+
+	resp := s.handle(req)
+	writeResponse(conn, resp)
+	zeroize(resp.MEK)
+
+	if req.Type == RequestStop {
+		s.Close()
+	}
+}
+
+// handle answers one request from a verified peer.
+//
+// Args:
+//
+//	req: decoded request.
+//
+// Returns:
+//
+//	Response: the reply; MEK is set only for a valid key request and must be zeroized
+//	          by the caller after it is written.
+//
+// Behavior:
+//  1. status, lock and stop need only the peer check done in handleConn.
+//  2. load replaces the session with a MEK the client already unlocked and verified.
+//  3. key validates the token and nonce through Session.Validate and refuses to hand out
+//     the MEK for any vault but the one that was unlocked.
+func (s *Server) handle(req Request) Response {
+	switch req.Type {
+	case RequestStatus:
+		dir, expires, ok := s.Session.Status()
+		if !ok {
+			return Response{Code: CodeLocked, Message: "agent is locked", PID: os.Getpid()}
+		}
+		return Response{OK: true, Dir: dir, TTLSeconds: int(time.Until(expires) / time.Second), PID: os.Getpid()}
+	case RequestLoad:
+		if req.Dir == "" || len(req.MEK) != 32 {
+			return Response{Code: CodeBadRequest, Message: "dir and a 32-byte key are required"}
+		}
+		ttl, err := s.Load(filepath.Clean(req.Dir), req.MEK)
+		if err != nil {
+			return Response{Code: CodeInternal, Message: "could not start session"}
+		}
+		return Response{OK: true, Dir: filepath.Clean(req.Dir), TTLSeconds: ttl}
+	case RequestKey:
+		mek, dir, err := s.Session.Validate(req.Token, req.Nonce)
+		if err != nil {
+			if errors.Is(err, ErrExpired) || errors.Is(err, ErrInvalidState) {
+				os.Remove(tokenPath(s.path))
+				return Response{Code: CodeLocked, Message: "agent is locked"}
+			}
+			if _, _, ok := s.Session.Status(); !ok {
+				return Response{Code: CodeLocked, Message: "agent is locked"}
+			}
+			return Response{Code: CodeUnauthorized, Message: err.Error()}
+		}
+		if filepath.Clean(req.Dir) != dir {
+			zeroize(mek)
+			return Response{Code: CodeWrongVault, Message: "agent holds the key for another vault", Dir: dir}
+		}
+		return Response{OK: true, Dir: dir, MEK: mek}
+	case RequestLock, RequestStop:
+		s.lock()
+		return Response{OK: true}
+	default:
+		return Response{Code: CodeBadRequest, Message: "unsupported request"}
+	}
+}
+
+func writeResponse(conn net.Conn, resp Response) {
+	b, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+	b = append(b, '\n')
+	conn.Write(b)
+	zeroize(b)
+}
+
+// writeToken replaces the token file atomically with mode 0600.
+func writeToken(path, token string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".token-*")
+	if err != nil {
+		return fmt.Errorf("create token file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("restrict token file: %w", err)
+	}
+	if _, err := tmp.WriteString(token); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("write token file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("close token file: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("replace token file: %w", err)
+	}
+	return nil
+}
+
+func zeroize(buf []byte) {
+	for i := range buf {
+		buf[i] = 0
+	}
+}
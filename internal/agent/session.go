@@ -0,0 +1,233 @@
+// Package agent keeps an unlocked MEK in memory for a limited time and serves it to
+// other processes of the same user. Session holds the token, idle timeout and
+// replay-protection nonces shared by pm agent and the browser native host.
+package agent
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+)
+
+// DefaultIdleTimeout is how long an unused session stays unlocked.
+const DefaultIdleTimeout = 10 * time.Minute
+
+var (
+	// ErrUnauthorized indicates a missing or wrong token, or a caller that is not the session owner.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrExpired indicates the session was idle longer than its timeout and has been wiped.
+	ErrExpired = errors.New("expired")
+	// ErrInvalidState indicates the cached key is unusable; the session has been wiped.
+	ErrInvalidState = errors.New("invalid state")
+	// ErrNonceReplayed indicates the nonce was already used in this session.
+	ErrNonceReplayed = errors.New("nonce_replayed")
+)
+
+// Session caches one MEK behind a random token. Every successful request slides the
+// expiry forward by the idle timeout. The zero value is a locked session.
+type Session struct {
+	// IdleTimeout overrides DefaultIdleTimeout when positive.
+	IdleTimeout time.Duration
+
+	mutex    sync.Mutex //To avoid race conditions
+	token    string
+	mek      []byte
+	expires  time.Time
+	dir      string
+	nonces   map[string]struct{}
+	ownerUID string
+}
+
+func (s *Session) ttl() time.Duration {
+	if s.IdleTimeout > 0 {
+		return s.IdleTimeout
+	}
+	return DefaultIdleTimeout
+}
+
+// Establish replaces any prior unlocked session with the provided MEK and metadata.
+//
+// Args:
+//
+//	dir: absolute path to the unlocked vault directory.
+//	mek: decrypted master encryption key to cache.
+//
+// Returns:
+//
+//	string: newly generated session token.
+//	int: token lifetime in seconds.
+//	error: non-nil when token generation or state initialization fails.
+//
+// Behavior:
+//  1. Locks the session mutex and clears any existing state.
+//  2. Copies the MEK, generates a crypto-random token, and records directory/expiry.
+//  3. On failure, zeroizes partial state before returning the error.
+func (s *Session) Establish(dir string, mek []byte) (string, int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.clearLockedUnsafe()
+
+	s.mek = make([]byte, len(mek))
+	copy(s.mek, mek)
+
+	token, err := generateToken()
+	if err != nil {
+		s.clearLockedUnsafe()
+		return "", 0, err
+	}
+
+	ttl := s.ttl()
+	s.token = token
+	s.dir = dir
+	s.expires = time.Now().Add(ttl)
+	s.nonces = make(map[string]struct{})
+	s.ownerUID = currentUserIdentifier()
+
+	return token, int(ttl / time.Second), nil
+}
+
+// Validate confirms session authenticity and checks replay-protection nonce.
+//
+// Args:
+//
+//	token: session token presented by the caller.
+//	nonce: per-request nonce to enforce uniqueness.
+//
+// Returns:
+//
+//	[]byte: copy of the cached MEK when authorization succeeds.
+//	string: associated vault directory path.
+//	error: non-nil for missing, expired, mismatched, or replayed requests.
+//
+// Behavior:
+//  1. Locks the session mutex and ensures stored and supplied tokens/nonces are present.
+//  2. Rejects expired sessions or unexpected MEK lengths, clearing state when detected.
+//  3. Validates the caller's OS identity matches the session owner (when available).
+//  4. Enforces nonce uniqueness per session to prevent replayed requests.
+//  5. Extends the expiry window on successful validation and returns MEK/dir copies.
+func (s *Session) Validate(token, nonce string) ([]byte, string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.token == "" || token == "" || nonce == "" {
+		return nil, "", ErrUnauthorized
+	}
+	if time.Now().After(s.expires) {
+		s.clearLockedUnsafe()
+		return nil, "", ErrExpired
+	}
+	if subtle.ConstantTimeCompare([]byte(s.token), []byte(token)) != 1 {
+		return nil, "", ErrUnauthorized
+	}
+	if owner := s.ownerUID; owner != "" {
+		if current := currentUserIdentifier(); current != "" && current != owner {
+			return nil, "", ErrUnauthorized
+		}
+	}
+	if len(s.mek) != 32 {
+		s.clearLockedUnsafe()
+		return nil, "", ErrInvalidState
+	}
+	if s.nonces == nil {
+		s.nonces = make(map[string]struct{})
+	}
+	if _, exists := s.nonces[nonce]; exists {
+		return nil, "", ErrNonceReplayed
+	}
+	s.nonces[nonce] = struct{}{}
+
+	s.expires = time.Now().Add(s.ttl())
+
+	mekCopy := make([]byte, len(s.mek))
+	copy(mekCopy, s.mek)
+	return mekCopy, s.dir, nil
+}
+
+// Status reports the unlocked vault directory and when the session expires; ok is false
+// while locked. An idle session is wiped here rather than reported.
+func (s *Session) Status() (dir string, expires time.Time, ok bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.token == "" {
+		return "", time.Time{}, false
+	}
+	if time.Now().After(s.expires) {
+		s.clearLockedUnsafe()
+		return "", time.Time{}, false
+	}
+	return s.dir, s.expires, true
+}
+
+// Clear zeroizes and removes the active session.
+func (s *Session) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.clearLockedUnsafe()
+}
+
+func (s *Session) clearLockedUnsafe() {
+	zeroize(s.mek)
+	s.mek = nil
+	s.token = ""
+	s.dir = ""
+	s.expires = time.Time{}
+	s.nonces = nil
+	s.ownerUID = ""
+}
+
+// NewNonce returns a fresh random nonce for one request.
+func NewNonce() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// generateToken creates a cryptographically secure session token.
+//
+// Args:
+//
+//	None.
+//
+// Returns:
+//
+//	string: base64-encoded 256-bit token.
+//	error: non-nil when the random source fails.
+//
+// Behavior:
+//  1. Allocates a 32-byte buffer.
+//  2. Fills the buffer using crypto/rand.Read.
+//  3. Base64-encodes the buffer for JSON-safe transport.
+func generateToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf), nil //Encode it into ascii to avoid encoding issues in json responses
+}
+
+func currentUserIdentifier() string {
+	if usr, err := user.Current(); err == nil && usr != nil {
+		if usr.Uid != "" {
+			return usr.Uid
+		}
+		if usr.Username != "" {
+			return usr.Username
+		}
+	}
+	if val := os.Getenv("USER"); val != "" {
+		return val
+	}
+	if val := os.Getenv("USERNAME"); val != "" {
+		return val
+	}
+	return ""
+}
@@ -0,0 +1,271 @@
+// Package audit checks the passwords stored in a vault: reuse across entries, weak
+// zxcvbn scores, age since the last change, and optionally breach-list hits. Entries are
+// decrypted in memory only; reuse is found by comparing keyed hashes.
+package audit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/nbutton23/zxcvbn-go"
+
+	"github.com/Hussein-Mazeh/PasswordManager/auth"
+	dbpkg "github.com/Hussein-Mazeh/PasswordManager/internal/db"
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+	"github.com/Hussein-Mazeh/PasswordManager/store"
+)
+
+// Issue names one problem with a stored password.
+type Issue string
+
+const (
+	IssueReused   Issue = "reused"   // the same password is stored for another entry
+	IssueWeak     Issue = "weak"     // zxcvbn score below Options.MinScore
+	IssueOld      Issue = "old"      // unchanged for longer than Options.MaxAge
+	IssueBreached Issue = "breached" // found in the breach dataset
+)
+
+const (
+	// DefaultMinScore matches the zxcvbn score the master password policy asks for.
+	DefaultMinScore = 3
+	// DefaultMaxAge is how long a password may go unchanged before it is reported.
+	DefaultMaxAge = 365 * 24 * time.Hour
+)
+
+// Options configures Run.
+type Options struct {
+	MinScore int           // zxcvbn score (1-4) below which a password is weak; 0 means DefaultMinScore, negative is off
+	MaxAge   time.Duration // 0 means DefaultMaxAge; negative turns the age check off
+	HIBP     bool          // look every distinct password up in the breach dataset
+	// Lookup performs the breach lookup, e.g. a configured auth.BreachChecker's Check;
+	// nil means auth.CheckHIBP.
+	Lookup func(ctx context.Context, pw string) (auth.HIBPResult, error)
+	Now    time.Time // reference time for ages; zero means time.Now()
+}
+
+// Finding is an entry with at least one issue.
+type Finding struct {
+	EntryID     int64    `json:"entry_id"`
+	Website     string   `json:"website"`
+	Username    string   `json:"username"`
+	UpdatedAt   string   `json:"updated_at"`
+	AgeDays     int      `json:"age_days"`
+	Score       int      `json:"score"`
+	Issues      []Issue  `json:"issues"`
+	ReusedWith  []string `json:"reused_with,omitempty"`  // other entries as website/username
+	BreachCount int      `json:"breach_count,omitempty"` // 0 when the dataset has no counts (a Bloom filter)
+}
+
+// Report is the result of one audit.
+type Report struct {
+	Checked     int       `json:"entries_checked"`
+	Skipped     int       `json:"entries_skipped"` // entries without a password, or that do not decrypt
+	Reused      int       `json:"reused"`
+	Weak        int       `json:"weak"`
+	Old         int       `json:"old"`
+	Breached    int       `json:"breached"`
+	HIBPChecked bool      `json:"hibp_checked"`
+	Findings    []Finding `json:"findings"`
+	Errors      []string  `json:"errors,omitempty"`
+}
+
+// FromPolicy returns options that hold passwords to the password policy's minimum
+// score and maximum age.
+func FromPolicy(pol store.Policy) Options {
+	opts := Options{MinScore: pol.MinScore, MaxAge: pol.MaxAge}
+	if opts.MinScore == 0 {
+		opts.MinScore = -1
+	}
+	if opts.MaxAge == 0 {
+		opts.MaxAge = -1
+	}
+	return opts
+}
+
+// Clean reports whether the audit found no issues.
+func (r *Report) Clean() bool { return len(r.Findings) == 0 }
+
+// Has reports whether the finding includes issue.
+func (f *Finding) Has(issue Issue) bool { return slices.Contains(f.Issues, issue) }
+
+// Run audits every live entry of the vault.
+//
+// Args:
+//
+//	ctx: bounds the breach lookups.
+//	d, keys, mek: the open database, its metadata keys and the master encryption key.
+//	opts: thresholds and whether to check the breach dataset; see Options.
+//
+// Returns:
+//
+//	Report: counts and one Finding per entry with issues, ordered by website and username.
+//	error: non-nil only when the entries cannot be listed.
+//
+// Behavior:
+//  1. Decrypts each live entry; trashed entries and TOTP keys are left out, and entries
+//     that do not decrypt are counted as skipped and named in Errors.
+//  2. Groups passwords by HMAC-SHA256 under a random key that lives for this run only,
+//     so plaintexts are never compared or kept beyond their own entry's checks.
+//  3. Scores each password with zxcvbn, using the website and username as user inputs,
+//     and measures its age from updated_at.
+//  4. With opts.HIBP, looks each distinct password up once. The first failed lookup is
+//     reported in Errors and ends the breach check, so an offline machine does not wait
+//     on one timeout per entry.
+func Run(ctx context.Context, d *dbpkg.DB, keys *vault.MetaKeys, mek []byte, opts Options) (Report, error) {
+	if opts.MinScore == 0 {
+		opts.MinScore = DefaultMinScore
+	}
+	if opts.MinScore > 4 {
+		opts.MinScore = 4
+	}
+	if opts.MaxAge == 0 {
+		opts.MaxAge = DefaultMaxAge
+	}
+	if opts.Lookup == nil {
+		opts.Lookup = auth.CheckHIBP
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+
+	rows, err := dbpkg.ListEntries(d, keys)
+	if err != nil {
+		return Report{}, err
+	}
+
+	hashKey := make([]byte, 32)
+	if _, err := rand.Read(hashKey); err != nil {
+		return Report{}, fmt.Errorf("read random: %w", err)
+	}
+	defer wipe(hashKey)
+
+	type audited struct {
+		finding Finding
+		hash    string
+	}
+	var entries []audited
+	breached := make(map[string]auth.HIBPResult)
+	hibpOK := opts.HIBP
+
+	report := Report{Findings: []Finding{}}
+	for _, r := range rows {
+		if r.Type == vault.TypeTOTP {
+			continue
+		}
+		plain, _, _, err := vault.DecryptEntryPassword(mek, r.Suite, r.Website, r.Username, r.Type, r.Salt, r.EncryptedPass)
+		if err != nil {
+			report.Skipped++
+			report.Errors = append(report.Errors, fmt.Sprintf("entry %d does not decrypt; run pm doctor", r.ID))
+			continue
+		}
+		payload, err := vault.DecodePayload(r.Format, plain)
+		if err != nil {
+			report.Skipped++
+			report.Errors = append(report.Errors, fmt.Sprintf("entry %d: %v", r.ID, err))
+			continue
+		}
+		pw := payload.Password
+		if pw == "" {
+			report.Skipped++
+			continue
+		}
+		report.Checked++
+
+		mac := hmac.New(sha256.New, hashKey)
+		mac.Write([]byte(pw))
+		hash := string(mac.Sum(nil))
+
+		f := Finding{
+			EntryID:   r.ID,
+			Website:   r.Website,
+			Username:  r.Username,
+			UpdatedAt: r.UpdatedAt,
+			Score:     zxcvbn.PasswordStrength(pw, []string{r.Website, r.Username}).Score,
+		}
+		if opts.MinScore > 0 && f.Score < opts.MinScore {
+			f.Issues = append(f.Issues, IssueWeak)
+		}
+		if updated, ok := parseTimestamp(r.UpdatedAt); ok {
+			age := opts.Now.Sub(updated)
+			f.AgeDays = int(age / (24 * time.Hour))
+			if opts.MaxAge > 0 && age > opts.MaxAge {
+				f.Issues = append(f.Issues, IssueOld)
+			}
+		}
+
+		if _, seen := breached[hash]; hibpOK && !seen {
+			res, err := opts.Lookup(ctx, pw)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("breach check stopped: %v", err))
+				hibpOK = false
+			} else {
+				breached[hash] = res
+			}
+		}
+		entries = append(entries, audited{finding: f, hash: hash})
+	}
+	report.HIBPChecked = opts.HIBP && hibpOK
+
+	groups := make(map[string][]int)
+	for i, e := range entries {
+		groups[e.hash] = append(groups[e.hash], i)
+	}
+	for i := range entries {
+		f := &entries[i].finding
+		if group := groups[entries[i].hash]; len(group) > 1 {
+			f.Issues = append(f.Issues, IssueReused)
+			for _, j := range group {
+				if j != i {
+					f.ReusedWith = append(f.ReusedWith, entries[j].finding.Website+"/"+entries[j].finding.Username)
+				}
+			}
+		}
+		if res := breached[entries[i].hash]; res.Found {
+			f.Issues = append(f.Issues, IssueBreached)
+			f.BreachCount = res.Count
+		}
+		if len(f.Issues) == 0 {
+			continue
+		}
+		sort.Slice(f.Issues, func(a, b int) bool { return issueOrder[f.Issues[a]] < issueOrder[f.Issues[b]] })
+		for _, issue := range f.Issues {
+			switch issue {
+			case IssueReused:
+				report.Reused++
+			case IssueWeak:
+				report.Weak++
+			case IssueOld:
+				report.Old++
+			case IssueBreached:
+				report.Breached++
+			}
+		}
+		report.Findings = append(report.Findings, *f)
+	}
+	return report, nil
+}
+
+// issueOrder lists the most urgent issue first.
+var issueOrder = map[Issue]int{IssueBreached: 0, IssueReused: 1, IssueWeak: 2, IssueOld: 3}
+
+// parseTimestamp reads a SQLite DATETIME as returned by the driver.
+func parseTimestamp(s string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,218 @@
+// Package backup writes consistent snapshots of a vault directory to a single bundle
+// file and restores them after validating every part.
+//
+// A bundle is a zip archive holding manifest.json, vault.db and header.json. The
+// database is copied with VACUUM INTO, and header.json is read before and after the
+// copy; if it changed in between (a key rotation or slot change was running) the
+// snapshot is retried, so the two files always come from the same moment.
+package backup
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	dbpkg "github.com/Hussein-Mazeh/PasswordManager/internal/db"
+	"github.com/Hussein-Mazeh/PasswordManager/store"
+)
+
+const (
+	manifestName = "manifest.json"
+	dbName       = "vault.db"
+	headerName   = "header.json"
+
+	// ManifestVersion is the layout version written in Manifest.Version.
+	ManifestVersion = 1
+
+	snapshotAttempts = 5
+	// maxFileSize bounds what Open extracts, so a crafted bundle cannot fill the disk.
+	maxFileSize = 1 << 30
+)
+
+// ErrHeaderBusy indicates header.json kept changing while the database was copied.
+var ErrHeaderBusy = errors.New("vault header changed during every snapshot attempt; retry when no key rotation is running")
+
+// Manifest describes a bundle. It is written first in the zip archive.
+type Manifest struct {
+	Format        string     `json:"format"` // always "pm-backup"
+	Version       int        `json:"version"`
+	CreatedAt     string     `json:"created_at"`
+	SchemaVersion int        `json:"schema_version"` // PRAGMA user_version of vault.db
+	HeaderVersion int        `json:"header_version"`
+	Files         []FileInfo `json:"files"`
+}
+
+// FileInfo is the size and SHA-256 of one file in the bundle.
+type FileInfo struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Create snapshots the vault in dir and writes the bundle to w.
+//
+// Args:
+//
+//	dir: vault directory holding vault.db and header.json.
+//	w: destination for the zip archive.
+//
+// Returns:
+//
+//	Manifest: what was written.
+//	error: non-nil when the vault is missing, the snapshot fails, or ErrHeaderBusy.
+//
+// Behavior:
+//  1. Copies the database into a private temporary directory with VACUUM INTO, which
+//     needs no key and does not block other readers or writers for long.
+//  2. Keeps the copy only if header.json was byte-for-byte the same before and after.
+//  3. Writes manifest.json, vault.db and header.json to the archive.
+func Create(dir string, w io.Writer) (Manifest, error) {
+	dbPath := filepath.Join(dir, dbName)
+	if _, err := os.Stat(dbPath); err != nil {
+		return Manifest{}, fmt.Errorf("vault database: %w", err)
+	}
+
+	stage, err := os.MkdirTemp("", "pm-backup-")
+	if err != nil {
+		return Manifest{}, fmt.Errorf("create staging directory: %w", err)
+	}
+	defer os.RemoveAll(stage)
+
+	header, err := snapshot(dir, filepath.Join(stage, dbName))
+	if err != nil {
+		return Manifest{}, err
+	}
+	if err := os.WriteFile(filepath.Join(stage, headerName), header, 0o600); err != nil {
+		return Manifest{}, fmt.Errorf("stage header: %w", err)
+	}
+
+	m, err := describe(stage)
+	if err != nil {
+		return Manifest{}, err
+	}
+	if err := writeBundle(w, stage, m); err != nil {
+		return Manifest{}, err
+	}
+	return m, nil
+}
+
+// snapshot copies vault.db to dest and returns the header.json that matches it.
+func snapshot(dir, dest string) ([]byte, error) {
+	database, err := dbpkg.Open(filepath.Join(dir, dbName))
+	if err != nil {
+		return nil, err
+	}
+	defer dbpkg.Close(database)
+
+	for attempt := 0; attempt < snapshotAttempts; attempt++ {
+		before, err := os.ReadFile(filepath.Join(dir, headerName))
+		if err != nil {
+			return nil, fmt.Errorf("read header: %w", err)
+		}
+		os.Remove(dest)
+		if err := dbpkg.Snapshot(database, dest); err != nil {
+			return nil, err
+		}
+		after, err := os.ReadFile(filepath.Join(dir, headerName))
+		if err != nil {
+			return nil, fmt.Errorf("read header: %w", err)
+		}
+		if bytes.Equal(before, after) {
+			return after, nil
+		}
+		time.Sleep(time.Duration(attempt+1) * 200 * time.Millisecond)
+	}
+	return nil, ErrHeaderBusy
+}
+
+// describe builds the manifest for the staged vault.db and header.json.
+func describe(stage string) (Manifest, error) {
+	m := Manifest{
+		Format:    "pm-backup",
+		Version:   ManifestVersion,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	hdr, err := store.LoadVaultHeader(store.Paths{Dir: stage})
+	if err != nil {
+		return Manifest{}, err
+	}
+	m.HeaderVersion = hdr.Version
+
+	database, err := dbpkg.Open(filepath.Join(stage, dbName))
+	if err != nil {
+		return Manifest{}, err
+	}
+	m.SchemaVersion, err = dbpkg.UserVersion(database)
+	dbpkg.Close(database)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	for _, name := range []string{dbName, headerName} {
+		info, err := checksum(filepath.Join(stage, name))
+		if err != nil {
+			return Manifest{}, err
+		}
+		info.Name = name
+		m.Files = append(m.Files, info)
+	}
+	return m, nil
+}
+
+func checksum(path string) (FileInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return FileInfo{}, fmt.Errorf("hash %s: %w", filepath.Base(path), err)
+	}
+	return FileInfo{Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+func writeBundle(w io.Writer, stage string, m Manifest) error {
+	zw := zip.NewWriter(w)
+	now := time.Now()
+	create := func(name string) (io.Writer, error) {
+		return zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now})
+	}
+
+	mw, err := create(manifestName)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(mw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(m); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+
+	for _, f := range m.Files {
+		fw, err := create(f.Name)
+		if err != nil {
+			return err
+		}
+		src, err := os.Open(filepath.Join(stage, f.Name))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(fw, src)
+		src.Close()
+		if err != nil {
+			return fmt.Errorf("write %s: %w", f.Name, err)
+		}
+	}
+	return zw.Close()
+}
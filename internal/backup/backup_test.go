@@ -0,0 +1,217 @@
+package backup
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	dbpkg "github.com/Hussein-Mazeh/PasswordManager/internal/db"
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+	"github.com/Hussein-Mazeh/PasswordManager/store"
+)
+
+// newVault writes a vault with one entry to dir and returns its MEK.
+func newVault(t *testing.T, dir, password string) []byte {
+	t.Helper()
+	mek := make([]byte, 32)
+	salt := make([]byte, krypto.SaltLengthBytes)
+	if _, err := rand.Read(mek); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rand.Read(salt); err != nil {
+		t.Fatal(err)
+	}
+
+	kdf := vault.NewArgon2KDFConfig(krypto.Argon2Params{MemoryMB: 8, Time: 1, Parallelism: 1, SaltLen: krypto.SaltLengthBytes, KeyLen: 32})
+	pdk, err := store.DerivePassphraseKey(kdf, []byte("master"), salt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slot, err := store.WrapKeySlot(store.MasterSlotLabel, kdf, salt, pdk, mek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr := vault.VaultHeader{Version: 2, User: "u", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if _, _, err := store.AddKeySlot(store.Paths{Dir: dir}, hdr, slot, mek); err != nil {
+		t.Fatal(err)
+	}
+
+	database, err := dbpkg.Open(filepath.Join(dir, dbName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbpkg.Close(database)
+	if err := dbpkg.Migrate(database); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := vault.DeriveMetaKeys(mek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	esalt, blob, err := vault.EncryptEntryPassword(mek, krypto.DefaultSuite, "example.com", "alice", vault.TypePassword, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dbpkg.InsertEntry(database, keys, "example.com", "alice", vault.TypePassword, krypto.DefaultSuite, vault.PayloadFormatRaw, esalt, blob); err != nil {
+		t.Fatal(err)
+	}
+	return mek
+}
+
+// readEntry returns the password stored for example.com/alice in dir.
+func readEntry(t *testing.T, dir string, mek []byte) string {
+	t.Helper()
+	database, err := dbpkg.Open(filepath.Join(dir, dbName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbpkg.Close(database)
+	keys, err := vault.DeriveMetaKeys(mek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	row, err := dbpkg.GetEntryBySiteAndUser(database, keys, "example.com", "alice")
+	if err != nil {
+		t.Fatalf("look up entry: %v", err)
+	}
+	pw, _, _, err := vault.DecryptEntryPassword(mek, row.Suite, row.Website, row.Username, row.Type, row.Salt, row.EncryptedPass)
+	if err != nil {
+		t.Fatalf("decrypt entry: %v", err)
+	}
+	return pw
+}
+
+func writeBackup(t *testing.T, dir string) (string, Manifest) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "vault.pmbak")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := Create(dir, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return path, m
+}
+
+func TestCreateOpenRestoreRoundTrip(t *testing.T) {
+	src := t.TempDir()
+	mek := newVault(t, src, "backed-up")
+	path, m := writeBackup(t, src)
+	if m.SchemaVersion != dbpkg.SchemaVersion() || len(m.Files) != 2 {
+		t.Fatalf("manifest %+v", m)
+	}
+
+	b, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer b.Close()
+
+	// Restoring into an empty directory moves nothing aside.
+	fresh := filepath.Join(t.TempDir(), "restored")
+	saved, err := b.Restore(fresh)
+	if err != nil || saved != "" {
+		t.Fatalf("Restore into empty dir = %q, %v", saved, err)
+	}
+	if got := readEntry(t, fresh, mek); got != "backed-up" {
+		t.Fatalf("restored password %q", got)
+	}
+
+	// Restoring over a vault keeps the old files in pre-restore-*.
+	other := t.TempDir()
+	otherMEK := newVault(t, other, "replaced")
+	saved, err = b.Restore(other)
+	if err != nil || saved == "" {
+		t.Fatalf("Restore over vault = %q, %v", saved, err)
+	}
+	if got := readEntry(t, other, mek); got != "backed-up" {
+		t.Fatalf("restored password %q", got)
+	}
+	if got := readEntry(t, saved, otherMEK); got != "replaced" {
+		t.Fatalf("moved-aside password %q", got)
+	}
+}
+
+// rewriteBundle copies the bundle at path, passing every file through edit.
+func rewriteBundle(t *testing.T, path string, edit func(name string, data []byte) []byte) string {
+	t.Helper()
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data = edit(f.Name, data); data == nil {
+			continue
+		}
+		w, err := zw.Create(f.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "edited.pmbak")
+	if err := os.WriteFile(out, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestOpenRejectsDamagedBundles(t *testing.T) {
+	src := t.TempDir()
+	newVault(t, src, "pw")
+	path, _ := writeBackup(t, src)
+
+	for name, edit := range map[string]func(string, []byte) []byte{
+		"flipped database byte": func(name string, data []byte) []byte {
+			if name == dbName {
+				data[len(data)/2] ^= 1
+			}
+			return data
+		},
+		"missing header": func(name string, data []byte) []byte {
+			if name == headerName {
+				return nil
+			}
+			return data
+		},
+		"modified header": func(name string, data []byte) []byte {
+			if name == headerName {
+				return append(data, ' ')
+			}
+			return data
+		},
+	} {
+		b, err := Open(rewriteBundle(t, path, edit))
+		if !errors.Is(err, ErrInvalidBundle) {
+			b.Close()
+			t.Errorf("%s: err = %v, want ErrInvalidBundle", name, err)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package backup
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	dbpkg "github.com/Hussein-Mazeh/PasswordManager/internal/db"
+	"github.com/Hussein-Mazeh/PasswordManager/store"
+)
+
+// ErrInvalidBundle indicates a bundle failed validation; nothing was restored.
+var ErrInvalidBundle = errors.New("invalid backup bundle")
+
+// Bundle is a validated backup extracted to a private staging directory. Close removes it.
+type Bundle struct {
+	Manifest Manifest
+	stage    string
+}
+
+// Close deletes the staged files.
+func (b *Bundle) Close() {
+	if b != nil && b.stage != "" {
+		os.RemoveAll(b.stage)
+	}
+}
+
+// Open extracts and validates the bundle at path.
+//
+// Args:
+//
+//	path: bundle written by Create.
+//
+// Returns:
+//
+//	*Bundle: staged, validated copy; the caller must Close it.
+//	error: wraps ErrInvalidBundle when any check fails.
+//
+// Behavior:
+//  1. Accepts only manifest.json, vault.db and header.json, each at most once.
+//  2. Checks the manifest format, and every file's size and SHA-256 against it.
+//  3. Decodes header.json and applies store.CheckHeader and store.CheckHeaderSealed.
+//  4. Runs PRAGMA integrity_check on vault.db and refuses schemas newer than this build.
+func Open(path string) (*Bundle, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+	defer zr.Close()
+
+	stage, err := os.MkdirTemp("", "pm-restore-")
+	if err != nil {
+		return nil, fmt.Errorf("create staging directory: %w", err)
+	}
+	b := &Bundle{stage: stage}
+	if err := b.extract(&zr.Reader); err != nil {
+		b.Close()
+		return nil, err
+	}
+	if err := b.validate(); err != nil {
+		b.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *Bundle) extract(zr *zip.Reader) error {
+	seen := make(map[string]bool)
+	for _, f := range zr.File {
+		switch f.Name {
+		case manifestName, dbName, headerName:
+		default:
+			return fmt.Errorf("%w: unexpected file %q", ErrInvalidBundle, f.Name)
+		}
+		if seen[f.Name] {
+			return fmt.Errorf("%w: duplicate file %q", ErrInvalidBundle, f.Name)
+		}
+		seen[f.Name] = true
+
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidBundle, f.Name, err)
+		}
+		err = writeLimited(filepath.Join(b.stage, f.Name), rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidBundle, f.Name, err)
+		}
+	}
+	if !seen[manifestName] {
+		return fmt.Errorf("%w: no manifest", ErrInvalidBundle)
+	}
+
+	data, err := os.ReadFile(filepath.Join(b.stage, manifestName))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &b.Manifest); err != nil {
+		return fmt.Errorf("%w: manifest: %v", ErrInvalidBundle, err)
+	}
+	return nil
+}
+
+func writeLimited(path string, r io.Reader) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, io.LimitReader(r, maxFileSize+1))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && n > maxFileSize {
+		err = errors.New("file too large")
+	}
+	return err
+}
+
+func (b *Bundle) validate() error {
+	m := b.Manifest
+	if m.Format != "pm-backup" {
+		return fmt.Errorf("%w: not a pm backup", ErrInvalidBundle)
+	}
+	if m.Version != ManifestVersion {
+		return fmt.Errorf("%w: unsupported manifest version %d", ErrInvalidBundle, m.Version)
+	}
+
+	listed := make(map[string]FileInfo)
+	for _, f := range m.Files {
+		listed[f.Name] = f
+	}
+	for _, name := range []string{dbName, headerName} {
+		want, ok := listed[name]
+		if !ok {
+			return fmt.Errorf("%w: manifest does not list %s", ErrInvalidBundle, name)
+		}
+		got, err := checksum(filepath.Join(b.stage, name))
+		if err != nil {
+			return fmt.Errorf("%w: %s missing", ErrInvalidBundle, name)
+		}
+		if got.Size != want.Size || got.SHA256 != want.SHA256 {
+			return fmt.Errorf("%w: %s does not match its checksum", ErrInvalidBundle, name)
+		}
+	}
+
+	hdr, err := store.LoadVaultHeader(store.Paths{Dir: b.stage})
+	if err != nil {
+		return fmt.Errorf("%w: header: %v", ErrInvalidBundle, err)
+	}
+	if err := store.CheckHeader(hdr); err != nil {
+		return fmt.Errorf("%w: header: %v", ErrInvalidBundle, err)
+	}
+	if err := store.CheckHeaderSealed(store.Paths{Dir: b.stage}, hdr); err != nil {
+		return fmt.Errorf("%w: header: %v", ErrInvalidBundle, err)
+	}
+
+	database, err := dbpkg.Open(filepath.Join(b.stage, dbName))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+	defer dbpkg.Close(database)
+	problems, err := dbpkg.IntegrityCheck(database)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: vault.db integrity check: %s", ErrInvalidBundle, problems[0])
+	}
+	schema, err := dbpkg.UserVersion(database)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+	if schema > dbpkg.SchemaVersion() {
+		return fmt.Errorf("%w: %w (schema %d, supported %d)", ErrInvalidBundle, dbpkg.ErrSchemaTooNew, schema, dbpkg.SchemaVersion())
+	}
+	return nil
+}
+
+// Restore replaces the vault in dir with the bundle. Existing vault files are moved to
+// a pre-restore-<timestamp> directory inside dir rather than deleted, and their path is
+// returned ("" when dir held no vault). Stop the GUI, native host and pm agent first:
+// a process holding the old database open keeps reading the moved file.
+func (b *Bundle) Restore(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("create vault directory: %w", err)
+	}
+
+	defer func() {
+		for _, name := range []string{dbName, headerName} {
+			os.Remove(filepath.Join(dir, name+".restore"))
+		}
+	}()
+	// Copy into dir first so the final step is a same-directory rename.
+	for _, name := range []string{dbName, headerName} {
+		if err := copyFile(filepath.Join(b.stage, name), filepath.Join(dir, name+".restore")); err != nil {
+			return "", err
+		}
+	}
+
+	var saved string
+	for _, name := range []string{dbName, dbName + "-journal", dbName + "-wal", dbName + "-shm", headerName} {
+		src := filepath.Join(dir, name)
+		if _, err := os.Lstat(src); err != nil {
+			continue
+		}
+		if saved == "" {
+			saved = filepath.Join(dir, "pre-restore-"+time.Now().UTC().Format("20060102T150405Z"))
+			if err := os.Mkdir(saved, 0o700); err != nil {
+				return "", fmt.Errorf("create %s: %w", saved, err)
+			}
+		}
+		if err := os.Rename(src, filepath.Join(saved, name)); err != nil {
+			return saved, fmt.Errorf("move %s aside: %w", name, err)
+		}
+	}
+
+	for _, name := range []string{dbName, headerName} {
+		if err := os.Rename(filepath.Join(dir, name+".restore"), filepath.Join(dir, name)); err != nil {
+			return saved, fmt.Errorf("install %s: %w", name, err)
+		}
+	}
+	return saved, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", filepath.Base(dst), err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return fmt.Errorf("copy %s: %w", filepath.Base(dst), err)
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return fmt.Errorf("sync %s: %w", filepath.Base(dst), err)
+	}
+	return out.Close()
+}
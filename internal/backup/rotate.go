@@ -0,0 +1,91 @@
+package backup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const bundlePrefix = "pm-backup-"
+
+// BundleName returns the file name used for a bundle created at t. Names sort in
+// creation order.
+func BundleName(t time.Time) string {
+	return bundlePrefix + t.UTC().Format("20060102T150405Z") + ".zip"
+}
+
+// CreateFile writes a bundle to path. The bundle is written to a temporary file in the
+// same directory and moved into place, so path never holds a partial bundle; an
+// existing file at path is an error.
+func CreateFile(dir, path string) (Manifest, error) {
+	if _, err := os.Lstat(path); err == nil {
+		return Manifest{}, fmt.Errorf("%s: %w", path, os.ErrExist)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".pm-backup-*.tmp")
+	if err != nil {
+		return Manifest{}, fmt.Errorf("create bundle: %w", err)
+	}
+	tmpPath := tmp.Name()
+
+	m, err := Create(dir, tmp)
+	if err == nil {
+		err = tmp.Chmod(0o600)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		// Link fails rather than replacing a file that appeared meanwhile.
+		err = os.Link(tmpPath, path)
+	}
+	os.Remove(tmpPath)
+	if err != nil {
+		return Manifest{}, err
+	}
+	return m, nil
+}
+
+// Rotate writes a new timestamped bundle into outDir and then deletes the oldest
+// pm-backup-*.zip files there until at most keep remain (keep <= 0 keeps all). It
+// returns the new bundle's path and the paths it removed.
+func Rotate(dir, outDir string, keep int) (string, []string, error) {
+	if err := os.MkdirAll(outDir, 0o700); err != nil {
+		return "", nil, fmt.Errorf("create backup directory: %w", err)
+	}
+	path := filepath.Join(outDir, BundleName(time.Now()))
+	if _, err := CreateFile(dir, path); err != nil {
+		return "", nil, err
+	}
+	if keep <= 0 {
+		return path, nil, nil
+	}
+
+	entries, err := os.ReadDir(outDir)
+	if err != nil {
+		return path, nil, fmt.Errorf("list backups: %w", err)
+	}
+	var bundles []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && strings.HasPrefix(e.Name(), bundlePrefix) && strings.HasSuffix(e.Name(), ".zip") {
+			bundles = append(bundles, e.Name())
+		}
+	}
+	sort.Strings(bundles)
+
+	var removed []string
+	for len(bundles) > keep {
+		old := filepath.Join(outDir, bundles[0])
+		if err := os.Remove(old); err != nil {
+			return path, removed, fmt.Errorf("remove old backup: %w", err)
+		}
+		removed = append(removed, old)
+		bundles = bundles[1:]
+	}
+	return path, removed, nil
+}
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+)
+
+// MigrateCipher re-encrypts every entry not already sealed with suite "to" and returns
+// how many rows changed. Password history rows are converted too. All rows are converted
+// in one transaction; on error nothing changes. The MEK and metadata are untouched, only
+// the password blobs and salts.
+func MigrateCipher(d *DB, mek []byte, to krypto.Suite) (int, error) {
+	if d == nil || d.sql == nil {
+		return 0, fmt.Errorf("database handle is nil")
+	}
+	if !to.Valid() {
+		return 0, krypto.ErrUnknownSuite
+	}
+
+	keys, err := vault.DeriveMetaKeys(mek)
+	if err != nil {
+		return 0, fmt.Errorf("derive metadata keys: %w", err)
+	}
+	defer keys.Wipe()
+
+	tx, err := d.sql.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("begin cipher migration: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT ` + entryColumns + ` FROM passwords`)
+	if err != nil {
+		return 0, fmt.Errorf("select entries: %w", err)
+	}
+	entries, err := collectEntries(keys, rows)
+	if err != nil {
+		return 0, err
+	}
+
+	converted := 0
+	for _, r := range entries {
+		if r.Suite == to {
+			continue
+		}
+		plaintext, _, _, err := vault.DecryptEntryPassword(mek, r.Suite, r.Website, r.Username, r.Type, r.Salt, r.EncryptedPass)
+		if err != nil {
+			return 0, fmt.Errorf("decrypt entry %d: %w", r.ID, err)
+		}
+		salt, enc, err := vault.EncryptEntryPassword(mek, to, r.Website, r.Username, r.Type, plaintext)
+		if err != nil {
+			return 0, fmt.Errorf("encrypt entry %d: %w", r.ID, err)
+		}
+		if _, err := tx.Exec(
+			`UPDATE passwords SET encrypted_pass = ?, salt = ?, cipher_suite = ? WHERE id = ?`,
+			enc, salt, to, r.ID,
+		); err != nil {
+			return 0, fmt.Errorf("update entry %d: %w", r.ID, err)
+		}
+		converted++
+	}
+
+	if err := reencryptHistory(tx, entries, func(r EntryRow, h HistoryRow) (krypto.Suite, []byte, []byte, error) {
+		if h.Suite == to {
+			return h.Suite, nil, nil, nil
+		}
+		plaintext, _, _, err := vault.DecryptEntryPassword(mek, h.Suite, r.Website, r.Username, h.Type, h.Salt, h.EncryptedPass)
+		if err != nil {
+			return 0, nil, nil, fmt.Errorf("decrypt: %w", err)
+		}
+		salt, enc, err := vault.EncryptEntryPassword(mek, to, r.Website, r.Username, h.Type, plaintext)
+		return to, salt, enc, err
+	}); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit cipher migration: %w", err)
+	}
+	return converted, nil
+}
@@ -3,9 +3,14 @@ package db
 import (
 	"database/sql"
 	"fmt"
+	"sort"
+
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
 )
 
 // EntryRow represents a credential row retrieved from storage.
+// Website and Username hold the decrypted metadata values.
 type EntryRow struct {
 	ID            int64
 	EncryptedPass []byte
@@ -13,19 +18,84 @@ type EntryRow struct {
 	Website       string
 	Username      string
 	Type          string
+	Suite         krypto.Suite
+	Format        int // vault.PayloadFormat* describing the decrypted plaintext
 	CreatedAt     string
 	UpdatedAt     string
+	DeletedAt     string // empty unless the entry is in the trash
+}
+
+const entryColumns = `id, encrypted_pass, salt, website_enc, username_enc, type, cipher_suite, payload_format, created_at, updated_at, deleted_at`
+
+// scanEntry reads one entry row and decrypts its metadata columns.
+func scanEntry(keys *vault.MetaKeys, scan func(dest ...any) error) (EntryRow, error) {
+	var (
+		r           EntryRow
+		websiteEnc  []byte
+		usernameEnc []byte
+		deletedAt   sql.NullString
+	)
+	if err := scan(
+		&r.ID,
+		&r.EncryptedPass,
+		&r.Salt,
+		&websiteEnc,
+		&usernameEnc,
+		&r.Type,
+		&r.Suite,
+		&r.Format,
+		&r.CreatedAt,
+		&r.UpdatedAt,
+		&deletedAt,
+	); err != nil {
+		return r, err
+	}
+	r.DeletedAt = deletedAt.String
+
+	website, err := keys.OpenMeta(vault.MetaFieldWebsite, websiteEnc)
+	if err != nil {
+		return r, fmt.Errorf("entry %d: %w", r.ID, err)
+	}
+	username, err := keys.OpenMeta(vault.MetaFieldUsername, usernameEnc)
+	if err != nil {
+		return r, fmt.Errorf("entry %d: %w", r.ID, err)
+	}
+	r.Website = website
+	r.Username = username
+	return r, nil
 }
 
-// InsertEntry stores a new credential row and returns its database ID.
-func InsertEntry(d *DB, website, username, typ string, salt, enc []byte) (int64, error) {
+// InsertEntry stores a new credential row sealed with suite and returns its database ID.
+// format records how the plaintext is laid out (see vault.PayloadFormatJSON). It returns
+// ErrEntryInTrash when the same website and username are waiting in the trash, and
+// ErrEntryExists when a live entry of the same type holds them. Entries of
+// type vault.TypeTOTP are stored under MetaKeys.TOTPIndex, beside the password entry.
+func InsertEntry(d *DB, keys *vault.MetaKeys, website, username, typ string, suite krypto.Suite, format int, salt, enc []byte) (int64, error) {
 	if d == nil || d.sql == nil {
 		return 0, fmt.Errorf("database handle is nil")
 	}
+	if keys == nil {
+		return 0, fmt.Errorf("metadata keys are nil")
+	}
+
+	entryIndex := keys.IndexFor(website, username, typ)
+	if err := indexHeld(d, entryIndex); err != nil {
+		return 0, err
+	}
+
+	websiteEnc, err := keys.SealMeta(vault.MetaFieldWebsite, website)
+	if err != nil {
+		return 0, err
+	}
+	usernameEnc, err := keys.SealMeta(vault.MetaFieldUsername, username)
+	if err != nil {
+		return 0, err
+	}
 
 	res, err := d.sql.Exec(
-		`INSERT INTO passwords (encrypted_pass, salt, website, username, type) VALUES (?, ?, ?, ?, ?)`,
-		enc, salt, website, username, typ,
+		`INSERT INTO passwords (encrypted_pass, salt, site_index, entry_index, website_enc, username_enc, type, cipher_suite, payload_format)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		enc, salt, keys.SiteIndex(website), entryIndex, websiteEnc, usernameEnc, typ, suite, format,
 	)
 	if err != nil {
 		return 0, fmt.Errorf("insert entry: %w", err)
@@ -39,15 +109,17 @@ func InsertEntry(d *DB, website, username, typ string, salt, enc []byte) (int64,
 	return id, nil
 }
 
-// UpdateEntryCipher rotates the salt, encrypted blob, and optional type for an existing credential.
-func UpdateEntryCipher(d *DB, id int64, typ string, salt, enc []byte) error {
+// UpdateEntryCipher rotates the salt, encrypted blob, cipher suite, payload format, and optional type for an existing credential.
+// updated_at is left alone: it records when the user last changed the entry, which the
+// password audit reads as the password's age, and re-encryption changes nothing the user sees.
+func UpdateEntryCipher(d *DB, id int64, typ string, suite krypto.Suite, format int, salt, enc []byte) error {
 	if d == nil || d.sql == nil {
 		return fmt.Errorf("database handle is nil")
 	}
 
 	_, err := d.sql.Exec(
-		`UPDATE passwords SET encrypted_pass = ?, salt = ?, type = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
-		enc, salt, typ, id,
+		`UPDATE passwords SET encrypted_pass = ?, salt = ?, type = ?, cipher_suite = ?, payload_format = ? WHERE id = ?`,
+		enc, salt, typ, suite, format, id,
 	)
 	if err != nil {
 		return fmt.Errorf("update entry cipher: %w", err)
@@ -56,70 +128,52 @@ func UpdateEntryCipher(d *DB, id int64, typ string, salt, enc []byte) error {
 	return nil
 }
 
-// GetEntryByWebsite returns all entries for a given website.
-func GetEntryByWebsite(d *DB, website string) ([]EntryRow, error) {
+// GetEntryByWebsite returns all entries whose website shares the eTLD+1 of the given website.
+// Entries in the trash are skipped, as they are by every lookup in this file, and so are
+// TOTP entries, which GetTOTPByWebsite returns.
+func GetEntryByWebsite(d *DB, keys *vault.MetaKeys, website string) ([]EntryRow, error) {
 	if d == nil || d.sql == nil {
 		return nil, fmt.Errorf("database handle is nil")
 	}
+	if keys == nil {
+		return nil, fmt.Errorf("metadata keys are nil")
+	}
 
 	rows, err := d.sql.Query(
-		`SELECT id, encrypted_pass, salt, website, username, type, created_at, updated_at
+		`SELECT `+entryColumns+`
 		 FROM passwords
-		 WHERE website = ?
-		 ORDER BY username`,
-		website,
+		 WHERE site_index = ? AND type <> ? AND deleted_at IS NULL`,
+		keys.SiteIndex(website), vault.TypeTOTP,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("select entries by website: %w", err)
 	}
 	defer rows.Close()
 
-	var results []EntryRow
-	for rows.Next() {
-		var r EntryRow
-		if err := rows.Scan(
-			&r.ID,
-			&r.EncryptedPass,
-			&r.Salt,
-			&r.Website,
-			&r.Username,
-			&r.Type,
-			&r.CreatedAt,
-			&r.UpdatedAt,
-		); err != nil {
-			return nil, fmt.Errorf("scan entry row: %w", err)
-		}
-		results = append(results, r)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("iterate entry rows: %w", err)
+	results, err := collectEntries(keys, rows)
+	if err != nil {
+		return nil, err
 	}
-
+	sort.Slice(results, func(i, j int) bool { return results[i].Username < results[j].Username })
 	return results, nil
 }
 
 // GetEntryBySiteAndUser returns a single entry matching website and username.
-func GetEntryBySiteAndUser(d *DB, website, username string) (*EntryRow, error) {
+func GetEntryBySiteAndUser(d *DB, keys *vault.MetaKeys, website, username string) (*EntryRow, error) {
 	if d == nil || d.sql == nil {
 		return nil, fmt.Errorf("database handle is nil")
 	}
+	if keys == nil {
+		return nil, fmt.Errorf("metadata keys are nil")
+	}
 
-	var r EntryRow
-	err := d.sql.QueryRow(
-		`SELECT id, encrypted_pass, salt, website, username, type, created_at, updated_at
+	row := d.sql.QueryRow(
+		`SELECT `+entryColumns+`
 		 FROM passwords
-		 WHERE website = ? AND username = ?`,
-		website, username,
-	).Scan(
-		&r.ID,
-		&r.EncryptedPass,
-		&r.Salt,
-		&r.Website,
-		&r.Username,
-		&r.Type,
-		&r.CreatedAt,
-		&r.UpdatedAt,
+		 WHERE entry_index = ? AND deleted_at IS NULL`,
+		keys.EntryIndex(website, username),
 	)
+	r, err := scanEntry(keys, row.Scan)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, err
@@ -130,26 +184,75 @@ func GetEntryBySiteAndUser(d *DB, website, username string) (*EntryRow, error) {
 	return &r, nil
 }
 
-// DeleteEntryBySiteAndUser deletes a credential matching website and username.
-// It returns sql.ErrNoRows if nothing was deleted.
-func DeleteEntryBySiteAndUser(d *DB, website, username string) error {
+// ListEntries returns every entry ordered by website and username.
+func ListEntries(d *DB, keys *vault.MetaKeys) ([]EntryRow, error) {
+	if d == nil || d.sql == nil {
+		return nil, fmt.Errorf("database handle is nil")
+	}
+	if keys == nil {
+		return nil, fmt.Errorf("metadata keys are nil")
+	}
+
+	rows, err := d.sql.Query(`SELECT ` + entryColumns + ` FROM passwords WHERE deleted_at IS NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("select entries: %w", err)
+	}
+	defer rows.Close()
+
+	results, err := collectEntries(keys, rows)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Website != results[j].Website {
+			return results[i].Website < results[j].Website
+		}
+		return results[i].Username < results[j].Username
+	})
+	return results, nil
+}
+
+// DeleteEntryBySiteAndUser moves a credential matching website and username, together
+// with the account's TOTP entry if it has one, to the trash. The rows, their ciphertext
+// and password history stay in place until PurgeTrash removes them; RestoreTrashed
+// brings the entry back.
+// It returns sql.ErrNoRows if no live entry matched.
+func DeleteEntryBySiteAndUser(d *DB, keys *vault.MetaKeys, website, username string) error {
 	if d == nil || d.sql == nil {
 		return fmt.Errorf("database handle is nil")
 	}
+	if keys == nil {
+		return fmt.Errorf("metadata keys are nil")
+	}
 
 	res, err := d.sql.Exec(
-		`DELETE FROM passwords WHERE website = ? AND username = ?`,
-		website, username,
+		`UPDATE passwords SET deleted_at = CURRENT_TIMESTAMP WHERE entry_index IN (?, ?) AND deleted_at IS NULL`,
+		keys.EntryIndex(website, username), keys.TOTPIndex(website, username),
 	)
 	if err != nil {
-		return fmt.Errorf("delete entry: %w", err)
+		return fmt.Errorf("trash entry: %w", err)
 	}
 	n, err := res.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("delete rows affected: %w", err)
+		return fmt.Errorf("trash rows affected: %w", err)
 	}
 	if n == 0 {
 		return sql.ErrNoRows
 	}
 	return nil
 }
+
+func collectEntries(keys *vault.MetaKeys, rows *sql.Rows) ([]EntryRow, error) {
+	var results []EntryRow
+	for rows.Next() {
+		r, err := scanEntry(keys, rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("scan entry row: %w", err)
+		}
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate entry rows: %w", err)
+	}
+	return results, nil
+}
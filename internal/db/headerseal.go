@@ -0,0 +1,106 @@
+package db
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+)
+
+const (
+	metaKeyHeaderSealed = "header_sealed"
+	headerSealedInfo    = "header-sealed-v1"
+)
+
+// headerSealedValue derives the marker value from the MEK, so a copy from another vault
+// does not verify; see HeaderSealedBy.
+func headerSealedValue(mek []byte) ([]byte, error) {
+	if len(mek) != 32 {
+		return nil, errors.New("invalid MEK length")
+	}
+	return krypto.HKDFSHA256(mek, nil, []byte(headerSealedInfo), 16)
+}
+
+// HeaderSealed reports whether the vault's header.json has been sealed with a MAC. Once
+// it has, a header without a MAC is a downgrade and must be refused. A database that
+// predates vault_meta reports false.
+func HeaderSealed(d *DB) (bool, error) {
+	if d == nil || d.sql == nil {
+		return false, fmt.Errorf("database handle is nil")
+	}
+
+	if ok, err := HasVaultMeta(d); err != nil || !ok {
+		return false, err
+	}
+
+	var stored []byte
+	err := d.sql.QueryRow(`SELECT value FROM vault_meta WHERE key = ?`, metaKeyHeaderSealed).Scan(&stored)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("read header seal: %w", err)
+	}
+	return true, nil
+}
+
+// HasVaultMeta reports whether the database has been migrated far enough to hold
+// vault_meta. Callers outside an unlock, which do not migrate, check it first.
+func HasVaultMeta(d *DB) (bool, error) {
+	if d == nil || d.sql == nil {
+		return false, fmt.Errorf("database handle is nil")
+	}
+	var tables int
+	if err := d.sql.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'vault_meta'`).Scan(&tables); err != nil {
+		return false, fmt.Errorf("look up vault_meta: %w", err)
+	}
+	return tables > 0, nil
+}
+
+// HeaderSealedBy reports whether the header seal marker was written under mek. It is
+// false when there is no marker.
+func HeaderSealedBy(d *DB, mek []byte) (bool, error) {
+	if d == nil || d.sql == nil {
+		return false, fmt.Errorf("database handle is nil")
+	}
+	sealed, err := HeaderSealed(d)
+	if err != nil || !sealed {
+		return false, err
+	}
+
+	var stored []byte
+	if err := d.sql.QueryRow(`SELECT value FROM vault_meta WHERE key = ?`, metaKeyHeaderSealed).Scan(&stored); err != nil {
+		return false, fmt.Errorf("read header seal: %w", err)
+	}
+	want, err := headerSealedValue(mek)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(stored, want), nil
+}
+
+// MarkHeaderSealed records that header.json carries a MAC under mek. The database must
+// be migrated.
+func MarkHeaderSealed(d *DB, mek []byte) error {
+	if d == nil || d.sql == nil {
+		return fmt.Errorf("database handle is nil")
+	}
+	return markHeaderSealed(d.sql, mek)
+}
+
+func markHeaderSealed(q querier, mek []byte) error {
+	value, err := headerSealedValue(mek)
+	if err != nil {
+		return err
+	}
+	if _, err := q.Exec(
+		`INSERT INTO vault_meta (key, value) VALUES (?, ?)
+		 ON CONFLICT(key) DO UPDATE SET value = excluded.value`,
+		metaKeyHeaderSealed, value,
+	); err != nil {
+		return fmt.Errorf("record header seal: %w", err)
+	}
+	return nil
+}
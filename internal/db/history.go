@@ -0,0 +1,320 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+)
+
+// The history table has no FOREIGN KEY on passwords(id): MigrateMetadata renames the
+// passwords table, and SQLite would follow the rename and leave history pointing at the
+// dropped legacy table. Deleting an entry only moves it to the trash and keeps its
+// history; PurgeTrash removes the history rows of the entries it purges.
+const createPasswordHistoryTable = `
+CREATE TABLE IF NOT EXISTS password_history (
+	id             INTEGER PRIMARY KEY AUTOINCREMENT,
+	entry_id       INTEGER NOT NULL,
+	encrypted_pass BLOB    NOT NULL,
+	salt           BLOB    NOT NULL,
+	type           TEXT    NOT NULL,
+	cipher_suite   INTEGER NOT NULL,
+	payload_format INTEGER NOT NULL,
+	updated_at     DATETIME NOT NULL,
+	archived_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_password_history_entry ON password_history(entry_id, id);
+`
+
+const (
+	metaKeyHistoryRetention = "history_retention"
+
+	// DefaultHistoryRetention is how many previous versions are kept per entry until
+	// SetHistoryRetention changes it.
+	DefaultHistoryRetention = 10
+)
+
+// ErrHistoryNotFound indicates the requested version is not in an entry's history.
+var ErrHistoryNotFound = errors.New("history version not found")
+
+// ErrTOTPTypeChange indicates an update that would turn a TOTP entry into another type or
+// the reverse; the two are stored under different blind indexes.
+var ErrTOTPTypeChange = errors.New("an entry cannot change to or from type totp")
+
+// HistoryRow is a previous version of an entry. The blob is the entry's ciphertext as it
+// was, so it is still bound to the entry's website and username through the entry AAD
+// and decrypts with vault.DecryptEntryPassword using the parent entry's metadata.
+type HistoryRow struct {
+	ID            int64
+	EntryID       int64
+	EncryptedPass []byte
+	Salt          []byte
+	Type          string
+	Suite         krypto.Suite
+	Format        int
+	UpdatedAt     string // when this version was written
+	ArchivedAt    string // when it was replaced
+}
+
+const historyColumns = `id, entry_id, encrypted_pass, salt, type, cipher_suite, payload_format, updated_at, archived_at`
+
+func scanHistory(scan func(dest ...any) error) (HistoryRow, error) {
+	var h HistoryRow
+	err := scan(&h.ID, &h.EntryID, &h.EncryptedPass, &h.Salt, &h.Type, &h.Suite, &h.Format, &h.UpdatedAt, &h.ArchivedAt)
+	return h, err
+}
+
+func collectHistory(rows *sql.Rows) ([]HistoryRow, error) {
+	defer rows.Close()
+	var out []HistoryRow
+	for rows.Next() {
+		h, err := scanHistory(rows.Scan)
+		if err != nil {
+			return nil, fmt.Errorf("scan history row: %w", err)
+		}
+		out = append(out, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate history rows: %w", err)
+	}
+	return out, nil
+}
+
+// ListHistory returns the previous versions of an entry, newest first.
+func ListHistory(d *DB, entryID int64) ([]HistoryRow, error) {
+	if d == nil || d.sql == nil {
+		return nil, fmt.Errorf("database handle is nil")
+	}
+	rows, err := d.sql.Query(
+		`SELECT `+historyColumns+` FROM password_history WHERE entry_id = ? ORDER BY id DESC`,
+		entryID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("select history: %w", err)
+	}
+	return collectHistory(rows)
+}
+
+// HistoryRetention returns how many previous versions are kept per entry.
+func HistoryRetention(d *DB) (int, error) {
+	if d == nil || d.sql == nil {
+		return 0, fmt.Errorf("database handle is nil")
+	}
+	return historyRetention(d.sql)
+}
+
+func historyRetention(q querier) (int, error) {
+	var raw []byte
+	err := q.QueryRow(`SELECT value FROM vault_meta WHERE key = ?`, metaKeyHistoryRetention).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return DefaultHistoryRetention, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("read history retention: %w", err)
+	}
+	n, err := strconv.Atoi(string(raw))
+	if err != nil || n < 0 {
+		return DefaultHistoryRetention, nil
+	}
+	return n, nil
+}
+
+// SetHistoryRetention sets how many previous versions are kept per entry (0 disables
+// history) and immediately drops versions beyond the new limit.
+func SetHistoryRetention(d *DB, keep int) error {
+	if d == nil || d.sql == nil {
+		return fmt.Errorf("database handle is nil")
+	}
+	if keep < 0 {
+		return fmt.Errorf("history retention cannot be negative")
+	}
+
+	tx, err := d.sql.Begin()
+	if err != nil {
+		return fmt.Errorf("begin retention update: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		`INSERT INTO vault_meta (key, value) VALUES (?, ?)
+		 ON CONFLICT(key) DO UPDATE SET value = excluded.value`,
+		metaKeyHistoryRetention, []byte(strconv.Itoa(keep)),
+	); err != nil {
+		return fmt.Errorf("record history retention: %w", err)
+	}
+	if _, err := tx.Exec(
+		`DELETE FROM password_history
+		  WHERE (SELECT COUNT(*) FROM password_history AS newer
+		          WHERE newer.entry_id = password_history.entry_id
+		            AND newer.id > password_history.id) >= ?`,
+		keep,
+	); err != nil {
+		return fmt.Errorf("prune history: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit retention update: %w", err)
+	}
+	return nil
+}
+
+// ReplaceEntry is UpdateEntryCipher for user edits: the current ciphertext is copied to
+// password_history before the row is overwritten, and the entry's history is trimmed to
+// the configured retention, all in one transaction. Re-encryption that keeps the same
+// plaintext (rotate-at-read, key rotation) should keep using UpdateEntryCipher.
+func ReplaceEntry(d *DB, id int64, typ string, suite krypto.Suite, format int, salt, enc []byte) error {
+	if d == nil || d.sql == nil {
+		return fmt.Errorf("database handle is nil")
+	}
+
+	tx, err := d.sql.Begin()
+	if err != nil {
+		return fmt.Errorf("begin entry update: %w", err)
+	}
+	defer tx.Rollback()
+
+	var current string
+	if err := tx.QueryRow(`SELECT type FROM passwords WHERE id = ?`, id).Scan(&current); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		return fmt.Errorf("select entry type: %w", err)
+	}
+	if (current == vault.TypeTOTP) != (typ == vault.TypeTOTP) {
+		return ErrTOTPTypeChange
+	}
+
+	if err := archiveEntry(tx, id); err != nil {
+		return err
+	}
+	res, err := tx.Exec(
+		`UPDATE passwords SET encrypted_pass = ?, salt = ?, type = ?, cipher_suite = ?, payload_format = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		enc, salt, typ, suite, format, id,
+	)
+	if err != nil {
+		return fmt.Errorf("update entry: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit entry update: %w", err)
+	}
+	return nil
+}
+
+// RestoreHistory makes history row historyID the current version of entry entryID. The
+// version being replaced is archived first, so a restore can itself be undone.
+func RestoreHistory(d *DB, entryID, historyID int64) error {
+	if d == nil || d.sql == nil {
+		return fmt.Errorf("database handle is nil")
+	}
+
+	tx, err := d.sql.Begin()
+	if err != nil {
+		return fmt.Errorf("begin restore: %w", err)
+	}
+	defer tx.Rollback()
+
+	h, err := scanHistory(tx.QueryRow(
+		`SELECT `+historyColumns+` FROM password_history WHERE id = ? AND entry_id = ?`,
+		historyID, entryID,
+	).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrHistoryNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("select history version: %w", err)
+	}
+
+	if err := archiveEntry(tx, entryID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		`UPDATE passwords SET encrypted_pass = ?, salt = ?, type = ?, cipher_suite = ?, payload_format = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		h.EncryptedPass, h.Salt, h.Type, h.Suite, h.Format, entryID,
+	); err != nil {
+		return fmt.Errorf("restore entry: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM password_history WHERE id = ?`, h.ID); err != nil {
+		return fmt.Errorf("remove restored version: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit restore: %w", err)
+	}
+	return nil
+}
+
+// archiveEntry copies the current version of an entry into password_history and trims
+// the entry's history to the retention limit.
+func archiveEntry(tx *sql.Tx, entryID int64) error {
+	keep, err := historyRetention(tx)
+	if err != nil {
+		return err
+	}
+	if keep == 0 {
+		_, err := tx.Exec(`DELETE FROM password_history WHERE entry_id = ?`, entryID)
+		return err
+	}
+
+	res, err := tx.Exec(
+		`INSERT INTO password_history (entry_id, encrypted_pass, salt, type, cipher_suite, payload_format, updated_at)
+		 SELECT id, encrypted_pass, salt, type, cipher_suite, payload_format, updated_at
+		   FROM passwords
+		  WHERE id = ?`,
+		entryID,
+	)
+	if err != nil {
+		return fmt.Errorf("archive entry: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+
+	if _, err := tx.Exec(
+		`DELETE FROM password_history
+		  WHERE entry_id = ?
+		    AND id NOT IN (SELECT id FROM password_history WHERE entry_id = ? ORDER BY id DESC LIMIT ?)`,
+		entryID, entryID, keep,
+	); err != nil {
+		return fmt.Errorf("prune history: %w", err)
+	}
+	return nil
+}
+
+// reencryptHistory rewrites every history row of the given entries through fn, which
+// receives the parent entry and the row and returns the new suite, salt and blob. A nil
+// blob leaves the row unchanged.
+func reencryptHistory(tx *sql.Tx, entries []EntryRow, fn func(r EntryRow, h HistoryRow) (krypto.Suite, []byte, []byte, error)) error {
+	for _, r := range entries {
+		rows, err := tx.Query(`SELECT `+historyColumns+` FROM password_history WHERE entry_id = ?`, r.ID)
+		if err != nil {
+			return fmt.Errorf("select history: %w", err)
+		}
+		history, err := collectHistory(rows)
+		if err != nil {
+			return err
+		}
+		for _, h := range history {
+			suite, salt, enc, err := fn(r, h)
+			if err != nil {
+				return fmt.Errorf("history %d of entry %d: %w", h.ID, r.ID, err)
+			}
+			if enc == nil {
+				continue
+			}
+			if _, err := tx.Exec(
+				`UPDATE password_history SET encrypted_pass = ?, salt = ?, cipher_suite = ? WHERE id = ?`,
+				enc, salt, suite, h.ID,
+			); err != nil {
+				return fmt.Errorf("update history %d: %w", h.ID, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+)
+
+// RawEntry is a passwords row exactly as stored, metadata still sealed. pm doctor uses
+// it to examine rows that ListEntries would reject outright.
+type RawEntry struct {
+	ID            int64
+	EncryptedPass []byte
+	Salt          []byte
+	SiteIndex     string
+	EntryIndex    string
+	WebsiteEnc    []byte
+	UsernameEnc   []byte
+	Type          string
+	Suite         krypto.Suite
+	Format        int
+	DeletedAt     string
+}
+
+// RawEntries returns every row of the passwords table, trashed ones included, by ID.
+func RawEntries(d *DB) ([]RawEntry, error) {
+	if d == nil || d.sql == nil {
+		return nil, fmt.Errorf("database handle is nil")
+	}
+	rows, err := d.sql.Query(
+		`SELECT id, encrypted_pass, salt, site_index, entry_index, website_enc, username_enc,
+		        type, cipher_suite, payload_format, COALESCE(deleted_at, '')
+		   FROM passwords ORDER BY id`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("select entries: %w", err)
+	}
+	defer rows.Close()
+
+	var out []RawEntry
+	for rows.Next() {
+		var r RawEntry
+		if err := rows.Scan(&r.ID, &r.EncryptedPass, &r.Salt, &r.SiteIndex, &r.EntryIndex, &r.WebsiteEnc, &r.UsernameEnc,
+			&r.Type, &r.Suite, &r.Format, &r.DeletedAt); err != nil {
+			return nil, fmt.Errorf("scan entry row: %w", err)
+		}
+		out = append(out, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate entry rows: %w", err)
+	}
+	return out, nil
+}
+
+// SetEntryIndexes rewrites the blind indexes of one row, for rows whose indexes no
+// longer match their decrypted website and username.
+func SetEntryIndexes(d *DB, id int64, siteIndex, entryIndex string) error {
+	if d == nil || d.sql == nil {
+		return fmt.Errorf("database handle is nil")
+	}
+	if _, err := d.sql.Exec(`UPDATE passwords SET site_index = ?, entry_index = ? WHERE id = ?`, siteIndex, entryIndex, id); err != nil {
+		return fmt.Errorf("update entry indexes: %w", err)
+	}
+	return nil
+}
+
+// OrphanedHistory returns the IDs of password_history rows whose entry no longer exists.
+func OrphanedHistory(d *DB) ([]int64, error) {
+	if d == nil || d.sql == nil {
+		return nil, fmt.Errorf("database handle is nil")
+	}
+	rows, err := d.sql.Query(
+		`SELECT id FROM password_history WHERE entry_id NOT IN (SELECT id FROM passwords) ORDER BY id`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("select orphaned history: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan history id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// DeleteOrphanedHistory removes password_history rows whose entry no longer exists and
+// returns how many were removed.
+func DeleteOrphanedHistory(d *DB) (int, error) {
+	if d == nil || d.sql == nil {
+		return 0, fmt.Errorf("database handle is nil")
+	}
+	res, err := d.sql.Exec(`DELETE FROM password_history WHERE entry_id NOT IN (SELECT id FROM passwords)`)
+	if err != nil {
+		return 0, fmt.Errorf("delete orphaned history: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("orphaned history rows affected: %w", err)
+	}
+	return int(n), nil
+}
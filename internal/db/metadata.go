@@ -0,0 +1,137 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+)
+
+// MigrateMetadata converts a vault that still stores website/username in plaintext
+// into the encrypted layout (sealed values plus blind indexes). It is a no-op for
+// vaults that were already converted.
+//
+// Args:
+//
+//	d: open database handle.
+//	keys: metadata subkeys derived from the unlocked MEK.
+//
+// Returns:
+//
+//	error: non-nil when the schema cannot be inspected or the conversion fails; the
+//	       transaction is rolled back so the legacy table stays intact.
+//
+// Behavior:
+//  1. Detects the legacy layout by looking for the plaintext website column.
+//  2. Renames the legacy table and creates the encrypted table in a single transaction.
+//  3. Copies each row newest-first, sealing metadata and computing blind indexes;
+//     rows colliding on (website, username) keep only the most recent version.
+//  4. Drops the legacy table and builds the lookup indexes before committing.
+func MigrateMetadata(d *DB, keys *vault.MetaKeys) error {
+	if d == nil || d.sql == nil {
+		return fmt.Errorf("database handle is nil")
+	}
+	if keys == nil {
+		return fmt.Errorf("metadata keys are nil")
+	}
+
+	legacy, err := hasPlaintextMetadata(d.sql)
+	if err != nil {
+		return fmt.Errorf("inspect schema: %w", err)
+	}
+	if !legacy {
+		return nil
+	}
+
+	tx, err := d.sql.Begin()
+	if err != nil {
+		return fmt.Errorf("begin metadata migration: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`ALTER TABLE passwords RENAME TO passwords_legacy`); err != nil {
+		return fmt.Errorf("rename legacy table: %w", err)
+	}
+	if _, err := tx.Exec(createPasswordsTable); err != nil {
+		return fmt.Errorf("create encrypted table: %w", err)
+	}
+
+	type legacyRow struct {
+		id       int64
+		website  string
+		username string
+	}
+
+	rows, err := tx.Query(`SELECT id, website, username FROM passwords_legacy ORDER BY updated_at DESC, id DESC`)
+	if err != nil {
+		return fmt.Errorf("select legacy rows: %w", err)
+	}
+	var legacyRows []legacyRow
+	for rows.Next() {
+		var r legacyRow
+		if err := rows.Scan(&r.id, &r.website, &r.username); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan legacy row: %w", err)
+		}
+		legacyRows = append(legacyRows, r)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return fmt.Errorf("iterate legacy rows: %w", err)
+	}
+	rows.Close()
+
+	for _, r := range legacyRows {
+		websiteEnc, err := keys.SealMeta(vault.MetaFieldWebsite, r.website)
+		if err != nil {
+			return err
+		}
+		usernameEnc, err := keys.SealMeta(vault.MetaFieldUsername, r.username)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(
+			`INSERT OR IGNORE INTO passwords
+			        (id, encrypted_pass, salt, site_index, entry_index, website_enc, username_enc, type, cipher_suite, payload_format, created_at, updated_at, deleted_at)
+			 SELECT id, encrypted_pass, salt, ?, ?, ?, ?, type, cipher_suite, payload_format, created_at, updated_at, deleted_at
+			   FROM passwords_legacy
+			  WHERE id = ?`,
+			keys.SiteIndex(r.website), keys.EntryIndex(r.website, r.username), websiteEnc, usernameEnc, r.id,
+		); err != nil {
+			return fmt.Errorf("copy legacy row %d: %w", r.id, err)
+		}
+	}
+
+	if _, err := tx.Exec(`DROP TABLE passwords_legacy`); err != nil {
+		return fmt.Errorf("drop legacy table: %w", err)
+	}
+	if _, err := tx.Exec(createPasswordsIndexes); err != nil {
+		return fmt.Errorf("create indexes: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit metadata migration: %w", err)
+	}
+	return nil
+}
+
+// hasPlaintextMetadata reports whether the passwords table still carries the
+// legacy plaintext website column.
+func hasPlaintextMetadata(q querier) (bool, error) {
+	rows, err := q.Query(`SELECT name FROM pragma_table_info('passwords')`)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return false, err
+		}
+		if name == "website" {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
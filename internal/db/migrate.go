@@ -0,0 +1,187 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrSchemaTooNew indicates vault.db was written by a newer build with migrations this
+// build does not know about. Opening it anyway could corrupt data, so callers must stop.
+var ErrSchemaTooNew = errors.New("vault database was created by a newer version")
+
+// querier is the subset of *sql.DB and *sql.Tx used by schema helpers.
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// migration is one ordered schema step. Vaults created before user_version was tracked
+// start at version 0 with some tables already present, so every step must be idempotent.
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sql.Tx) error
+}
+
+// migrations lists every schema step in order. Append new steps with the next version;
+// never edit or reorder a step that has shipped.
+var migrations = []migration{
+	{version: 1, name: "create passwords and vault_meta", up: migrateBaseTables},
+	{version: 2, name: "de-duplicate entries and add unique index", up: migrateUniqueEntries},
+	{version: 3, name: "add passwords.cipher_suite", up: migrateCipherSuite},
+	{version: 4, name: "add passwords.payload_format", up: migratePayloadFormat},
+	{version: 5, name: "create password_history", up: migratePasswordHistory},
+	{version: 6, name: "add passwords.deleted_at", up: migrateDeletedAt},
+}
+
+// SchemaVersion returns the number of the newest migration this build knows about.
+func SchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// UserVersion reads PRAGMA user_version, the last migration applied to d.
+func UserVersion(d *DB) (int, error) {
+	if d == nil || d.sql == nil {
+		return 0, fmt.Errorf("database handle is nil")
+	}
+	var v int
+	if err := d.sql.QueryRow(`PRAGMA user_version`).Scan(&v); err != nil {
+		return 0, fmt.Errorf("read schema version: %w", err)
+	}
+	return v, nil
+}
+
+// Migrate brings the schema up to SchemaVersion. Every entry point (service.New,
+// pm session, the native host) calls it right after Open.
+//
+// Args:
+//
+//	d: open database handle.
+//
+// Returns:
+//
+//	error: ErrSchemaTooNew when the file is ahead of this build; otherwise non-nil when a
+//	       step fails, in which case that step is rolled back and earlier steps stay applied.
+//
+// Behavior:
+//  1. Reads PRAGMA user_version to find the last applied step.
+//  2. Runs each later step in its own transaction and bumps user_version inside the
+//     same transaction, so a crash never records a step that did not complete.
+//  3. Vaults still using the plaintext website/username layout are fixed up (duplicates
+//     removed, unique index added) but stay plaintext; MigrateMetadata converts them
+//     once the MEK is available.
+func Migrate(d *DB) error {
+	current, err := UserVersion(d)
+	if err != nil {
+		return err
+	}
+	if current > SchemaVersion() {
+		return fmt.Errorf("%w (schema %d, supported %d)", ErrSchemaTooNew, current, SchemaVersion())
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := applyMigration(d.sql, m); err != nil {
+			return fmt.Errorf("migrate schema to %d (%s): %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+func applyMigration(q *sql.DB, m migration) error {
+	tx, err := q.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.up(tx); err != nil {
+		return err
+	}
+	// PRAGMA does not take bind parameters; version is a compile-time constant.
+	if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, m.version)); err != nil {
+		return fmt.Errorf("record schema version: %w", err)
+	}
+	return tx.Commit()
+}
+
+func migrateBaseTables(tx *sql.Tx) error {
+	if _, err := tx.Exec(createPasswordsTable); err != nil {
+		return fmt.Errorf("create passwords: %w", err)
+	}
+	if _, err := tx.Exec(createVaultMetaTable); err != nil {
+		return fmt.Errorf("create vault_meta: %w", err)
+	}
+	return nil
+}
+
+// migrateUniqueEntries removes duplicate credentials (keeping the most recently updated
+// row) and adds the unique index. Vaults created by the old internal/vault schema had no
+// UNIQUE constraint, so lookups could silently pick an arbitrary duplicate.
+func migrateUniqueEntries(tx *sql.Tx) error {
+	legacy, err := hasPlaintextMetadata(tx)
+	if err != nil {
+		return fmt.Errorf("inspect schema: %w", err)
+	}
+
+	if legacy {
+		if _, err := tx.Exec(`
+			DELETE FROM passwords
+			 WHERE EXISTS (
+			       SELECT 1 FROM passwords AS newer
+			        WHERE newer.website = passwords.website
+			          AND newer.username = passwords.username
+			          AND (newer.updated_at > passwords.updated_at
+			               OR (newer.updated_at = passwords.updated_at AND newer.id > passwords.id)))`,
+		); err != nil {
+			return fmt.Errorf("remove duplicate entries: %w", err)
+		}
+		if _, err := tx.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS uniq_passwords_site_user ON passwords(website, username)`); err != nil {
+			return fmt.Errorf("create unique index: %w", err)
+		}
+		return nil
+	}
+
+	if _, err := tx.Exec(`
+		DELETE FROM passwords
+		 WHERE EXISTS (
+		       SELECT 1 FROM passwords AS newer
+		        WHERE newer.entry_index = passwords.entry_index
+		          AND (newer.updated_at > passwords.updated_at
+		               OR (newer.updated_at = passwords.updated_at AND newer.id > passwords.id)))`,
+	); err != nil {
+		return fmt.Errorf("remove duplicate entries: %w", err)
+	}
+	if _, err := tx.Exec(createPasswordsIndexes); err != nil {
+		return fmt.Errorf("create indexes: %w", err)
+	}
+	return nil
+}
+
+// migrateCipherSuite adds the per-entry suite column. Existing rows get the default,
+// AES-GCM, which is the only suite they could have been written with.
+func migrateCipherSuite(tx *sql.Tx) error {
+	return ensureColumn(tx, "passwords", "cipher_suite", "INTEGER NOT NULL DEFAULT 1")
+}
+
+// migratePayloadFormat adds the per-entry payload layout. Existing rows hold a bare
+// secret, which is the raw format (0).
+func migratePayloadFormat(tx *sql.Tx) error {
+	return ensureColumn(tx, "passwords", "payload_format", "INTEGER NOT NULL DEFAULT 0")
+}
+
+func migratePasswordHistory(tx *sql.Tx) error {
+	if _, err := tx.Exec(createPasswordHistoryTable); err != nil {
+		return fmt.Errorf("create password_history: %w", err)
+	}
+	return nil
+}
+
+// migrateDeletedAt adds the trash timestamp. Existing rows are live (NULL).
+func migrateDeletedAt(tx *sql.Tx) error {
+	return ensureColumn(tx, "passwords", "deleted_at", "DATETIME")
+}
@@ -0,0 +1,203 @@
+package db
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+)
+
+const createVaultMetaTable = `
+CREATE TABLE IF NOT EXISTS vault_meta (
+	key   TEXT PRIMARY KEY,
+	value BLOB NOT NULL
+);
+`
+
+const (
+	metaKeyMEKCheck = "mek_check"
+	mekCheckInfo    = "mek-check-v1"
+)
+
+// mekCheckValue derives a short fingerprint of the MEK that identifies which key the
+// rows were encrypted under without revealing the key itself.
+func mekCheckValue(mek []byte) ([]byte, error) {
+	if len(mek) != 32 {
+		return nil, errors.New("invalid MEK length")
+	}
+	return krypto.HKDFSHA256(mek, nil, []byte(mekCheckInfo), 16)
+}
+
+// MEKCheck reports whether the rows in the database were encrypted under mek.
+// Databases that have never been rotated carry no check value and match any MEK.
+func MEKCheck(d *DB, mek []byte) (bool, error) {
+	if d == nil || d.sql == nil {
+		return false, fmt.Errorf("database handle is nil")
+	}
+
+	var stored []byte
+	err := d.sql.QueryRow(`SELECT value FROM vault_meta WHERE key = ?`, metaKeyMEKCheck).Scan(&stored)
+	if errors.Is(err, sql.ErrNoRows) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("read mek check: %w", err)
+	}
+
+	want, err := mekCheckValue(mek)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(stored, want), nil
+}
+
+// HasMEKCheck reports whether the database carries a MEK check value, which only a
+// rotation writes. A database that predates vault_meta reports false.
+func HasMEKCheck(d *DB) (bool, error) {
+	if d == nil || d.sql == nil {
+		return false, fmt.Errorf("database handle is nil")
+	}
+	if ok, err := HasVaultMeta(d); err != nil || !ok {
+		return false, err
+	}
+
+	var n int
+	if err := d.sql.QueryRow(`SELECT COUNT(*) FROM vault_meta WHERE key = ?`, metaKeyMEKCheck).Scan(&n); err != nil {
+		return false, fmt.Errorf("read mek check: %w", err)
+	}
+	return n > 0, nil
+}
+
+// RotateEntries re-encrypts every credential from oldMEK to newMEK.
+//
+// Args:
+//
+//	d: open database handle (already migrated to the encrypted metadata layout).
+//	oldMEK: key the rows are currently encrypted under.
+//	newMEK: replacement key.
+//
+// Returns:
+//
+//	error: non-nil if any row fails to decrypt or re-encrypt; the transaction is
+//	       rolled back and the database is left entirely under oldMEK.
+//
+// Behavior:
+//  1. Opens a single transaction over the passwords table.
+//  2. Decrypts each row's metadata and password with oldMEK and re-encrypts them via
+//     vault.EncryptEntryPassword and the new metadata keys (fresh blind indexes).
+//  3. Re-encrypts each entry's password_history rows the same way, keeping them bound
+//     to the entry's website and username.
+//  4. Records the new MEK check value (and header seal marker, when present) in
+//     vault_meta and commits. The commit is the
+//     point at which the vault switches keys; see MEKCheck.
+func RotateEntries(d *DB, oldMEK, newMEK []byte) error {
+	if d == nil || d.sql == nil {
+		return fmt.Errorf("database handle is nil")
+	}
+
+	oldKeys, err := vault.DeriveMetaKeys(oldMEK)
+	if err != nil {
+		return fmt.Errorf("derive old metadata keys: %w", err)
+	}
+	defer oldKeys.Wipe()
+	newKeys, err := vault.DeriveMetaKeys(newMEK)
+	if err != nil {
+		return fmt.Errorf("derive new metadata keys: %w", err)
+	}
+	defer newKeys.Wipe()
+
+	check, err := mekCheckValue(newMEK)
+	if err != nil {
+		return err
+	}
+
+	sealed, err := HeaderSealed(d)
+	if err != nil {
+		return err
+	}
+
+	tx, err := d.sql.Begin()
+	if err != nil {
+		return fmt.Errorf("begin rotation: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT ` + entryColumns + ` FROM passwords`)
+	if err != nil {
+		return fmt.Errorf("select entries: %w", err)
+	}
+	var entries []EntryRow
+	for rows.Next() {
+		r, err := scanEntry(oldKeys, rows.Scan)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("read entry: %w", err)
+		}
+		entries = append(entries, r)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return fmt.Errorf("iterate entries: %w", err)
+	}
+	rows.Close()
+
+	for _, r := range entries {
+		plaintext, _, _, err := vault.DecryptEntryPassword(oldMEK, r.Suite, r.Website, r.Username, r.Type, r.Salt, r.EncryptedPass)
+		if err != nil {
+			return fmt.Errorf("decrypt entry %d: %w", r.ID, err)
+		}
+		salt, enc, err := vault.EncryptEntryPassword(newMEK, r.Suite, r.Website, r.Username, r.Type, plaintext)
+		if err != nil {
+			return fmt.Errorf("encrypt entry %d: %w", r.ID, err)
+		}
+		websiteEnc, err := newKeys.SealMeta(vault.MetaFieldWebsite, r.Website)
+		if err != nil {
+			return err
+		}
+		usernameEnc, err := newKeys.SealMeta(vault.MetaFieldUsername, r.Username)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(
+			`UPDATE passwords
+			    SET encrypted_pass = ?, salt = ?, site_index = ?, entry_index = ?, website_enc = ?, username_enc = ?
+			  WHERE id = ?`,
+			enc, salt, newKeys.SiteIndex(r.Website), newKeys.IndexFor(r.Website, r.Username, r.Type), websiteEnc, usernameEnc, r.ID,
+		); err != nil {
+			return fmt.Errorf("update entry %d: %w", r.ID, err)
+		}
+	}
+
+	if err := reencryptHistory(tx, entries, func(r EntryRow, h HistoryRow) (krypto.Suite, []byte, []byte, error) {
+		plaintext, _, _, err := vault.DecryptEntryPassword(oldMEK, h.Suite, r.Website, r.Username, h.Type, h.Salt, h.EncryptedPass)
+		if err != nil {
+			return 0, nil, nil, fmt.Errorf("decrypt: %w", err)
+		}
+		salt, enc, err := vault.EncryptEntryPassword(newMEK, h.Suite, r.Website, r.Username, h.Type, plaintext)
+		return h.Suite, salt, enc, err
+	}); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(
+		`INSERT INTO vault_meta (key, value) VALUES (?, ?)
+		 ON CONFLICT(key) DO UPDATE SET value = excluded.value`,
+		metaKeyMEKCheck, check,
+	); err != nil {
+		return fmt.Errorf("record mek check: %w", err)
+	}
+	if sealed {
+		if err := markHeaderSealed(tx, newMEK); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit rotation: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package db
+
+import (
+	"fmt"
+	"os"
+)
+
+// Snapshot writes a transactionally consistent copy of the database to dest with
+// VACUUM INTO, so it is safe while the GUI, native host or another pm process has the
+// vault open. dest must not exist yet. The copy is chmodded to 0600.
+func Snapshot(d *DB, dest string) error {
+	if d == nil || d.sql == nil {
+		return fmt.Errorf("database handle is nil")
+	}
+	if _, err := d.sql.Exec(`VACUUM INTO ?`, dest); err != nil {
+		return fmt.Errorf("snapshot database: %w", err)
+	}
+	if err := EnsurePerm0600(dest); err != nil {
+		os.Remove(dest)
+		return err
+	}
+	return nil
+}
+
+// IntegrityCheck runs PRAGMA integrity_check and returns the problems SQLite reports;
+// an empty slice means the file is sound.
+func IntegrityCheck(d *DB) ([]string, error) {
+	if d == nil || d.sql == nil {
+		return nil, fmt.Errorf("database handle is nil")
+	}
+	rows, err := d.sql.Query(`PRAGMA integrity_check`)
+	if err != nil {
+		return nil, fmt.Errorf("integrity check: %w", err)
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return nil, fmt.Errorf("scan integrity check: %w", err)
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("integrity check: %w", err)
+	}
+	return problems, nil
+}
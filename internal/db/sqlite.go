@@ -70,24 +70,36 @@ CREATE TABLE IF NOT EXISTS passwords (
 	id             INTEGER PRIMARY KEY AUTOINCREMENT,
 	encrypted_pass BLOB    NOT NULL,
 	salt           BLOB    NOT NULL,
-	website        TEXT    NOT NULL,
-	username       TEXT    NOT NULL,
+	site_index     TEXT    NOT NULL,
+	entry_index    TEXT    NOT NULL,
+	website_enc    BLOB    NOT NULL,
+	username_enc   BLOB    NOT NULL,
 	type           TEXT    NOT NULL DEFAULT 'password',
+	cipher_suite   INTEGER NOT NULL DEFAULT 1,
+	payload_format INTEGER NOT NULL DEFAULT 0,
 	created_at     DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
 	updated_at     DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-	UNIQUE(website, username)
+	deleted_at     DATETIME,
+	UNIQUE(entry_index)
 );
+`
 
-CREATE UNIQUE INDEX IF NOT EXISTS uniq_passwords_site_user ON passwords(website, username);
+const createPasswordsIndexes = `
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_passwords_entry ON passwords(entry_index);
+CREATE INDEX IF NOT EXISTS idx_passwords_site ON passwords(site_index);
 `
 
-// Migrate ensures the passwords table (and index) exist.
-func Migrate(d *DB) error {
-	if d == nil || d.sql == nil {
-		return fmt.Errorf("database handle is nil")
+// ensureColumn adds column to table when an older vault predates it. Existing rows get
+// the column default.
+func ensureColumn(q querier, table, column, decl string) error {
+	var n int
+	err := q.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&n)
+	if err != nil {
+		return err
 	}
-	if _, err := d.sql.Exec(createPasswordsTable); err != nil {
-		return fmt.Errorf("migrate schema: %w", err)
+	if n > 0 {
+		return nil
 	}
-	return nil
+	_, err = q.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, decl))
+	return err
 }
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+)
+
+// GetTOTPBySiteAndUser returns the TOTP entry of the account website/username. Its
+// encrypted payload is the otpauth:// URI, sealed like any entry password.
+func GetTOTPBySiteAndUser(d *DB, keys *vault.MetaKeys, website, username string) (*EntryRow, error) {
+	if d == nil || d.sql == nil {
+		return nil, fmt.Errorf("database handle is nil")
+	}
+	if keys == nil {
+		return nil, fmt.Errorf("metadata keys are nil")
+	}
+
+	row := d.sql.QueryRow(
+		`SELECT `+entryColumns+`
+		 FROM passwords
+		 WHERE entry_index = ? AND deleted_at IS NULL`,
+		keys.TOTPIndex(website, username),
+	)
+	r, err := scanEntry(keys, row.Scan)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("select totp entry: %w", err)
+	}
+	return &r, nil
+}
+
+// GetTOTPByWebsite returns the TOTP entries whose website shares the eTLD+1 of website,
+// ordered by username.
+func GetTOTPByWebsite(d *DB, keys *vault.MetaKeys, website string) ([]EntryRow, error) {
+	if d == nil || d.sql == nil {
+		return nil, fmt.Errorf("database handle is nil")
+	}
+	if keys == nil {
+		return nil, fmt.Errorf("metadata keys are nil")
+	}
+
+	rows, err := d.sql.Query(
+		`SELECT `+entryColumns+`
+		 FROM passwords
+		 WHERE site_index = ? AND type = ? AND deleted_at IS NULL`,
+		keys.SiteIndex(website), vault.TypeTOTP,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("select totp entries by website: %w", err)
+	}
+	defer rows.Close()
+
+	results, err := collectEntries(keys, rows)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Username < results[j].Username })
+	return results, nil
+}
+
+// DeleteTOTP moves only the TOTP entry of website/username to the trash, leaving the
+// account's password entry in place. It returns sql.ErrNoRows if there is none.
+func DeleteTOTP(d *DB, keys *vault.MetaKeys, website, username string) error {
+	if d == nil || d.sql == nil {
+		return fmt.Errorf("database handle is nil")
+	}
+	if keys == nil {
+		return fmt.Errorf("metadata keys are nil")
+	}
+
+	res, err := d.sql.Exec(
+		`UPDATE passwords SET deleted_at = CURRENT_TIMESTAMP WHERE entry_index = ? AND deleted_at IS NULL`,
+		keys.TOTPIndex(website, username),
+	)
+	if err != nil {
+		return fmt.Errorf("trash totp entry: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("trash rows affected: %w", err)
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
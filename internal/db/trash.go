@@ -0,0 +1,195 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+)
+
+// ErrEntryInTrash indicates a website/username pair cannot be added because a trashed
+// entry still holds it; restore or purge that entry first.
+var ErrEntryInTrash = errors.New("an entry for this website and username is in the trash")
+
+// ErrEntryExists indicates a website/username pair cannot be added because an entry of
+// the same type already holds it; update that entry instead.
+var ErrEntryExists = errors.New("an entry for this website and username already exists")
+
+// ListTrash returns every trashed entry, most recently deleted first.
+func ListTrash(d *DB, keys *vault.MetaKeys) ([]EntryRow, error) {
+	if d == nil || d.sql == nil {
+		return nil, fmt.Errorf("database handle is nil")
+	}
+	if keys == nil {
+		return nil, fmt.Errorf("metadata keys are nil")
+	}
+
+	rows, err := d.sql.Query(`SELECT ` + entryColumns + ` FROM passwords WHERE deleted_at IS NOT NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("select trash: %w", err)
+	}
+	defer rows.Close()
+
+	results, err := collectEntries(keys, rows)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].DeletedAt > results[j].DeletedAt })
+	return results, nil
+}
+
+// EntryInTrash reports whether a trashed entry of type typ holds website and username,
+// which would make InsertEntry fail with ErrEntryInTrash.
+func EntryInTrash(d *DB, keys *vault.MetaKeys, website, username, typ string) bool {
+	if d == nil || d.sql == nil || keys == nil {
+		return false
+	}
+	return indexInTrash(d, keys.IndexFor(website, username, typ))
+}
+
+func indexInTrash(d *DB, entryIndex string) bool {
+	return indexHeld(d, entryIndex) == ErrEntryInTrash
+}
+
+// indexHeld returns ErrEntryInTrash or ErrEntryExists when a row already holds
+// entryIndex, and nil when it is free or the lookup fails; the insert then reports the
+// failure.
+func indexHeld(d *DB, entryIndex string) error {
+	if d == nil || d.sql == nil {
+		return nil
+	}
+	var trashed bool
+	err := d.sql.QueryRow(
+		`SELECT deleted_at IS NOT NULL FROM passwords WHERE entry_index = ?`,
+		entryIndex,
+	).Scan(&trashed)
+	switch {
+	case err != nil:
+		return nil
+	case trashed:
+		return ErrEntryInTrash
+	default:
+		return ErrEntryExists
+	}
+}
+
+// RestoreTrashed moves a trashed entry, and the account's TOTP entry if that is trashed
+// too, back to the live vault. It returns sql.ErrNoRows if no trashed entry matches
+// website and username.
+func RestoreTrashed(d *DB, keys *vault.MetaKeys, website, username string) error {
+	if d == nil || d.sql == nil {
+		return fmt.Errorf("database handle is nil")
+	}
+	if keys == nil {
+		return fmt.Errorf("metadata keys are nil")
+	}
+
+	res, err := d.sql.Exec(
+		`UPDATE passwords SET deleted_at = NULL WHERE entry_index IN (?, ?) AND deleted_at IS NOT NULL`,
+		keys.EntryIndex(website, username), keys.TOTPIndex(website, username),
+	)
+	if err != nil {
+		return fmt.Errorf("restore entry: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("restore rows affected: %w", err)
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// PurgeTrash permanently removes entries that have been in the trash for at least
+// olderThan (0 purges the whole trash) and returns how many were removed.
+//
+// Args:
+//
+//	d: open database handle.
+//	olderThan: minimum time since deletion.
+//
+// Returns:
+//
+//	int: number of entries removed.
+//	error: non-nil when the purge fails; the transaction is rolled back.
+//
+// Behavior:
+//  1. Pins one connection and enables PRAGMA secure_delete on it, so SQLite zeroes the
+//     freed pages instead of leaving old cells in the file.
+//  2. Overwrites each purged entry's ciphertext, salt and sealed metadata, and those of its
+//     password history, with random bytes of the same length before deleting the rows.
+//  3. Commits everything in one transaction.
+func PurgeTrash(d *DB, olderThan time.Duration) (int, error) {
+	if d == nil || d.sql == nil {
+		return 0, fmt.Errorf("database handle is nil")
+	}
+	if olderThan < 0 {
+		return 0, fmt.Errorf("purge age cannot be negative")
+	}
+
+	ctx := context.Background()
+	conn, err := d.sql.Conn(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `PRAGMA secure_delete = ON`); err != nil {
+		return 0, fmt.Errorf("enable secure delete: %w", err)
+	}
+	defer conn.ExecContext(ctx, `PRAGMA secure_delete = OFF`)
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin purge: %w", err)
+	}
+	defer tx.Rollback()
+
+	const purged = `SELECT id FROM passwords
+		 WHERE deleted_at IS NOT NULL
+		   AND deleted_at <= datetime('now', ?)`
+	age := fmt.Sprintf("-%d seconds", int64(olderThan/time.Second))
+
+	if _, err := tx.Exec(
+		`UPDATE password_history
+		    SET encrypted_pass = randomblob(length(encrypted_pass)),
+		        salt = randomblob(length(salt))
+		  WHERE entry_id IN (`+purged+`)`,
+		age,
+	); err != nil {
+		return 0, fmt.Errorf("overwrite history: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM password_history WHERE entry_id IN (`+purged+`)`, age); err != nil {
+		return 0, fmt.Errorf("delete history: %w", err)
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE passwords
+		    SET encrypted_pass = randomblob(length(encrypted_pass)),
+		        salt = randomblob(length(salt)),
+		        website_enc = randomblob(length(website_enc)),
+		        username_enc = randomblob(length(username_enc))
+		  WHERE id IN (`+purged+`)`,
+		age,
+	); err != nil {
+		return 0, fmt.Errorf("overwrite entries: %w", err)
+	}
+	res, err := tx.Exec(`DELETE FROM passwords WHERE id IN (`+purged+`)`, age)
+	if err != nil {
+		return 0, fmt.Errorf("delete entries: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("purge rows affected: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit purge: %w", err)
+	}
+	return int(n), nil
+}
@@ -0,0 +1,275 @@
+// Package doctor verifies a vault directory: file permissions, the header, the SQLite
+// file, and every entry and history version, and repairs the problems that can be
+// fixed without losing data.
+package doctor
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	dbpkg "github.com/Hussein-Mazeh/PasswordManager/internal/db"
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+	"github.com/Hussein-Mazeh/PasswordManager/store"
+)
+
+// Severity grades a finding.
+type Severity string
+
+const (
+	SeverityOK      Severity = "ok"
+	SeverityWarning Severity = "warning" // works today but weakens security or will be fixed up later
+	SeverityError   Severity = "error"   // data that cannot be read or trusted
+)
+
+// Check names the group a finding belongs to.
+const (
+	CheckFiles     = "files"
+	CheckHeader    = "header"
+	CheckDatabase  = "database"
+	CheckEntries   = "entries"
+	CheckUnlock    = "unlock"
+	CheckHistory   = "history"
+	CheckHeaderMAC = "header-mac"
+)
+
+// Finding is one line of the report.
+type Finding struct {
+	Check      string   `json:"check"`
+	Severity   Severity `json:"severity"`
+	Subject    string   `json:"subject,omitempty"`
+	EntryID    int64    `json:"entry_id,omitempty"`
+	Message    string   `json:"message"`
+	Repairable bool     `json:"repairable,omitempty"` // --repair can fix it
+	Repaired   bool     `json:"repaired,omitempty"`
+}
+
+// Report collects findings for one vault.
+type Report struct {
+	Dir      string    `json:"dir"`
+	Entries  int       `json:"entries_checked"`
+	Errors   int       `json:"errors"`
+	Warnings int       `json:"warnings"`
+	Repaired int       `json:"repaired"`
+	Findings []Finding `json:"findings"`
+}
+
+// Add appends findings and updates the counters.
+func (r *Report) Add(fs ...Finding) {
+	for _, f := range fs {
+		switch {
+		case f.Repaired:
+			r.Repaired++
+		case f.Severity == SeverityError:
+			r.Errors++
+		case f.Severity == SeverityWarning:
+			r.Warnings++
+		}
+		r.Findings = append(r.Findings, f)
+	}
+}
+
+// Healthy reports whether no unrepaired errors were found.
+func (r *Report) Healthy() bool { return r.Errors == 0 }
+
+// Files checks that the vault directory is 0700 and vault.db and header.json are 0600,
+// as db.EnsurePerm0600 intends, and chmods them when repair is set. Permissions are not
+// checked on Windows, where EnsurePerm0600 does nothing either.
+func Files(dir string, repair bool) []Finding {
+	var out []Finding
+	info, err := os.Stat(dir)
+	if err != nil {
+		return []Finding{{Check: CheckFiles, Severity: SeverityError, Subject: dir, Message: err.Error()}}
+	}
+	if !info.IsDir() {
+		return []Finding{{Check: CheckFiles, Severity: SeverityError, Subject: dir, Message: "not a directory"}}
+	}
+
+	want := []struct {
+		path string
+		mode os.FileMode
+	}{
+		{dir, 0o700},
+		{filepath.Join(dir, "vault.db"), 0o600},
+		{filepath.Join(dir, "header.json"), 0o600},
+	}
+	for _, w := range want {
+		info, err := os.Stat(w.path)
+		if err != nil {
+			out = append(out, Finding{Check: CheckFiles, Severity: SeverityError, Subject: w.path, Message: "missing"})
+			continue
+		}
+		if runtime.GOOS == "windows" {
+			continue
+		}
+		if mode := info.Mode().Perm(); mode&^w.mode != 0 {
+			f := Finding{
+				Check:      CheckFiles,
+				Severity:   SeverityWarning,
+				Subject:    w.path,
+				Message:    fmt.Sprintf("mode %04o, want %04o", mode, w.mode),
+				Repairable: true,
+			}
+			if repair {
+				if err := os.Chmod(w.path, w.mode); err != nil {
+					f.Message += ": " + err.Error()
+				} else {
+					f.Repaired = true
+				}
+			}
+			out = append(out, f)
+		}
+	}
+	if len(out) == 0 {
+		out = append(out, Finding{Check: CheckFiles, Severity: SeverityOK, Message: "vault directory and files present with owner-only permissions"})
+	}
+	return out
+}
+
+// Header checks that header.json decodes and that every key slot carries a usable salt,
+// wrapped key and KDF configuration. The MAC needs the MEK; see HeaderMAC.
+func Header(dir string) []Finding {
+	hdr, err := store.LoadVaultHeader(store.Paths{Dir: dir})
+	if err != nil {
+		return []Finding{{Check: CheckHeader, Severity: SeverityError, Message: err.Error()}}
+	}
+	if err := store.CheckHeader(hdr); err != nil {
+		return []Finding{{Check: CheckHeader, Severity: SeverityError, Message: err.Error()}}
+	}
+
+	var out []Finding
+	for _, slot := range hdr.KeySlots {
+		out = append(out, checkSlot(fmt.Sprintf("slot %d (%s)", slot.ID, slot.Label), slot)...)
+	}
+	if hdr.Recovery != nil {
+		out = append(out, checkSlot("recovery slot", *hdr.Recovery)...)
+	}
+	if hdr.Pending != nil {
+		out = append(out, Finding{Check: CheckHeader, Severity: SeverityWarning, Subject: "pending slot",
+			Message: "a key rotation was interrupted; the next unlock finishes or discards it"})
+	}
+	if hdr.CipherSuite != 0 && !hdr.CipherSuite.Valid() {
+		out = append(out, Finding{Check: CheckHeader, Severity: SeverityError, Message: fmt.Sprintf("unknown cipher suite %d", hdr.CipherSuite)})
+	}
+	if err := store.CheckHeaderSealed(store.Paths{Dir: dir}, hdr); errors.Is(err, store.ErrHeaderTampered) {
+		out = append(out, Finding{Check: CheckHeader, Severity: SeverityError,
+			Message: "header has no MAC although the vault was sealed; header.json was replaced or tampered with"})
+	} else if err != nil {
+		out = append(out, Finding{Check: CheckHeader, Severity: SeverityError, Message: err.Error()})
+	} else if hdr.MAC == "" {
+		out = append(out, Finding{Check: CheckHeader, Severity: SeverityWarning,
+			Message: "header has no MAC; it is sealed on the next unlock"})
+	}
+	if len(out) == 0 {
+		out = append(out, Finding{Check: CheckHeader, Severity: SeverityOK,
+			Message: fmt.Sprintf("header version %d with %d key slot(s)", hdr.Version, len(hdr.KeySlots))})
+	}
+	return out
+}
+
+func checkSlot(subject string, slot vault.KeySlot) []Finding {
+	var problems []string
+	if salt, err := base64.StdEncoding.DecodeString(slot.Salt); err != nil || len(salt) != krypto.SaltLengthBytes {
+		problems = append(problems, fmt.Sprintf("salt is not %d base64-encoded bytes", krypto.SaltLengthBytes))
+	}
+	if _, err := base64.StdEncoding.DecodeString(slot.WrapNonce); err != nil || slot.WrapNonce == "" {
+		problems = append(problems, "wrap nonce missing or malformed")
+	}
+	if _, err := base64.StdEncoding.DecodeString(slot.WrappedMEK); err != nil || slot.WrappedMEK == "" {
+		problems = append(problems, "wrapped key missing or malformed")
+	}
+	switch slot.KDF.Name {
+	case vault.KDFArgon2id:
+		if slot.KDF.MemoryMB == 0 || slot.KDF.Time == 0 || slot.KDF.Parallelism == 0 || slot.KDF.KeyLen != 32 {
+			problems = append(problems, "Argon2id parameters incomplete")
+		}
+	case vault.KDFRecovery:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown KDF %q", slot.KDF.Name))
+	}
+
+	out := make([]Finding, 0, len(problems))
+	for _, p := range problems {
+		out = append(out, Finding{Check: CheckHeader, Severity: SeverityError, Subject: subject, Message: p})
+	}
+	return out
+}
+
+// HeaderMAC verifies the header MAC with the unlocked MEK, and that vault.db records the
+// header as sealed so a header stripped of its MAC is refused.
+func HeaderMAC(dir string, d *dbpkg.DB, mek []byte) []Finding {
+	hdr, err := store.LoadHeaderForMEK(store.Paths{Dir: dir}, mek)
+	switch {
+	case errors.Is(err, store.ErrHeaderTampered):
+		return []Finding{{Check: CheckHeaderMAC, Severity: SeverityError, Message: "header MAC is missing or does not match; header.json was edited or tampered with"}}
+	case err != nil:
+		return []Finding{{Check: CheckHeaderMAC, Severity: SeverityError, Message: err.Error()}}
+	case hdr.MAC == "":
+		return []Finding{{Check: CheckHeaderMAC, Severity: SeverityWarning,
+			Message: "header has no MAC yet; unlock with the master password to seal it"}}
+	}
+
+	sealed, err := dbpkg.HeaderSealedBy(d, mek)
+	switch {
+	case err != nil:
+		return []Finding{{Check: CheckHeaderMAC, Severity: SeverityError, Message: err.Error()}}
+	case !sealed:
+		return []Finding{{Check: CheckHeaderMAC, Severity: SeverityWarning,
+			Message: "header MAC verified, but vault.db does not record the seal; unlock with the master password to record it"}}
+	}
+	return []Finding{{Check: CheckHeaderMAC, Severity: SeverityOK, Message: "header MAC verified"}}
+}
+
+// Database runs PRAGMA integrity_check, compares the schema version with this build,
+// and looks for history rows whose entry is gone, deleting them when repair is set.
+// ok is false when the file is damaged and entries should not be examined.
+func Database(d *dbpkg.DB, repair bool) (findings []Finding, ok bool) {
+	problems, err := dbpkg.IntegrityCheck(d)
+	if err != nil {
+		return []Finding{{Check: CheckDatabase, Severity: SeverityError, Message: err.Error()}}, false
+	}
+	for _, p := range problems {
+		findings = append(findings, Finding{Check: CheckDatabase, Severity: SeverityError, Subject: "integrity_check", Message: p})
+	}
+	if len(problems) > 0 {
+		return findings, false
+	}
+	findings = append(findings, Finding{Check: CheckDatabase, Severity: SeverityOK, Subject: "integrity_check", Message: "ok"})
+
+	version, err := dbpkg.UserVersion(d)
+	switch {
+	case err != nil:
+		findings = append(findings, Finding{Check: CheckDatabase, Severity: SeverityError, Subject: "schema", Message: err.Error()})
+	case version > dbpkg.SchemaVersion():
+		findings = append(findings, Finding{Check: CheckDatabase, Severity: SeverityError, Subject: "schema",
+			Message: fmt.Sprintf("schema %d is newer than this build (%d)", version, dbpkg.SchemaVersion())})
+		return findings, false
+	case version < dbpkg.SchemaVersion():
+		findings = append(findings, Finding{Check: CheckDatabase, Severity: SeverityWarning, Subject: "schema",
+			Message: fmt.Sprintf("schema %d, current %d; migrated on the next unlock", version, dbpkg.SchemaVersion())})
+	}
+
+	// The history table appeared in schema 5; older files have nothing to orphan.
+	if version >= 5 {
+		orphans, err := dbpkg.OrphanedHistory(d)
+		if err != nil {
+			findings = append(findings, Finding{Check: CheckDatabase, Severity: SeverityError, Subject: "password_history", Message: err.Error()})
+		} else if len(orphans) > 0 {
+			f := Finding{Check: CheckDatabase, Severity: SeverityWarning, Subject: "password_history",
+				Message: fmt.Sprintf("%d history version(s) belong to no entry", len(orphans)), Repairable: true}
+			if repair {
+				if _, err := dbpkg.DeleteOrphanedHistory(d); err != nil {
+					f.Message += ": " + err.Error()
+				} else {
+					f.Repaired = true
+				}
+			}
+			findings = append(findings, f)
+		}
+	}
+	return findings, true
+}
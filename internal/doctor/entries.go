@@ -0,0 +1,153 @@
+package doctor
+
+import (
+	"fmt"
+
+	dbpkg "github.com/Hussein-Mazeh/PasswordManager/internal/db"
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+)
+
+// aeadTagSize is the authentication tag length of both supported suites.
+const aeadTagSize = 16
+
+// entryMeta is a row's decrypted website and username, when they decrypt.
+type entryMeta struct {
+	website, username string
+	ok                bool
+}
+
+// Entries trial-decrypts every entry, trashed ones included, and every history version.
+//
+// Args:
+//
+//	d: open, migrated database.
+//	keys: metadata keys derived from mek.
+//	mek: 32-byte master encryption key.
+//	repair: rewrite blind indexes that no longer match their metadata.
+//
+// Returns:
+//
+//	[]Finding: one per problem, or a single ok finding.
+//	int: number of entries examined.
+//	error: non-nil only when the table cannot be read at all.
+//
+// Behavior:
+//  1. Reports unknown cipher suites, salts that are not vault.EntrySaltLen bytes, and
+//     blobs too short to hold a nonce and tag, without attempting to decrypt them.
+//  2. Opens the sealed website and username; rows whose metadata fails cannot be
+//     decrypted either, since both are part of the entry AAD.
+//  3. Decrypts the payload. On failure, tries the website/username of every other row:
+//     if one opens it, the row's metadata and ciphertext were mixed up (AAD mismatch);
+//     otherwise the ciphertext is corrupted or sealed under another key.
+//  4. Nothing is written back; unlike Service.GetEntry no rotate-at-read happens.
+func Entries(d *dbpkg.DB, keys *vault.MetaKeys, mek []byte, repair bool) ([]Finding, int, error) {
+	raws, err := dbpkg.RawEntries(d)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	metas := make([]entryMeta, len(raws))
+	for i, r := range raws {
+		w, werr := keys.OpenMeta(vault.MetaFieldWebsite, r.WebsiteEnc)
+		u, uerr := keys.OpenMeta(vault.MetaFieldUsername, r.UsernameEnc)
+		metas[i] = entryMeta{website: w, username: u, ok: werr == nil && uerr == nil}
+	}
+
+	var out []Finding
+	for i, r := range raws {
+		m := metas[i]
+		subject := fmt.Sprintf("entry %d", r.ID)
+		if m.ok {
+			subject = m.website + "/" + m.username
+		}
+		if r.DeletedAt != "" {
+			subject += " (in trash)"
+		}
+		fail := func(msg string) {
+			out = append(out, Finding{Check: CheckEntries, Severity: SeverityError, Subject: subject, EntryID: r.ID, Message: msg})
+		}
+
+		if msg := blobProblem(r.Suite, r.Salt, r.EncryptedPass); msg != "" {
+			fail(msg)
+			continue
+		}
+		if !m.ok {
+			fail("website/username metadata does not decrypt")
+			continue
+		}
+
+		entryIndex := keys.IndexFor(m.website, m.username, r.Type)
+		if keys.SiteIndex(m.website) != r.SiteIndex || entryIndex != r.EntryIndex {
+			f := Finding{Check: CheckEntries, Severity: SeverityWarning, Subject: subject, EntryID: r.ID,
+				Message: "blind index does not match the metadata; lookups miss this entry", Repairable: true}
+			if repair {
+				if err := dbpkg.SetEntryIndexes(d, r.ID, keys.SiteIndex(m.website), entryIndex); err != nil {
+					f.Message += ": " + err.Error()
+				} else {
+					f.Repaired = true
+				}
+			}
+			out = append(out, f)
+		}
+
+		if msg := openProblem(mek, r.Suite, m, r.Type, r.Format, r.Salt, r.EncryptedPass, metas); msg != "" {
+			fail(msg)
+		}
+
+		history, err := dbpkg.ListHistory(d, r.ID)
+		if err != nil {
+			fail(err.Error())
+			continue
+		}
+		for n, h := range history {
+			msg := blobProblem(h.Suite, h.Salt, h.EncryptedPass)
+			if msg == "" {
+				msg = openProblem(mek, h.Suite, m, h.Type, h.Format, h.Salt, h.EncryptedPass, metas)
+			}
+			if msg != "" {
+				out = append(out, Finding{Check: CheckHistory, Severity: SeverityError,
+					Subject: fmt.Sprintf("%s version %d", subject, n+1), EntryID: r.ID, Message: msg})
+			}
+		}
+	}
+
+	if len(out) == 0 {
+		out = append(out, Finding{Check: CheckEntries, Severity: SeverityOK, Message: fmt.Sprintf("%d entries decrypt", len(raws))})
+	}
+	return out, len(raws), nil
+}
+
+// blobProblem describes a stored salt/blob pair that cannot possibly decrypt.
+func blobProblem(suite krypto.Suite, salt, blob []byte) string {
+	switch {
+	case !suite.Valid():
+		return fmt.Sprintf("unknown cipher suite %d", suite)
+	case len(salt) != vault.EntrySaltLen:
+		return fmt.Sprintf("wrong salt length: %d bytes, want %d", len(salt), vault.EntrySaltLen)
+	case len(blob) < suite.NonceSize()+aeadTagSize:
+		return fmt.Sprintf("truncated blob: %d bytes, need at least %d", len(blob), suite.NonceSize()+aeadTagSize)
+	}
+	return ""
+}
+
+// openProblem decrypts and decodes one blob and describes why it fails, if it does.
+func openProblem(mek []byte, suite krypto.Suite, m entryMeta, typ string, format int, salt, blob []byte, all []entryMeta) string {
+	plain, _, _, err := vault.DecryptEntryPassword(mek, suite, m.website, m.username, typ, salt, blob)
+	if err == nil {
+		if _, err := vault.DecodePayload(format, plain); err != nil {
+			return err.Error()
+		}
+		return ""
+	}
+
+	for _, other := range all {
+		if !other.ok || (other.website == m.website && other.username == m.username) {
+			continue
+		}
+		if _, _, _, err := vault.DecryptEntryPassword(mek, suite, other.website, other.username, typ, salt, blob); err == nil {
+			return fmt.Sprintf("AAD mismatch: ciphertext was sealed for %s/%s", other.website, other.username)
+		}
+	}
+	return "does not decrypt: ciphertext corrupted or sealed under another key"
+}
@@ -0,0 +1,175 @@
+package exporter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+)
+
+// ArchiveVersion is the envelope layout version written in Archive.Version.
+const ArchiveVersion = 1
+
+// Limits on the KDF parameters Open accepts, so a crafted archive cannot make it
+// allocate gigabytes or spin for minutes before the passphrase is even checked.
+const (
+	maxArchiveMemoryMB = 4096
+	maxArchiveTime     = 64
+)
+
+// ErrBadPassphrase indicates the archive did not decrypt: the passphrase is wrong or
+// the file was modified.
+var ErrBadPassphrase = errors.New("wrong export passphrase or corrupted archive")
+
+// Archive is the self-contained encrypted export. Everything needed to decrypt it apart
+// from the passphrase is in the envelope: the Argon2id parameters and salt derive a
+// 32-byte key, and Cipher seals the JSON Document as nonce|ciphertext. The envelope
+// itself, without Ciphertext, is the AEAD associated data, so its fields cannot be
+// changed without failing decryption.
+type Archive struct {
+	Format     string     `json:"format"` // always "pm-archive"
+	Version    int        `json:"version"`
+	CreatedAt  string     `json:"created_at"`
+	Cipher     string     `json:"cipher"`
+	KDF        ArchiveKDF `json:"kdf"`
+	Ciphertext []byte     `json:"ciphertext,omitempty"`
+}
+
+// ArchiveKDF records how the archive key was derived from the passphrase.
+type ArchiveKDF struct {
+	Algorithm   string `json:"algorithm"` // always "argon2id"
+	MemoryMB    uint32 `json:"memory_mb"`
+	Time        uint32 `json:"time"`
+	Parallelism uint8  `json:"parallelism"`
+	Salt        []byte `json:"salt"`
+}
+
+// aad returns the associated data binding the envelope to the ciphertext.
+func (a Archive) aad() ([]byte, error) {
+	a.Ciphertext = nil
+	return json.Marshal(a)
+}
+
+// Seal encrypts doc under passphrase and returns the archive file contents.
+//
+// Args:
+//
+//	doc: decrypted export from Collect.
+//	passphrase: export passphrase; it is independent of the master password.
+//	params: Argon2id cost; KeyLen and SaltLen are forced to 32 and krypto.SaltLengthBytes.
+//	suite: AEAD used to seal the document.
+//
+// Returns:
+//
+//	[]byte: indented JSON Archive.
+//	error: non-nil when key derivation or encryption fails.
+func Seal(doc Document, passphrase []byte, params krypto.Argon2Params, suite krypto.Suite) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("export passphrase is required")
+	}
+	if !suite.Valid() {
+		return nil, krypto.ErrUnknownSuite
+	}
+	params.KeyLen = 32
+	params.SaltLen = krypto.SaltLengthBytes
+
+	salt, err := krypto.NewRandomSalt(params.SaltLen)
+	if err != nil {
+		return nil, err
+	}
+	key, err := krypto.DeriveKeyArgon2id(passphrase, salt, params)
+	if err != nil {
+		return nil, fmt.Errorf("derive archive key: %w", err)
+	}
+	defer zeroize(key)
+
+	plain, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("encode export: %w", err)
+	}
+	defer zeroize(plain)
+
+	a := Archive{
+		Format:    "pm-archive",
+		Version:   ArchiveVersion,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		Cipher:    suite.String(),
+		KDF: ArchiveKDF{
+			Algorithm:   "argon2id",
+			MemoryMB:    params.MemoryMB,
+			Time:        params.Time,
+			Parallelism: params.Parallelism,
+			Salt:        salt,
+		},
+	}
+	aad, err := a.aad()
+	if err != nil {
+		return nil, err
+	}
+	a.Ciphertext, err = suite.Seal(key, plain, aad)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt export: %w", err)
+	}
+	return json.MarshalIndent(a, "", "  ")
+}
+
+// Open decrypts an archive written by Seal. It returns ErrBadPassphrase when the
+// passphrase is wrong or the archive was tampered with.
+func Open(data, passphrase []byte) (Document, error) {
+	var a Archive
+	if err := json.Unmarshal(data, &a); err != nil {
+		return Document{}, fmt.Errorf("parse archive: %w", err)
+	}
+	if a.Format != "pm-archive" {
+		return Document{}, errors.New("not a pm export archive")
+	}
+	if a.Version != ArchiveVersion {
+		return Document{}, fmt.Errorf("unsupported archive version %d", a.Version)
+	}
+	if a.KDF.Algorithm != "argon2id" {
+		return Document{}, fmt.Errorf("unsupported archive KDF %q", a.KDF.Algorithm)
+	}
+	if a.KDF.MemoryMB > maxArchiveMemoryMB || a.KDF.Time > maxArchiveTime || a.KDF.Parallelism == 0 {
+		return Document{}, errors.New("archive KDF parameters are out of range")
+	}
+	suite, err := krypto.ParseSuite(a.Cipher)
+	if err != nil {
+		return Document{}, err
+	}
+
+	key, err := krypto.DeriveKeyArgon2id(passphrase, a.KDF.Salt, krypto.Argon2Params{
+		MemoryMB:    a.KDF.MemoryMB,
+		Time:        a.KDF.Time,
+		Parallelism: a.KDF.Parallelism,
+		SaltLen:     len(a.KDF.Salt),
+		KeyLen:      32,
+	})
+	if err != nil {
+		return Document{}, fmt.Errorf("derive archive key: %w", err)
+	}
+	defer zeroize(key)
+
+	aad, err := a.aad()
+	if err != nil {
+		return Document{}, err
+	}
+	plain, err := suite.Open(key, a.Ciphertext, aad)
+	if err != nil {
+		return Document{}, ErrBadPassphrase
+	}
+	defer zeroize(plain)
+
+	var doc Document
+	if err := json.Unmarshal(plain, &doc); err != nil {
+		return Document{}, fmt.Errorf("decode export: %w", err)
+	}
+	return doc, nil
+}
+
+func zeroize(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,180 @@
+// Package exporter reads every entry out of the vault and writes it either as a
+// passphrase-protected archive or as plaintext CSV/JSON.
+package exporter
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	dbpkg "github.com/Hussein-Mazeh/PasswordManager/internal/db"
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+)
+
+// DocumentVersion is the layout version written in Document.Version.
+const DocumentVersion = 1
+
+// Document is the complete decrypted export. The archive seals it as JSON and the
+// plaintext JSON mode writes it as-is.
+type Document struct {
+	Format     string  `json:"format"` // always "pm-export"
+	Version    int     `json:"version"`
+	ExportedAt string  `json:"exported_at"`
+	Entries    []Entry `json:"entries"`
+}
+
+// Entry is one credential with its payload, timestamps and previous versions.
+type Entry struct {
+	Website  string `json:"website"`
+	Username string `json:"username"`
+	Type     string `json:"type"`
+	vault.EntryPayload
+	CreatedAt string    `json:"created_at"`
+	UpdatedAt string    `json:"updated_at"`
+	DeletedAt string    `json:"deleted_at,omitempty"` // set for entries exported from the trash
+	History   []Version `json:"history,omitempty"`    // newest first
+}
+
+// Version is a previous version of an entry from its password history.
+type Version struct {
+	Type string `json:"type"`
+	vault.EntryPayload
+	UpdatedAt  string `json:"updated_at"`
+	ArchivedAt string `json:"archived_at"`
+}
+
+// Collect decrypts every live entry, and the trash when includeTrash is set, together
+// with its password history.
+//
+// Args:
+//
+//	d: open database handle.
+//	keys: metadata keys for the vault.
+//	mek: 32-byte master encryption key.
+//	includeTrash: also export entries waiting in the trash.
+//
+// Returns:
+//
+//	Document: entries ordered by website and username, then trashed entries.
+//	error: non-nil when any entry or history version fails to decrypt; an export
+//	       that silently drops entries would not be a backup.
+//
+// Behavior:
+//   - Reads only; unlike Service.GetEntry it does not persist rotate-at-read ciphertexts.
+func Collect(d *dbpkg.DB, keys *vault.MetaKeys, mek []byte, includeTrash bool) (Document, error) {
+	doc := Document{
+		Format:     "pm-export",
+		Version:    DocumentVersion,
+		ExportedAt: time.Now().UTC().Format(time.RFC3339),
+		Entries:    []Entry{},
+	}
+
+	rows, err := dbpkg.ListEntries(d, keys)
+	if err != nil {
+		return Document{}, err
+	}
+	if includeTrash {
+		trashed, err := dbpkg.ListTrash(d, keys)
+		if err != nil {
+			return Document{}, err
+		}
+		rows = append(rows, trashed...)
+	}
+
+	for _, row := range rows {
+		e, err := collectEntry(d, mek, row)
+		if err != nil {
+			return Document{}, fmt.Errorf("%s / %s: %w", row.Website, row.Username, err)
+		}
+		doc.Entries = append(doc.Entries, e)
+	}
+	return doc, nil
+}
+
+func collectEntry(d *dbpkg.DB, mek []byte, row dbpkg.EntryRow) (Entry, error) {
+	payload, err := openPayload(mek, row, row.Type, row.Format, row.Suite, row.Salt, row.EncryptedPass)
+	if err != nil {
+		return Entry{}, err
+	}
+	e := Entry{
+		Website:      row.Website,
+		Username:     row.Username,
+		Type:         row.Type,
+		EntryPayload: payload,
+		CreatedAt:    row.CreatedAt,
+		UpdatedAt:    row.UpdatedAt,
+		DeletedAt:    row.DeletedAt,
+	}
+
+	history, err := dbpkg.ListHistory(d, row.ID)
+	if err != nil {
+		return Entry{}, err
+	}
+	for i, h := range history {
+		// History blobs keep the entry's AAD, so they only open under the parent's metadata.
+		p, err := openPayload(mek, row, h.Type, h.Format, h.Suite, h.Salt, h.EncryptedPass)
+		if err != nil {
+			return Entry{}, fmt.Errorf("version %d: %w", i+1, err)
+		}
+		e.History = append(e.History, Version{
+			Type:         h.Type,
+			EntryPayload: p,
+			UpdatedAt:    h.UpdatedAt,
+			ArchivedAt:   h.ArchivedAt,
+		})
+	}
+	return e, nil
+}
+
+func openPayload(mek []byte, row dbpkg.EntryRow, typ string, format int, suite krypto.Suite, salt, blob []byte) (vault.EntryPayload, error) {
+	plain, _, _, err := vault.DecryptEntryPassword(mek, suite, row.Website, row.Username, typ, salt, blob)
+	if err != nil {
+		return vault.EntryPayload{}, fmt.Errorf("decrypt: %w", err)
+	}
+	return vault.DecodePayload(format, plain)
+}
+
+// WriteJSON writes doc as indented JSON.
+func WriteJSON(w io.Writer, doc Document) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// csvHeader lists the CSV columns. URLs are newline separated, tags comma separated and
+// custom fields a JSON array; history is only in the JSON and archive exports.
+var csvHeader = []string{
+	"website", "username", "type", "password", "notes", "urls", "tags", "folder", "fields",
+	"created_at", "updated_at", "deleted_at",
+}
+
+// WriteCSV writes one row per entry of doc.
+func WriteCSV(w io.Writer, doc Document) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, e := range doc.Entries {
+		fields := ""
+		if len(e.Fields) > 0 {
+			b, err := json.Marshal(e.Fields)
+			if err != nil {
+				return fmt.Errorf("encode fields: %w", err)
+			}
+			fields = string(b)
+		}
+		if err := cw.Write([]string{
+			e.Website, e.Username, e.Type, e.Password, e.Notes,
+			strings.Join(e.URLs, "\n"), strings.Join(e.Tags, ","), e.Folder, fields,
+			e.CreatedAt, e.UpdatedAt, e.DeletedAt,
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
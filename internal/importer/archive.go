@@ -0,0 +1,55 @@
+package importer
+
+import (
+	"fmt"
+
+	"github.com/Hussein-Mazeh/PasswordManager/internal/exporter"
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+)
+
+// ParseArchive decrypts an archive written by pm export and returns its entries as
+// records. A wrong passphrase or a modified archive fails with exporter.ErrBadPassphrase.
+//
+// Unlike the other formats, an archive entry keeps its website, type and payload exactly
+// as exported, so TOTP entries come back as TOTP entries. Entries that were in the trash
+// when the archive was made are skipped, and password history is not carried over.
+func ParseArchive(data, passphrase []byte) ([]Record, []Result, error) {
+	doc, err := exporter.Open(data, passphrase)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read %s export: %w", PMArchive, err)
+	}
+
+	var records []Record
+	var skipped []Result
+	for i, e := range doc.Entries {
+		rec := Record{
+			Website:  e.Website,
+			Username: e.Username,
+			Type:     e.Type,
+			Payload:  e.EntryPayload,
+			Source:   fmt.Sprintf("entry %d", i+1),
+		}
+		if rec.Type == "" {
+			rec.Type = vault.TypePassword
+		}
+		rec.Payload.Normalize()
+
+		reason := ""
+		switch {
+		case e.DeletedAt != "":
+			reason = "in the archive's trash"
+		case rec.Website == "":
+			reason = "no website"
+		default:
+			if err := rec.Payload.Validate(); err != nil {
+				reason = err.Error()
+			}
+		}
+		if reason != "" {
+			skipped = append(skipped, Result{Record: rec, Status: StatusSkipped, Reason: reason})
+			continue
+		}
+		records = append(records, rec)
+	}
+	return records, skipped, nil
+}
@@ -0,0 +1,115 @@
+package importer
+
+import (
+	"crypto/rand"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	dbpkg "github.com/Hussein-Mazeh/PasswordManager/internal/db"
+	"github.com/Hussein-Mazeh/PasswordManager/internal/exporter"
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+)
+
+// openVaultDB returns a migrated database in a new directory with a random MEK.
+func openVaultDB(t *testing.T) (*dbpkg.DB, *vault.MetaKeys, []byte) {
+	t.Helper()
+	d, err := dbpkg.Open(filepath.Join(t.TempDir(), "vault.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dbpkg.Close(d) })
+	if err := dbpkg.Migrate(d); err != nil {
+		t.Fatal(err)
+	}
+	mek := make([]byte, 32)
+	if _, err := rand.Read(mek); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := vault.DeriveMetaKeys(mek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d, keys, mek
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	src, srcKeys, srcMEK := openVaultDB(t)
+	records := []Record{
+		{Website: "example.com", Username: "alice", Type: vault.TypePassword, Payload: vault.EntryPayload{Password: "pw-1", Notes: "kept", Tags: []string{"work"}}},
+		{Website: "example.com", Username: "alice", Type: vault.TypeTOTP, Payload: vault.EntryPayload{Password: "otpauth://totp/example:alice?secret=JBSWY3DPEHPK3PXP"}},
+		{Website: "old.example", Username: "bob", Type: vault.TypePassword, Payload: vault.EntryPayload{Password: "pw-2"}},
+	}
+	if _, err := Apply(src, srcKeys, srcMEK, krypto.DefaultSuite, records, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := dbpkg.DeleteEntryBySiteAndUser(src, srcKeys, "old.example", "bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := exporter.Collect(src, srcKeys, srcMEK, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pass := []byte("correct horse battery staple")
+	params := krypto.Argon2Params{MemoryMB: 8, Time: 1, Parallelism: 1, SaltLen: krypto.SaltLengthBytes, KeyLen: 32}
+	data, err := exporter.Seal(doc, pass, params, krypto.DefaultSuite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := ParseArchive(data, []byte("wrong passphrase")); !errors.Is(err, exporter.ErrBadPassphrase) {
+		t.Fatalf("wrong passphrase: err = %v, want ErrBadPassphrase", err)
+	}
+	if _, _, err := Parse(PMArchive, data); err == nil {
+		t.Fatal("Parse accepted an archive without its passphrase")
+	}
+
+	got, skipped, err := ParseArchive(data, pass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(skipped) != 1 || skipped[0].Website != "old.example" {
+		t.Fatalf("skipped = %+v, want the trashed old.example entry", skipped)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d records, want 2", len(got))
+	}
+
+	dst, dstKeys, dstMEK := openVaultDB(t)
+	results, err := Apply(dst, dstKeys, dstMEK, krypto.DefaultSuite, got, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := Summary(results)[StatusImported]; n != 2 {
+		t.Fatalf("imported %d, want 2: %+v", n, results)
+	}
+
+	row, err := dbpkg.GetEntryBySiteAndUser(dst, dstKeys, "example.com", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, _, _, err := vault.DecryptEntryPassword(dstMEK, row.Suite, row.Website, row.Username, row.Type, row.Salt, row.EncryptedPass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := vault.DecodePayload(row.Format, plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload.Password != "pw-1" || payload.Notes != "kept" || len(payload.Tags) != 1 {
+		t.Errorf("imported payload = %+v", payload)
+	}
+	if _, err := dbpkg.GetTOTPBySiteAndUser(dst, dstKeys, "example.com", "alice"); err != nil {
+		t.Errorf("TOTP entry not imported: %v", err)
+	}
+
+	again, err := Apply(dst, dstKeys, dstMEK, krypto.DefaultSuite, got, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := Summary(again)[StatusDuplicate]; n != 2 {
+		t.Errorf("second import: %d duplicates, want 2: %+v", n, again)
+	}
+}
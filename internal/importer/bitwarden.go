@@ -0,0 +1,104 @@
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+)
+
+// bitwardenExport is the unencrypted JSON written by Bitwarden's "Export vault".
+type bitwardenExport struct {
+	Encrypted bool `json:"encrypted"`
+	Folders   []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"folders"`
+	Items []struct {
+		Type     int    `json:"type"`
+		Name     string `json:"name"`
+		Notes    string `json:"notes"`
+		FolderID string `json:"folderId"`
+		Login    *struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			TOTP     string `json:"totp"`
+			URIs     []struct {
+				URI string `json:"uri"`
+			} `json:"uris"`
+		} `json:"login"`
+		Fields []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+			Type  int    `json:"type"`
+		} `json:"fields"`
+	} `json:"items"`
+}
+
+const (
+	bitwardenLogin = 1
+
+	bitwardenHiddenField = 1
+	bitwardenBoolField   = 2
+	bitwardenLinkedField = 3 // points at another login property; carries no value
+)
+
+func parseBitwarden(data []byte) ([]item, error) {
+	var exp bitwardenExport
+	if err := json.Unmarshal(data, &exp); err != nil {
+		return nil, err
+	}
+	if exp.Encrypted {
+		return nil, errors.New("encrypted Bitwarden exports are not supported; export as unencrypted JSON")
+	}
+	folders := make(map[string]string, len(exp.Folders))
+	for _, f := range exp.Folders {
+		folders[f.ID] = f.Name
+	}
+
+	items := make([]item, 0, len(exp.Items))
+	for i, bw := range exp.Items {
+		it := item{
+			source: fmt.Sprintf("item %d (%s)", i+1, bw.Name),
+			name:   bw.Name,
+			payload: vault.EntryPayload{
+				Notes:  bw.Notes,
+				Folder: folders[bw.FolderID],
+			},
+		}
+		if bw.Type != bitwardenLogin || bw.Login == nil {
+			it.skip = fmt.Sprintf("Bitwarden item type %d is not a login", bw.Type)
+			items = append(items, it)
+			continue
+		}
+
+		it.username = bw.Login.Username
+		it.payload.Password = bw.Login.Password
+		for _, u := range bw.Login.URIs {
+			it.urls = append(it.urls, u.URI)
+		}
+		if bw.Login.TOTP != "" {
+			it.payload.SetField(vault.CustomField{Name: "totp", Type: vault.FieldHidden, Value: bw.Login.TOTP})
+		}
+		for _, f := range bw.Fields {
+			if f.Type == bitwardenLinkedField || strings.TrimSpace(f.Name) == "" {
+				continue
+			}
+			field := vault.CustomField{Name: f.Name, Type: vault.FieldText, Value: f.Value}
+			switch f.Type {
+			case bitwardenHiddenField:
+				field.Type = vault.FieldHidden
+			case bitwardenBoolField:
+				field.Type = vault.FieldBoolean
+				if field.Value != "true" {
+					field.Value = "false"
+				}
+			}
+			it.payload.SetField(field)
+		}
+		items = append(items, it)
+	}
+	return items, nil
+}
@@ -0,0 +1,94 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// csvColumns maps the columns a browser export uses onto item fields. Each entry lists
+// the accepted header names, lowercase.
+type csvColumns struct {
+	name, url, username, password, notes []string
+}
+
+// chromeColumns covers Chrome, Edge and other Chromium exports ("name,url,username,password,note").
+var chromeColumns = csvColumns{
+	name:     []string{"name", "title"},
+	url:      []string{"url"},
+	username: []string{"username"},
+	password: []string{"password"},
+	notes:    []string{"note", "notes"},
+}
+
+// firefoxColumns covers Firefox's logins.csv.
+var firefoxColumns = csvColumns{
+	url:      []string{"url"},
+	username: []string{"username"},
+	password: []string{"password"},
+}
+
+func parseCSV(data []byte, cols csvColumns) ([]item, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+
+	header, err := r.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("file is empty")
+		}
+		return nil, err
+	}
+	index := make(map[string]int, len(header))
+	for i, h := range header {
+		index[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	column := func(names []string) int {
+		for _, n := range names {
+			if i, ok := index[n]; ok {
+				return i
+			}
+		}
+		return -1
+	}
+	nameCol, urlCol := column(cols.name), column(cols.url)
+	userCol, passCol, notesCol := column(cols.username), column(cols.password), column(cols.notes)
+	if urlCol < 0 || userCol < 0 || passCol < 0 {
+		return nil, fmt.Errorf("header %q lacks url, username or password columns", strings.Join(header, ","))
+	}
+
+	var items []item
+	for {
+		row, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		get := func(i int) string {
+			if i < 0 || i >= len(row) {
+				return ""
+			}
+			return row[i]
+		}
+		// Quoted fields may span lines, so take the line from the reader.
+		line, _ := r.FieldPos(0)
+		it := item{
+			source:   fmt.Sprintf("line %d", line),
+			name:     get(nameCol),
+			username: get(userCol),
+		}
+		if u := strings.TrimSpace(get(urlCol)); u != "" {
+			it.urls = []string{u}
+		}
+		it.payload.Password = get(passCol)
+		it.payload.Notes = get(notesCol)
+		items = append(items, it)
+	}
+	return items, nil
+}
@@ -0,0 +1,243 @@
+// Package importer reads credentials exported by other password managers and adds them
+// to the vault.
+package importer
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	dbpkg "github.com/Hussein-Mazeh/PasswordManager/internal/db"
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+)
+
+// Format names an export file layout.
+type Format string
+
+const (
+	ChromeCSV     Format = "chrome-csv"
+	FirefoxCSV    Format = "firefox-csv"
+	BitwardenJSON Format = "bitwarden-json"
+	KeePassXML    Format = "keepass-xml"
+	OnePUX        Format = "1pux"
+	// PMArchive is an encrypted archive from pm export; read it with ParseArchive.
+	PMArchive Format = "pm-archive"
+)
+
+// Formats lists the supported formats in the order they are offered to users.
+func Formats() []Format {
+	return []Format{ChromeCSV, FirefoxCSV, BitwardenJSON, KeePassXML, OnePUX, PMArchive}
+}
+
+// ParseFormat maps a user-supplied name onto a Format.
+func ParseFormat(name string) (Format, error) {
+	f := Format(strings.ToLower(strings.TrimSpace(name)))
+	for _, known := range Formats() {
+		if f == known {
+			return f, nil
+		}
+	}
+	names := make([]string, 0, len(Formats()))
+	for _, known := range Formats() {
+		names = append(names, string(known))
+	}
+	return "", fmt.Errorf("unknown import format %q (use %s)", name, strings.Join(names, ", "))
+}
+
+// Record is one credential read from an export, ready to be stored.
+type Record struct {
+	Website  string // eTLD+1 of the first URL, or the item's name when it has no URL
+	Username string
+	Type     string
+	Payload  vault.EntryPayload
+	Source   string // where the record came from in the file, for reports
+}
+
+// Status is what happened, or would happen, to one record.
+type Status string
+
+const (
+	StatusImported  Status = "imported"
+	StatusDuplicate Status = "duplicate" // same website and username already in the vault or earlier in the file
+	StatusInTrash   Status = "in-trash"  // same website and username is in the vault trash
+	StatusSkipped   Status = "skipped"   // the export item cannot become an entry
+	StatusFailed    Status = "failed"
+)
+
+// Result reports the outcome for one export item.
+type Result struct {
+	Record
+	Status Status
+	Reason string
+}
+
+// Parse decodes an export file in the given format. Items that cannot become entries,
+// such as ones without a username, are returned as skipped results rather than errors.
+func Parse(format Format, data []byte) ([]Record, []Result, error) {
+	var (
+		items []item
+		err   error
+	)
+	switch format {
+	case ChromeCSV:
+		items, err = parseCSV(data, chromeColumns)
+	case FirefoxCSV:
+		items, err = parseCSV(data, firefoxColumns)
+	case BitwardenJSON:
+		items, err = parseBitwarden(data)
+	case KeePassXML:
+		items, err = parseKeePass(data)
+	case OnePUX:
+		items, err = parseOnePUX(data)
+	case PMArchive:
+		return nil, nil, errors.New("a pm-archive export needs its passphrase; use ParseArchive")
+	default:
+		return nil, nil, fmt.Errorf("unknown import format %q", format)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("read %s export: %w", format, err)
+	}
+
+	var records []Record
+	var skipped []Result
+	for _, it := range items {
+		rec, reason := it.record()
+		if reason != "" {
+			skipped = append(skipped, Result{Record: rec, Status: StatusSkipped, Reason: reason})
+			continue
+		}
+		records = append(records, rec)
+	}
+	return records, skipped, nil
+}
+
+// item is the format-neutral shape every parser produces.
+type item struct {
+	source   string
+	name     string
+	username string
+	urls     []string
+	payload  vault.EntryPayload
+	skip     string // set by parsers for items they recognise but cannot import
+}
+
+func (it item) record() (Record, string) {
+	rec := Record{
+		Username: strings.TrimSpace(it.username),
+		Type:     vault.TypePassword,
+		Payload:  it.payload,
+		Source:   it.source,
+	}
+	rec.Payload.URLs = append(it.urls, rec.Payload.URLs...)
+	rec.Payload.Normalize()
+
+	switch {
+	case len(rec.Payload.URLs) > 0:
+		rec.Website = vault.NormalizeSite(rec.Payload.URLs[0])
+	case strings.TrimSpace(it.name) != "":
+		rec.Website = strings.ToLower(strings.TrimSpace(it.name))
+	}
+
+	if it.skip != "" {
+		return rec, it.skip
+	}
+	if rec.Website == "" {
+		return rec, "no URL or name"
+	}
+	if rec.Username == "" {
+		return rec, "no username"
+	}
+	if err := rec.Payload.Validate(); err != nil {
+		return rec, err.Error()
+	}
+	return rec, ""
+}
+
+// Apply stores records in the vault, or only checks them when dryRun is set.
+//
+// Args:
+//
+//	d, keys: open database and metadata keys of an unlocked vault.
+//	mek, suite: key and AEAD used to encrypt new entries.
+//	records: parsed records, usually from Parse.
+//	dryRun: report what would happen without writing anything.
+//
+// Returns:
+//
+//	[]Result: one result per record, in input order.
+//	error: non-nil only when the vault cannot be queried; per-record problems are results.
+//
+// Behavior:
+//  1. A record whose website and username already exist (UNIQUE(website, username)),
+//     or appeared earlier in the same import, is reported as a duplicate and left alone.
+//     TOTP records are compared with TOTP entries only, as they are stored beside the
+//     account's password entry.
+//  2. A record matching an entry in the trash is reported as in-trash.
+//  3. Every other record is encrypted and inserted on its own; a failure is reported and
+//     the import carries on.
+func Apply(d *dbpkg.DB, keys *vault.MetaKeys, mek []byte, suite krypto.Suite, records []Record, dryRun bool) ([]Result, error) {
+	results := make([]Result, 0, len(records))
+	seen := make(map[string]bool, len(records))
+
+	for _, rec := range records {
+		res := Result{Record: rec, Status: StatusImported}
+		key := keys.IndexFor(rec.Website, rec.Username, rec.Type)
+
+		lookup := dbpkg.GetEntryBySiteAndUser
+		if rec.Type == vault.TypeTOTP {
+			lookup = dbpkg.GetTOTPBySiteAndUser
+		}
+		_, err := lookup(d, keys, rec.Website, rec.Username)
+		switch {
+		case err == nil:
+			res.Status, res.Reason = StatusDuplicate, "already in the vault"
+		case !errors.Is(err, sql.ErrNoRows):
+			return results, fmt.Errorf("look up %s/%s: %w", rec.Website, rec.Username, err)
+		case seen[key]:
+			res.Status, res.Reason = StatusDuplicate, "repeated in this file"
+		}
+		seen[key] = true
+
+		if res.Status == StatusImported {
+			res.Status, res.Reason = store(d, keys, mek, suite, rec, dryRun)
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+func store(d *dbpkg.DB, keys *vault.MetaKeys, mek []byte, suite krypto.Suite, rec Record, dryRun bool) (Status, string) {
+	plain, format, err := vault.EncodePayload(rec.Payload)
+	if err != nil {
+		return StatusFailed, err.Error()
+	}
+	if dryRun {
+		if dbpkg.EntryInTrash(d, keys, rec.Website, rec.Username, rec.Type) {
+			return StatusInTrash, "restore or purge the trashed entry first"
+		}
+		return StatusImported, ""
+	}
+
+	salt, blob, err := vault.EncryptEntryPassword(mek, suite, rec.Website, rec.Username, rec.Type, plain)
+	if err != nil {
+		return StatusFailed, fmt.Sprintf("encrypt: %v", err)
+	}
+	if _, err := dbpkg.InsertEntry(d, keys, rec.Website, rec.Username, rec.Type, suite, format, salt, blob); err != nil {
+		if errors.Is(err, dbpkg.ErrEntryInTrash) {
+			return StatusInTrash, "restore or purge the trashed entry first"
+		}
+		return StatusFailed, err.Error()
+	}
+	return StatusImported, ""
+}
+
+// Summary counts results by status.
+func Summary(results []Result) map[Status]int {
+	counts := make(map[Status]int)
+	for _, r := range results {
+		counts[r.Status]++
+	}
+	return counts
+}
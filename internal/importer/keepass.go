@@ -0,0 +1,112 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+)
+
+// keepassFile is the KeePass 2.x XML export ("KeePass XML (2.x)"). Only the parts needed
+// for entries are decoded; <History> inside an entry is deliberately not.
+type keepassFile struct {
+	XMLName xml.Name     `xml:"KeePassFile"`
+	Root    keepassGroup `xml:"Root>Group"`
+}
+
+type keepassGroup struct {
+	Name    string         `xml:"Name"`
+	Entries []keepassEntry `xml:"Entry"`
+	Groups  []keepassGroup `xml:"Group"`
+}
+
+type keepassEntry struct {
+	Tags    string `xml:"Tags"`
+	Strings []struct {
+		Key   string `xml:"Key"`
+		Value struct {
+			Text      string `xml:",chardata"`
+			Protected string `xml:"ProtectInMemory,attr"`
+		} `xml:"Value"`
+	} `xml:"String"`
+}
+
+// keepassRecycleBin is the default name of KeePass's trash group; its entries are not imported.
+const keepassRecycleBin = "Recycle Bin"
+
+func parseKeePass(data []byte) ([]item, error) {
+	var f keepassFile
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(&f); err != nil {
+		return nil, err
+	}
+	if f.XMLName.Local == "" {
+		return nil, errors.New("not a KeePass XML export")
+	}
+
+	var items []item
+	// The root group is the database itself, so folders start below it.
+	for _, g := range f.Root.Groups {
+		items = walkKeePass(g, "", items)
+	}
+	for i, e := range f.Root.Entries {
+		items = append(items, keepassItem(e, "", fmt.Sprintf("%s entry %d", f.Root.Name, i+1)))
+	}
+	return items, nil
+}
+
+func walkKeePass(g keepassGroup, parent string, items []item) []item {
+	if g.Name == keepassRecycleBin && parent == "" {
+		return items
+	}
+	folder := g.Name
+	if parent != "" {
+		folder = parent + "/" + g.Name
+	}
+	for i, e := range g.Entries {
+		items = append(items, keepassItem(e, folder, fmt.Sprintf("%s entry %d", folder, i+1)))
+	}
+	for _, sub := range g.Groups {
+		items = walkKeePass(sub, folder, items)
+	}
+	return items
+}
+
+func keepassItem(e keepassEntry, folder, source string) item {
+	it := item{source: source, payload: vault.EntryPayload{Folder: folder}}
+	it.payload.Tags = strings.FieldsFunc(e.Tags, func(r rune) bool { return r == ';' || r == ',' })
+
+	for _, s := range e.Strings {
+		value := s.Value.Text
+		switch s.Key {
+		case "Title":
+			it.name = value
+		case "UserName":
+			it.username = value
+		case "Password":
+			it.payload.Password = value
+		case "URL":
+			if strings.TrimSpace(value) != "" {
+				it.urls = append(it.urls, value)
+			}
+		case "Notes":
+			it.payload.Notes = value
+		default:
+			if strings.TrimSpace(s.Key) == "" || value == "" {
+				continue
+			}
+			typ := vault.FieldText
+			if strings.EqualFold(s.Value.Protected, "true") {
+				typ = vault.FieldHidden
+			}
+			it.payload.SetField(vault.CustomField{Name: s.Key, Type: typ, Value: value})
+		}
+	}
+	if it.name != "" {
+		it.source += " (" + it.name + ")"
+	}
+	return it
+}
@@ -0,0 +1,176 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+)
+
+// onePUXData is export.data inside a 1Password .1pux archive.
+type onePUXData struct {
+	Accounts []struct {
+		Vaults []struct {
+			Attrs struct {
+				Name string `json:"name"`
+			} `json:"attrs"`
+			Items []onePUXItem `json:"items"`
+		} `json:"vaults"`
+	} `json:"accounts"`
+}
+
+type onePUXItem struct {
+	State        string `json:"state"`
+	CategoryUUID string `json:"categoryUuid"`
+	Overview     struct {
+		Title string `json:"title"`
+		URL   string `json:"url"`
+		URLs  []struct {
+			URL string `json:"url"`
+		} `json:"urls"`
+		Tags []string `json:"tags"`
+	} `json:"overview"`
+	Details struct {
+		LoginFields []struct {
+			Value       string `json:"value"`
+			Name        string `json:"name"`
+			Designation string `json:"designation"`
+			FieldType   string `json:"fieldType"`
+		} `json:"loginFields"`
+		NotesPlain string `json:"notesPlain"`
+		Password   string `json:"password"`
+		Sections   []struct {
+			Fields []struct {
+				Title string                     `json:"title"`
+				ID    string                     `json:"id"`
+				Value map[string]json.RawMessage `json:"value"`
+			} `json:"fields"`
+		} `json:"sections"`
+	} `json:"details"`
+}
+
+// 1Password category UUIDs for the item kinds that carry a username and password.
+const (
+	onePUXLogin    = "001"
+	onePUXPassword = "005"
+)
+
+func parseOnePUX(data []byte) ([]item, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("open archive: %w", err)
+	}
+	var raw []byte
+	for _, f := range zr.File {
+		if f.Name != "export.data" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("open export.data: %w", err)
+		}
+		raw, err = io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read export.data: %w", err)
+		}
+	}
+	if raw == nil {
+		return nil, errors.New("archive has no export.data")
+	}
+
+	var exp onePUXData
+	if err := json.Unmarshal(raw, &exp); err != nil {
+		return nil, err
+	}
+
+	var items []item
+	for _, acct := range exp.Accounts {
+		for _, v := range acct.Vaults {
+			for i, op := range v.Items {
+				items = append(items, onePUXEntry(op, v.Attrs.Name, fmt.Sprintf("%s item %d (%s)", v.Attrs.Name, i+1, op.Overview.Title)))
+			}
+		}
+	}
+	return items, nil
+}
+
+func onePUXEntry(op onePUXItem, folder, source string) item {
+	it := item{
+		source: source,
+		name:   op.Overview.Title,
+		payload: vault.EntryPayload{
+			Notes:  op.Details.NotesPlain,
+			Folder: folder,
+			Tags:   op.Overview.Tags,
+		},
+	}
+	if op.State == "archived" || op.State == "deleted" {
+		it.skip = "item is " + op.State + " in 1Password"
+		return it
+	}
+	if op.CategoryUUID != onePUXLogin && op.CategoryUUID != onePUXPassword {
+		it.skip = fmt.Sprintf("1Password category %s is not a login", op.CategoryUUID)
+		return it
+	}
+
+	if op.Overview.URL != "" {
+		it.urls = append(it.urls, op.Overview.URL)
+	}
+	for _, u := range op.Overview.URLs {
+		it.urls = append(it.urls, u.URL)
+	}
+
+	it.payload.Password = op.Details.Password
+	for _, lf := range op.Details.LoginFields {
+		switch lf.Designation {
+		case "username":
+			it.username = lf.Value
+		case "password":
+			it.payload.Password = lf.Value
+		}
+	}
+
+	for _, sec := range op.Details.Sections {
+		for _, f := range sec.Fields {
+			name := f.Title
+			if name == "" {
+				name = f.ID
+			}
+			field, ok := onePUXField(name, f.Value)
+			if ok {
+				it.payload.SetField(field)
+			}
+		}
+	}
+	return it
+}
+
+// onePUXField converts a section field. Its value is an object with one key naming the
+// kind, e.g. {"concealed": "..."} or {"string": "..."}; non-string kinds are skipped.
+func onePUXField(name string, value map[string]json.RawMessage) (vault.CustomField, bool) {
+	if strings.TrimSpace(name) == "" {
+		return vault.CustomField{}, false
+	}
+	for kind, raw := range value {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil || s == "" {
+			continue
+		}
+		typ := vault.FieldText
+		switch kind {
+		case "concealed", "totp":
+			typ = vault.FieldHidden
+		}
+		if kind == "totp" {
+			name = "totp"
+		}
+		return vault.CustomField{Name: name, Type: typ, Value: s}, true
+	}
+	return vault.CustomField{}, false
+}
@@ -5,7 +5,6 @@ import (
 	"context"
 	"crypto/rand"
 	"database/sql"
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"os"
@@ -14,17 +13,34 @@ import (
 	"time"
 
 	"github.com/Hussein-Mazeh/PasswordManager/auth"
+	"github.com/Hussein-Mazeh/PasswordManager/internal/agent"
+	"github.com/Hussein-Mazeh/PasswordManager/internal/audit"
 	"github.com/Hussein-Mazeh/PasswordManager/internal/bio/toggle"
+	dbpkg "github.com/Hussein-Mazeh/PasswordManager/internal/db"
+	"github.com/Hussein-Mazeh/PasswordManager/internal/importer"
 	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
 	"github.com/Hussein-Mazeh/PasswordManager/krypto"
 	"github.com/Hussein-Mazeh/PasswordManager/store"
 )
 
+// ErrHeaderTampered is returned (wrapped) by unlock paths when header.json fails its MAC check.
+var ErrHeaderTampered = store.ErrHeaderTampered
+
+// ErrKeyfileRequired is returned (wrapped) by unlock paths when the vault needs a keyfile
+// and none was given.
+var ErrKeyfileRequired = store.ErrKeyfileRequired
+
+// ErrEntryInTrash is returned (wrapped) by AddEntry when the website/username pair
+// belongs to an entry in the trash.
+var ErrEntryInTrash = dbpkg.ErrEntryInTrash
+
 // Service exposes high-level vault operations for CLI/GUI.
 type Service struct {
-	sql   *sql.DB     // sqlite handle (vault/vault.db)
-	paths store.Paths // points to vault dir (header.json lives here)
-	mek   []byte      // decrypted MEK in memory after Unlock
+	db    *dbpkg.DB       // sqlite handle (vault/vault.db)
+	paths store.Paths     // points to vault dir (header.json lives here)
+	mek   []byte          // decrypted MEK in memory after Unlock
+	meta  *vault.MetaKeys // metadata subkeys derived from the MEK
+	suite krypto.Suite    // AEAD for new entries, from the header at unlock
 }
 
 // New returns a ready service bound to a vault directory (where BOTH header.json and vault.db live).
@@ -34,23 +50,30 @@ func New(vaultDir string) (*Service, error) {
 	}
 	dbPath := filepath.Join(vaultDir, "vault.db")
 
-	db, err := vault.Open(vault.Config{FilePath: dbPath})
+	db, err := dbpkg.Open(dbPath)
 	if err != nil {
 		return nil, fmt.Errorf("open sqlite (%s): %w", dbPath, err)
 	}
+	if err := dbpkg.Migrate(db); err != nil {
+		dbpkg.Close(db)
+		return nil, fmt.Errorf("migrate sqlite (%s): %w", dbPath, err)
+	}
 	return &Service{
-		sql:   db,
+		db:    db,
 		paths: store.Paths{Dir: vaultDir},
 	}, nil
 }
 
 // Close DB and zeroize MEK.
 func (s *Service) Close() {
-	if s.sql != nil {
-		_ = s.sql.Close()
+	if s.db != nil {
+		_ = dbpkg.Close(s.db)
 	}
 	wipe(s.mek)
 	s.mek = nil
+	s.meta.Wipe()
+	s.meta = nil
+	s.suite = 0
 }
 
 func wipe(b []byte) {
@@ -62,10 +85,25 @@ func wipe(b []byte) {
 	}
 }
 
-func (s *Service) setMEK(mek []byte) {
+// readKeyfile hashes the keyfile at path; an empty path means no keyfile.
+func readKeyfile(path string) ([]byte, error) {
+	if strings.TrimSpace(path) == "" {
+		return nil, nil
+	}
+	return krypto.HashKeyfile(path)
+}
+
+func (s *Service) setMEK(mek []byte) error {
+	s.meta.Wipe()
+	s.meta = nil
 	if len(mek) == 0 {
+		wipe(s.mek)
 		s.mek = nil
-		return
+		return nil
+	}
+	meta, err := vault.DeriveMetaKeys(mek)
+	if err != nil {
+		return err
 	}
 	if cap(s.mek) < len(mek) {
 		s.mek = make([]byte, len(mek))
@@ -73,9 +111,11 @@ func (s *Service) setMEK(mek []byte) {
 		s.mek = s.mek[:len(mek)]
 	}
 	copy(s.mek, mek)
+	s.meta = meta
+	return nil
 }
 
-// NeedsMasterSetup returns true when the vault header is missing or lacks a wrapped MEK.
+// NeedsMasterSetup returns true when the vault header is missing or has no key slots.
 func (s *Service) NeedsMasterSetup() (bool, error) {
 	hdr, err := store.LoadVaultHeader(s.paths)
 	if err != nil {
@@ -84,106 +124,124 @@ func (s *Service) NeedsMasterSetup() (bool, error) {
 		}
 		return false, fmt.Errorf("load header: %w", err)
 	}
-	if hdr.WrapNonce == "" || hdr.WrappedMEK == "" {
-		return true, nil
-	}
-	return false, nil
+	return len(hdr.KeySlots) == 0, nil
 }
 
 // SetMaster initializes the vault header with a new Argon2id KDF configuration and wrapped MEK.
-// It must only be called when NeedsMasterSetup reports true.
-func (s *Service) SetMaster(user, master string) error {
+// It must only be called when NeedsMasterSetup reports true. When keyfilePath is not empty,
+// the master slot also requires that keyfile to unlock.
+func (s *Service) SetMaster(user, master, keyfilePath string) error {
+	_, err := s.setMaster(user, master, keyfilePath, false)
+	return err
+}
+
+// SetMasterWithRecovery behaves like SetMaster and additionally wraps the MEK under a
+// freshly generated recovery code, which is returned for the user to print or save.
+func (s *Service) SetMasterWithRecovery(user, master, keyfilePath string) (string, error) {
+	return s.setMaster(user, master, keyfilePath, true)
+}
+
+// validateMaster holds a new master password to the vault's password policy. An empty
+// user is taken from the header, when there is one.
+func (s *Service) validateMaster(user, master string) error {
+	if user == "" {
+		if hdr, err := store.LoadVaultHeader(s.paths); err == nil {
+			user = hdr.User
+		}
+	}
+	_, opts, err := store.PasswordOptions(s.paths, user, "")
+	if err != nil {
+		return err
+	}
+	return auth.ValidateMasterPasswordAdvanced(context.Background(), master, opts)
+}
+
+func (s *Service) setMaster(user, master, keyfilePath string, withRecovery bool) (string, error) {
 	user = strings.TrimSpace(user)
 	if user == "" {
-		return errors.New("username is required")
+		return "", errors.New("username is required")
 	}
 	if master == "" {
-		return errors.New("master password cannot be empty")
+		return "", errors.New("master password cannot be empty")
 	}
 
-	ctx := context.Background()
-	opts := auth.DefaultValidateOptions()
-	opts.EnableHIBP = true
-	opts.MinZXCVBNScore = 3
-	if err := auth.ValidateMasterPasswordAdvanced(ctx, master, opts); err != nil {
-		return fmt.Errorf("validate master password: %w", err)
+	if err := s.validateMaster(user, master); err != nil {
+		return "", fmt.Errorf("validate master password: %w", err)
 	}
 
 	hdr, err := store.LoadVaultHeader(s.paths)
-	headerExists := err == nil
 	switch {
 	case errors.Is(err, os.ErrNotExist):
 		hdr = vault.VaultHeader{}
 	case err != nil:
-		return fmt.Errorf("load header: %w", err)
+		return "", fmt.Errorf("load header: %w", err)
+	}
+	if len(hdr.KeySlots) > 0 {
+		return "", errors.New("vault already initialised; unlock instead")
 	}
-	if headerExists && hdr.WrapNonce != "" && hdr.WrappedMEK != "" {
-		return errors.New("vault already initialised; unlock instead")
+
+	keyfile, err := readKeyfile(keyfilePath)
+	if err != nil {
+		return "", err
 	}
+	defer wipe(keyfile)
 
-	params := krypto.DefaultArgon2Params()
+	params := hdr.Argon2Floor()
 	params.SaltLen = krypto.SaltLengthBytes
+	kdf := vault.NewArgon2KDFConfig(params)
+	kdf.Keyfile = keyfile != nil
 
 	salt, err := krypto.NewRandomSalt(params.SaltLen)
 	if err != nil {
-		return fmt.Errorf("generate salt: %w", err)
+		return "", fmt.Errorf("generate salt: %w", err)
 	}
-	hdr.Salt = base64.StdEncoding.EncodeToString(salt)
 
 	masterBytes := []byte(master)
 	defer wipe(masterBytes)
 
-	pdk, err := krypto.DeriveKeyArgon2id(masterBytes, salt, params)
+	pdk, err := store.DerivePassphraseKey(kdf, masterBytes, salt, keyfile)
 	if err != nil {
-		return fmt.Errorf("derive key: %w", err)
+		return "", fmt.Errorf("derive key: %w", err)
 	}
 	defer wipe(pdk)
 
 	mek := make([]byte, 32)
 	if _, err := rand.Read(mek); err != nil {
-		return fmt.Errorf("generate mek: %w", err)
+		return "", fmt.Errorf("generate mek: %w", err)
 	}
 	defer wipe(mek)
 
-	hdr.Version = 1
-	hdr.User = user
-	hdr.KDF = vault.KDFConfig{
-		Name:        "argon2id",
-		MemoryMB:    params.MemoryMB,
-		Time:        params.Time,
-		Parallelism: params.Parallelism,
-		SaltLen:     krypto.SaltLengthBytes,
-		KeyLen:      params.KeyLen,
-	}
-
-	now := time.Now().UTC()
-	if hdr.CreatedAt.IsZero() {
-		hdr.CreatedAt = now
+	slot, err := store.WrapKeySlot(store.MasterSlotLabel, kdf, salt, pdk, mek)
+	if err != nil {
+		return "", fmt.Errorf("wrap mek: %w", err)
 	}
-	hdr.UpdatedAt = now
 
-	if err := store.WrapAndSaveMEK(s.paths, hdr, pdk, mek); err != nil {
-		return fmt.Errorf("persist header: %w", err)
+	hdr.Version = vault.HeaderVersion
+	hdr.User = user
+	hdr, _, err = store.AddKeySlot(s.paths, hdr, slot, mek)
+	if err != nil {
+		return "", fmt.Errorf("persist header: %w", err)
 	}
 
-	s.setMEK(nil)
-	return nil
-}
+	var code string
+	if withRecovery {
+		var entropy []byte
+		code, entropy, err = krypto.NewRecoveryCode()
+		if err != nil {
+			return "", err
+		}
+		defer wipe(entropy)
 
-// buildKDF pulls Argon2 + salt from the header and decodes the base64 salt.
-func buildKDF(hdr vault.VaultHeader) (krypto.Argon2Params, []byte, error) {
-	params := krypto.Argon2Params{
-		MemoryMB:    hdr.KDF.MemoryMB,
-		Time:        hdr.KDF.Time,
-		Parallelism: hdr.KDF.Parallelism,
-		SaltLen:     hdr.KDF.SaltLen,
-		KeyLen:      hdr.KDF.KeyLen,
-	}
-	salt, err := base64.StdEncoding.DecodeString(hdr.Salt)
-	if err != nil {
-		return krypto.Argon2Params{}, nil, fmt.Errorf("decode salt: %w", err)
+		recovery, err := store.WrapRecoverySlot(entropy, mek)
+		if err != nil {
+			return "", fmt.Errorf("wrap recovery slot: %w", err)
+		}
+		if _, err := store.SetRecoverySlot(s.paths, hdr, recovery, mek); err != nil {
+			return "", fmt.Errorf("persist recovery slot: %w", err)
+		}
 	}
-	return params, salt, nil
+
+	return code, s.setMEK(nil)
 }
 
 func (s *Service) requireBiometricForUnlock() error {
@@ -206,80 +264,406 @@ func (s *Service) requireBiometricForUnlock() error {
 	return nil
 }
 
-// Unlock derives the PDK via Argon2id and unwraps the MEK from header.json.
-func (s *Service) Unlock(master string) error {
+// Unlock tries the secret against each key slot in header.json and keeps the unwrapped MEK.
+// keyfilePath is only needed for slots set up with a keyfile; pass "" otherwise.
+func (s *Service) Unlock(master, keyfilePath string) error {
 	if err := s.requireBiometricForUnlock(); err != nil {
 		return err
 	}
 
-	hdr, err := store.LoadVaultHeader(s.paths)
+	masterBytes := []byte(master)
+	defer wipe(masterBytes)
+
+	keyfile, err := readKeyfile(keyfilePath)
 	if err != nil {
-		return fmt.Errorf("load header: %w", err)
+		return err
+	}
+	defer wipe(keyfile)
+
+	mek, hdr, slotID, err := store.UnlockMEK(s.paths, masterBytes, keyfile)
+	if err != nil {
+		return fmt.Errorf("unwrap MEK: %w", err)
+	}
+	defer wipe(mek)
+
+	mek, hdr, err = store.ResolveRotation(s.paths, hdr, masterBytes, keyfile, mek, s.dbUsesMEK)
+	if err != nil {
+		return fmt.Errorf("resolve key rotation: %w", err)
+	}
+	defer wipe(mek)
+
+	// Best effort: a failed upgrade leaves the old slot in place and the vault usable.
+	if upgraded, err := store.UpgradeSlotKDF(s.paths, hdr, slotID, masterBytes, keyfile, mek); err == nil {
+		hdr = upgraded
+	}
+	s.suite = hdr.EntrySuite()
+
+	if err := s.setMEK(mek); err != nil {
+		return fmt.Errorf("derive metadata keys: %w", err)
+	}
+	if err := dbpkg.MigrateMetadata(s.db, s.meta); err != nil {
+		_ = s.setMEK(nil)
+		return fmt.Errorf("encrypt legacy metadata: %w", err)
+	}
+	return nil
+}
+
+// Import parses an export from another password manager and adds its credentials, or
+// only reports what would happen when dryRun is set. Items that cannot be imported come
+// back as skipped results after the ones that were processed.
+func (s *Service) Import(format importer.Format, data []byte, dryRun bool) ([]importer.Result, error) {
+	if s.mek == nil {
+		return nil, errors.New("vault locked")
+	}
+	records, skipped, err := importer.Parse(format, data)
+	if err != nil {
+		return nil, err
+	}
+	return s.applyImport(records, skipped, dryRun)
+}
+
+// ImportArchive is Import for an archive written by pm export, decrypted with the
+// export passphrase. A wrong passphrase fails with exporter.ErrBadPassphrase.
+func (s *Service) ImportArchive(data, passphrase []byte, dryRun bool) ([]importer.Result, error) {
+	if s.mek == nil {
+		return nil, errors.New("vault locked")
+	}
+	records, skipped, err := importer.ParseArchive(data, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return s.applyImport(records, skipped, dryRun)
+}
+
+func (s *Service) applyImport(records []importer.Record, skipped []importer.Result, dryRun bool) ([]importer.Result, error) {
+	results, err := importer.Apply(s.db, s.meta, s.mek, s.entrySuite(), records, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	return append(results, skipped...), nil
+}
+
+// Audit checks every stored password for reuse, weak scores, age and, when opts.HIBP is
+// set, breach-list hits in the dataset hibp.json selects. Zero MinScore and MaxAge take
+// the password policy's. Plaintexts exist only in memory
+// for the duration of the call.
+func (s *Service) Audit(ctx context.Context, opts audit.Options) (audit.Report, error) {
+	if s.mek == nil {
+		return audit.Report{}, errors.New("vault locked")
+	}
+	if opts.MinScore == 0 && opts.MaxAge == 0 {
+		pol, err := store.LoadPolicy(s.paths)
+		if err != nil {
+			return audit.Report{}, err
+		}
+		policyOpts := audit.FromPolicy(pol)
+		opts.MinScore, opts.MaxAge = policyOpts.MinScore, policyOpts.MaxAge
+	}
+	if opts.HIBP && opts.Lookup == nil {
+		cfg, err := store.LoadHIBPConfig(s.paths)
+		if err != nil {
+			return audit.Report{}, err
+		}
+		checker := cfg.BreachChecker()
+		if checker == nil {
+			return audit.Report{}, errors.New("breach checking is turned off in hibp.json")
+		}
+		opts.Lookup = checker.Check
+	}
+	return audit.Run(ctx, s.db, s.meta, s.mek, opts)
+}
+
+// SiteRule returns the generator rule for website: what site-rules.json holds for it,
+// raised to the password policy (see store.GeneratorRule). It needs no unlock.
+func (s *Service) SiteRule(website string) (krypto.SiteRule, bool, error) {
+	return store.GeneratorRule(s.paths, website)
+}
+
+// AgentUnlocked reports whether a running pm agent holds the key for this vault.
+func (s *Service) AgentUnlocked() bool {
+	st, err := agent.NewClient("").Status()
+	if err != nil || !st.Unlocked {
+		return false
 	}
+	dir, err := filepath.Abs(s.paths.Dir)
+	return err == nil && filepath.Clean(dir) == st.Dir
+}
 
-	params, salt, err := buildKDF(hdr)
+// UnlockWithAgent takes the MEK from a running pm agent instead of a master password.
+// The key must verify against the header MAC and the database, so a key cached before a
+// rotation is refused.
+func (s *Service) UnlockWithAgent() error {
+	mek, err := agent.NewClient("").Key(s.paths.Dir)
 	if err != nil {
 		return err
 	}
+	defer wipe(mek)
+
+	hdr, err := store.LoadHeaderForMEK(s.paths, mek)
+	if err != nil {
+		return fmt.Errorf("verify agent key: %w", err)
+	}
+	ok, err := s.dbUsesMEK(mek)
+	if err != nil {
+		return fmt.Errorf("verify agent key: %w", err)
+	}
+	if !ok {
+		return errors.New("pm agent holds an outdated key for this vault; unlock with the master password")
+	}
+	s.suite = hdr.EntrySuite()
+
+	if err := s.setMEK(mek); err != nil {
+		return fmt.Errorf("derive metadata keys: %w", err)
+	}
+	if err := dbpkg.MigrateMetadata(s.db, s.meta); err != nil {
+		_ = s.setMEK(nil)
+		return fmt.Errorf("encrypt legacy metadata: %w", err)
+	}
+	return nil
+}
+
+// entrySuite returns the AEAD for newly written entries.
+func (s *Service) entrySuite() krypto.Suite {
+	if s.suite.Valid() {
+		return s.suite
+	}
+	return krypto.DefaultSuite
+}
+
+func (s *Service) dbUsesMEK(mek []byte) (bool, error) {
+	return dbpkg.MEKCheck(s.db, mek)
+}
+
+// RotationRemovesSlotsError is returned by RotateMEK when rotating would remove other
+// key slots and the caller did not agree to it. Nothing was changed.
+type RotationRemovesSlotsError struct {
+	Slots []vault.KeySlot
+}
+
+func (e *RotationRemovesSlotsError) Error() string {
+	labels := make([]string, len(e.Slots))
+	for i, slot := range e.Slots {
+		labels[i] = fmt.Sprintf("%d (%s)", slot.ID, slot.Label)
+	}
+	return "rotating the key removes key slot(s) " + strings.Join(labels, ", ")
+}
+
+// RotateResult reports what RotateMEK changed besides the key.
+type RotateResult struct {
+	RemovedSlots []vault.KeySlot // other slots, which wrapped the old MEK
+	RecoveryCode string          // replaces the old recovery code; empty when the vault had none
+}
+
+// RotateMEK replaces the MEK itself: every entry is re-encrypted under a fresh key and
+// the slot opened by master is rewrapped around it. Other key slots wrap the old MEK and
+// are removed, so RotateMEK returns *RotationRemovesSlotsError without changing anything
+// unless removeSlots is set. A vault with a recovery code gets a new one, returned in
+// RotateResult. The service is left unlocked with the new MEK.
+//
+// Crash safety: the new MEK is first stored as a pending slot next to the old ones, the
+// rows are re-encrypted in one SQLite transaction, and only then is the header swapped.
+// An interruption at any point is resolved by the next Unlock (see store.ResolveRotation),
+// which drops the recovery code because its replacement was never shown.
+func (s *Service) RotateMEK(master, keyfilePath string, removeSlots bool) (RotateResult, error) {
+	if master == "" {
+		return RotateResult{}, errors.New("master password is required")
+	}
 
 	masterBytes := []byte(master)
 	defer wipe(masterBytes)
 
-	pdk, err := krypto.DeriveKeyArgon2id(masterBytes, salt, params)
+	keyfile, err := readKeyfile(keyfilePath)
+	if err != nil {
+		return RotateResult{}, err
+	}
+	defer wipe(keyfile)
+
+	oldMEK, hdr, slotID, err := store.UnlockMEK(s.paths, masterBytes, keyfile)
+	if err != nil {
+		return RotateResult{}, fmt.Errorf("verify master password: %w", err)
+	}
+	defer wipe(oldMEK)
+
+	oldMEK, hdr, err = store.ResolveRotation(s.paths, hdr, masterBytes, keyfile, oldMEK, s.dbUsesMEK)
+	if err != nil {
+		return RotateResult{}, fmt.Errorf("resolve key rotation: %w", err)
+	}
+	defer wipe(oldMEK)
+
+	result := RotateResult{RemovedSlots: store.SlotsDroppedByRotation(hdr, slotID)}
+	if len(result.RemovedSlots) > 0 && !removeSlots {
+		return RotateResult{}, &RotationRemovesSlotsError{Slots: result.RemovedSlots}
+	}
+
+	oldKeys, err := vault.DeriveMetaKeys(oldMEK)
+	if err != nil {
+		return RotateResult{}, fmt.Errorf("derive metadata keys: %w", err)
+	}
+	err = dbpkg.MigrateMetadata(s.db, oldKeys)
+	oldKeys.Wipe()
+	if err != nil {
+		return RotateResult{}, fmt.Errorf("encrypt legacy metadata: %w", err)
+	}
+
+	newMEK := make([]byte, 32)
+	if _, err := rand.Read(newMEK); err != nil {
+		return RotateResult{}, fmt.Errorf("generate mek: %w", err)
+	}
+	defer wipe(newMEK)
+
+	slot, _ := hdr.Slot(slotID)
+	params := slot.KDF.Argon2Params().Stronger(hdr.Argon2Floor())
+	kdf := vault.NewArgon2KDFConfig(params)
+	kdf.Keyfile = slot.KDF.Keyfile
+	salt, err := krypto.NewRandomSalt(params.SaltLen)
 	if err != nil {
-		return fmt.Errorf("derive PDK: %w", err)
+		return RotateResult{}, fmt.Errorf("generate salt: %w", err)
+	}
+	pdk, err := store.DerivePassphraseKey(kdf, masterBytes, salt, keyfile)
+	if err != nil {
+		return RotateResult{}, fmt.Errorf("derive PDK: %w", err)
 	}
 	defer wipe(pdk)
 
-	mek, _, err := store.LoadAndUnwrapMEK(s.paths, pdk)
+	pending, err := store.WrapKeySlot(slot.Label, kdf, salt, pdk, newMEK)
 	if err != nil {
-		return fmt.Errorf("unwrap MEK: %w", err)
+		return RotateResult{}, fmt.Errorf("wrap new mek: %w", err)
 	}
-	defer wipe(mek)
 
-	s.setMEK(mek)
-	return nil
+	var recovery *vault.KeySlot
+	if hdr.Recovery != nil {
+		code, entropy, err := krypto.NewRecoveryCode()
+		if err != nil {
+			return RotateResult{}, err
+		}
+		recoverySlot, err := store.WrapRecoverySlot(entropy, newMEK)
+		wipe(entropy)
+		if err != nil {
+			return RotateResult{}, fmt.Errorf("wrap recovery slot: %w", err)
+		}
+		recovery = &recoverySlot
+		result.RecoveryCode = code
+	}
+
+	hdr, err = store.BeginRotation(s.paths, hdr, slotID, pending, oldMEK)
+	if err != nil {
+		return RotateResult{}, fmt.Errorf("stage rotation: %w", err)
+	}
+
+	if err := dbpkg.RotateEntries(s.db, oldMEK, newMEK); err != nil {
+		if _, abortErr := store.AbortRotation(s.paths, hdr, oldMEK); abortErr != nil {
+			return RotateResult{}, fmt.Errorf("re-encrypt entries: %w (discard pending slot: %v)", err, abortErr)
+		}
+		return RotateResult{}, fmt.Errorf("re-encrypt entries: %w", err)
+	}
+
+	if _, err := store.CommitRotation(s.paths, hdr, newMEK, recovery); err != nil {
+		// Entries are already under the new MEK; the next Unlock promotes the pending slot.
+		return RotateResult{}, fmt.Errorf("swap header (finish by unlocking again): %w", err)
+	}
+
+	s.suite = hdr.EntrySuite()
+	if err := s.setMEK(newMEK); err != nil {
+		return RotateResult{}, err
+	}
+	return result, nil
 }
 
-// ChangeMaster rewraps the header MEK and validates the new password using auth policy.
-func (s *Service) ChangeMaster(oldMaster, newMaster string) error {
-	if oldMaster == "" || newMaster == "" {
-		return errors.New("old and new master passwords are required")
+// MigrateCipher re-encrypts every entry with suite "to" and makes it the default for new
+// entries. Entries are converted in one transaction before the header is updated, so an
+// interruption leaves a mix of suites that still decrypts; running it again finishes the job.
+// It returns the number of entries that were converted.
+func (s *Service) MigrateCipher(master, keyfilePath string, to krypto.Suite) (int, error) {
+	if master == "" {
+		return 0, errors.New("master password is required")
+	}
+	if !to.Valid() {
+		return 0, krypto.ErrUnknownSuite
 	}
 
-	ctx := context.Background()
-	opts := auth.DefaultValidateOptions()
-	opts.EnableHIBP = true
-	opts.MinZXCVBNScore = 3
-	if err := auth.ValidateMasterPasswordAdvanced(ctx, newMaster, opts); err != nil {
-		return fmt.Errorf("validate new master password: %w", err)
+	masterBytes := []byte(master)
+	defer wipe(masterBytes)
+
+	keyfile, err := readKeyfile(keyfilePath)
+	if err != nil {
+		return 0, err
 	}
+	defer wipe(keyfile)
 
-	hdr, err := store.LoadVaultHeader(s.paths)
+	mek, hdr, _, err := store.UnlockMEK(s.paths, masterBytes, keyfile)
 	if err != nil {
-		return fmt.Errorf("load header: %w", err)
+		return 0, fmt.Errorf("verify master password: %w", err)
 	}
+	defer wipe(mek)
 
-	params, oldSalt, err := buildKDF(hdr)
+	mek, hdr, err = store.ResolveRotation(s.paths, hdr, masterBytes, keyfile, mek, s.dbUsesMEK)
 	if err != nil {
-		return err
+		return 0, fmt.Errorf("resolve key rotation: %w", err)
+	}
+	defer wipe(mek)
+
+	keys, err := vault.DeriveMetaKeys(mek)
+	if err != nil {
+		return 0, fmt.Errorf("derive metadata keys: %w", err)
+	}
+	err = dbpkg.MigrateMetadata(s.db, keys)
+	keys.Wipe()
+	if err != nil {
+		return 0, fmt.Errorf("encrypt legacy metadata: %w", err)
+	}
+
+	n, err := dbpkg.MigrateCipher(s.db, mek, to)
+	if err != nil {
+		return 0, fmt.Errorf("re-encrypt entries: %w", err)
+	}
+
+	if hdr.EntrySuite() != to {
+		if hdr, err = store.SetCipherSuite(s.paths, hdr, to, mek); err != nil {
+			return n, fmt.Errorf("update header: %w", err)
+		}
+	}
+
+	s.suite = hdr.EntrySuite()
+	return n, s.setMEK(mek)
+}
+
+// ChangeMaster rewraps the key slot opened by oldMaster and validates the new password using auth policy.
+// oldKeyfilePath must be given if the slot currently requires a keyfile; the rewrapped slot
+// requires newKeyfilePath, or no keyfile when it is "".
+func (s *Service) ChangeMaster(oldMaster, newMaster, oldKeyfilePath, newKeyfilePath string) error {
+	if oldMaster == "" || newMaster == "" {
+		return errors.New("old and new master passwords are required")
+	}
+
+	if err := s.validateMaster("", newMaster); err != nil {
+		return fmt.Errorf("validate new master password: %w", err)
 	}
 
 	oldBytes := []byte(oldMaster)
 	defer wipe(oldBytes)
 
-	oldPDK, err := krypto.DeriveKeyArgon2id(oldBytes, oldSalt, params)
+	oldKeyfile, err := readKeyfile(oldKeyfilePath)
+	if err != nil {
+		return err
+	}
+	defer wipe(oldKeyfile)
+	newKeyfile, err := readKeyfile(newKeyfilePath)
 	if err != nil {
-		return fmt.Errorf("derive old PDK: %w", err)
+		return err
 	}
-	defer wipe(oldPDK)
+	defer wipe(newKeyfile)
 
-	mek, hdrCurrent, err := store.LoadAndUnwrapMEK(s.paths, oldPDK)
+	mek, hdr, slotID, err := store.UnlockMEK(s.paths, oldBytes, oldKeyfile)
 	if err != nil {
 		return fmt.Errorf("verify old master password: %w", err)
 	}
 	defer wipe(mek)
 
+	slot, _ := hdr.Slot(slotID)
+	params := slot.KDF.Argon2Params().Stronger(hdr.Argon2Floor())
+	kdf := vault.NewArgon2KDFConfig(params)
+	kdf.Keyfile = newKeyfile != nil
+
 	newSalt, err := krypto.NewRandomSalt(params.SaltLen)
 	if err != nil {
 		return fmt.Errorf("generate new salt: %w", err)
@@ -288,145 +672,351 @@ func (s *Service) ChangeMaster(oldMaster, newMaster string) error {
 	newBytes := []byte(newMaster)
 	defer wipe(newBytes)
 
-	newPDK, err := krypto.DeriveKeyArgon2id(newBytes, newSalt, params)
+	newPDK, err := store.DerivePassphraseKey(kdf, newBytes, newSalt, newKeyfile)
 	if err != nil {
 		return fmt.Errorf("derive new PDK: %w", err)
 	}
 	defer wipe(newPDK)
 
-	hdrCurrent.Salt = base64.StdEncoding.EncodeToString(newSalt)
-	hdrCurrent.KDF.Name = "argon2id"
+	if _, err := store.RewrapKeySlot(s.paths, hdr, slotID, kdf, newSalt, newPDK, mek); err != nil {
+		return fmt.Errorf("rewrap mek: %w", err)
+	}
+
+	s.suite = hdr.EntrySuite()
+	return s.setMEK(mek)
+}
+
+// ResetMasterWithRecovery unwraps the MEK with a recovery code and protects it under
+// newMaster, leaving the service unlocked. The recovery code stays valid.
+// The reset master slot does not require a keyfile.
+func (s *Service) ResetMasterWithRecovery(code, newMaster string) error {
+	if strings.TrimSpace(code) == "" || newMaster == "" {
+		return errors.New("recovery code and new master password are required")
+	}
+
+	if err := s.validateMaster("", newMaster); err != nil {
+		return fmt.Errorf("validate new master password: %w", err)
+	}
+
+	mek, hdr, err := store.UnlockRecovery(s.paths, code)
+	if err != nil {
+		return fmt.Errorf("verify recovery code: %w", err)
+	}
+	defer wipe(mek)
+
+	params := hdr.Argon2Floor()
+	params.SaltLen = krypto.SaltLengthBytes
+
+	salt, err := krypto.NewRandomSalt(params.SaltLen)
+	if err != nil {
+		return fmt.Errorf("generate salt: %w", err)
+	}
+
+	newBytes := []byte(newMaster)
+	defer wipe(newBytes)
+
+	pdk, err := krypto.DeriveKeyArgon2id(newBytes, salt, params)
+	if err != nil {
+		return fmt.Errorf("derive new PDK: %w", err)
+	}
+	defer wipe(pdk)
 
-	if err := store.RewrapMEK(s.paths, hdrCurrent, newPDK, mek); err != nil {
+	if _, err := store.ReplaceMasterSlot(s.paths, hdr, vault.NewArgon2KDFConfig(params), salt, pdk, mek); err != nil {
 		return fmt.Errorf("rewrap mek: %w", err)
 	}
 
-	s.setMEK(mek)
-	return nil
+	s.suite = hdr.EntrySuite()
+	return s.setMEK(mek)
+}
+
+// Entry is a decrypted credential: its metadata plus the structured payload.
+type Entry struct {
+	ID        int64
+	Website   string
+	Username  string
+	Type      string
+	Payload   vault.EntryPayload
+	CreatedAt string
+	UpdatedAt string
+}
+
+// Add stores (website, username, password) encrypted with the current MEK. It returns
+// the password policy warnings, as AddEntry does.
+func (s *Service) Add(website, username, plaintext string) ([]auth.Violation, error) {
+	if plaintext == "" {
+		return nil, errors.New("password cannot be empty")
+	}
+	return s.AddEntry(website, username, "password", vault.EntryPayload{Password: plaintext})
 }
 
-// Add stores (website, username, password) encrypted with the current MEK.
-func (s *Service) Add(website, username, plaintext string) error {
+// AddEntry stores a credential with a full payload (password, notes, URLs, tags, folder
+// and custom fields). An empty typ defaults to "password". The password is held to the
+// policy's entries mode: under block a failing password returns *auth.PolicyError and is
+// not stored; otherwise the warnings are returned for the caller to show.
+func (s *Service) AddEntry(website, username, typ string, payload vault.EntryPayload) ([]auth.Violation, error) {
 	if s.mek == nil {
-		return errors.New("vault locked")
+		return nil, errors.New("vault locked")
 	}
 	if website == "" || username == "" {
-		return errors.New("website and username required")
+		return nil, errors.New("website and username required")
 	}
-	if plaintext == "" {
-		return errors.New("password cannot be empty")
+	if typ == "" {
+		typ = "password"
 	}
 
-	salt, blob, err := vault.EncryptEntryPassword(s.mek, website, username, "password", plaintext)
+	warnings, err := s.checkEntryPolicy(website, username, typ, payload.Password)
 	if err != nil {
-		return fmt.Errorf("encrypt: %w", err)
+		return warnings, err
 	}
 
-	_, err = s.sql.Exec(
-		`INSERT INTO passwords (encrypted_pass, salt, website, username, type)
-		 VALUES (?, ?, ?, ?, 'password')`,
-		blob, salt, website, username,
-	)
+	plain, format, err := vault.EncodePayload(payload)
 	if err != nil {
-		return fmt.Errorf("insert entry: %w", err)
+		return nil, err
 	}
-	return nil
+
+	salt, blob, err := vault.EncryptEntryPassword(s.mek, s.entrySuite(), website, username, typ, plain)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt: %w", err)
+	}
+
+	if _, err := dbpkg.InsertEntry(s.db, s.meta, website, username, typ, s.entrySuite(), format, salt, blob); err != nil {
+		return nil, fmt.Errorf("insert entry: %w", err)
+	}
+	return warnings, nil
+}
+
+// checkEntryPolicy holds a new entry password to the password policy. TOTP keys and
+// empty passwords are not checked.
+func (s *Service) checkEntryPolicy(website, username, typ, pw string) ([]auth.Violation, error) {
+	if typ == vault.TypeTOTP || pw == "" {
+		return nil, nil
+	}
+	return store.CheckEntryPassword(context.Background(), s.paths, website, username, pw)
 }
 
 // Get returns the decrypted password for (website, username).
 func (s *Service) Get(website, username string) (string, error) {
-	if s.mek == nil {
-		return "", errors.New("vault locked")
+	entry, err := s.GetEntry(website, username)
+	if err != nil {
+		return "", err
 	}
+	return entry.Payload.Password, nil
+}
 
-	var (
-		id   int64
-		typ  string
-		enc  []byte
-		salt []byte
-	)
+// GetEntry returns the decrypted credential and payload for (website, username).
+// Entries written before payloads existed come back with only Payload.Password set.
+func (s *Service) GetEntry(website, username string) (Entry, error) {
+	if s.mek == nil {
+		return Entry{}, errors.New("vault locked")
+	}
 
-	err := s.sql.QueryRow(
-		`SELECT id, encrypted_pass, salt, "type"
-           FROM passwords
-          WHERE website = ? AND username = ?`,
-		website, username,
-	).Scan(&id, &enc, &salt, &typ)
+	row, err := dbpkg.GetEntryBySiteAndUser(s.db, s.meta, website, username)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return "", fmt.Errorf("not found")
+			return Entry{}, fmt.Errorf("not found")
 		}
-		return "", fmt.Errorf("select: %w", err)
+		return Entry{}, fmt.Errorf("select: %w", err)
+	}
+
+	plain, newSalt, newBlob, err := vault.DecryptEntryPassword(s.mek, row.Suite, row.Website, row.Username, row.Type, row.Salt, row.EncryptedPass)
+	if err != nil {
+		return Entry{}, fmt.Errorf("decrypt: %w", err)
 	}
 
-	plain, newSalt, newBlob, err := vault.DecryptEntryPassword(s.mek, website, username, typ, salt, enc)
+	payload, err := vault.DecodePayload(row.Format, plain)
 	if err != nil {
-		return "", fmt.Errorf("decrypt: %w", err)
+		return Entry{}, err
+	}
+	entry := Entry{
+		ID:        row.ID,
+		Website:   row.Website,
+		Username:  row.Username,
+		Type:      row.Type,
+		Payload:   payload,
+		CreatedAt: row.CreatedAt,
+		UpdatedAt: row.UpdatedAt,
 	}
 
 	// Rotate-at-read if crypto lib returned updated salt/ciphertext.
-	if !bytes.Equal(newSalt, salt) || !bytes.Equal(newBlob, enc) {
-		if _, uerr := s.sql.Exec(
-			`UPDATE passwords
-                SET encrypted_pass = ?, salt = ?, updated_at = CURRENT_TIMESTAMP
-              WHERE id = ?`,
-			newBlob, newSalt, id,
-		); uerr != nil {
-			return plain, fmt.Errorf("rotation persisted partially: %w", uerr)
+	if !bytes.Equal(newSalt, row.Salt) || !bytes.Equal(newBlob, row.EncryptedPass) {
+		if uerr := dbpkg.UpdateEntryCipher(s.db, row.ID, row.Type, row.Suite, row.Format, newSalt, newBlob); uerr != nil {
+			return entry, fmt.Errorf("rotation persisted partially: %w", uerr)
 		}
 	}
 
-	return plain, nil
+	return entry, nil
 }
 
 // Update changes the password and (optionally) the type for a site/user.
-// If newType == "", the existing row.Type is kept.
-func (s *Service) Update(website, username, newType, newPlaintext string) error {
+// If newType == "", the existing row.Type is kept. Notes, URLs, tags, the folder
+// and custom fields are left as they are.
+func (s *Service) Update(website, username, newType, newPlaintext string) ([]auth.Violation, error) {
+	if newPlaintext == "" {
+		return nil, errors.New("new password cannot be empty")
+	}
+	entry, err := s.GetEntry(website, username)
+	if err != nil {
+		return nil, err
+	}
+	entry.Payload.Password = newPlaintext
+	return s.UpdateEntry(website, username, newType, entry.Payload)
+}
+
+// UpdateEntry replaces the whole payload and (optionally) the type for a site/user.
+// If newType == "", the existing row.Type is kept. A changed password is held to the
+// password policy as in AddEntry.
+func (s *Service) UpdateEntry(website, username, newType string, payload vault.EntryPayload) ([]auth.Violation, error) {
 	if s.mek == nil {
-		return errors.New("vault locked")
+		return nil, errors.New("vault locked")
 	}
 	if website == "" || username == "" {
-		return errors.New("website and username required")
-	}
-	if newPlaintext == "" {
-		return errors.New("new password cannot be empty")
+		return nil, errors.New("website and username required")
 	}
 
-	var id int64
-	var curType string
-	err := s.sql.QueryRow(
-		`SELECT id, "type" FROM passwords WHERE website = ? AND username = ?`,
-		website, username,
-	).Scan(&id, &curType)
+	row, err := dbpkg.GetEntryBySiteAndUser(s.db, s.meta, website, username)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return fmt.Errorf("not found")
+			return nil, fmt.Errorf("not found")
 		}
-		return fmt.Errorf("select: %w", err)
+		return nil, fmt.Errorf("select: %w", err)
 	}
 
-	typ := curType
+	typ := row.Type
 	if newType != "" {
 		typ = newType
 	}
 
-	salt, blob, err := vault.EncryptEntryPassword(s.mek, website, username, typ, newPlaintext)
+	var warnings []auth.Violation
+	if !s.passwordUnchanged(row, payload.Password) {
+		if warnings, err = s.checkEntryPolicy(website, username, typ, payload.Password); err != nil {
+			return warnings, err
+		}
+	}
+
+	plain, format, err := vault.EncodePayload(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	salt, blob, err := vault.EncryptEntryPassword(s.mek, s.entrySuite(), website, username, typ, plain)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt: %w", err)
+	}
+
+	if err := dbpkg.ReplaceEntry(s.db, row.ID, typ, s.entrySuite(), format, salt, blob); err != nil {
+		return nil, fmt.Errorf("update: %w", err)
+	}
+	return warnings, nil
+}
+
+// passwordUnchanged reports whether row already stores pw as its password.
+func (s *Service) passwordUnchanged(row *dbpkg.EntryRow, pw string) bool {
+	plain, _, _, err := vault.DecryptEntryPassword(s.mek, row.Suite, row.Website, row.Username, row.Type, row.Salt, row.EncryptedPass)
+	if err != nil {
+		return false
+	}
+	old, err := vault.DecodePayload(row.Format, plain)
+	return err == nil && old.Password == pw
+}
+
+// HistoryItem is a previous version of an entry. Version 1 is the version replaced by
+// the most recent update, 2 the one before it, and so on.
+type HistoryItem struct {
+	Version    int
+	Type       string
+	Payload    vault.EntryPayload
+	UpdatedAt  string // when the version was written
+	ArchivedAt string // when it was replaced
+}
+
+// History returns the previous versions of (website, username), newest first.
+// Versions that fail to decrypt are reported as an error rather than skipped.
+func (s *Service) History(website, username string) ([]HistoryItem, error) {
+	if s.mek == nil {
+		return nil, errors.New("vault locked")
+	}
+	row, history, err := s.loadHistory(website, username)
 	if err != nil {
-		return fmt.Errorf("encrypt: %w", err)
+		return nil, err
 	}
 
-	_, err = s.sql.Exec(
-		`UPDATE passwords
-		    SET encrypted_pass = ?, salt = ?, "type" = ?, updated_at = CURRENT_TIMESTAMP
-		  WHERE id = ?`,
-		blob, salt, typ, id,
-	)
+	out := make([]HistoryItem, 0, len(history))
+	for i, h := range history {
+		// History blobs keep the entry's AAD, so they only open under the parent's metadata.
+		plain, _, _, err := vault.DecryptEntryPassword(s.mek, h.Suite, row.Website, row.Username, h.Type, h.Salt, h.EncryptedPass)
+		if err != nil {
+			return nil, fmt.Errorf("decrypt version %d: %w", i+1, err)
+		}
+		payload, err := vault.DecodePayload(h.Format, plain)
+		if err != nil {
+			return nil, fmt.Errorf("decode version %d: %w", i+1, err)
+		}
+		out = append(out, HistoryItem{
+			Version:    i + 1,
+			Type:       h.Type,
+			Payload:    payload,
+			UpdatedAt:  h.UpdatedAt,
+			ArchivedAt: h.ArchivedAt,
+		})
+	}
+	return out, nil
+}
+
+// RestoreVersion makes a previous version (numbered as in History) current again.
+// The version it replaces moves into history, so the restore can be undone.
+func (s *Service) RestoreVersion(website, username string, version int) error {
+	if s.mek == nil {
+		return errors.New("vault locked")
+	}
+	row, history, err := s.loadHistory(website, username)
 	if err != nil {
-		return fmt.Errorf("update: %w", err)
+		return err
+	}
+	if version < 1 || version > len(history) {
+		return fmt.Errorf("no version %d (entry has %d)", version, len(history))
+	}
+	h := history[version-1]
+
+	// Refuse to restore a version that no longer opens for this entry.
+	if _, _, _, err := vault.DecryptEntryPassword(s.mek, h.Suite, row.Website, row.Username, h.Type, h.Salt, h.EncryptedPass); err != nil {
+		return fmt.Errorf("decrypt version %d: %w", version, err)
+	}
+
+	if err := dbpkg.RestoreHistory(s.db, row.ID, h.ID); err != nil {
+		return fmt.Errorf("restore: %w", err)
 	}
 	return nil
 }
 
+func (s *Service) loadHistory(website, username string) (*dbpkg.EntryRow, []dbpkg.HistoryRow, error) {
+	row, err := dbpkg.GetEntryBySiteAndUser(s.db, s.meta, website, username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, fmt.Errorf("not found")
+		}
+		return nil, nil, fmt.Errorf("select: %w", err)
+	}
+	history, err := dbpkg.ListHistory(s.db, row.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("history: %w", err)
+	}
+	return row, history, nil
+}
+
+// HistoryRetention returns how many previous versions are kept per entry.
+func (s *Service) HistoryRetention() (int, error) {
+	return dbpkg.HistoryRetention(s.db)
+}
+
+// SetHistoryRetention sets how many previous versions are kept per entry; 0 turns
+// history off. Versions beyond the new limit are deleted immediately.
+func (s *Service) SetHistoryRetention(keep int) error {
+	if s.mek == nil {
+		return errors.New("vault locked")
+	}
+	return dbpkg.SetHistoryRetention(s.db, keep)
+}
+
 // ListItem is a minimal row for GUI lists.
 type ListItem struct {
 	ID       int64
@@ -434,7 +1024,9 @@ type ListItem struct {
 	Username string
 }
 
-// Delete removes the credential row for (website, username).
+// Delete moves the credential for (website, username), and its TOTP key if it has one,
+// to the trash. It disappears from List and lookups but can be brought back with
+// RestoreFromTrash until it is purged.
 func (s *Service) Delete(website, username string) error {
 	if s.mek == nil {
 		return errors.New("vault locked")
@@ -443,43 +1035,145 @@ func (s *Service) Delete(website, username string) error {
 		return errors.New("website and username required")
 	}
 
-	res, err := s.sql.Exec(
-		`DELETE FROM passwords WHERE website = ? AND username = ?`,
-		website, username,
-	)
+	if err := dbpkg.DeleteEntryBySiteAndUser(s.db, s.meta, website, username); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("not found")
+		}
+		return fmt.Errorf("delete: %w", err)
+	}
+	return nil
+}
+
+// AddTOTP stores the TOTP key of (website, username). input is an otpauth:// URI or the
+// bare Base32 secret a site shows for manual entry; it is stored as a normalized URI.
+func (s *Service) AddTOTP(website, username, input string) error {
+	if s.mek == nil {
+		return errors.New("vault locked")
+	}
+	if website == "" || username == "" {
+		return errors.New("website and username required")
+	}
+	key, err := krypto.ParseOTPKey(input, website, username)
 	if err != nil {
+		return err
+	}
+	if _, err := dbpkg.GetTOTPBySiteAndUser(s.db, s.meta, website, username); err == nil {
+		return errors.New("account already has a TOTP key")
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("select: %w", err)
+	}
+	_, err = s.AddEntry(website, username, vault.TypeTOTP, vault.EntryPayload{Password: key.URI()})
+	return err
+}
+
+// TOTP returns the TOTP key of (website, username); callers derive codes with its Code
+// and Remaining methods.
+func (s *Service) TOTP(website, username string) (krypto.TOTP, error) {
+	if s.mek == nil {
+		return krypto.TOTP{}, errors.New("vault locked")
+	}
+
+	row, err := dbpkg.GetTOTPBySiteAndUser(s.db, s.meta, website, username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return krypto.TOTP{}, fmt.Errorf("not found")
+		}
+		return krypto.TOTP{}, fmt.Errorf("select: %w", err)
+	}
+	plain, _, _, err := vault.DecryptEntryPassword(s.mek, row.Suite, row.Website, row.Username, row.Type, row.Salt, row.EncryptedPass)
+	if err != nil {
+		return krypto.TOTP{}, fmt.Errorf("decrypt: %w", err)
+	}
+	payload, err := vault.DecodePayload(row.Format, plain)
+	if err != nil {
+		return krypto.TOTP{}, err
+	}
+	return krypto.ParseOTPAuthURI(payload.Password)
+}
+
+// DeleteTOTP moves the TOTP key of (website, username) to the trash; the password entry
+// stays.
+func (s *Service) DeleteTOTP(website, username string) error {
+	if s.mek == nil {
+		return errors.New("vault locked")
+	}
+	if err := dbpkg.DeleteTOTP(s.db, s.meta, website, username); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("not found")
+		}
 		return fmt.Errorf("delete: %w", err)
 	}
-	n, err := res.RowsAffected()
+	return nil
+}
+
+// TrashItem is a trashed entry as shown in trash lists.
+type TrashItem struct {
+	ID        int64
+	Website   string
+	Username  string
+	DeletedAt string
+}
+
+// Trash returns the entries in the trash, most recently deleted first.
+func (s *Service) Trash() ([]TrashItem, error) {
+	if s.mek == nil {
+		return nil, errors.New("vault locked")
+	}
+	rows, err := dbpkg.ListTrash(s.db, s.meta)
 	if err != nil {
-		return fmt.Errorf("rows affected: %w", err)
+		return nil, fmt.Errorf("query: %w", err)
 	}
-	if n == 0 {
-		return fmt.Errorf("not found")
+
+	out := make([]TrashItem, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, TrashItem{ID: r.ID, Website: r.Website, Username: r.Username, DeletedAt: r.DeletedAt})
+	}
+	return out, nil
+}
+
+// RestoreFromTrash moves a trashed entry back into the vault.
+func (s *Service) RestoreFromTrash(website, username string) error {
+	if s.mek == nil {
+		return errors.New("vault locked")
+	}
+	if err := dbpkg.RestoreTrashed(s.db, s.meta, website, username); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("not in trash")
+		}
+		return fmt.Errorf("restore: %w", err)
 	}
 	return nil
 }
 
-// List returns (id, website, username) for all entries.
+// PurgeTrash permanently removes entries that have been in the trash for at least
+// olderThan (0 empties the trash). Their ciphertext is overwritten before the rows are
+// deleted. It returns the number of entries removed.
+func (s *Service) PurgeTrash(olderThan time.Duration) (int, error) {
+	if s.mek == nil {
+		return 0, errors.New("vault locked")
+	}
+	return dbpkg.PurgeTrash(s.db, olderThan)
+}
+
+// List returns (id, website, username) for all entries. TOTP keys are left out; they
+// belong to the account's entry and are read with TOTP.
 func (s *Service) List() ([]ListItem, error) {
 	if s.mek == nil {
 		return nil, errors.New("vault locked")
 	}
-	rows, err := s.sql.Query(`SELECT id, website, username FROM passwords ORDER BY website, username`)
+	rows, err := dbpkg.ListEntries(s.db, s.meta)
 	if err != nil {
 		return nil, fmt.Errorf("query: %w", err)
 	}
-	defer rows.Close()
 
-	var out []ListItem
-	for rows.Next() {
-		var it ListItem
-		if err := rows.Scan(&it.ID, &it.Website, &it.Username); err != nil {
-			return nil, err
+	out := make([]ListItem, 0, len(rows))
+	for _, r := range rows {
+		if r.Type == vault.TypeTOTP {
+			continue
 		}
-		out = append(out, it)
+		out = append(out, ListItem{ID: r.ID, Website: r.Website, Username: r.Username})
 	}
-	return out, rows.Err()
+	return out, nil
 }
 
 // EnableBiometrics persists biometric toggle metadata after local auth.
@@ -510,5 +1204,9 @@ func (s *Service) BiometricStatus() (toggle.State, error) {
 }
 
 // MekSetUnsafe allows tests to inject an already-derived MEK reference.
-func (s *Service) MekSetUnsafe(m []byte) { s.mek = m }
-func (s *Service) IsUnlocked() bool      { return s.mek != nil }
+func (s *Service) MekSetUnsafe(m []byte) {
+	s.mek = m
+	s.meta.Wipe()
+	s.meta, _ = vault.DeriveMetaKeys(m)
+}
+func (s *Service) IsUnlocked() bool { return s.mek != nil }
@@ -9,7 +9,9 @@ import (
 )
 
 const (
-	entrySaltLen   = 16
+	// EntrySaltLen is the length of the per-entry HKDF salt stored next to each blob.
+	EntrySaltLen = 16
+
 	entryInfo      = "entry-key-v1"
 	entryAADPrefix = "entry-aad-v1"
 )
@@ -19,28 +21,32 @@ const (
 // Args:
 //
 //	mek: 32-byte master encryption key derived from the user's credentials.
-//	website: identifier for the credential's site; currently unused but reserved for AAD.
-//	username: identifier for the account; currently unused but reserved for AAD.
-//	typ: logical credential type (e.g. "password"); currently unused but reserved for AAD.
+//	suite: AEAD used to seal the password (stored alongside the entry).
+//	website: identifier for the credential's site; bound into the AAD.
+//	username: identifier for the account; bound into the AAD.
+//	typ: logical credential type (e.g. "password"); bound into the AAD unless it is
+//	     "password" (or empty), so a TOTP blob cannot stand in for the password blob of
+//	     the same account.
 //	plaintext: secret to encrypt and store in the vault.
 //
 // Returns:
 //
 //	salt: random salt used for HKDF key derivation.
-//	blob: AES-GCM nonce concatenated with ciphertext.
+//	blob: nonce concatenated with ciphertext; the nonce length depends on suite.
 //	err: non-nil when key derivation or encryption fails.
 //
 // Behavior:
 //  1. Validates the MEK length.
 //  2. Generates a per-entry salt and derives an AES-256 key with HKDF-SHA256.
-//  3. Encrypts the plaintext with AES-GCM and returns salt plus nonce|ciphertext.
-func EncryptEntryPassword(mek []byte, website, username, typ, plaintext string) (salt []byte, blob []byte, err error) {
+//  3. Encrypts the plaintext with the suite's AEAD and returns salt plus nonce|ciphertext.
+func EncryptEntryPassword(mek []byte, suite krypto.Suite, website, username, typ, plaintext string) (salt []byte, blob []byte, err error) {
 	if len(mek) != 32 {
 		return nil, nil, errors.New("invalid MEK length")
 	}
-	_ = typ
-
-	salt = make([]byte, entrySaltLen)
+	if !suite.Valid() {
+		return nil, nil, krypto.ErrUnknownSuite
+	}
+	salt = make([]byte, EntrySaltLen)
 	if _, err := rand.Read(salt); err != nil {
 		return nil, nil, fmt.Errorf("generate entry salt: %w", err)
 	}
@@ -51,14 +57,12 @@ func EncryptEntryPassword(mek []byte, website, username, typ, plaintext string)
 	}
 	defer zeroize(perKey)
 
-	aad := entryAAD(website, username)
+	aad := entryAAD(website, username, typ)
 
-	nonce, ciphertext, err := krypto.EncryptAESGCM(perKey, []byte(plaintext), aad)
+	blob, err = suite.Seal(perKey, []byte(plaintext), aad)
 	if err != nil {
 		return nil, nil, fmt.Errorf("encrypt entry password: %w", err)
 	}
-
-	blob = append(nonce, ciphertext...)
 	return salt, blob, nil
 }
 
@@ -67,6 +71,7 @@ func EncryptEntryPassword(mek []byte, website, username, typ, plaintext string)
 // Args:
 //
 //	mek: 32-byte master encryption key derived from the user's credentials.
+//	suite: AEAD the entry was sealed with; the re-encryption uses the same suite.
 //	website: identifier for the credential's site (passed through to EncryptEntryPassword).
 //	username: identifier for the account (passed through to EncryptEntryPassword).
 //	typ: logical credential type (passed through to EncryptEntryPassword).
@@ -83,16 +88,21 @@ func EncryptEntryPassword(mek []byte, website, username, typ, plaintext string)
 // Behavior:
 //  1. Validates MEK, salt, and blob lengths.
 //  2. Recomputes the per-entry AES key via HKDF-SHA256.
-//  3. Splits nonce/ciphertext and decrypts with AES-GCM.
+//  3. Splits nonce/ciphertext at the suite's nonce size and decrypts. Entries of a custom
+//     type sealed before the type was bound into the AAD still open with the old AAD;
+//     TOTP entries never do.
 //  4. Re-encrypts the plaintext via EncryptEntryPassword to rotate salt and nonce.
-func DecryptEntryPassword(mek []byte, website, username, typ string, salt, blob []byte) (plaintext string, newSalt []byte, newBlob []byte, err error) {
+func DecryptEntryPassword(mek []byte, suite krypto.Suite, website, username, typ string, salt, blob []byte) (plaintext string, newSalt []byte, newBlob []byte, err error) {
 	if len(mek) != 32 {
 		return "", nil, nil, errors.New("invalid MEK length")
 	}
-	if len(salt) != entrySaltLen {
+	if len(salt) != EntrySaltLen {
 		return "", nil, nil, errors.New("invalid entry salt length")
 	}
-	if len(blob) <= 12 {
+	if !suite.Valid() {
+		return "", nil, nil, krypto.ErrUnknownSuite
+	}
+	if len(blob) <= suite.NonceSize() {
 		return "", nil, nil, errors.New("encrypted blob too short")
 	}
 
@@ -102,19 +112,19 @@ func DecryptEntryPassword(mek []byte, website, username, typ string, salt, blob
 	}
 	defer zeroize(perKey)
 
-	nonce := blob[:12]
-	ciphertext := blob[12:]
-
-	aad := entryAAD(website, username)
-
-	ptBytes, err := krypto.DecryptAESGCM(perKey, nonce, ciphertext, aad)
+	ptBytes, err := suite.Open(perKey, blob, entryAAD(website, username, typ))
+	if err != nil && typ != TypeTOTP && !isPasswordType(typ) {
+		// Custom types were sealed without the type before it was bound; the
+		// re-encryption below upgrades the entry.
+		ptBytes, err = suite.Open(perKey, blob, entryAAD(website, username, TypePassword))
+	}
 	if err != nil {
 		return "", nil, nil, fmt.Errorf("decrypt entry password: %w", err)
 	}
 
 	pwd := string(ptBytes)
 
-	rotatedSalt, rotatedBlob, err := EncryptEntryPassword(mek, website, username, typ, pwd)
+	rotatedSalt, rotatedBlob, err := EncryptEntryPassword(mek, suite, website, username, typ, pwd)
 	if err != nil {
 		return "", nil, nil, fmt.Errorf("reencrypt entry password: %w", err)
 	}
@@ -129,6 +139,16 @@ func zeroize(buf []byte) {
 	}
 }
 
-func entryAAD(website, username string) []byte {
-	return []byte(entryAADPrefix + "\x00" + website + "\x00" + username)
+// entryAAD binds a blob to its account and, for types other than password, to its type.
+// Password entries keep the original layout so existing vaults still open.
+func entryAAD(website, username, typ string) []byte {
+	aad := entryAADPrefix + "\x00" + website + "\x00" + username
+	if !isPasswordType(typ) {
+		aad += "\x00" + typ
+	}
+	return []byte(aad)
+}
+
+func isPasswordType(typ string) bool {
+	return typ == "" || typ == TypePassword
 }
@@ -0,0 +1,56 @@
+package vault
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+)
+
+func TestEntryBlobBoundToType(t *testing.T) {
+	mek := bytes.Repeat([]byte{7}, 32)
+	for _, suite := range []krypto.Suite{krypto.SuiteAESGCM, krypto.SuiteXChaCha20Poly1305} {
+		salt, blob, err := EncryptEntryPassword(mek, suite, "example.com", "alice", TypeTOTP, "JBSWY3DPEHPK3PXP")
+		if err != nil {
+			t.Fatalf("%s: encrypt: %v", suite, err)
+		}
+		if _, _, _, err := DecryptEntryPassword(mek, suite, "example.com", "alice", TypePassword, salt, blob); err == nil {
+			t.Fatalf("%s: TOTP blob opened as the password entry", suite)
+		}
+		got, _, _, err := DecryptEntryPassword(mek, suite, "example.com", "alice", TypeTOTP, salt, blob)
+		if err != nil || got != "JBSWY3DPEHPK3PXP" {
+			t.Fatalf("%s: decrypt TOTP = %q, %v", suite, got, err)
+		}
+
+		salt, blob, err = EncryptEntryPassword(mek, suite, "example.com", "alice", TypePassword, "hunter2")
+		if err != nil {
+			t.Fatalf("%s: encrypt: %v", suite, err)
+		}
+		if _, _, _, err := DecryptEntryPassword(mek, suite, "example.com", "alice", TypeTOTP, salt, blob); err == nil {
+			t.Fatalf("%s: password blob opened as the TOTP entry", suite)
+		}
+	}
+}
+
+func TestLegacyCustomTypeStillOpens(t *testing.T) {
+	mek := bytes.Repeat([]byte{9}, 32)
+	suite := krypto.DefaultSuite
+
+	// Entries of a custom type used to be sealed like password entries.
+	salt, blob, err := EncryptEntryPassword(mek, suite, "example.com", "alice", TypePassword, "pin-1234")
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	got, newSalt, newBlob, err := DecryptEntryPassword(mek, suite, "example.com", "alice", "pin", salt, blob)
+	if err != nil || got != "pin-1234" {
+		t.Fatalf("decrypt legacy entry = %q, %v", got, err)
+	}
+
+	// The re-encrypted blob carries the type.
+	if _, _, _, err := DecryptEntryPassword(mek, suite, "example.com", "alice", TypePassword, newSalt, newBlob); err == nil {
+		t.Fatal("upgraded blob still opens as a password entry")
+	}
+	if _, _, _, err := DecryptEntryPassword(mek, suite, "example.com", "alice", "pin", newSalt, newBlob); err != nil {
+		t.Fatalf("decrypt upgraded entry: %v", err)
+	}
+}
@@ -1,6 +1,24 @@
 package vault
 
-import "time"
+import (
+	"time"
+
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+)
+
+const (
+	// HeaderVersion is the current header layout (multi key slot, MAC over all fields).
+	HeaderVersion = 3
+	// KeySlotHeaderVersion is the multi key slot layout written before the header MAC.
+	KeySlotHeaderVersion = 2
+	// LegacyHeaderVersion is the single-slot layout that stored Salt/WrapNonce/WrappedMEK inline.
+	LegacyHeaderVersion = 1
+
+	// KDFArgon2id names the password-stretching KDF used by passphrase slots.
+	KDFArgon2id = "argon2id"
+	// KDFRecovery names the HKDF expansion used by the recovery-code slot.
+	KDFRecovery = "hkdf-sha256"
+)
 
 // KDFConfig describes the key-derivation parameters stored in the vault header.
 type KDFConfig struct {
@@ -10,17 +28,116 @@ type KDFConfig struct {
 	Parallelism uint8  `json:"parallelism"`
 	SaltLen     int    `json:"saltLen"`
 	KeyLen      uint32 `json:"keyLen"`
+	// Keyfile marks Argon2id slots whose PDK also mixes in a keyfile digest
+	// (krypto.MixKeyfile); unlocking them needs the password and the keyfile.
+	Keyfile bool `json:"keyfile,omitempty"`
 }
 
-// VaultHeader captures metadata persisted alongside the vault contents.
-type VaultHeader struct {
-	Version    int       `json:"version"`
-	User       string    `json:"user"`
+// NewArgon2KDFConfig records Argon2id parameters in header form.
+func NewArgon2KDFConfig(p krypto.Argon2Params) KDFConfig {
+	return KDFConfig{
+		Name:        KDFArgon2id,
+		MemoryMB:    p.MemoryMB,
+		Time:        p.Time,
+		Parallelism: p.Parallelism,
+		SaltLen:     krypto.SaltLengthBytes,
+		KeyLen:      p.KeyLen,
+	}
+}
+
+// NewRecoveryKDFConfig describes the recovery slot, whose secret is already high-entropy.
+func NewRecoveryKDFConfig() KDFConfig {
+	return KDFConfig{
+		Name:    KDFRecovery,
+		SaltLen: krypto.SaltLengthBytes,
+		KeyLen:  32,
+	}
+}
+
+// Argon2Params converts the stored configuration back into krypto parameters.
+func (c KDFConfig) Argon2Params() krypto.Argon2Params {
+	return krypto.Argon2Params{
+		MemoryMB:    c.MemoryMB,
+		Time:        c.Time,
+		Parallelism: c.Parallelism,
+		SaltLen:     c.SaltLen,
+		KeyLen:      c.KeyLen,
+	}
+}
+
+// KeySlot holds one wrapped copy of the MEK that a single unlock secret can open.
+// Every slot has its own salt and KDF parameters, so secrets can be added or revoked
+// without touching the encrypted entries.
+type KeySlot struct {
+	ID         int       `json:"id"`
+	Label      string    `json:"label,omitempty"`
 	CreatedAt  time.Time `json:"createdAt"`
-	UpdatedAt  time.Time `json:"updatedAt"`
 	Salt       string    `json:"salt"`
 	WrapNonce  string    `json:"wrapNonce"`
 	WrappedMEK string    `json:"wrappedMEK"`
 	KDF        KDFConfig `json:"kdf"`
-	
+}
+
+// VaultHeader captures metadata persisted alongside the vault contents.
+type VaultHeader struct {
+	Version   int       `json:"version"`
+	User      string    `json:"user"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	KeySlots  []KeySlot `json:"keySlots,omitempty"`
+	// Recovery wraps the MEK under the printable recovery code; it is never tried by
+	// a normal unlock and is not counted among KeySlots.
+	Recovery *KeySlot `json:"recovery,omitempty"`
+	// Pending holds the replacement MEK, wrapped under the rotating secret, while a key
+	// rotation is in flight. It is promoted or discarded on the next unlock.
+	Pending *KeySlot `json:"pending,omitempty"`
+	// CipherSuite is the AEAD used for newly written entries; zero means krypto.DefaultSuite.
+	// Existing rows keep the suite recorded next to them until migrated.
+	CipherSuite krypto.Suite `json:"cipherSuite,omitempty"`
+	// KDFFloor is the minimum Argon2id cost for passphrase slots, recorded by pm master
+	// tune. Weaker slots are rewrapped when they next unlock; see Argon2Floor.
+	KDFFloor KDFConfig `json:"kdfFloor,omitzero"`
+	// MAC authenticates every other field with a key derived from the MEK (see store.ComputeHeaderMAC).
+	MAC string `json:"mac,omitempty"`
+
+	// Legacy single-slot fields (version 1). store.LoadVaultHeader folds them into KeySlots.
+	Salt       string    `json:"salt,omitempty"`
+	WrapNonce  string    `json:"wrapNonce,omitempty"`
+	WrappedMEK string    `json:"wrappedMEK,omitempty"`
+	KDF        KDFConfig `json:"kdf,omitzero"`
+}
+
+// EntrySuite returns the cipher suite new entries should be encrypted with.
+func (h *VaultHeader) EntrySuite() krypto.Suite {
+	if h.CipherSuite.Valid() {
+		return h.CipherSuite
+	}
+	return krypto.DefaultSuite
+}
+
+// Argon2Floor returns the minimum Argon2id parameters for passphrase slots: the
+// built-in defaults, raised to KDFFloor when one is recorded.
+func (h *VaultHeader) Argon2Floor() krypto.Argon2Params {
+	return krypto.DefaultArgon2Params().Stronger(h.KDFFloor.Argon2Params())
+}
+
+// Slot returns the key slot with the given ID.
+func (h *VaultHeader) Slot(id int) (*KeySlot, bool) {
+	for i := range h.KeySlots {
+		if h.KeySlots[i].ID == id {
+			return &h.KeySlots[i], true
+		}
+	}
+	return nil, false
+}
+
+// NextSlotID returns the lowest unused slot ID.
+func (h *VaultHeader) NextSlotID() int {
+	id := 0
+	for {
+		if _, taken := h.Slot(id); !taken {
+			return id
+		}
+		id++
+	}
 }
@@ -0,0 +1,177 @@
+package vault
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+)
+
+const (
+	metaEncInfo   = "meta-key-v1"
+	metaIndexInfo = "meta-index-v1"
+	metaAADPrefix = "entry-meta-v1"
+
+	// MetaFieldWebsite labels the encrypted website column.
+	MetaFieldWebsite = "website"
+	// MetaFieldUsername labels the encrypted username column.
+	MetaFieldUsername = "username"
+
+	// TypePassword is the default entry type.
+	TypePassword = "password"
+
+	// TypeTOTP is the entry type of a stored otpauth:// URI. A TOTP entry shares its
+	// website and username with the account's password entry; see TOTPIndex.
+	TypeTOTP = "totp"
+)
+
+// MetaKeys holds the MEK-derived subkeys that protect entry metadata.
+// The encryption key seals website/username values at rest while the index key
+// produces deterministic blind indexes so rows can be located without decrypting the table.
+type MetaKeys struct {
+	enc   []byte
+	index []byte
+}
+
+// DeriveMetaKeys derives the metadata encryption and blind-index keys from the MEK.
+//
+// Args:
+//
+//	mek: 32-byte master encryption key.
+//
+// Returns:
+//
+//	*MetaKeys: subkeys for sealing metadata and computing blind indexes.
+//	error: non-nil when the MEK is malformed or HKDF fails.
+//
+// Behavior:
+//  1. Validates the MEK length.
+//  2. Expands two independent 32-byte keys with HKDF-SHA256 under distinct info labels.
+func DeriveMetaKeys(mek []byte) (*MetaKeys, error) {
+	if len(mek) != 32 {
+		return nil, errors.New("invalid MEK length")
+	}
+
+	enc, err := krypto.HKDFSHA256(mek, nil, []byte(metaEncInfo), 32)
+	if err != nil {
+		return nil, fmt.Errorf("derive metadata key: %w", err)
+	}
+	index, err := krypto.HKDFSHA256(mek, nil, []byte(metaIndexInfo), 32)
+	if err != nil {
+		zeroize(enc)
+		return nil, fmt.Errorf("derive index key: %w", err)
+	}
+
+	return &MetaKeys{enc: enc, index: index}, nil
+}
+
+// Wipe zeroizes the derived subkeys.
+func (k *MetaKeys) Wipe() {
+	if k == nil {
+		return
+	}
+	zeroize(k.enc)
+	zeroize(k.index)
+	k.enc = nil
+	k.index = nil
+}
+
+// SiteIndex returns the blind index for a website, computed over its normalized eTLD+1.
+// All spellings of the same registrable domain (www.example.com, https://example.com/login)
+// map to the same index.
+func (k *MetaKeys) SiteIndex(website string) string {
+	return k.blindIndex("site", NormalizeSite(website))
+}
+
+// EntryIndex returns the blind index identifying a single (website, username) pair.
+// It is computed over the exact values so it mirrors the UNIQUE(website, username) semantics.
+func (k *MetaKeys) EntryIndex(website, username string) string {
+	return k.blindIndex("entry", website+"\x00"+username)
+}
+
+// TOTPIndex returns the blind index of the TOTP entry for a (website, username) pair.
+// It is keyed under its own label so the account's password entry and its TOTP entry do
+// not collide under UNIQUE(entry_index).
+func (k *MetaKeys) TOTPIndex(website, username string) string {
+	return k.blindIndex("totp", website+"\x00"+username)
+}
+
+// IndexFor returns the entry index a row of type typ is stored under.
+func (k *MetaKeys) IndexFor(website, username, typ string) string {
+	if typ == TypeTOTP {
+		return k.TOTPIndex(website, username)
+	}
+	return k.EntryIndex(website, username)
+}
+
+func (k *MetaKeys) blindIndex(label, value string) string {
+	mac := hmac.New(sha256.New, k.index)
+	mac.Write([]byte(label))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SealMeta encrypts a metadata value for storage, returning nonce|ciphertext.
+// The field name is bound as AAD so website and username blobs cannot be swapped.
+func (k *MetaKeys) SealMeta(field, value string) ([]byte, error) {
+	if k == nil || len(k.enc) != 32 {
+		return nil, errors.New("metadata keys not initialised")
+	}
+	nonce, ciphertext, err := krypto.EncryptAESGCM(k.enc, []byte(value), metaAAD(field))
+	if err != nil {
+		return nil, fmt.Errorf("encrypt %s: %w", field, err)
+	}
+	return append(nonce, ciphertext...), nil
+}
+
+// OpenMeta decrypts a metadata blob produced by SealMeta.
+func (k *MetaKeys) OpenMeta(field string, blob []byte) (string, error) {
+	if k == nil || len(k.enc) != 32 {
+		return "", errors.New("metadata keys not initialised")
+	}
+	if len(blob) <= 12 {
+		return "", fmt.Errorf("encrypted %s too short", field)
+	}
+	plaintext, err := krypto.DecryptAESGCM(k.enc, blob[:12], blob[12:], metaAAD(field))
+	if err != nil {
+		return "", fmt.Errorf("decrypt %s: %w", field, err)
+	}
+	return string(plaintext), nil
+}
+
+// NormalizeSite reduces a website identifier (bare host, host:port, or URL) to its
+// lowercase eTLD+1. Hosts that publicsuffix cannot classify (IPs, localhost) are
+// returned lowercased without port or trailing dot.
+func NormalizeSite(website string) string {
+	host := strings.ToLower(strings.TrimSpace(website))
+	if strings.Contains(host, "://") {
+		if u, err := url.Parse(host); err == nil && u.Host != "" {
+			host = u.Host
+		}
+	}
+	if i := strings.IndexAny(host, "/?#"); i >= 0 {
+		host = host[:i]
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(host, ".")
+
+	if etld1, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		return etld1
+	}
+	return host
+}
+
+func metaAAD(field string) []byte {
+	return []byte(metaAADPrefix + "\x00" + field)
+}
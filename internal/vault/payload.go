@@ -0,0 +1,237 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Payload formats stored in passwords.payload_format. They describe the plaintext inside
+// encrypted_pass, so rotation and cipher migration carry the format over unchanged.
+const (
+	// PayloadFormatRaw is the original layout: the plaintext is the bare secret.
+	PayloadFormatRaw = 0
+	// PayloadFormatJSON is an EntryPayload encoded as JSON.
+	PayloadFormatJSON = 1
+)
+
+// FieldType describes how a custom field is shown and edited.
+type FieldType string
+
+const (
+	// FieldText is shown as-is.
+	FieldText FieldType = "text"
+	// FieldHidden is masked until revealed, like the password.
+	FieldHidden FieldType = "hidden"
+	// FieldBoolean holds "true" or "false".
+	FieldBoolean FieldType = "boolean"
+)
+
+// ParseFieldType maps a user-supplied name onto a FieldType.
+func ParseFieldType(name string) (FieldType, error) {
+	switch t := FieldType(strings.ToLower(strings.TrimSpace(name))); t {
+	case FieldText, FieldHidden, FieldBoolean:
+		return t, nil
+	case "bool":
+		return FieldBoolean, nil
+	default:
+		return "", fmt.Errorf("unknown field type %q (use text, hidden or boolean)", name)
+	}
+}
+
+// MatchMode decides which pages an entry is offered on. Modes other than base-domain
+// and never compare the page against the entry's URLs, or against its website when it
+// has none.
+type MatchMode string
+
+const (
+	// MatchDefault is base-domain, or host when the browser extension asks for exact hosts.
+	MatchDefault MatchMode = ""
+	// MatchBaseDomain accepts any page under the website's eTLD+1.
+	MatchBaseDomain MatchMode = "base-domain"
+	// MatchHost accepts pages whose hostname equals a URL's hostname.
+	MatchHost MatchMode = "host"
+	// MatchHostPort also needs the port to match, counting the scheme's default port.
+	MatchHostPort MatchMode = "host-port"
+	// MatchPrefix accepts pages whose URL starts with one of the URLs.
+	MatchPrefix MatchMode = "prefix"
+	// MatchExact accepts pages whose URL equals one of the URLs.
+	MatchExact MatchMode = "exact"
+	// MatchRegex treats the URLs as regular expressions searched for in the page URL.
+	MatchRegex MatchMode = "regex"
+	// MatchNever keeps the entry out of autofill.
+	MatchNever MatchMode = "never"
+)
+
+// ParseMatchMode maps a user-supplied name onto a MatchMode; "default" and "" clear it.
+func ParseMatchMode(name string) (MatchMode, error) {
+	switch m := MatchMode(strings.ToLower(strings.TrimSpace(name))); m {
+	case MatchDefault, "default":
+		return MatchDefault, nil
+	case MatchBaseDomain, MatchHost, MatchHostPort, MatchPrefix, MatchExact, MatchRegex, MatchNever:
+		return m, nil
+	case "domain":
+		return MatchBaseDomain, nil
+	case "starts-with", "startswith":
+		return MatchPrefix, nil
+	default:
+		return "", fmt.Errorf("unknown match mode %q (use base-domain, host, host-port, prefix, exact, regex, never or default)", name)
+	}
+}
+
+// CustomField is a user-defined name/value pair such as a recovery code or a security question.
+type CustomField struct {
+	Name  string    `json:"name"`
+	Type  FieldType `json:"type"`
+	Value string    `json:"value"`
+}
+
+// EntryPayload is the structured secret sealed inside an entry. Website, username and
+// type stay in their own columns so lookups keep working without decrypting payloads.
+type EntryPayload struct {
+	Password string        `json:"password"`
+	Notes    string        `json:"notes,omitempty"`
+	URLs     []string      `json:"urls,omitempty"`
+	Tags     []string      `json:"tags,omitempty"`
+	Folder   string        `json:"folder,omitempty"`
+	Fields   []CustomField `json:"fields,omitempty"`
+	Match    MatchMode     `json:"match,omitempty"`
+}
+
+// Field returns the custom field called name.
+func (p EntryPayload) Field(name string) (CustomField, bool) {
+	for _, f := range p.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return CustomField{}, false
+}
+
+// SetField adds the field or replaces the value and type of an existing one with the same name.
+func (p *EntryPayload) SetField(f CustomField) {
+	for i := range p.Fields {
+		if p.Fields[i].Name == f.Name {
+			p.Fields[i] = f
+			return
+		}
+	}
+	p.Fields = append(p.Fields, f)
+}
+
+// RemoveField deletes the field called name and reports whether it existed.
+func (p *EntryPayload) RemoveField(name string) bool {
+	for i := range p.Fields {
+		if p.Fields[i].Name == name {
+			p.Fields = append(p.Fields[:i], p.Fields[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize trims URLs, tags and the folder, drops empty and duplicate URLs and tags,
+// and fills in the text type for fields that have none.
+func (p *EntryPayload) Normalize() {
+	p.URLs = cleanList(p.URLs)
+	p.Tags = cleanList(p.Tags)
+	p.Folder = strings.Trim(strings.TrimSpace(p.Folder), "/")
+	for i := range p.Fields {
+		p.Fields[i].Name = strings.TrimSpace(p.Fields[i].Name)
+		if p.Fields[i].Type == "" {
+			p.Fields[i].Type = FieldText
+		}
+	}
+}
+
+// Validate checks that the entry holds something, that custom fields are well formed
+// and that the match mode has the URLs it needs.
+func (p EntryPayload) Validate() error {
+	if p.Password == "" && p.Notes == "" && len(p.Fields) == 0 {
+		return errors.New("entry needs a password, notes or at least one custom field")
+	}
+	switch p.Match {
+	case MatchDefault, MatchBaseDomain, MatchHost, MatchHostPort, MatchNever:
+	case MatchPrefix, MatchExact:
+		if len(p.URLs) == 0 {
+			return fmt.Errorf("match mode %s needs at least one URL", p.Match)
+		}
+	case MatchRegex:
+		if len(p.URLs) == 0 {
+			return fmt.Errorf("match mode %s needs at least one URL pattern", p.Match)
+		}
+		for _, u := range p.URLs {
+			if _, err := regexp.Compile(u); err != nil {
+				return fmt.Errorf("URL pattern %q: %w", u, err)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown match mode %q", p.Match)
+	}
+	seen := make(map[string]bool, len(p.Fields))
+	for _, f := range p.Fields {
+		if f.Name == "" {
+			return errors.New("custom field name cannot be empty")
+		}
+		if seen[f.Name] {
+			return fmt.Errorf("duplicate custom field %q", f.Name)
+		}
+		seen[f.Name] = true
+		switch f.Type {
+		case FieldText, FieldHidden:
+		case FieldBoolean:
+			if f.Value != "true" && f.Value != "false" {
+				return fmt.Errorf("boolean field %q must be true or false", f.Name)
+			}
+		default:
+			return fmt.Errorf("custom field %q has unknown type %q", f.Name, f.Type)
+		}
+	}
+	return nil
+}
+
+// EncodePayload normalizes and validates p and returns the plaintext to encrypt along
+// with its payload format.
+func EncodePayload(p EntryPayload) (string, int, error) {
+	p.Normalize()
+	if err := p.Validate(); err != nil {
+		return "", 0, err
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return "", 0, fmt.Errorf("encode entry payload: %w", err)
+	}
+	return string(b), PayloadFormatJSON, nil
+}
+
+// DecodePayload parses a decrypted entry. Raw entries become a payload holding only the password.
+func DecodePayload(format int, plaintext string) (EntryPayload, error) {
+	switch format {
+	case PayloadFormatRaw:
+		return EntryPayload{Password: plaintext}, nil
+	case PayloadFormatJSON:
+		var p EntryPayload
+		if err := json.Unmarshal([]byte(plaintext), &p); err != nil {
+			return EntryPayload{}, fmt.Errorf("decode entry payload: %w", err)
+		}
+		return p, nil
+	default:
+		return EntryPayload{}, fmt.Errorf("unknown entry payload format %d", format)
+	}
+}
+
+func cleanList(in []string) []string {
+	var out []string
+	seen := make(map[string]bool, len(in))
+	for _, s := range in {
+		s = strings.TrimSpace(s)
+		if s == "" || seen[s] {
+			continue
+		}
+		seen[s] = true
+		out = append(out, s)
+	}
+	return out
+}
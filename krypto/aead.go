@@ -7,6 +7,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
 )
 
 const gcmNonceSize = 12
@@ -61,3 +63,38 @@ func DecryptAESGCM(key, nonce, ciphertext, aad []byte) ([]byte, error) {
 	}
 	return plaintext, nil
 }
+
+// EncryptXChaCha20Poly1305 encrypts plaintext using XChaCha20-Poly1305 with a random
+// 24-byte nonce, returning the nonce and ciphertext.
+func EncryptXChaCha20Poly1305(key, plaintext, aad []byte) (nonce, ciphertext []byte, err error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create xchacha20-poly1305: %w", err)
+	}
+
+	nonce = make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, nil, fmt.Errorf("generate nonce: %w", err)
+	}
+
+	ciphertext = aead.Seal(nil, nonce, plaintext, aad)
+	return nonce, ciphertext, nil
+}
+
+// DecryptXChaCha20Poly1305 decrypts the ciphertext using XChaCha20-Poly1305.
+func DecryptXChaCha20Poly1305(key, nonce, ciphertext, aad []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, fmt.Errorf("create xchacha20-poly1305: %w", err)
+	}
+
+	if len(nonce) != chacha20poly1305.NonceSizeX {
+		return nil, errors.New("invalid nonce size")
+	}
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt: %w", err)
+	}
+	return plaintext, nil
+}
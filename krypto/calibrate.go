@@ -0,0 +1,88 @@
+package krypto
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	calibrationStartMemoryMB = 64
+	calibrationMaxTime       = 16
+)
+
+// Below reports whether p is weaker than floor in memory or iterations.
+func (p Argon2Params) Below(floor Argon2Params) bool {
+	return p.MemoryMB < floor.MemoryMB || p.Time < floor.Time
+}
+
+// Stronger returns the element-wise maximum of p and other, keeping p's salt and key lengths.
+func (p Argon2Params) Stronger(other Argon2Params) Argon2Params {
+	out := p
+	out.MemoryMB = max(p.MemoryMB, other.MemoryMB)
+	out.Time = max(p.Time, other.Time)
+	out.Parallelism = max(p.Parallelism, other.Parallelism)
+	return out
+}
+
+// MeasureArgon2 times one Argon2id derivation with p on this machine.
+func MeasureArgon2(p Argon2Params) (time.Duration, error) {
+	salt, err := NewRandomSalt(SaltLengthBytes)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	key, err := DeriveKeyArgon2id([]byte("calibration"), salt, p)
+	elapsed := time.Since(start)
+	for i := range key {
+		key[i] = 0
+	}
+	return elapsed, err
+}
+
+// CalibrateArgon2 benchmarks this machine and picks Argon2id parameters whose derivation
+// takes roughly target. Memory is raised first (doubling from 64 MB up to maxMemoryMB)
+// while the default iteration count still fits, since memory hardness is what slows GPU
+// attacks, and iterations are then added to use the remaining budget. The result is never
+// weaker than DefaultArgon2Params.
+//
+// Returns the chosen parameters and the measured time for them.
+func CalibrateArgon2(target time.Duration, maxMemoryMB uint32) (Argon2Params, time.Duration, error) {
+	if target <= 0 {
+		return Argon2Params{}, 0, errors.New("calibration target must be positive")
+	}
+	defaults := DefaultArgon2Params()
+	if maxMemoryMB < defaults.MemoryMB {
+		maxMemoryMB = defaults.MemoryMB
+	}
+
+	p := defaults
+	p.MemoryMB = calibrationStartMemoryMB
+	p.Time = 1
+
+	elapsed, err := MeasureArgon2(p)
+	if err != nil {
+		return Argon2Params{}, 0, err
+	}
+
+	// Grow memory while the minimum iteration count at double the memory still fits.
+	minPasses := time.Duration(defaults.Time)
+	for elapsed*2*minPasses <= target && p.MemoryMB*2 <= maxMemoryMB {
+		p.MemoryMB *= 2
+		if elapsed, err = MeasureArgon2(p); err != nil {
+			return Argon2Params{}, 0, err
+		}
+	}
+
+	// Spend the rest on iterations; cost grows roughly linearly with Time.
+	if elapsed > 0 {
+		if passes := uint32(target / elapsed); passes > 1 {
+			p.Time = min(passes, calibrationMaxTime)
+		}
+	}
+
+	p = p.Stronger(defaults)
+	if elapsed, err = MeasureArgon2(p); err != nil {
+		return Argon2Params{}, 0, err
+	}
+	return p, elapsed, nil
+}
@@ -0,0 +1,319 @@
+package krypto
+
+import (
+	"crypto/rand"
+	_ "embed"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"math/bits"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// CharClass is a set of password character classes, combined with |.
+type CharClass uint8
+
+const (
+	ClassLower CharClass = 1 << iota
+	ClassUpper
+	ClassDigit
+	ClassSymbol
+
+	AllClasses = ClassLower | ClassUpper | ClassDigit | ClassSymbol
+)
+
+const (
+	lowerChars = "abcdefghijklmnopqrstuvwxyz"
+	upperChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	digitChars = "0123456789"
+
+	// DefaultSymbols leaves out quotes, backslash and space, which forms and shells
+	// commonly mangle.
+	DefaultSymbols = "!#$%&()*+,-./:;<=>?@[]^_{|}~"
+	// AmbiguousChars are the characters that are easily misread in print.
+	AmbiguousChars = "0O1lI|"
+
+	MinPasswordLength  = 4
+	MaxPasswordLength  = 256
+	MinPassphraseWords = 4
+	MaxPassphraseWords = 20
+
+	// generateAttempts bounds the rejection sampling in GeneratePassword; even a
+	// 4-character password with four required classes succeeds within a few dozen draws.
+	generateAttempts = 10000
+)
+
+// ErrGeneratorOptions indicates options that cannot produce any password.
+var ErrGeneratorOptions = errors.New("invalid generator options")
+
+// PasswordOptions configures GeneratePassword.
+type PasswordOptions struct {
+	Length           int
+	Classes          CharClass // classes characters are drawn from
+	Required         CharClass // classes that must appear at least once; a subset of Classes
+	Symbols          string    // symbol alphabet; empty means DefaultSymbols
+	ExcludeAmbiguous bool      // leave out AmbiguousChars
+	Exclude          string    // further characters never used
+}
+
+// DefaultPasswordOptions returns 20 characters drawn from, and requiring, every class.
+func DefaultPasswordOptions() PasswordOptions {
+	return PasswordOptions{Length: 20, Classes: AllClasses, Required: AllClasses}
+}
+
+// PassphraseOptions configures GeneratePassphrase.
+type PassphraseOptions struct {
+	Words      int
+	Separator  string
+	Capitalize bool // upper-case the first letter of every word; adds no entropy
+}
+
+// DefaultPassphraseOptions returns six words joined by hyphens (about 77 bits).
+func DefaultPassphraseOptions() PassphraseOptions {
+	return PassphraseOptions{Words: 6, Separator: "-"}
+}
+
+// Generated is a generated secret and the entropy of the process that produced it,
+// assuming an attacker knows the options used.
+type Generated struct {
+	Secret      string
+	EntropyBits float64
+}
+
+// GeneratePassword returns a random password drawn uniformly from every string of
+// opts.Length characters that satisfies opts.
+//
+// Args:
+//
+//	opts: length, classes and exclusions; see PasswordOptions.
+//
+// Returns:
+//
+//	Generated: the password and its exact entropy in bits.
+//	error: ErrGeneratorOptions (wrapped) when opts leave nothing to draw from.
+//
+// Behavior:
+//  1. Builds one alphabet per enabled class, minus excluded and ambiguous characters.
+//  2. Draws every character with crypto/rand and redraws the whole password until each
+//     required class appears, which keeps the result uniform over the valid passwords.
+//  3. Counts the valid passwords by inclusion-exclusion over the required classes to
+//     report entropy, so requirements are not over-credited.
+func GeneratePassword(opts PasswordOptions) (Generated, error) {
+	pools, err := opts.pools()
+	if err != nil {
+		return Generated{}, err
+	}
+	if opts.Length < MinPasswordLength || opts.Length > MaxPasswordLength {
+		return Generated{}, fmt.Errorf("%w: length must be between %d and %d", ErrGeneratorOptions, MinPasswordLength, MaxPasswordLength)
+	}
+	if n := bits.OnesCount8(uint8(opts.Required)); n > opts.Length {
+		return Generated{}, fmt.Errorf("%w: %d required classes do not fit in %d characters", ErrGeneratorOptions, n, opts.Length)
+	}
+
+	var alphabet []rune
+	for _, p := range pools {
+		alphabet = append(alphabet, p.chars...)
+	}
+
+	out := make([]rune, opts.Length)
+	for attempt := 0; attempt < generateAttempts; attempt++ {
+		for i := range out {
+			n, err := randIndex(len(alphabet))
+			if err != nil {
+				return Generated{}, err
+			}
+			out[i] = alphabet[n]
+		}
+		if hasRequired(out, pools) {
+			return Generated{Secret: string(out), EntropyBits: passwordEntropy(opts.Length, pools)}, nil
+		}
+	}
+	return Generated{}, fmt.Errorf("%w: required classes are too rare to satisfy", ErrGeneratorOptions)
+}
+
+// GeneratePassphrase returns opts.Words words picked uniformly from the EFF large
+// wordlist (7776 words, 12.9 bits each), as a diceware roll would.
+func GeneratePassphrase(opts PassphraseOptions) (Generated, error) {
+	if opts.Words < MinPassphraseWords || opts.Words > MaxPassphraseWords {
+		return Generated{}, fmt.Errorf("%w: words must be between %d and %d", ErrGeneratorOptions, MinPassphraseWords, MaxPassphraseWords)
+	}
+	words, err := effWordlist()
+	if err != nil {
+		return Generated{}, err
+	}
+
+	picked := make([]string, opts.Words)
+	for i := range picked {
+		n, err := randIndex(len(words))
+		if err != nil {
+			return Generated{}, err
+		}
+		w := words[n]
+		if opts.Capitalize {
+			w = strings.ToUpper(w[:1]) + w[1:]
+		}
+		picked[i] = w
+	}
+	return Generated{
+		Secret:      strings.Join(picked, opts.Separator),
+		EntropyBits: float64(opts.Words) * math.Log2(float64(len(words))),
+	}, nil
+}
+
+// pool is the alphabet of one character class after exclusions.
+type pool struct {
+	chars    []rune
+	required bool
+}
+
+func (o PasswordOptions) pools() ([]pool, error) {
+	if o.Classes&AllClasses == 0 {
+		return nil, fmt.Errorf("%w: no character classes enabled", ErrGeneratorOptions)
+	}
+	if o.Required&^o.Classes != 0 {
+		return nil, fmt.Errorf("%w: a required class is not enabled", ErrGeneratorOptions)
+	}
+	exclude := o.Exclude
+	if o.ExcludeAmbiguous {
+		exclude += AmbiguousChars
+	}
+	symbols := o.Symbols
+	if symbols == "" {
+		symbols = DefaultSymbols
+	}
+
+	var out []pool
+	for _, c := range []struct {
+		class CharClass
+		chars string
+	}{
+		{ClassLower, lowerChars},
+		{ClassUpper, upperChars},
+		{ClassDigit, digitChars},
+		{ClassSymbol, symbols},
+	} {
+		if o.Classes&c.class == 0 {
+			continue
+		}
+		p := pool{required: o.Required&c.class != 0}
+		seen := make(map[rune]bool)
+		for _, r := range c.chars {
+			if seen[r] || strings.ContainsRune(exclude, r) || r > unicode.MaxASCII || !unicode.IsPrint(r) || r == ' ' {
+				continue
+			}
+			if c.class == ClassSymbol && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+				continue
+			}
+			seen[r] = true
+			p.chars = append(p.chars, r)
+		}
+		if len(p.chars) == 0 {
+			return nil, fmt.Errorf("%w: every character of an enabled class is excluded", ErrGeneratorOptions)
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+func hasRequired(pw []rune, pools []pool) bool {
+	for _, p := range pools {
+		if !p.required {
+			continue
+		}
+		found := false
+		for _, r := range pw {
+			if containsRune(p.chars, r) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func containsRune(set []rune, r rune) bool {
+	for _, s := range set {
+		if s == r {
+			return true
+		}
+	}
+	return false
+}
+
+// passwordEntropy returns log2 of the number of length-character strings over the
+// pools that contain every required pool at least once.
+func passwordEntropy(length int, pools []pool) float64 {
+	total := 0
+	var required []int
+	for _, p := range pools {
+		total += len(p.chars)
+		if p.required {
+			required = append(required, len(p.chars))
+		}
+	}
+
+	count := new(big.Int)
+	term := new(big.Int)
+	for subset := 0; subset < 1<<len(required); subset++ {
+		size := total
+		for i, n := range required {
+			if subset&(1<<i) != 0 {
+				size -= n
+			}
+		}
+		term.Exp(big.NewInt(int64(size)), big.NewInt(int64(length)), nil)
+		if bits.OnesCount(uint(subset))%2 == 1 {
+			count.Sub(count, term)
+		} else {
+			count.Add(count, term)
+		}
+	}
+	return log2Big(count)
+}
+
+func log2Big(n *big.Int) float64 {
+	if n.Sign() <= 0 {
+		return 0
+	}
+	mant := new(big.Float)
+	exp := new(big.Float).SetInt(n).MantExp(mant)
+	m, _ := mant.Float64()
+	return float64(exp) + math.Log2(m)
+}
+
+func randIndex(n int) (int, error) {
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, fmt.Errorf("read random: %w", err)
+	}
+	return int(v.Int64()), nil
+}
+
+// effLargeWordlist is https://www.eff.org/files/2016/07/18/eff_large_wordlist.txt:
+// five dice digits, a tab and a word per line.
+//
+//go:embed eff_large_wordlist.txt
+var effLargeWordlist string
+
+var effWordlist = sync.OnceValues(func() ([]string, error) {
+	lines := strings.Split(strings.TrimSpace(effLargeWordlist), "\n")
+	words := make([]string, 0, len(lines))
+	for _, line := range lines {
+		_, word, ok := strings.Cut(strings.TrimSpace(line), "\t")
+		if !ok || word == "" || !utf8.ValidString(word) {
+			return nil, errors.New("embedded wordlist is malformed")
+		}
+		words = append(words, word)
+	}
+	if len(words) != 7776 {
+		return nil, fmt.Errorf("embedded wordlist has %d words, want 7776", len(words))
+	}
+	return words, nil
+})
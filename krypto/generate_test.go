@@ -0,0 +1,145 @@
+package krypto
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestGeneratePasswordHonoursClasses(t *testing.T) {
+	opts := PasswordOptions{
+		Length:           6,
+		Classes:          ClassLower | ClassDigit | ClassSymbol,
+		Required:         ClassDigit | ClassSymbol,
+		Symbols:          "-_",
+		ExcludeAmbiguous: true,
+		Exclude:          "xyz",
+	}
+	allowed := "abcdefghijkmnopqrstuvw" + "23456789" + "-_"
+	for i := 0; i < 500; i++ {
+		g, err := GeneratePassword(opts)
+		if err != nil {
+			t.Fatalf("GeneratePassword: %v", err)
+		}
+		if len(g.Secret) != opts.Length {
+			t.Fatalf("%q: length %d, want %d", g.Secret, len(g.Secret), opts.Length)
+		}
+		for _, r := range g.Secret {
+			if !strings.ContainsRune(allowed, r) {
+				t.Fatalf("%q: unexpected character %q", g.Secret, r)
+			}
+		}
+		if !strings.ContainsAny(g.Secret, "23456789") || !strings.ContainsAny(g.Secret, "-_") {
+			t.Fatalf("%q: missing a required class", g.Secret)
+		}
+	}
+}
+
+func TestGeneratePasswordEntropy(t *testing.T) {
+	tests := []struct {
+		name string
+		opts PasswordOptions
+		want float64
+	}{
+		{
+			name: "no requirements",
+			opts: PasswordOptions{Length: 10, Classes: ClassLower},
+			want: 10 * math.Log2(26),
+		},
+		{
+			// 36^4 strings, minus those without a digit (26^4) or without a letter (10^4).
+			name: "two required classes",
+			opts: PasswordOptions{Length: 4, Classes: ClassLower | ClassDigit, Required: ClassLower | ClassDigit},
+			want: math.Log2(36*36*36*36 - 26*26*26*26 - 10*10*10*10),
+		},
+	}
+	for _, tt := range tests {
+		g, err := GeneratePassword(tt.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if math.Abs(g.EntropyBits-tt.want) > 1e-9 {
+			t.Errorf("%s: entropy %.4f bits, want %.4f", tt.name, g.EntropyBits, tt.want)
+		}
+	}
+
+	// Requiring every class costs the default options well under a bit.
+	g, err := GeneratePassword(DefaultPasswordOptions())
+	if err != nil {
+		t.Fatalf("default: %v", err)
+	}
+	unconstrained := 20 * math.Log2(float64(26+26+10+len(DefaultSymbols)))
+	if g.EntropyBits >= unconstrained || unconstrained-g.EntropyBits > 1 {
+		t.Errorf("default: entropy %.4f bits, want just under %.4f", g.EntropyBits, unconstrained)
+	}
+}
+
+func TestGeneratePasswordRejectsImpossibleOptions(t *testing.T) {
+	for name, opts := range map[string]PasswordOptions{
+		"no classes":      {Length: 12},
+		"too short":       {Length: MinPasswordLength - 1, Classes: ClassLower},
+		"too long":        {Length: MaxPasswordLength + 1, Classes: ClassLower},
+		"required not on": {Length: 12, Classes: ClassLower, Required: ClassDigit},
+		"class excluded":  {Length: 12, Classes: ClassDigit, Exclude: digitChars},
+	} {
+		if _, err := GeneratePassword(opts); !errors.Is(err, ErrGeneratorOptions) {
+			t.Errorf("%s: err = %v, want ErrGeneratorOptions", name, err)
+		}
+	}
+}
+
+func TestGeneratePassphrase(t *testing.T) {
+	words, err := effWordlist()
+	if err != nil {
+		t.Fatalf("wordlist: %v", err)
+	}
+	known := make(map[string]bool, len(words))
+	for _, w := range words {
+		known[w] = true
+	}
+
+	g, err := GeneratePassphrase(PassphraseOptions{Words: 7, Separator: " ", Capitalize: true})
+	if err != nil {
+		t.Fatalf("GeneratePassphrase: %v", err)
+	}
+	picked := strings.Split(g.Secret, " ")
+	if len(picked) != 7 {
+		t.Fatalf("%q: %d words, want 7", g.Secret, len(picked))
+	}
+	for _, w := range picked {
+		if w[:1] != strings.ToUpper(w[:1]) || !known[strings.ToLower(w[:1])+w[1:]] {
+			t.Fatalf("%q: %q is not a capitalized wordlist word", g.Secret, w)
+		}
+	}
+	if want := 7 * math.Log2(7776); math.Abs(g.EntropyBits-want) > 1e-9 {
+		t.Errorf("entropy %.4f bits, want %.4f", g.EntropyBits, want)
+	}
+
+	if _, err := GeneratePassphrase(PassphraseOptions{Words: MinPassphraseWords - 1}); !errors.Is(err, ErrGeneratorOptions) {
+		t.Errorf("too few words: err = %v, want ErrGeneratorOptions", err)
+	}
+}
+
+func TestSiteRuleApply(t *testing.T) {
+	rule, err := ParsePasswordRules("minlength: 8; maxlength: 12; required: lower; required: digit; allowed: [-_]")
+	if err != nil {
+		t.Fatalf("ParsePasswordRules: %v", err)
+	}
+	opts := DefaultPasswordOptions().Apply(rule)
+	if opts.Length != 12 {
+		t.Errorf("length %d, want 12", opts.Length)
+	}
+	for i := 0; i < 200; i++ {
+		g, err := GeneratePassword(opts)
+		if err != nil {
+			t.Fatalf("GeneratePassword: %v", err)
+		}
+		if strings.ContainsAny(g.Secret, upperChars) || strings.Trim(g.Secret, lowerChars+digitChars+"-_") != "" {
+			t.Fatalf("%q breaks the site rule", g.Secret)
+		}
+		if !strings.ContainsAny(g.Secret, lowerChars) || !strings.ContainsAny(g.Secret, digitChars) {
+			t.Fatalf("%q misses a class the site requires", g.Secret)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package krypto
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	keyfileInfo = "keyfile-pdk-v1"
+	// keyfileMaxBytes bounds how much of a keyfile is read; larger files are rejected
+	// so that pointing at a disk image or device does not hang the unlock.
+	keyfileMaxBytes = 64 << 20
+)
+
+// ErrInvalidKeyfile indicates a keyfile that is empty or too large to use.
+var ErrInvalidKeyfile = errors.New("invalid keyfile")
+
+// HashKeyfile reads the keyfile at path and returns the SHA-256 digest of its contents.
+// Any file works as a keyfile; only its exact bytes matter, not its name or location.
+func HashKeyfile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open keyfile: %w", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, io.LimitReader(f, keyfileMaxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("read keyfile: %w", err)
+	}
+	if n == 0 || n > keyfileMaxBytes {
+		return nil, ErrInvalidKeyfile
+	}
+	return h.Sum(nil), nil
+}
+
+// MixKeyfile binds a password-derived key to a keyfile digest. The result is
+// HKDF-SHA256(pdk, salt=digest), so both the password and the keyfile are needed to
+// reproduce it, and a stolen keyfile alone reveals nothing about the PDK.
+func MixKeyfile(pdk, digest []byte) ([]byte, error) {
+	if len(pdk) == 0 {
+		return nil, errors.New("pdk is required")
+	}
+	if len(digest) != sha256.Size {
+		return nil, ErrInvalidKeyfile
+	}
+	return HKDFSHA256(pdk, digest, []byte(keyfileInfo), len(pdk))
+}
@@ -0,0 +1,166 @@
+package krypto
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// SiteRule is what a site accepts, in the terms of the HTML passwordrules attribute
+// ("minlength: 8; maxlength: 16; required: lower, upper; allowed: digit, [-_!]").
+// The zero value places no restriction.
+type SiteRule struct {
+	MinLength int
+	MaxLength int       // zero means no limit
+	Allowed   CharClass // classes the site accepts besides Required; zero with Required zero means all
+	Required  CharClass
+	Symbols   string // the only symbols the site accepts; empty means any
+}
+
+// ParsePasswordRules parses a passwordrules string. Property names and the classes
+// lower, upper, digit, special, ascii-printable and unicode are case-insensitive;
+// [..] lists custom characters, whose letters and digits enable the matching class and
+// whose other characters become the symbol set. Unknown properties such as
+// max-consecutive are ignored, as the passwordrules proposal asks.
+func ParsePasswordRules(s string) (SiteRule, error) {
+	var r SiteRule
+	var special bool
+	var custom strings.Builder
+
+	for _, prop := range splitOutsideBrackets(s, ';') {
+		name, value, ok := strings.Cut(prop, ":")
+		if !ok {
+			if strings.TrimSpace(prop) == "" {
+				continue
+			}
+			return SiteRule{}, fmt.Errorf("password rule %q: missing ':'", strings.TrimSpace(prop))
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+
+		switch name {
+		case "minlength", "maxlength":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return SiteRule{}, fmt.Errorf("password rule %s: %q is not a length", name, value)
+			}
+			if name == "minlength" {
+				r.MinLength = max(r.MinLength, n)
+			} else if r.MaxLength == 0 || n < r.MaxLength {
+				r.MaxLength = n
+			}
+		case "required", "allowed":
+			var classes CharClass
+			for _, item := range splitOutsideBrackets(value, ',') {
+				item = strings.TrimSpace(item)
+				switch {
+				case strings.HasPrefix(item, "[") && strings.HasSuffix(item, "]") && len(item) >= 2:
+					for _, c := range item[1 : len(item)-1] {
+						switch {
+						case unicode.IsLower(c):
+							classes |= ClassLower
+						case unicode.IsUpper(c):
+							classes |= ClassUpper
+						case unicode.IsDigit(c):
+							classes |= ClassDigit
+						default:
+							classes |= ClassSymbol
+							custom.WriteRune(c)
+						}
+					}
+				case strings.EqualFold(item, "lower"):
+					classes |= ClassLower
+				case strings.EqualFold(item, "upper"):
+					classes |= ClassUpper
+				case strings.EqualFold(item, "digit"):
+					classes |= ClassDigit
+				case strings.EqualFold(item, "special"):
+					classes |= ClassSymbol
+					special = true
+				case strings.EqualFold(item, "ascii-printable"), strings.EqualFold(item, "unicode"):
+					classes |= AllClasses
+					special = true
+				case item == "":
+				default:
+					return SiteRule{}, fmt.Errorf("password rule %s: unknown class %q", name, item)
+				}
+			}
+			if name == "required" {
+				r.Required |= classes
+			} else {
+				r.Allowed |= classes
+			}
+		}
+	}
+
+	if r.MaxLength > 0 && r.MinLength > r.MaxLength {
+		return SiteRule{}, fmt.Errorf("password rule: minlength %d exceeds maxlength %d", r.MinLength, r.MaxLength)
+	}
+	if custom.Len() > 0 {
+		r.Symbols = custom.String()
+		if special {
+			r.Symbols = DefaultSymbols + r.Symbols
+		}
+	}
+	return r, nil
+}
+
+// Apply narrows o to what the site accepts: the length is clamped to the rule's range,
+// classes the site does not allow are dropped, the classes it requires are added, and
+// the symbol set is cut down to the site's.
+func (o PasswordOptions) Apply(r SiteRule) PasswordOptions {
+	if r.MinLength > o.Length {
+		o.Length = r.MinLength
+	}
+	if r.MaxLength > 0 && o.Length > r.MaxLength {
+		o.Length = r.MaxLength
+	}
+
+	if allowed := r.Allowed | r.Required; allowed != 0 {
+		o.Classes = o.Classes&allowed | r.Required
+		if o.Classes == 0 {
+			o.Classes = allowed
+		}
+	}
+	o.Required = o.Required&o.Classes | r.Required
+
+	if r.Symbols != "" {
+		current := o.Symbols
+		if current == "" {
+			current = DefaultSymbols
+		}
+		var kept strings.Builder
+		for _, c := range current {
+			if strings.ContainsRune(r.Symbols, c) {
+				kept.WriteRune(c)
+			}
+		}
+		o.Symbols = kept.String()
+		if o.Symbols == "" {
+			o.Symbols = r.Symbols
+		}
+	}
+	return o
+}
+
+// splitOutsideBrackets splits s at sep, except inside [..] custom character lists.
+func splitOutsideBrackets(s string, sep rune) []string {
+	var parts []string
+	var cur strings.Builder
+	inBrackets := false
+	for _, c := range s {
+		switch {
+		case c == '[' && !inBrackets:
+			inBrackets = true
+		case c == ']' && inBrackets:
+			inBrackets = false
+		case c == sep && !inBrackets:
+			parts = append(parts, cur.String())
+			cur.Reset()
+			continue
+		}
+		cur.WriteRune(c)
+	}
+	return append(parts, cur.String())
+}
@@ -0,0 +1,88 @@
+package krypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// RecoveryEntropyBytes is the amount of randomness carried by a recovery code (128 bits).
+	RecoveryEntropyBytes = 16
+	recoveryChecksumLen  = 4
+	recoveryGroupLen     = 4
+	recoveryKeyInfo      = "recovery-key-v1"
+)
+
+// ErrInvalidRecoveryCode indicates a recovery code that is malformed or fails its checksum.
+var ErrInvalidRecoveryCode = errors.New("invalid recovery code")
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewRecoveryCode generates a printable recovery code and returns it with its raw entropy.
+// The code is Base32 over entropy||SHA-256(entropy)[:4], grouped as XXXX-XXXX-...
+// so that typos are caught by ParseRecoveryCode before any unwrap is attempted.
+func NewRecoveryCode() (string, []byte, error) {
+	entropy := make([]byte, RecoveryEntropyBytes)
+	if _, err := rand.Read(entropy); err != nil {
+		return "", nil, fmt.Errorf("generate recovery entropy: %w", err)
+	}
+	return FormatRecoveryCode(entropy), entropy, nil
+}
+
+// FormatRecoveryCode renders entropy as a grouped Base32 recovery code with checksum.
+func FormatRecoveryCode(entropy []byte) string {
+	sum := sha256.Sum256(entropy)
+	raw := append(append([]byte(nil), entropy...), sum[:recoveryChecksumLen]...)
+	encoded := recoveryEncoding.EncodeToString(raw)
+
+	var b strings.Builder
+	for i := 0; i < len(encoded); i += recoveryGroupLen {
+		if i > 0 {
+			b.WriteByte('-')
+		}
+		end := min(i+recoveryGroupLen, len(encoded))
+		b.WriteString(encoded[i:end])
+	}
+	return b.String()
+}
+
+// ParseRecoveryCode validates a recovery code and returns its entropy.
+// Case, whitespace, and group separators are ignored.
+func ParseRecoveryCode(code string) ([]byte, error) {
+	cleaned := strings.Map(func(r rune) rune {
+		switch {
+		case r == '-' || r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			return -1
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		default:
+			return r
+		}
+	}, code)
+
+	raw, err := recoveryEncoding.DecodeString(cleaned)
+	if err != nil || len(raw) != RecoveryEntropyBytes+recoveryChecksumLen {
+		return nil, ErrInvalidRecoveryCode
+	}
+
+	entropy := raw[:RecoveryEntropyBytes]
+	sum := sha256.Sum256(entropy)
+	if subtle.ConstantTimeCompare(sum[:recoveryChecksumLen], raw[RecoveryEntropyBytes:]) != 1 {
+		return nil, ErrInvalidRecoveryCode
+	}
+	return entropy, nil
+}
+
+// DeriveRecoveryKey expands recovery-code entropy into a 256-bit wrapping key.
+// The code is already high-entropy, so HKDF replaces the Argon2id stretch used for passwords.
+func DeriveRecoveryKey(entropy, salt []byte) ([]byte, error) {
+	if len(entropy) != RecoveryEntropyBytes {
+		return nil, ErrInvalidRecoveryCode
+	}
+	return HKDFSHA256(entropy, salt, []byte(recoveryKeyInfo), 32)
+}
@@ -0,0 +1,219 @@
+package krypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// TOTPDefaultPeriod and TOTPDefaultDigits are the RFC 6238 defaults that apply when
+	// an otpauth URI leaves them out.
+	TOTPDefaultPeriod = 30
+	TOTPDefaultDigits = 6
+
+	totpMaxPeriod    = 3600
+	totpMinSecretLen = 10 // 80 bits, the RFC 4226 minimum
+)
+
+// ErrInvalidOTPAuth indicates an otpauth URI or secret that cannot produce codes.
+var ErrInvalidOTPAuth = errors.New("invalid otpauth URI")
+
+var otpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTP is a time-based one-time password key as carried by an otpauth://totp URI.
+type TOTP struct {
+	Secret    []byte
+	Algorithm string // SHA1, SHA256 or SHA512
+	Digits    int    // 6 or 8
+	Period    int    // seconds per code
+	Issuer    string
+	Account   string
+}
+
+// ParseOTPAuthURI parses otpauth://totp/Issuer:account?secret=...&issuer=...&algorithm=...&digits=...&period=...
+// Missing algorithm, digits and period take the RFC 6238 defaults (SHA1, 6, 30).
+// HOTP (counter-based) URIs are rejected.
+func ParseOTPAuthURI(uri string) (TOTP, error) {
+	u, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil {
+		return TOTP{}, fmt.Errorf("%w: %v", ErrInvalidOTPAuth, err)
+	}
+	if !strings.EqualFold(u.Scheme, "otpauth") {
+		return TOTP{}, fmt.Errorf("%w: scheme must be otpauth", ErrInvalidOTPAuth)
+	}
+	if !strings.EqualFold(u.Host, "totp") {
+		return TOTP{}, fmt.Errorf("%w: only totp keys are supported, not %q", ErrInvalidOTPAuth, u.Host)
+	}
+
+	q := u.Query()
+	secret, err := DecodeOTPSecret(q.Get("secret"))
+	if err != nil {
+		return TOTP{}, err
+	}
+	t := TOTP{
+		Secret:    secret,
+		Algorithm: "SHA1",
+		Digits:    TOTPDefaultDigits,
+		Period:    TOTPDefaultPeriod,
+		Issuer:    q.Get("issuer"),
+	}
+
+	label := strings.TrimPrefix(u.Path, "/")
+	if issuer, account, ok := strings.Cut(label, ":"); ok {
+		t.Account = strings.TrimSpace(account)
+		if t.Issuer == "" {
+			t.Issuer = strings.TrimSpace(issuer)
+		}
+	} else {
+		t.Account = strings.TrimSpace(label)
+	}
+
+	if a := q.Get("algorithm"); a != "" {
+		t.Algorithm = strings.ToUpper(a)
+	}
+	if d := q.Get("digits"); d != "" {
+		if t.Digits, err = strconv.Atoi(d); err != nil {
+			return TOTP{}, fmt.Errorf("%w: digits %q", ErrInvalidOTPAuth, d)
+		}
+	}
+	if p := q.Get("period"); p != "" {
+		if t.Period, err = strconv.Atoi(p); err != nil {
+			return TOTP{}, fmt.Errorf("%w: period %q", ErrInvalidOTPAuth, p)
+		}
+	}
+	if err := t.validate(); err != nil {
+		return TOTP{}, err
+	}
+	return t, nil
+}
+
+// ParseOTPKey accepts what a site's 2FA setup page offers: an otpauth://totp URI (from
+// the QR code) or the bare Base32 secret shown for manual entry. A bare secret takes the
+// RFC 6238 defaults and is labelled with issuer and account.
+func ParseOTPKey(s, issuer, account string) (TOTP, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(strings.ToLower(s), "otpauth:") {
+		return ParseOTPAuthURI(s)
+	}
+	secret, err := DecodeOTPSecret(s)
+	if err != nil {
+		return TOTP{}, err
+	}
+	return TOTP{
+		Secret:    secret,
+		Algorithm: "SHA1",
+		Digits:    TOTPDefaultDigits,
+		Period:    TOTPDefaultPeriod,
+		Issuer:    issuer,
+		Account:   account,
+	}, nil
+}
+
+// DecodeOTPSecret decodes a Base32 TOTP secret as shown by sites that offer "enter this
+// key manually": case, spaces, hyphens and padding are ignored.
+func DecodeOTPSecret(s string) ([]byte, error) {
+	cleaned := strings.ToUpper(strings.NewReplacer(" ", "", "-", "", "=", "").Replace(s))
+	if cleaned == "" {
+		return nil, fmt.Errorf("%w: secret missing", ErrInvalidOTPAuth)
+	}
+	secret, err := otpEncoding.DecodeString(cleaned)
+	if err != nil {
+		return nil, fmt.Errorf("%w: secret is not Base32", ErrInvalidOTPAuth)
+	}
+	if len(secret) < totpMinSecretLen {
+		return nil, fmt.Errorf("%w: secret shorter than %d bytes", ErrInvalidOTPAuth, totpMinSecretLen)
+	}
+	return secret, nil
+}
+
+func (t TOTP) validate() error {
+	if _, err := t.hash(); err != nil {
+		return err
+	}
+	if t.Digits != 6 && t.Digits != 8 {
+		return fmt.Errorf("%w: digits must be 6 or 8", ErrInvalidOTPAuth)
+	}
+	if t.Period <= 0 || t.Period > totpMaxPeriod {
+		return fmt.Errorf("%w: period must be between 1 and %d seconds", ErrInvalidOTPAuth, totpMaxPeriod)
+	}
+	if len(t.Secret) < totpMinSecretLen {
+		return fmt.Errorf("%w: secret shorter than %d bytes", ErrInvalidOTPAuth, totpMinSecretLen)
+	}
+	return nil
+}
+
+func (t TOTP) hash() (func() hash.Hash, error) {
+	switch t.Algorithm {
+	case "SHA1":
+		return sha1.New, nil
+	case "SHA256":
+		return sha256.New, nil
+	case "SHA512":
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidOTPAuth, t.Algorithm)
+}
+
+// URI renders t as an otpauth://totp URI that ParseOTPAuthURI reads back.
+func (t TOTP) URI() string {
+	label := t.Account
+	if t.Issuer != "" {
+		label = t.Issuer + ":" + t.Account
+	}
+	q := url.Values{}
+	q.Set("secret", otpEncoding.EncodeToString(t.Secret))
+	if t.Issuer != "" {
+		q.Set("issuer", t.Issuer)
+	}
+	q.Set("algorithm", t.Algorithm)
+	q.Set("digits", strconv.Itoa(t.Digits))
+	q.Set("period", strconv.Itoa(t.Period))
+	return (&url.URL{Scheme: "otpauth", Host: "totp", Path: "/" + label, RawQuery: q.Encode()}).String()
+}
+
+// Code returns the RFC 6238 code for the time step containing at.
+//
+// Behavior:
+//  1. The counter is floor(unix seconds / Period), as a big-endian uint64.
+//  2. HMAC-<Algorithm>(Secret, counter) is truncated dynamically (RFC 4226 section 5.3)
+//     to a 31-bit integer and reduced modulo 10^Digits, keeping leading zeros.
+func (t TOTP) Code(at time.Time) (string, error) {
+	if err := t.validate(); err != nil {
+		return "", err
+	}
+	h, _ := t.hash()
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(at.Unix())/uint64(t.Period))
+	mac := hmac.New(h, t.Secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < t.Digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", t.Digits, value%mod), nil
+}
+
+// Remaining returns how long the code for at stays valid.
+func (t TOTP) Remaining(at time.Time) time.Duration {
+	if t.Period <= 0 {
+		return 0
+	}
+	period := time.Duration(t.Period) * time.Second
+	return period - time.Duration(at.UnixNano())%period
+}
@@ -0,0 +1,96 @@
+package krypto
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B test vectors: 8 digits, 30-second period, with the 20-, 32- and
+// 64-byte ASCII seeds for SHA1, SHA256 and SHA512.
+func TestTOTPRFC6238Vectors(t *testing.T) {
+	seeds := map[string]string{
+		"SHA1":   "12345678901234567890",
+		"SHA256": "12345678901234567890123456789012",
+		"SHA512": "1234567890123456789012345678901234567890123456789012345678901234",
+	}
+	vectors := []struct {
+		unix int64
+		algo string
+		code string
+	}{
+		{59, "SHA1", "94287082"},
+		{59, "SHA256", "46119246"},
+		{59, "SHA512", "90693936"},
+		{1111111109, "SHA1", "07081804"},
+		{1111111109, "SHA256", "68084774"},
+		{1111111109, "SHA512", "25091201"},
+		{1111111111, "SHA1", "14050471"},
+		{1111111111, "SHA256", "67062674"},
+		{1111111111, "SHA512", "99943326"},
+		{1234567890, "SHA1", "89005924"},
+		{1234567890, "SHA256", "91819424"},
+		{1234567890, "SHA512", "93441116"},
+		{2000000000, "SHA1", "69279037"},
+		{2000000000, "SHA256", "90698825"},
+		{2000000000, "SHA512", "38618901"},
+		{20000000000, "SHA1", "65353130"},
+		{20000000000, "SHA256", "77737706"},
+		{20000000000, "SHA512", "47863826"},
+	}
+	for _, v := range vectors {
+		key := TOTP{Secret: []byte(seeds[v.algo]), Algorithm: v.algo, Digits: 8, Period: 30}
+		got, err := key.Code(time.Unix(v.unix, 0))
+		if err != nil {
+			t.Fatalf("%s at %d: %v", v.algo, v.unix, err)
+		}
+		if got != v.code {
+			t.Errorf("%s at %d: got %s, want %s", v.algo, v.unix, got, v.code)
+		}
+	}
+}
+
+func TestParseOTPAuthURI(t *testing.T) {
+	// GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ is the Base32 form of "12345678901234567890".
+	key, err := ParseOTPAuthURI("otpauth://totp/Example:alice@example.com?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Issuer != "Example" || key.Account != "alice@example.com" || key.Algorithm != "SHA1" || key.Digits != 8 || key.Period != 30 {
+		t.Fatalf("unexpected key %+v", key)
+	}
+	code, err := key.Code(time.Unix(59, 0))
+	if err != nil || code != "94287082" {
+		t.Fatalf("got %q, %v; want 94287082", code, err)
+	}
+	if rem := key.Remaining(time.Unix(59, 0)); rem != time.Second {
+		t.Fatalf("remaining %v, want 1s", rem)
+	}
+	if got := key.URI(); got == "" {
+		t.Fatal("URI is empty")
+	} else if back, err := ParseOTPAuthURI(got); err != nil || string(back.Secret) != string(key.Secret) || back.Digits != 8 {
+		t.Fatalf("URI %q does not round-trip: %+v, %v", got, back, err)
+	}
+}
+
+func TestParseOTPKeyRejectsBadInput(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"not base32!",
+		"GEZDGNBV", // 5 bytes, under the minimum
+		"otpauth://hotp/x?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+		"otpauth://totp/x?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=7",
+		"otpauth://totp/x?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&algorithm=MD5",
+	} {
+		if _, err := ParseOTPKey(in, "", ""); !errors.Is(err, ErrInvalidOTPAuth) {
+			t.Errorf("%q: got %v, want ErrInvalidOTPAuth", in, err)
+		}
+	}
+	key, err := ParseOTPKey("gezd gnbv-gy3t qojq gezd gnbv gy3t qojq", "Example", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(key.Secret) != "12345678901234567890" || key.Account != "bob" {
+		t.Fatalf("unexpected key %+v", key)
+	}
+}
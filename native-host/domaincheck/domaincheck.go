@@ -41,14 +41,15 @@ func ETLDPlusOne(host string) (string, error) {
 //
 // Behavior:
 //  1. Computes the runtime host’s eTLD+1; failures (IPs, malformed hosts) deny autofill.
-//  2. Compares eTLD+1 values case-insensitively, rejecting mismatches as potential phishing.
+//  2. Compares eTLD+1 values case-insensitively, rejecting mismatches as potential phishing
+//     unless an equivalent-domain group holds both (see Equivalent).
 //  3. When requireExactHost is set, ensures both stored and runtime hosts match after sanitization.
 func AllowAutofill(savedETLD1, host string, requireExactHost bool, exactHost string) bool {
 	hostETLD1, err := ETLDPlusOne(host)
 	if err != nil {
 		return false
 	}
-	if !strings.EqualFold(hostETLD1, savedETLD1) {
+	if !Equivalent(hostETLD1, savedETLD1) {
 		return false
 	}
 	if requireExactHost {
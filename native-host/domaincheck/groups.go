@@ -0,0 +1,27 @@
+package domaincheck
+
+import (
+	"strings"
+
+	"github.com/Hussein-Mazeh/PasswordManager/store"
+)
+
+// groups is the equivalent-domain table consulted by AllowAutofill and MatchURL.
+var groups = store.BuiltinDomainGroups()
+
+// UseGroups replaces the equivalent-domain table, normally with store.LoadDomainGroups.
+func UseGroups(g store.DomainGroups) {
+	groups = g
+}
+
+// Equivalent reports whether two eTLD+1 values name the same site or share a group,
+// such as google.com and youtube.com.
+func Equivalent(a, b string) bool {
+	return groups.Equivalent(sanitizeHost(a), sanitizeHost(b))
+}
+
+// Equivalents returns etld1 followed by the domains grouped with it, for looking up
+// credentials saved under any of them.
+func Equivalents(etld1 string) []string {
+	return groups.Equivalents(strings.ToLower(strings.TrimSpace(etld1)))
+}
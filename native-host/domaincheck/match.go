@@ -0,0 +1,149 @@
+package domaincheck
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+)
+
+// Rule is an entry's URL match rule as stored in its payload.
+type Rule struct {
+	Mode    vault.MatchMode
+	Website string   // the entry's website column; host modes fall back to it when URLs is empty
+	URLs    []string // URLs, or patterns for vault.MatchRegex
+}
+
+// MatchURL decides whether an entry may be offered on the page at pageURL.
+//
+// Args:
+//
+//	rule: the entry's match rule; vault.MatchDefault must be resolved by the caller.
+//	pageURL: full URL of the page, or a bare host when only that is known.
+//
+// Returns:
+//
+//	bool: true when the page satisfies the rule.
+//
+// Behavior:
+//  1. base-domain compares eTLD+1 values, as AllowAutofill does, so equivalent-domain
+//     groups apply.
+//  2. host and host-port compare the page's hostname, and port, with those of each URL
+//     (or the website); a URL without a scheme is read as https.
+//  3. prefix, exact and regex compare the full page URL, so a bare host never matches.
+//     prefix first requires the same scheme, host and port, then compares the path and
+//     query, so https://app.example.com does not cover https://app.example.com.evil.net.
+//     A regex must match the whole URL, as if written ^(?:pattern)$.
+//  4. never, an unknown mode, or a pattern that does not compile denies.
+func MatchURL(rule Rule, pageURL string) bool {
+	targets := rule.URLs
+	if len(targets) == 0 && rule.Website != "" {
+		targets = []string{rule.Website}
+	}
+	pageHost, pagePort, ok := splitURL(pageURL)
+	if !ok {
+		return false
+	}
+
+	switch rule.Mode {
+	case vault.MatchBaseDomain:
+		pageETLD1, err := ETLDPlusOne(pageHost)
+		if err != nil {
+			return false
+		}
+		for _, t := range targets {
+			host, _, ok := splitURL(t)
+			if !ok {
+				continue
+			}
+			if etld1, err := ETLDPlusOne(host); err == nil && Equivalent(etld1, pageETLD1) {
+				return true
+			}
+		}
+	case vault.MatchHost, vault.MatchHostPort:
+		for _, t := range targets {
+			host, port, ok := splitURL(t)
+			if !ok || host != pageHost {
+				continue
+			}
+			if rule.Mode == vault.MatchHost || port == pagePort {
+				return true
+			}
+		}
+	case vault.MatchPrefix, vault.MatchExact:
+		page, ok := parseFullURL(pageURL)
+		if !ok {
+			return false
+		}
+		for _, t := range rule.URLs {
+			if rule.Mode == vault.MatchExact && pageURL == t {
+				return true
+			}
+			if rule.Mode == vault.MatchPrefix && hasURLPrefix(page, t) {
+				return true
+			}
+		}
+	case vault.MatchRegex:
+		if !strings.Contains(pageURL, "://") {
+			return false
+		}
+		for _, t := range rule.URLs {
+			re, err := regexp.Compile(`^(?:` + t + `)$`)
+			if err == nil && re.MatchString(pageURL) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// splitURL returns the sanitized hostname of a URL or bare host and its port, filling
+// in 443 or 80 from the scheme when none is given.
+func splitURL(raw string) (host, port string, ok bool) {
+	raw = strings.TrimSpace(raw)
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" {
+		return "", "", false
+	}
+	port = u.Port()
+	if port == "" {
+		switch strings.ToLower(u.Scheme) {
+		case "http":
+			port = "80"
+		case "https":
+			port = "443"
+		}
+	}
+	return strings.TrimSuffix(strings.ToLower(u.Hostname()), "."), port, true
+}
+
+// parseFullURL parses a URL that carries a scheme and host.
+func parseFullURL(raw string) (*url.URL, bool) {
+	if !strings.Contains(raw, "://") {
+		return nil, false
+	}
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Hostname() == "" {
+		return nil, false
+	}
+	return u, true
+}
+
+// hasURLPrefix reports whether page lies under the URL prefix: same scheme, host and
+// port, and a path and query that start with the prefix's.
+func hasURLPrefix(page *url.URL, prefix string) bool {
+	p, ok := parseFullURL(prefix)
+	if !ok || !strings.EqualFold(page.Scheme, p.Scheme) {
+		return false
+	}
+	pageHost, pagePort, _ := splitURL(page.String())
+	host, port, _ := splitURL(p.String())
+	if host != pageHost || port != pagePort {
+		return false
+	}
+	return strings.HasPrefix(page.RequestURI(), p.RequestURI())
+}
@@ -0,0 +1,57 @@
+package domaincheck
+
+import (
+	"testing"
+
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+)
+
+func TestMatchURL(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		page string
+		want bool
+	}{
+		{"base-domain subdomain", Rule{Mode: vault.MatchBaseDomain, Website: "example.com"}, "https://login.example.com/", true},
+		{"base-domain bare host", Rule{Mode: vault.MatchBaseDomain, Website: "example.com"}, "example.com", true},
+		{"base-domain group", Rule{Mode: vault.MatchBaseDomain, Website: "google.com"}, "https://www.youtube.com/", true},
+		{"base-domain other site", Rule{Mode: vault.MatchBaseDomain, Website: "example.com"}, "https://example.com.evil.net/", false},
+
+		{"host same", Rule{Mode: vault.MatchHost, URLs: []string{"https://app.example.com/login"}}, "https://app.example.com/other", true},
+		{"host any port", Rule{Mode: vault.MatchHost, URLs: []string{"https://app.example.com"}}, "https://app.example.com:8443/", true},
+		{"host sibling", Rule{Mode: vault.MatchHost, URLs: []string{"https://app.example.com"}}, "https://www.example.com/", false},
+		{"host website fallback", Rule{Mode: vault.MatchHost, Website: "example.com"}, "https://example.com/", true},
+
+		{"host-port default", Rule{Mode: vault.MatchHostPort, URLs: []string{"https://app.example.com"}}, "https://app.example.com:443/x", true},
+		{"host-port other port", Rule{Mode: vault.MatchHostPort, URLs: []string{"https://app.example.com"}}, "https://app.example.com:8443/", false},
+		{"host-port scheme port", Rule{Mode: vault.MatchHostPort, URLs: []string{"https://app.example.com"}}, "http://app.example.com/", false},
+
+		{"prefix path", Rule{Mode: vault.MatchPrefix, URLs: []string{"https://app.example.com/admin"}}, "https://app.example.com/admin/users", true},
+		{"prefix root", Rule{Mode: vault.MatchPrefix, URLs: []string{"https://app.example.com"}}, "https://app.example.com/", true},
+		{"prefix other path", Rule{Mode: vault.MatchPrefix, URLs: []string{"https://app.example.com/admin"}}, "https://app.example.com/login", false},
+		{"prefix longer host", Rule{Mode: vault.MatchPrefix, URLs: []string{"https://app.example.com"}}, "https://app.example.com.evil.net/", false},
+		{"prefix userinfo", Rule{Mode: vault.MatchPrefix, URLs: []string{"https://app.example.com"}}, "https://app.example.com@evil.net/", false},
+		{"prefix scheme", Rule{Mode: vault.MatchPrefix, URLs: []string{"https://app.example.com"}}, "http://app.example.com/", false},
+		{"prefix port", Rule{Mode: vault.MatchPrefix, URLs: []string{"https://app.example.com"}}, "https://app.example.com:8443/", false},
+		{"prefix bare host", Rule{Mode: vault.MatchPrefix, URLs: []string{"https://app.example.com"}}, "app.example.com", false},
+
+		{"exact same", Rule{Mode: vault.MatchExact, URLs: []string{"https://example.com/login"}}, "https://example.com/login", true},
+		{"exact query", Rule{Mode: vault.MatchExact, URLs: []string{"https://example.com/login"}}, "https://example.com/login?next=/", false},
+
+		{"regex whole URL", Rule{Mode: vault.MatchRegex, URLs: []string{`https://corp\.example\.com/.*`}}, "https://corp.example.com/sso", true},
+		{"regex unanchored pattern", Rule{Mode: vault.MatchRegex, URLs: []string{`corp\.example\.com`}}, "https://evil.net/?corp.example.com", false},
+		{"regex suffix", Rule{Mode: vault.MatchRegex, URLs: []string{`https://corp\.example\.com/.*`}}, "https://corp.example.com/.evil.net", true},
+		{"regex alternation", Rule{Mode: vault.MatchRegex, URLs: []string{`https://a\.example\.com/|https://b\.example\.com/`}}, "https://b.example.com/", true},
+		{"regex alternation anchored", Rule{Mode: vault.MatchRegex, URLs: []string{`https://a\.example\.com/|x`}}, "https://evil.net/x", false},
+		{"regex invalid", Rule{Mode: vault.MatchRegex, URLs: []string{`(`}}, "https://example.com/", false},
+
+		{"never", Rule{Mode: vault.MatchNever, Website: "example.com"}, "https://example.com/", false},
+		{"unresolved default", Rule{Mode: vault.MatchDefault, Website: "example.com"}, "https://example.com/", false},
+	}
+	for _, tt := range tests {
+		if got := MatchURL(tt.rule, tt.page); got != tt.want {
+			t.Errorf("%s: MatchURL(%s, %q) = %v, want %v", tt.name, tt.rule.Mode, tt.page, got, tt.want)
+		}
+	}
+}
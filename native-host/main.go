@@ -2,23 +2,23 @@ package main
 
 import (
 	"bufio"
-	"crypto/rand"
-	"crypto/subtle"
-	"encoding/base64"
+	"context"
+	"database/sql"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"os/signal"
-	"os/user"
 	"path/filepath"
 	"strings"
-	"sync"
 	"syscall"
 	"time"
 
+	"github.com/Hussein-Mazeh/PasswordManager/auth"
+	"github.com/Hussein-Mazeh/PasswordManager/internal/agent"
 	dbpkg "github.com/Hussein-Mazeh/PasswordManager/internal/db"
 	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
 	"github.com/Hussein-Mazeh/PasswordManager/krypto"
@@ -29,158 +29,13 @@ import (
 
 const (
 	version      = "0.1.0"
-	unlockTTL    = 10 * time.Minute
 	bufferSize   = 1 << 16
 	maxFrameSize = 1 << 20
 )
 
-var (
-	errUnauthorized  = errors.New("unauthorized")
-	errExpired       = errors.New("expired")
-	errInvalidState  = errors.New("invalid state")
-	errNonceReplayed = errors.New("nonce_replayed")
-)
-
-type sessionState struct {
-	mutex    sync.Mutex //To avoid race conditions
-	token    string
-	mek      []byte
-	expires  time.Time
-	dir      string
-	nonces   map[string]struct{}
-	ownerUID string
-}
-
-// establish replaces any prior unlocked session with the provided MEK and metadata.
-//
-// Args:
-//
-//	dir: absolute path to the unlocked vault directory.
-//	mek: decrypted master encryption key to cache.
-//
-// Returns:
-//
-//	string: newly generated session token.
-//	int: token lifetime in seconds.
-//	error: non-nil when token generation or state initialization fails.
-//
-// Behavior:
-//  1. Locks the session mutex and clears any existing state.
-//  2. Copies the MEK, generates a crypto-random token, and records directory/expiry.
-//  3. On failure, zeroizes partial state before returning the error.
-func (s *sessionState) establish(dir string, mek []byte) (string, int, error) {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
-	s.clearLockedUnsafe()
-
-	s.mek = make([]byte, len(mek))
-	copy(s.mek, mek)
-
-	token, err := generateToken()
-	if err != nil {
-		s.clearLockedUnsafe()
-		return "", 0, err
-	}
-
-	s.token = token
-	s.dir = dir
-	s.expires = time.Now().Add(unlockTTL)
-	s.nonces = make(map[string]struct{})
-	s.ownerUID = currentUserIdentifier()
-
-	return token, int(unlockTTL / time.Second), nil
-}
-
-// validateRequest confirms session authenticity and checks replay-protection nonce.
-//
-// Args:
-//
-//	token: session token presented by the caller.
-//	nonce: per-request nonce to enforce uniqueness.
-//
-// Returns:
-//
-//	[]byte: copy of the cached MEK when authorization succeeds.
-//	string: associated vault directory path.
-//	error: non-nil for missing, expired, mismatched, or replayed requests.
-//
-// Behavior:
-//  1. Locks the session mutex and ensures stored and supplied tokens/nonces are present.
-//  2. Rejects expired sessions or unexpected MEK lengths, clearing state when detected.
-//  3. Validates the caller's OS identity matches the session owner (when available).
-//  4. Enforces nonce uniqueness per session to prevent replayed requests.
-//  5. Extends the expiry window on successful validation and returns MEK/dir copies.
-func (s *sessionState) validateRequest(token, nonce string) ([]byte, string, error) {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
-	if s.token == "" || token == "" || nonce == "" {
-		return nil, "", errUnauthorized
-	}
-	if time.Now().After(s.expires) {
-		s.clearLockedUnsafe()
-		return nil, "", errExpired
-	}
-	if subtle.ConstantTimeCompare([]byte(s.token), []byte(token)) != 1 {
-		return nil, "", errUnauthorized
-	}
-	if owner := s.ownerUID; owner != "" {
-		if current := currentUserIdentifier(); current != "" && current != owner {
-			return nil, "", errUnauthorized
-		}
-	}
-	if len(s.mek) != 32 {
-		s.clearLockedUnsafe()
-		return nil, "", errInvalidState
-	}
-	if s.nonces == nil {
-		s.nonces = make(map[string]struct{})
-	}
-	if _, exists := s.nonces[nonce]; exists {
-		return nil, "", errNonceReplayed
-	}
-	s.nonces[nonce] = struct{}{}
-
-	s.expires = time.Now().Add(unlockTTL)
-
-	mekCopy := make([]byte, len(s.mek))
-	copy(mekCopy, s.mek)
-	return mekCopy, s.dir, nil
-}
-
-// clear zeroizes and removes the active session.
-//
-// Args:
-//
-//	None.
-//
-// Returns:
-//
-//	None.
-//
-// Behavior:
-//  1. Locks the session mutex.
-//  2. Calls clearLockedUnsafe to wipe MEK, token, directory, and expiry timestamp.
-func (s *sessionState) clear() {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-	s.clearLockedUnsafe()
-}
-
-func (s *sessionState) clearLockedUnsafe() {
-	if len(s.mek) > 0 {
-		zeroize(s.mek)
-	}
-	s.mek = nil
-	s.token = ""
-	s.dir = ""
-	s.expires = time.Time{}
-	s.nonces = nil
-	s.ownerUID = ""
-}
-
-var sess sessionState
+// sess is the browser's unlocked session. It shares its token, idle timeout and nonce
+// handling with pm agent through agent.Session.
+var sess agent.Session
 
 // Behavior:
 //  1. Installs signal handlers that clear session state before exiting.
@@ -191,7 +46,7 @@ func main() {
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
 		<-sigCh
-		sess.clear()
+		sess.Clear()
 		os.Exit(0)
 	}()
 
@@ -225,6 +80,12 @@ type unlockRequest struct {
 	Type           string `json:"type"`
 	Dir            string `json:"dir"`
 	MasterPassword string `json:"masterPassword"`
+	KeyfilePath    string `json:"keyfilePath,omitempty"`
+}
+
+type agentUnlockRequest struct {
+	Type string `json:"type"`
+	Dir  string `json:"dir"`
 }
 
 type sessionRequest struct {
@@ -237,8 +98,9 @@ type getCredentialsRequest struct {
 	sessionRequest
 	DomainETLD1      string `json:"domainEtld1"`
 	ExactHost        string `json:"exactHost"`
+	URL              string `json:"url,omitempty"` // the page URL, needed by prefix, exact and regex entries
 	Username         string `json:"username"`
-	RequireExactHost bool   `json:"requireExactHost"`
+	RequireExactHost bool   `json:"requireExactHost"` // match mode for entries that have none
 }
 
 type saveCredentialRequest struct {
@@ -250,6 +112,25 @@ type saveCredentialRequest struct {
 	RequireExactHost bool   `json:"requireExactHost"`
 }
 
+type generatePasswordRequest struct {
+	sessionRequest
+	DomainETLD1 string `json:"domainEtld1,omitempty"`
+	Rules       string `json:"rules,omitempty"`     // the field's passwordrules attribute
+	MaxLength   int    `json:"maxLength,omitempty"` // the field's maxlength attribute
+	Length      int    `json:"length,omitempty"`
+	Passphrase  bool   `json:"passphrase,omitempty"`
+	Words       int    `json:"words,omitempty"`
+}
+
+type getTOTPRequest struct {
+	sessionRequest
+	DomainETLD1      string `json:"domainEtld1"`
+	ExactHost        string `json:"exactHost"`
+	Username         string `json:"username"`
+	RequireExactHost bool   `json:"requireExactHost"`
+	URL              string `json:"url,omitempty"` // the page URL, needed by prefix, exact and regex entries
+}
+
 type response struct {
 	OK      bool   `json:"ok"`
 	Data    any    `json:"data,omitempty"`
@@ -274,13 +155,15 @@ type unlockData struct {
 //
 // Behavior:
 //  1. Parses the envelope to determine the command type, returning BAD_JSON on failure.
-//  2. Unmarshals into the typed request and delegates to command-specific handlers.
-//  3. Emits UNSUPPORTED responses for unknown commands without mutating global state.
+//  2. Reloads the equivalent-domain groups, so pm domains edits apply to the next request.
+//  3. Unmarshals into the typed request and delegates to command-specific handlers.
+//  4. Emits UNSUPPORTED responses for unknown commands without mutating global state.
 func handleRequest(payload []byte) response {
 	var env envelope
 	if err := json.Unmarshal(payload, &env); err != nil {
 		return response{OK: false, Code: "BAD_JSON", Message: "invalid json"}
 	}
+	loadDomainGroups()
 
 	switch env.Type {
 	case "health":
@@ -291,17 +174,23 @@ func handleRequest(payload []byte) response {
 			return response{OK: false, Code: "BAD_JSON", Message: "invalid json"}
 		}
 		return handleUnlock(req)
+	case "agentUnlock":
+		var req agentUnlockRequest
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return response{OK: false, Code: "BAD_JSON", Message: "invalid json"}
+		}
+		return handleAgentUnlock(req)
 	case "lock":
 		var req sessionRequest
 		if err := json.Unmarshal(payload, &req); err != nil {
 			return response{OK: false, Code: "BAD_JSON", Message: "invalid json"}
 		}
-		if mek, _, err := sess.validateRequest(req.SessionToken, req.Nonce); err != nil {
+		if mek, _, err := sess.Validate(req.SessionToken, req.Nonce); err != nil {
 			return sessionErrorResponse(err)
 		} else {
 			zeroize(mek)
 		}
-		sess.clear()
+		sess.Clear()
 		return response{OK: true}
 	case "getCredentials":
 		var req getCredentialsRequest
@@ -315,6 +204,18 @@ func handleRequest(payload []byte) response {
 			return response{OK: false, Code: "BAD_JSON", Message: "invalid json"}
 		}
 		return handleSaveCredential(req)
+	case "generatePassword":
+		var req generatePasswordRequest
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return response{OK: false, Code: "BAD_JSON", Message: "invalid json"}
+		}
+		return handleGeneratePassword(req)
+	case "getTotp":
+		var req getTOTPRequest
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return response{OK: false, Code: "BAD_JSON", Message: "invalid json"}
+		}
+		return handleGetTOTP(req)
 	case "phishingCheck":
 		var req phishingCheckRequest
 		if err := json.Unmarshal(payload, &req); err != nil {
@@ -326,14 +227,25 @@ func handleRequest(payload []byte) response {
 	}
 }
 
+// loadDomainGroups installs the built-in and custom equivalent-domain groups for
+// domaincheck. A custom file that does not load leaves only the built-in groups.
+func loadDomainGroups() {
+	groups, err := store.LoadDomainGroups()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "passwordmanager-host: %v; using built-in domain groups\n", err)
+		groups = store.BuiltinDomainGroups()
+	}
+	domaincheck.UseGroups(groups)
+}
+
 func sessionErrorResponse(err error) response {
-	if errors.Is(err, errNonceReplayed) {
+	if errors.Is(err, agent.ErrNonceReplayed) {
 		return response{OK: false, Code: "NONCE_REPLAY"}
 	}
-	if errors.Is(err, errExpired) {
+	if errors.Is(err, agent.ErrExpired) {
 		return response{OK: false, Code: "SESSION_EXPIRED"}
 	}
-	if errors.Is(err, errInvalidState) {
+	if errors.Is(err, agent.ErrInvalidState) {
 		return response{OK: false, Code: "INVALID_STATE"}
 	}
 	return response{OK: false, Code: "UNAUTHORIZED"}
@@ -343,7 +255,7 @@ func sessionErrorResponse(err error) response {
 //
 // Args:
 //
-//	req: unlock request containing vault directory and master password.
+//	req: unlock request containing vault directory, master password, and optional keyfile path.
 //
 // Returns:
 //
@@ -351,14 +263,16 @@ func sessionErrorResponse(err error) response {
 //
 // Behavior:
 //  1. Validates request fields and resolves the vault directory path.
-//  2. Loads the vault header, derives the PDK via Argon2id, and unwraps the MEK.
+//  2. Tries the password (and keyfile digest, if a path was sent) against each key slot in
+//     the vault header, unwraps the MEK, and resolves any interrupted key rotation.
+//     A slot below the vault's KDF floor is then rewrapped.
 //  3. Establishes the session while zeroizing sensitive buffers throughout.
 func handleUnlock(req unlockRequest) response {
 	if strings.TrimSpace(req.Dir) == "" {
 		return response{OK: false, Code: "BAD_REQUEST", Message: "vault directory required"}
 	}
 
-	sess.clear()
+	sess.Clear()
 
 	pwBytes := []byte(req.MasterPassword)
 	defer zeroize(pwBytes)
@@ -372,67 +286,155 @@ func handleUnlock(req unlockRequest) response {
 		dir = req.Dir
 	}
 
+	var keyfile []byte
+	if strings.TrimSpace(req.KeyfilePath) != "" {
+		keyfile, err = krypto.HashKeyfile(req.KeyfilePath)
+		if err != nil {
+			return response{OK: false, Code: "KEYFILE_INVALID", Message: "keyfile unreadable"}
+		}
+		defer zeroize(keyfile)
+	}
+
 	paths := store.Paths{Dir: dir}
-	hdr, err := store.LoadVaultHeader(paths)
+	mek, hdr, slotID, err := store.UnlockMEK(paths, pwBytes, keyfile)
 	if err != nil {
+		zeroize(mek)
+		if errors.Is(err, store.ErrHeaderTampered) {
+			return response{OK: false, Code: "HEADER_TAMPERED", Message: "vault header failed integrity check"}
+		}
+		if errors.Is(err, store.ErrKeyfileRequired) {
+			return response{OK: false, Code: "KEYFILE_REQUIRED", Message: "vault requires a keyfile"}
+		}
 		return response{OK: false, Code: "UNLOCK_FAILED", Message: "unlock failed"}
 	}
 
-	if hdr.KDF.Name != "argon2id" || hdr.Salt == "" {
+	mek, hdr, err = resolveRotation(dir, paths, hdr, pwBytes, keyfile, mek)
+	if err != nil {
+		if errors.Is(err, dbpkg.ErrSchemaTooNew) {
+			return response{OK: false, Code: "SCHEMA_TOO_NEW", Message: "vault database is newer than this host"}
+		}
 		return response{OK: false, Code: "UNLOCK_FAILED", Message: "unlock failed"}
 	}
+	// Best effort: a failed upgrade leaves the old slot in place and the vault usable.
+	_, _ = store.UpgradeSlotKDF(paths, hdr, slotID, pwBytes, keyfile, mek)
 
-	salt, err := base64.StdEncoding.DecodeString(hdr.Salt)
+	token, ttlSeconds, err := sess.Establish(dir, mek)
+	zeroize(mek)
 	if err != nil {
-		return response{OK: false, Code: "UNLOCK_FAILED", Message: "unlock failed"}
+		return response{OK: false, Code: "INTERNAL", Message: "unlock failed"}
 	}
-	defer zeroize(salt)
 
-	params := krypto.Argon2Params{
-		MemoryMB:    hdr.KDF.MemoryMB,
-		Time:        hdr.KDF.Time,
-		Parallelism: hdr.KDF.Parallelism,
-		SaltLen:     hdr.KDF.SaltLen,
-		KeyLen:      hdr.KDF.KeyLen,
+	return response{OK: true, Data: unlockData{Token: token, TTLSeconds: ttlSeconds}}
+}
+
+// handleAgentUnlock opens a session with the MEK held by a running pm agent, so the
+// browser does not need the master password while the agent is unlocked.
+//
+// Args:
+//
+//	req: request containing the vault directory.
+//
+// Returns:
+//
+//	response: success contains a session token and TTL; AGENT_UNAVAILABLE when no agent
+//	          answers, AGENT_LOCKED when it holds no key for this vault.
+//
+// Behavior:
+//  1. Asks the agent for the key of the (absolute) vault directory.
+//  2. Checks the key against the header MAC and the database MEK check value, so a key
+//     left over from before a rotation is refused.
+//  3. Establishes the browser session and zeroizes the key copy.
+func handleAgentUnlock(req agentUnlockRequest) response {
+	if strings.TrimSpace(req.Dir) == "" {
+		return response{OK: false, Code: "BAD_REQUEST", Message: "vault directory required"}
 	}
 
-	pdk, err := krypto.DeriveKeyArgon2id(pwBytes, salt, params)
+	sess.Clear()
+
+	dir, err := filepath.Abs(req.Dir)
 	if err != nil {
-		return response{OK: false, Code: "UNLOCK_FAILED", Message: "unlock failed"}
+		dir = req.Dir
 	}
-	defer zeroize(pdk)
 
-	mek, _, err := store.LoadAndUnwrapMEK(paths, pdk)
+	mek, err := agent.NewClient("").Key(dir)
 	if err != nil {
-		zeroize(mek)
-		return response{OK: false, Code: "UNLOCK_FAILED", Message: "unlock failed"}
+		if errors.Is(err, agent.ErrNotRunning) {
+			return response{OK: false, Code: "AGENT_UNAVAILABLE", Message: "pm agent is not running"}
+		}
+		return response{OK: false, Code: "AGENT_LOCKED", Message: "pm agent is not unlocked for this vault"}
 	}
+	defer zeroize(mek)
 
-	token, ttlSeconds, err := sess.establish(dir, mek)
-	zeroize(mek)
+	if _, err := store.LoadHeaderForMEK(store.Paths{Dir: dir}, mek); err != nil {
+		return response{OK: false, Code: "AGENT_LOCKED", Message: "pm agent is not unlocked for this vault"}
+	}
+	database, err := dbpkg.Open(filepath.Join(dir, "vault.db"))
 	if err != nil {
-		return response{OK: false, Code: "INTERNAL", Message: "unlock failed"}
+		return response{OK: false, Code: "DB_ERROR", Message: "database unavailable"}
+	}
+	defer dbpkg.Close(database)
+	if err := dbpkg.Migrate(database); err != nil {
+		if errors.Is(err, dbpkg.ErrSchemaTooNew) {
+			return response{OK: false, Code: "SCHEMA_TOO_NEW", Message: "vault database is newer than this host"}
+		}
+		return response{OK: false, Code: "DB_ERROR", Message: "database unavailable"}
+	}
+	if ok, err := dbpkg.MEKCheck(database, mek); err != nil || !ok {
+		return response{OK: false, Code: "AGENT_LOCKED", Message: "pm agent is not unlocked for this vault"}
 	}
 
+	token, ttlSeconds, err := sess.Establish(dir, mek)
+	if err != nil {
+		return response{OK: false, Code: "INTERNAL", Message: "unlock failed"}
+	}
 	return response{OK: true, Data: unlockData{Token: token, TTLSeconds: ttlSeconds}}
 }
 
+// resolveRotation finishes or discards an interrupted MEK rotation so the session MEK
+// matches the database, and returns the header after it. On failure the unlocked MEK is
+// zeroized.
+func resolveRotation(dir string, paths store.Paths, hdr vault.VaultHeader, secret, keyfile, mek []byte) ([]byte, vault.VaultHeader, error) {
+	database, err := dbpkg.Open(filepath.Join(dir, "vault.db"))
+	if err != nil {
+		zeroize(mek)
+		return nil, hdr, err
+	}
+	defer dbpkg.Close(database)
+	if err := dbpkg.Migrate(database); err != nil {
+		zeroize(mek)
+		return nil, hdr, err
+	}
+
+	resolved, hdr, err := store.ResolveRotation(paths, hdr, secret, keyfile, mek, func(m []byte) (bool, error) {
+		return dbpkg.MEKCheck(database, m)
+	})
+	if err != nil {
+		zeroize(mek)
+		return nil, hdr, err
+	}
+	return resolved, hdr, nil
+}
+
 // handleGetCredentials decrypts and returns stored credentials for a site/user.
 //
 // Args:
 //
-//	req: request containing session token, eTLD+1, host, and optional username.
+//	req: request containing session token, eTLD+1, host, optional page URL and optional
+//	     username.
 //
 // Returns:
 //
 //	response: success includes an array of credential maps; errors describe the failure.
 //
 // Behavior:
-//  1. Validates the session token and checks domain policy for the requested host.
-//  2. Opens/migrates the SQLite database and loads matching rows.
-//  3. Decrypts rows via decryptRow, refreshing ciphertext when needed, and returns results.
+//  1. Validates the session token and checks that the host belongs to the eTLD+1.
+//  2. Opens/migrates the SQLite database and loads matching rows via the eTLD+1 blind index,
+//     trying the domains grouped with the eTLD+1 in turn until one has a match.
+//  3. Decrypts rows via decryptRow, refreshing ciphertext when needed, and keeps only those
+//     whose match mode accepts the page. Entries without a mode match on the base domain,
+//     or on the host when requireExactHost is set.
 func handleGetCredentials(req getCredentialsRequest) response {
-	mek, dir, err := sess.validateRequest(req.SessionToken, req.Nonce)
+	mek, dir, err := sess.Validate(req.SessionToken, req.Nonce)
 	if err != nil {
 		return sessionErrorResponse(err)
 	}
@@ -442,44 +444,161 @@ func handleGetCredentials(req getCredentialsRequest) response {
 		return response{OK: false, Code: "BAD_REQUEST"}
 	}
 
-	if !domaincheck.AllowAutofill(req.DomainETLD1, req.ExactHost, req.RequireExactHost, req.ExactHost) {
-		return response{OK: false, Code: "ETLD_MISMATCH"}
+	accept, bad := pageMatcher(req.DomainETLD1, req.ExactHost, req.URL, req.RequireExactHost)
+	if bad != nil {
+		return *bad
 	}
 
-	dbPath := filepath.Join(dir, "vault.db")
-	database, err := dbpkg.Open(dbPath)
-	if err != nil {
-		return response{OK: false, Code: "DB_ERROR", Message: "database unavailable"}
+	database, keys, bad := openSessionDB(dir, mek)
+	if bad != nil {
+		return *bad
 	}
 	defer dbpkg.Close(database)
-	if err := dbpkg.Migrate(database); err != nil {
-		return response{OK: false, Code: "DB_ERROR", Message: "database unavailable"}
-	}
+	defer keys.Wipe()
 
 	result := make([]map[string]string, 0)
 
-	if strings.TrimSpace(req.Username) != "" {
-		row, err := dbpkg.GetEntryBySiteAndUser(database, req.DomainETLD1, req.Username)
-		if err == nil && row != nil {
-			if item, ok := decryptRow(database, mek, row); ok {
-				result = append(result, item)
-			}
-		}
-	} else {
-		rows, err := dbpkg.GetEntryByWebsite(database, req.DomainETLD1)
-		if err == nil {
-			for _, row := range rows {
-				if item, ok := decryptRow(database, mek, &row); ok {
+	for _, site := range domaincheck.Equivalents(req.DomainETLD1) {
+		if strings.TrimSpace(req.Username) != "" {
+			row, err := dbpkg.GetEntryBySiteAndUser(database, keys, site, req.Username)
+			if err == nil && row != nil {
+				if item, ok := decryptRow(database, mek, row, accept); ok {
 					result = append(result, item)
-					break
+				}
+			}
+		} else {
+			rows, err := dbpkg.GetEntryByWebsite(database, keys, site)
+			if err == nil {
+				for _, row := range rows {
+					if item, ok := decryptRow(database, mek, &row, accept); ok {
+						result = append(result, item)
+						break
+					}
 				}
 			}
 		}
+		if len(result) > 0 {
+			break
+		}
 	}
 
 	return response{OK: true, Data: map[string]any{"items": result}}
 }
 
+// pageMatcher checks the page of a getCredentials or getTotp request and returns the
+// test applied to each entry's match rule.
+//
+// Args:
+//
+//	etld1: the page's eTLD+1 as resolved by the extension.
+//	exactHost: the page's hostname.
+//	pageURL: the full page URL, or "" when the caller did not send it.
+//	requireExactHost: selects the mode of entries that have none.
+//
+// Returns:
+//
+//	func(domaincheck.Rule) bool: reports whether an entry's rule accepts the page.
+//	*response: ETLD_MISMATCH when exactHost is outside etld1, BAD_REQUEST when pageURL
+//	           is not on exactHost; nil otherwise.
+//
+// Behavior:
+//  1. Entries without a mode match on the base domain, or on the host when
+//     requireExactHost is set.
+//  2. Without pageURL the rules see only the host, so prefix, exact and regex entries
+//     never match.
+func pageMatcher(etld1, exactHost, pageURL string, requireExactHost bool) (func(domaincheck.Rule) bool, *response) {
+	if !domaincheck.AllowAutofill(etld1, exactHost, false, "") {
+		return nil, &response{OK: false, Code: "ETLD_MISMATCH"}
+	}
+	page := exactHost
+	if pageURL != "" {
+		if !domaincheck.AllowAutofill(etld1, exactHost, true, hostOf(pageURL)) {
+			return nil, &response{OK: false, Code: "BAD_REQUEST"}
+		}
+		page = pageURL
+	}
+	return ruleMatcher(page, requireExactHost), nil
+}
+
+// ruleMatcher returns a test of entry rules against page, resolving entries without a
+// mode to base-domain, or to host when requireExactHost is set.
+func ruleMatcher(page string, requireExactHost bool) func(domaincheck.Rule) bool {
+	fallback := vault.MatchBaseDomain
+	if requireExactHost {
+		fallback = vault.MatchHost
+	}
+	return func(rule domaincheck.Rule) bool {
+		if rule.Mode == vault.MatchDefault {
+			rule.Mode = fallback
+		}
+		return domaincheck.MatchURL(rule, page)
+	}
+}
+
+// openSessionDB opens and migrates the vault database of a session and derives its
+// metadata keys. The caller closes the database and wipes the keys; on failure the
+// returned response is the one to send.
+func openSessionDB(dir string, mek []byte) (*dbpkg.DB, *vault.MetaKeys, *response) {
+	database, err := dbpkg.Open(filepath.Join(dir, "vault.db"))
+	if err != nil {
+		return nil, nil, &response{OK: false, Code: "DB_ERROR", Message: "database unavailable"}
+	}
+	if err := dbpkg.Migrate(database); err != nil {
+		dbpkg.Close(database)
+		return nil, nil, &response{OK: false, Code: "DB_ERROR", Message: "database unavailable"}
+	}
+	keys, err := vault.DeriveMetaKeys(mek)
+	if err != nil {
+		dbpkg.Close(database)
+		return nil, nil, &response{OK: false, Code: "INTERNAL"}
+	}
+	if err := dbpkg.MigrateMetadata(database, keys); err != nil {
+		keys.Wipe()
+		dbpkg.Close(database)
+		return nil, nil, &response{OK: false, Code: "DB_ERROR", Message: "database unavailable"}
+	}
+	return database, keys, nil
+}
+
+// entryRule decrypts row and returns its match rule. ok is false when the row does not
+// decrypt, which callers treat as a rule that matches nothing.
+func entryRule(mek []byte, row *dbpkg.EntryRow) (domaincheck.Rule, bool) {
+	plaintext, _, _, err := vault.DecryptEntryPassword(mek, row.Suite, row.Website, row.Username, row.Type, row.Salt, row.EncryptedPass)
+	if err != nil {
+		return domaincheck.Rule{}, false
+	}
+	payload, err := vault.DecodePayload(row.Format, plaintext)
+	zeroizeString(&plaintext)
+	if err != nil {
+		return domaincheck.Rule{}, false
+	}
+	zeroizeString(&payload.Password)
+	return domaincheck.Rule{Mode: payload.Match, Website: row.Website, URLs: payload.URLs}, true
+}
+
+// totpRule returns the match rule of a TOTP entry. A TOTP entry has no rule of its own,
+// so it is that of the account's password entry, or the website alone when the account
+// has none.
+func totpRule(database *dbpkg.DB, mek []byte, keys *vault.MetaKeys, row *dbpkg.EntryRow) (domaincheck.Rule, bool) {
+	account, err := dbpkg.GetEntryBySiteAndUser(database, keys, row.Website, row.Username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domaincheck.Rule{Website: row.Website}, true
+	}
+	if err != nil {
+		return domaincheck.Rule{}, false
+	}
+	return entryRule(mek, account)
+}
+
+// hostOf returns the hostname of rawURL, or "" when it does not parse.
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
 // decryptRow unwraps a database credential row and materializes plaintext fields.
 //
 // Args:
@@ -487,24 +606,29 @@ func handleGetCredentials(req getCredentialsRequest) response {
 //	database: open SQLite handle used for optional ciphertext rotation.
 //	mek: master encryption key supporting decryption.
 //	row: credential row retrieved from the passwords table.
+//	accept: decides from the entry's match rule whether it may be returned.
 //
 // Returns:
 //
 //	map[string]string: decrypted username/password pair when successful.
-//	bool: false when decryption fails and the row should be skipped.
+//	bool: false when decryption fails or accept refuses the entry, and the row should be skipped.
 //
 // Behavior:
 //  1. Decrypts the entry via vault.DecryptEntryPassword to obtain plaintext and new blobs.
 //  2. Updates stored ciphertext when rotation material is provided, zeroizing buffers afterward.
-//  3. Returns the plaintext credential map while zeroizing temporary copies.
-func decryptRow(database *dbpkg.DB, mek []byte, row *dbpkg.EntryRow) (map[string]string, bool) {
-	plaintext, newSalt, newBlob, err := vault.DecryptEntryPassword(mek, row.Website, row.Username, row.Type, row.Salt, row.EncryptedPass)
+//  3. Extracts the password from the entry payload once accept allows it; notes and custom
+//     fields never leave the host.
+//  4. Returns the plaintext credential map while zeroizing temporary copies.
+func decryptRow(database *dbpkg.DB, mek []byte, row *dbpkg.EntryRow, accept func(domaincheck.Rule) bool) (map[string]string, bool) {
+	plaintext, newSalt, newBlob, err := vault.DecryptEntryPassword(mek, row.Suite, row.Website, row.Username, row.Type, row.Salt, row.EncryptedPass)
 	if err != nil {
+		// Only the row ID is logged; `pm doctor` explains what is wrong with it.
+		fmt.Fprintf(os.Stderr, "passwordmanager-host: entry %d does not decrypt; run pm doctor\n", row.ID)
 		return nil, false
 	}
 
 	if len(newSalt) > 0 && len(newBlob) > 0 {
-		_ = dbpkg.UpdateEntryCipher(database, row.ID, row.Type, newSalt, newBlob)
+		_ = dbpkg.UpdateEntryCipher(database, row.ID, row.Type, row.Suite, row.Format, newSalt, newBlob)
 	}
 	if len(newSalt) > 0 {
 		zeroize(newSalt)
@@ -513,11 +637,21 @@ func decryptRow(database *dbpkg.DB, mek []byte, row *dbpkg.EntryRow) (map[string
 		zeroize(newBlob)
 	}
 
+	payload, err := vault.DecodePayload(row.Format, plaintext)
+	zeroizeString(&plaintext)
+	if err != nil || payload.Password == "" {
+		return nil, false
+	}
+	if !accept(domaincheck.Rule{Mode: payload.Match, Website: row.Website, URLs: payload.URLs}) {
+		zeroizeString(&payload.Password)
+		return nil, false
+	}
+
 	item := map[string]string{
 		"username": row.Username,
-		"password": plaintext,
+		"password": payload.Password,
 	}
-	zeroizeString(&plaintext)
+	zeroizeString(&payload.Password)
 	return item, true
 }
 
@@ -533,10 +667,12 @@ func decryptRow(database *dbpkg.DB, mek []byte, row *dbpkg.EntryRow) (map[string
 //
 // Behavior:
 //  1. Validates the session token and enforces domain policy requirements.
-//  2. Encrypts the plaintext password with the MEK to produce salt/ciphertext blobs.
-//  3. Inserts the credential into SQLite while zeroizing sensitive buffers regardless of outcome.
+//  2. Holds the password to the vault's password policy when its entries mode is on:
+//     POLICY_VIOLATION under block, policyWarnings in the response under warn.
+//  3. Encrypts the password as an entry payload with the MEK under the header's cipher suite.
+//  4. Inserts the credential into SQLite while zeroizing sensitive buffers regardless of outcome.
 func handleSaveCredential(req saveCredentialRequest) response {
-	mek, dir, err := sess.validateRequest(req.SessionToken, req.Nonce)
+	mek, dir, err := sess.Validate(req.SessionToken, req.Nonce)
 	if err != nil {
 		return sessionErrorResponse(err)
 	}
@@ -550,6 +686,15 @@ func handleSaveCredential(req saveCredentialRequest) response {
 		return response{OK: false, Code: "ETLD_MISMATCH"}
 	}
 
+	warnings, err := store.CheckEntryPassword(context.Background(), store.Paths{Dir: dir}, req.DomainETLD1, req.Username, req.Password)
+	if err != nil {
+		var perr *auth.PolicyError
+		if errors.As(err, &perr) {
+			return response{OK: false, Code: "POLICY_VIOLATION", Message: perr.Error(), Data: map[string]any{"violations": perr.Violations}}
+		}
+		return response{OK: false, Code: "POLICY_INVALID", Message: "policy.json is invalid"}
+	}
+
 	passwordBytes := []byte(req.Password)
 	defer zeroize(passwordBytes)
 	defer zeroizeString(&req.Password)
@@ -564,20 +709,233 @@ func handleSaveCredential(req saveCredentialRequest) response {
 		return response{OK: false, Code: "DB_ERROR", Message: "database unavailable"}
 	}
 
-	salt, blob, err := vault.EncryptEntryPassword(mek, req.DomainETLD1, req.Username, "password", req.Password)
+	keys, err := vault.DeriveMetaKeys(mek)
+	if err != nil {
+		return response{OK: false, Code: "INTERNAL"}
+	}
+	defer keys.Wipe()
+	if err := dbpkg.MigrateMetadata(database, keys); err != nil {
+		return response{OK: false, Code: "DB_ERROR", Message: "database unavailable"}
+	}
+
+	hdr, err := store.LoadVaultHeader(store.Paths{Dir: dir})
+	if err != nil {
+		return response{OK: false, Code: "INTERNAL"}
+	}
+	suite := hdr.EntrySuite()
+
+	plain, format, err := vault.EncodePayload(vault.EntryPayload{Password: req.Password})
+	if err != nil {
+		return response{OK: false, Code: "ENCRYPT_FAILED"}
+	}
+	defer zeroizeString(&plain)
+
+	salt, blob, err := vault.EncryptEntryPassword(mek, suite, req.DomainETLD1, req.Username, "password", plain)
 	if err != nil {
 		return response{OK: false, Code: "ENCRYPT_FAILED"}
 	}
 
-	id, err := dbpkg.InsertEntry(database, req.DomainETLD1, req.Username, "password", salt, blob)
+	id, err := dbpkg.InsertEntry(database, keys, req.DomainETLD1, req.Username, "password", suite, format, salt, blob)
 	if err != nil {
+		if errors.Is(err, dbpkg.ErrEntryInTrash) {
+			return response{OK: false, Code: "IN_TRASH", Message: "credential is in the vault trash"}
+		}
 		return response{OK: false, Code: "DB_ERROR", Message: "database unavailable"}
 	}
 
 	zeroize(salt)
 	zeroize(blob)
 
-	return response{OK: true, Data: map[string]any{"saved": true, "id": id}}
+	data := map[string]any{"saved": true, "id": id}
+	if len(warnings) > 0 {
+		data["policyWarnings"] = warnings
+	}
+	return response{OK: true, Data: data}
+}
+
+// handleGeneratePassword generates a password or passphrase for a signup or
+// change-password form.
+//
+// Args:
+//
+//	req: request containing session token, optional eTLD+1, the form field's
+//	     passwordrules and maxlength attributes, and optional length or passphrase words.
+//
+// Returns:
+//
+//	response: success includes the secret and its entropy in bits; RULES_INVALID when the
+//	          page's rules do not parse, GENERATE_FAILED when no secret satisfies them.
+//
+// Behavior:
+//  1. Validates the session token; the vault directory comes from the session.
+//  2. Narrows the default options by the site-rules.json rule for the eTLD+1 and the
+//     password policy, then by the page's passwordrules and maxlength.
+//  3. Nothing is stored; the extension saves the secret with saveCredential once the form
+//     is submitted.
+func handleGeneratePassword(req generatePasswordRequest) response {
+	mek, dir, err := sess.Validate(req.SessionToken, req.Nonce)
+	if err != nil {
+		return sessionErrorResponse(err)
+	}
+	zeroize(mek)
+
+	var rules []krypto.SiteRule
+	r, ok, err := store.GeneratorRule(store.Paths{Dir: dir}, req.DomainETLD1)
+	if err != nil {
+		return response{OK: false, Code: "RULES_INVALID", Message: "site-rules.json or policy.json is invalid"}
+	}
+	if ok {
+		rules = append(rules, r)
+	}
+	if req.Rules != "" {
+		r, err := krypto.ParsePasswordRules(req.Rules)
+		if err != nil {
+			return response{OK: false, Code: "RULES_INVALID", Message: err.Error()}
+		}
+		rules = append(rules, r)
+	}
+	if req.MaxLength > 0 {
+		rules = append(rules, krypto.SiteRule{MaxLength: req.MaxLength})
+	}
+
+	var gen krypto.Generated
+	if req.Passphrase {
+		opts := krypto.DefaultPassphraseOptions()
+		if req.Words > 0 {
+			opts.Words = req.Words
+		}
+		gen, err = krypto.GeneratePassphrase(opts)
+		for _, r := range rules {
+			if err == nil && r.MaxLength > 0 && len(gen.Secret) > r.MaxLength {
+				err = errors.New("passphrase exceeds the field's maximum length")
+			}
+		}
+	} else {
+		opts := krypto.DefaultPasswordOptions()
+		if req.Length > 0 {
+			opts.Length = req.Length
+		}
+		for _, r := range rules {
+			opts = opts.Apply(r)
+		}
+		gen, err = krypto.GeneratePassword(opts)
+	}
+	if err != nil {
+		return response{OK: false, Code: "GENERATE_FAILED", Message: err.Error()}
+	}
+	return response{OK: true, Data: map[string]any{"password": gen.Secret, "entropyBits": gen.EntropyBits}}
+}
+
+// handleGetTOTP returns the current one-time code for an account so the extension can
+// fill the OTP field that follows the password form.
+//
+// Args:
+//
+//	req: request containing session token, site metadata, optional page URL and the
+//	     username that was filled; with no username the first TOTP key stored for the
+//	     site that the page matches is used.
+//
+// Returns:
+//
+//	response: success includes the code, the seconds it stays valid, its digits and
+//	          period; NOT_FOUND when no TOTP key is stored or the page does not match the
+//	          account, TOTP_INVALID when the stored key does not produce codes.
+//
+// Behavior:
+//  1. Validates the session token and applies the same domain policy as getCredentials.
+//  2. Loads the account's TOTP entry, under the eTLD+1 or a domain grouped with it, and
+//     keeps it only when the match mode of the account's password entry accepts the
+//     page, as getCredentials would; an account without a password entry matches on
+//     its website.
+//  3. Decrypts the otpauth URI and derives the code; the secret itself never leaves the host.
+func handleGetTOTP(req getTOTPRequest) response {
+	mek, dir, err := sess.Validate(req.SessionToken, req.Nonce)
+	if err != nil {
+		return sessionErrorResponse(err)
+	}
+	defer zeroize(mek)
+
+	if req.DomainETLD1 == "" || req.ExactHost == "" {
+		return response{OK: false, Code: "BAD_REQUEST"}
+	}
+
+	accept, bad := pageMatcher(req.DomainETLD1, req.ExactHost, req.URL, req.RequireExactHost)
+	if bad != nil {
+		return *bad
+	}
+
+	database, keys, bad := openSessionDB(dir, mek)
+	if bad != nil {
+		return *bad
+	}
+	defer dbpkg.Close(database)
+	defer keys.Wipe()
+
+	// A TOTP entry is returned only where the account's password entry would be filled.
+	allowed := func(row *dbpkg.EntryRow) bool {
+		rule, ok := totpRule(database, mek, keys, row)
+		return ok && accept(rule)
+	}
+
+	var row *dbpkg.EntryRow
+	for _, site := range domaincheck.Equivalents(req.DomainETLD1) {
+		if strings.TrimSpace(req.Username) != "" {
+			found, err := dbpkg.GetTOTPBySiteAndUser(database, keys, site, req.Username)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return response{OK: false, Code: "DB_ERROR", Message: "database unavailable"}
+			}
+			if err == nil && allowed(found) {
+				row = found
+			}
+		} else {
+			rows, err := dbpkg.GetTOTPByWebsite(database, keys, site)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return response{OK: false, Code: "DB_ERROR", Message: "database unavailable"}
+			}
+			for i := range rows {
+				if allowed(&rows[i]) {
+					row = &rows[i]
+					break
+				}
+			}
+		}
+		if row != nil {
+			break
+		}
+	}
+	if row == nil {
+		return response{OK: false, Code: "NOT_FOUND"}
+	}
+
+	plaintext, _, _, err := vault.DecryptEntryPassword(mek, row.Suite, row.Website, row.Username, row.Type, row.Salt, row.EncryptedPass)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "passwordmanager-host: entry %d does not decrypt; run pm doctor\n", row.ID)
+		return response{OK: false, Code: "TOTP_INVALID"}
+	}
+	payload, err := vault.DecodePayload(row.Format, plaintext)
+	zeroizeString(&plaintext)
+	if err != nil {
+		return response{OK: false, Code: "TOTP_INVALID"}
+	}
+	key, err := krypto.ParseOTPAuthURI(payload.Password)
+	zeroizeString(&payload.Password)
+	if err != nil {
+		return response{OK: false, Code: "TOTP_INVALID"}
+	}
+	defer zeroize(key.Secret)
+
+	now := time.Now()
+	code, err := key.Code(now)
+	if err != nil {
+		return response{OK: false, Code: "TOTP_INVALID"}
+	}
+	return response{OK: true, Data: map[string]any{
+		"username":         row.Username,
+		"code":             code,
+		"remainingSeconds": int(key.Remaining(now) / time.Second),
+		"digits":           key.Digits,
+		"period":           key.Period,
+	}}
 }
 
 // readFrame consumes a native messaging frame from stdin.
@@ -611,24 +969,6 @@ func readFrame(r *bufio.Reader) ([]byte, error) {
 	return payload, nil
 }
 
-func currentUserIdentifier() string {
-	if usr, err := user.Current(); err == nil && usr != nil {
-		if usr.Uid != "" {
-			return usr.Uid
-		}
-		if usr.Username != "" {
-			return usr.Username
-		}
-	}
-	if val := os.Getenv("USER"); val != "" {
-		return val
-	}
-	if val := os.Getenv("USERNAME"); val != "" {
-		return val
-	}
-	return ""
-}
-
 // writeFrame emits a response using Chrome's native messaging framing.
 //
 // Args:
@@ -660,29 +1000,6 @@ func writeFrame(w *bufio.Writer, resp response) error {
 	return w.Flush()
 }
 
-// generateToken creates a cryptographically secure session token.
-//
-// Args:
-//
-//	None.
-//
-// Returns:
-//
-//	string: base64-encoded 256-bit token.
-//	error: non-nil when the random source fails.
-//
-// Behavior:
-//  1. Allocates a 32-byte buffer.
-//  2. Fills the buffer using crypto/rand.Read.
-//  3. Base64-encodes the buffer for JSON-safe transport.
-func generateToken() (string, error) {
-	buf := make([]byte, 32)
-	if _, err := rand.Read(buf); err != nil {
-		return "", err
-	}
-	return base64.StdEncoding.EncodeToString(buf), nil //Encode it into ascii to avoid encoding issues in json responses
-}
-
 func zeroize(buf []byte) {
 	for i := range buf {
 		buf[i] = 0
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"database/sql"
+	"errors"
 	"net/url"
 	"strings"
 	"unicode"
@@ -8,13 +10,21 @@ import (
 	"github.com/Zamiell/confusables"
 	"golang.org/x/net/idna"
 	"golang.org/x/net/publicsuffix"
+
+	dbpkg "github.com/Hussein-Mazeh/PasswordManager/internal/db"
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+	"github.com/Hussein-Mazeh/PasswordManager/native-host/domaincheck"
 )
 
+// phishingCheckRequest carries the page to inspect. The session fields are optional: with
+// them the check also applies the match modes of the stored entries.
 type phishingCheckRequest struct {
-	Type       string `json:"type"`
-	URL        string `json:"url"`
-	SavedETLD1 string `json:"savedEtld1"`
-	ExactHost  string `json:"exactHost"`
+	sessionRequest
+	URL              string `json:"url"`
+	SavedETLD1       string `json:"savedEtld1"`
+	ExactHost        string `json:"exactHost"`
+	Username         string `json:"username,omitempty"`         // restricts the entries checked to one account
+	RequireExactHost bool   `json:"requireExactHost,omitempty"` // match mode for entries that have none
 }
 
 type phishingVerdict struct {
@@ -27,20 +37,119 @@ type phishingVerdict struct {
 //
 // Args:
 //
-//	req: native messaging payload containing the URL under inspection and stored site metadata.
+//	req: native messaging payload containing the URL under inspection, stored site
+//	     metadata and, optionally, a session token and the account being filled.
 //
 // Returns:
 //
-//	response: JSON-serializable envelope containing the phishingVerdict.
+//	response: JSON-serializable envelope containing the phishingVerdict; session errors
+//	          when a session token is sent and does not validate.
 //
 // Behavior:
 //  1. Delegates to evaluatePhishingCheck with the supplied parameters.
-//  2. Wraps the resulting verdict in a successful response for the caller.
+//  2. With a session token, also applies the match modes of the stored entries via
+//     entryModeReasons, which can only add reasons to the verdict.
+//  3. Wraps the resulting verdict in a successful response for the caller.
 func handlePhishingCheck(req phishingCheckRequest) response {
 	verdict := evaluatePhishingCheck(req.URL, req.SavedETLD1, req.ExactHost)
+	if req.SessionToken == "" {
+		return response{OK: true, Data: verdict}
+	}
+
+	mek, dir, err := sess.Validate(req.SessionToken, req.Nonce)
+	if err != nil {
+		return sessionErrorResponse(err)
+	}
+	defer zeroize(mek)
+
+	etld1 := strings.ToLower(strings.TrimSpace(req.SavedETLD1))
+	if etld1 == "" {
+		etld1 = verdict.ETLD1
+	}
+	if etld1 == "" {
+		return response{OK: true, Data: verdict}
+	}
+	database, keys, bad := openSessionDB(dir, mek)
+	if bad != nil {
+		return *bad
+	}
+	defer dbpkg.Close(database)
+	defer keys.Wipe()
+
+	reasons, err := entryModeReasons(database, mek, keys, etld1, req.Username, req.URL, req.RequireExactHost)
+	if err != nil {
+		return response{OK: false, Code: "DB_ERROR", Message: "database unavailable"}
+	}
+	if len(reasons) > 0 {
+		verdict.Reasons = append(verdict.Reasons, reasons...)
+		verdict.OK = false
+	}
 	return response{OK: true, Data: verdict}
 }
 
+// entryModeReasons applies the match modes of the entries stored for etld1, and the
+// domains grouped with it, to rawURL.
+//
+// Args:
+//
+//	database: open vault database of the session.
+//	mek: session MEK, to decrypt the entries' rules.
+//	keys: metadata keys for the blind-index lookups.
+//	etld1: eTLD+1 the entries are stored under.
+//	username: account being filled, or "" for every account of the site.
+//	rawURL: full URL of the page requesting autofill.
+//	requireExactHost: selects the mode of entries that have none.
+//
+// Returns:
+//
+//	[]string: nil when no entry is stored or one accepts the page; otherwise MATCH_NEVER
+//	          when every entry is set to never, URL_MISMATCH when not.
+//	error: non-nil when the lookup fails.
+//
+// Behavior:
+//  1. Resolves entries without a mode the way getCredentials does.
+//  2. An entry that does not decrypt counts as one that refuses the page.
+func entryModeReasons(database *dbpkg.DB, mek []byte, keys *vault.MetaKeys, etld1, username, rawURL string, requireExactHost bool) ([]string, error) {
+	accept := ruleMatcher(rawURL, requireExactHost)
+	found, never := 0, 0
+	for _, site := range domaincheck.Equivalents(etld1) {
+		var rows []dbpkg.EntryRow
+		if strings.TrimSpace(username) != "" {
+			row, err := dbpkg.GetEntryBySiteAndUser(database, keys, site, username)
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, *row)
+		} else {
+			var err error
+			if rows, err = dbpkg.GetEntryByWebsite(database, keys, site); err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return nil, err
+			}
+		}
+		for i := range rows {
+			found++
+			rule, ok := entryRule(mek, &rows[i])
+			if ok && accept(rule) {
+				return nil, nil
+			}
+			if ok && rule.Mode == vault.MatchNever {
+				never++
+			}
+		}
+	}
+	switch {
+	case found == 0:
+		return nil, nil
+	case never == found:
+		return []string{"MATCH_NEVER"}, nil
+	default:
+		return []string{"URL_MISMATCH"}, nil
+	}
+}
+
 // evaluatePhishingCheck inspects URL and stored metadata for XSS attacks.
 //
 // Args:
@@ -56,6 +165,8 @@ func handlePhishingCheck(req phishingCheckRequest) response {
 // Behavior:
 //  1. Parses the URL, capturing eTLD+1 via IDNA and publicsuffix helpers.
 //  2. Records reasons for failure (HTTP, eTLD mismatch, host mismatch, punycode, mixed scripts, confusables).
+//     An eTLD+1 in the same equivalent-domain group as savedETLD1 is trusted: it raises
+//     neither ETLD_MISMATCH nor CONFUSABLE.
 //  3. Returns a verdict where OK is true only when no reasons were recorded.
 func evaluatePhishingCheck(rawURL, savedETLD1, exactHost string) phishingVerdict {
 	var reasons []string
@@ -102,7 +213,8 @@ func evaluatePhishingCheck(rawURL, savedETLD1, exactHost string) phishingVerdict
 	}
 
 	saved := strings.ToLower(strings.TrimSpace(savedETLD1))
-	if saved != "" && etld1 != "" && !strings.EqualFold(saved, etld1) {
+	grouped := saved != "" && etld1 != "" && domaincheck.Equivalent(saved, etld1)
+	if saved != "" && etld1 != "" && !grouped {
 		reasons = append(reasons, "ETLD_MISMATCH")
 	}
 
@@ -118,7 +230,7 @@ func evaluatePhishingCheck(rawURL, savedETLD1, exactHost string) phishingVerdict
 		reasons = append(reasons, "MIXED_SCRIPT")
 	}
 
-	if saved != "" && etld1 != "" && looksConfusable(saved, etld1) {
+	if saved != "" && etld1 != "" && !grouped && looksConfusable(saved, etld1) {
 		reasons = append(reasons, "CONFUSABLE")
 	}
 
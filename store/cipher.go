@@ -0,0 +1,24 @@
+package store
+
+import (
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+)
+
+// SetCipherSuite records suite as the AEAD for newly written entries and re-seals the
+// header. Rows already in the database are not touched; see db.MigrateCipher.
+func SetCipherSuite(p Paths, hdr vault.VaultHeader, suite krypto.Suite, mek []byte) (vault.VaultHeader, error) {
+	if err := checkMutable(hdr); err != nil {
+		return hdr, err
+	}
+	if !suite.Valid() {
+		return hdr, krypto.ErrUnknownSuite
+	}
+
+	hdr.CipherSuite = suite
+
+	if err := saveSealedHeader(p, &hdr, mek); err != nil {
+		return hdr, err
+	}
+	return hdr, nil
+}
@@ -0,0 +1,256 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+)
+
+const domainGroupsFilename = "domain-groups.json"
+
+// ErrDomainGroupNotFound is returned when removing a custom group that does not exist.
+var ErrDomainGroupNotFound = errors.New("domain group not found")
+
+// DomainGroup is a set of registrable domains (eTLD+1) run by the same service, whose
+// credentials autofill on any of them.
+type DomainGroup struct {
+	Name    string   `json:"name"`
+	Domains []string `json:"domains"`
+	Builtin bool     `json:"-"`
+}
+
+// DomainGroups is the table of equivalent domains: the built-in groups followed by the
+// user's own.
+type DomainGroups []DomainGroup
+
+// builtinDomainGroups lists services known to sign in across several registrable domains.
+// Every domain of a group must be run by the same operator today; a domain that was sold
+// would hand that operator's credentials to a third party, so check ownership before
+// adding one.
+var builtinDomainGroups = []DomainGroup{
+	{Name: "amazon", Domains: []string{"amazon.com", "amazon.ca", "amazon.co.jp", "amazon.co.uk", "amazon.com.au", "amazon.com.br", "amazon.com.mx", "amazon.de", "amazon.es", "amazon.fr", "amazon.in", "amazon.it", "amazon.nl"}},
+	{Name: "apple", Domains: []string{"apple.com", "icloud.com"}},
+	{Name: "atlassian", Domains: []string{"atlassian.com", "atlassian.net", "bitbucket.org", "trello.com"}},
+	{Name: "ebay", Domains: []string{"ebay.com", "ebay.ca", "ebay.co.uk", "ebay.com.au", "ebay.de", "ebay.fr", "ebay.it"}},
+	{Name: "google", Domains: []string{"google.com", "gmail.com", "youtube.com", "google.co.uk", "google.de", "google.fr", "google.ca", "google.com.au"}},
+	{Name: "microsoft", Domains: []string{"microsoft.com", "live.com", "microsoftonline.com", "office.com", "office365.com", "outlook.com", "xbox.com"}},
+	{Name: "paypal", Domains: []string{"paypal.com", "paypal.me"}},
+}
+
+// BuiltinDomainGroups returns a copy of the groups that ship with pm.
+func BuiltinDomainGroups() DomainGroups {
+	out := make(DomainGroups, len(builtinDomainGroups))
+	for i, g := range builtinDomainGroups {
+		out[i] = DomainGroup{Name: g.Name, Domains: slices.Clone(g.Domains), Builtin: true}
+	}
+	return out
+}
+
+// DomainGroupsPath is the user's custom group file: $PM_DOMAIN_GROUPS when set,
+// otherwise domain-groups.json under the user configuration directory (~/.config/pm on
+// Linux). It is per user rather than per vault because the browser's phishing check
+// runs before any vault is unlocked.
+func DomainGroupsPath() (string, error) {
+	if path := os.Getenv("PM_DOMAIN_GROUPS"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("locate domain groups: %w", err)
+	}
+	return filepath.Join(dir, "pm", domainGroupsFilename), nil
+}
+
+// LoadDomainGroups returns the built-in groups followed by the custom ones. A missing
+// file adds none.
+func LoadDomainGroups() (DomainGroups, error) {
+	custom, err := loadCustomDomainGroups()
+	if err != nil {
+		return nil, err
+	}
+	return append(BuiltinDomainGroups(), custom...), nil
+}
+
+func loadCustomDomainGroups() (DomainGroups, error) {
+	path, err := DomainGroupsPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read domain groups: %w", err)
+	}
+	var groups DomainGroups
+	if err := json.Unmarshal(data, &groups); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	for i := range groups {
+		g, err := newDomainGroup(groups[i].Name, groups[i].Domains)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		groups[i] = g
+	}
+	return groups, nil
+}
+
+// newDomainGroup trims the name and reduces each domain to its eTLD+1, dropping duplicates.
+func newDomainGroup(name string, domains []string) (DomainGroup, error) {
+	g := DomainGroup{Name: strings.TrimSpace(name)}
+	if g.Name == "" {
+		return DomainGroup{}, errors.New("domain group needs a name")
+	}
+	for _, d := range domains {
+		site := vault.NormalizeSite(d)
+		if _, err := publicsuffix.EffectiveTLDPlusOne(site); err != nil {
+			return DomainGroup{}, fmt.Errorf("group %s: %q is not a registrable domain", g.Name, d)
+		}
+		if !slices.Contains(g.Domains, site) {
+			g.Domains = append(g.Domains, site)
+		}
+	}
+	if len(g.Domains) < 2 {
+		return DomainGroup{}, fmt.Errorf("group %s needs at least two domains", g.Name)
+	}
+	return g, nil
+}
+
+// AddDomainGroup creates the custom group name, or adds domains to it when it exists.
+// Names of built-in groups are refused.
+func AddDomainGroup(name string, domains []string) (DomainGroup, error) {
+	groups, err := loadCustomDomainGroups()
+	if err != nil {
+		return DomainGroup{}, err
+	}
+	name = strings.TrimSpace(name)
+	for _, b := range builtinDomainGroups {
+		if strings.EqualFold(b.Name, name) {
+			return DomainGroup{}, fmt.Errorf("%s is a built-in group", b.Name)
+		}
+	}
+
+	i := slices.IndexFunc(groups, func(g DomainGroup) bool { return strings.EqualFold(g.Name, name) })
+	if i >= 0 {
+		domains = append(slices.Clone(groups[i].Domains), domains...)
+		name = groups[i].Name
+	}
+	g, err := newDomainGroup(name, domains)
+	if err != nil {
+		return DomainGroup{}, err
+	}
+	if i >= 0 {
+		groups[i] = g
+	} else {
+		groups = append(groups, g)
+	}
+	return g, saveCustomDomainGroups(groups)
+}
+
+// RemoveDomainGroup deletes the custom group name or, with domains, only those domains;
+// a group left with fewer than two domains is deleted. It reports whether the group
+// still exists. Built-in groups cannot be removed.
+func RemoveDomainGroup(name string, domains []string) (bool, error) {
+	groups, err := loadCustomDomainGroups()
+	if err != nil {
+		return false, err
+	}
+	name = strings.TrimSpace(name)
+	for _, b := range builtinDomainGroups {
+		if strings.EqualFold(b.Name, name) {
+			return false, fmt.Errorf("%s is a built-in group and cannot be removed", b.Name)
+		}
+	}
+	i := slices.IndexFunc(groups, func(g DomainGroup) bool { return strings.EqualFold(g.Name, name) })
+	if i < 0 {
+		return false, ErrDomainGroupNotFound
+	}
+
+	kept := false
+	if len(domains) > 0 {
+		g := &groups[i]
+		for _, d := range domains {
+			site := vault.NormalizeSite(d)
+			j := slices.Index(g.Domains, site)
+			if j < 0 {
+				return false, fmt.Errorf("group %s does not contain %s", g.Name, site)
+			}
+			g.Domains = slices.Delete(g.Domains, j, j+1)
+		}
+		kept = len(g.Domains) >= 2
+	}
+	if !kept {
+		groups = slices.Delete(groups, i, i+1)
+	}
+	return kept, saveCustomDomainGroups(groups)
+}
+
+func saveCustomDomainGroups(groups DomainGroups) error {
+	path, err := DomainGroupsPath()
+	if err != nil {
+		return err
+	}
+	if groups == nil {
+		groups = DomainGroups{}
+	}
+	data, err := json.MarshalIndent(groups, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode domain groups: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create domain groups directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("write domain groups: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("install domain groups: %w", err)
+	}
+	return nil
+}
+
+// Equivalent reports whether the registrable domains a and b are the same or share a group.
+func (gs DomainGroups) Equivalent(a, b string) bool {
+	a, b = strings.ToLower(strings.TrimSpace(a)), strings.ToLower(strings.TrimSpace(b))
+	if a == "" || b == "" {
+		return false
+	}
+	if a == b {
+		return true
+	}
+	for _, g := range gs {
+		if slices.Contains(g.Domains, a) && slices.Contains(g.Domains, b) {
+			return true
+		}
+	}
+	return false
+}
+
+// Equivalents returns site followed by every other domain grouped with it.
+func (gs DomainGroups) Equivalents(site string) []string {
+	site = strings.ToLower(strings.TrimSpace(site))
+	out := []string{site}
+	for _, g := range gs {
+		if !slices.Contains(g.Domains, site) {
+			continue
+		}
+		for _, d := range g.Domains {
+			if !slices.Contains(out, d) {
+				out = append(out, d)
+			}
+		}
+	}
+	return out
+}
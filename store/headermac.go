@@ -0,0 +1,184 @@
+package store
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	dbpkg "github.com/Hussein-Mazeh/PasswordManager/internal/db"
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+)
+
+const headerMACInfo = "header-mac-v1"
+
+// ErrHeaderTampered indicates header.json was modified outside the password manager:
+// its MAC is missing or does not match the contents.
+var ErrHeaderTampered = errors.New("vault header failed integrity check")
+
+// ComputeHeaderMAC returns the base64 HMAC-SHA256 of every header field except MAC itself,
+// keyed with HKDF(mek, "header-mac-v1").
+func ComputeHeaderMAC(hdr vault.VaultHeader, mek []byte) (string, error) {
+	if len(mek) != 32 {
+		return "", errors.New("invalid MEK length")
+	}
+
+	hdr.MAC = ""
+	data, err := json.Marshal(hdr)
+	if err != nil {
+		return "", fmt.Errorf("encode header: %w", err)
+	}
+
+	key, err := krypto.HKDFSHA256(mek, nil, []byte(headerMACInfo), 32)
+	if err != nil {
+		return "", fmt.Errorf("derive header mac key: %w", err)
+	}
+	defer zeroize(key)
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// VerifyHeaderMAC checks the header MAC with the unwrapped MEK. Headers written before
+// MACs existed (version < HeaderVersion, no MAC) pass and are sealed on the next save;
+// callers with the vault directory must also apply CheckHeaderSealed, which refuses
+// such a header once vault.db records that the vault was sealed.
+func VerifyHeaderMAC(hdr vault.VaultHeader, mek []byte) error {
+	if hdr.MAC == "" {
+		if hdr.Version < vault.HeaderVersion {
+			return nil
+		}
+		return ErrHeaderTampered
+	}
+
+	want, err := ComputeHeaderMAC(hdr, mek)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(want), []byte(hdr.MAC)) {
+		return ErrHeaderTampered
+	}
+	return nil
+}
+
+// CheckHeaderSealed fails with ErrHeaderTampered when hdr has no MAC although vault.db
+// in p records that the header was sealed: stripping the MAC and lowering the version
+// would otherwise pass as a header from before MACs existed. It needs no key, so load
+// paths and backup validation apply it before trusting the header. vault.db is opened
+// only for a header without a MAC.
+//
+// The marker only shows that the vault was sealed; it cannot prove that it was not.
+// Someone who can write both header.json and vault.db can delete the marker together
+// with the MAC, and for a vault that was never rotated nothing else in vault.db shows
+// that the header was sealed, so the header passes as a pre-MAC one. The header MAC
+// guards against edits to header.json alone, not against an attacker who controls every
+// vault file; such an attacker still cannot unwrap the MEK or read entries.
+func CheckHeaderSealed(p Paths, hdr vault.VaultHeader) error {
+	if hdr.MAC != "" {
+		return nil
+	}
+	sealed, err := headerSealed(p)
+	if err != nil {
+		return err
+	}
+	if sealed {
+		return ErrHeaderTampered
+	}
+	return nil
+}
+
+// headerSealed reports whether vault.db shows that the header was sealed: it carries
+// the seal marker or a MEK check value. Only a rotation writes the check value, and
+// every version that rotates also seals headers, so it still counts when the marker has
+// been deleted. The marker itself is checked against the MEK by markHeaderSealed on
+// every unlock. A vault without a database yet has neither.
+func headerSealed(p Paths) (bool, error) {
+	if _, err := os.Stat(p.DatabasePath()); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("stat vault database: %w", err)
+	}
+	database, err := dbpkg.Open(p.DatabasePath())
+	if err != nil {
+		return false, err
+	}
+	defer dbpkg.Close(database)
+	if sealed, err := dbpkg.HeaderSealed(database); err != nil || sealed {
+		return sealed, err
+	}
+	return dbpkg.HasMEKCheck(database)
+}
+
+// markHeaderSealed records in vault.db that the header carries a MAC under mek, unless
+// the marker is already there. A vault without a database yet gets one, so the marker
+// exists from the first unlock of a new vault.
+func markHeaderSealed(p Paths, mek []byte) error {
+	database, err := dbpkg.Open(p.DatabasePath())
+	if err != nil {
+		return err
+	}
+	defer dbpkg.Close(database)
+
+	if ok, err := dbpkg.HeaderSealedBy(database, mek); err != nil || ok {
+		return err
+	}
+	if ok, err := dbpkg.HasVaultMeta(database); err != nil {
+		return err
+	} else if !ok {
+		if err := dbpkg.Migrate(database); err != nil {
+			return fmt.Errorf("initialise vault database: %w", err)
+		}
+	}
+	return dbpkg.MarkHeaderSealed(database, mek)
+}
+
+// saveSealedHeader bumps the header to the current version, refreshes its timestamps,
+// recomputes the MAC, and saves header.json. hdr is updated in place.
+func saveSealedHeader(p Paths, hdr *vault.VaultHeader, mek []byte) error {
+	hdr.Version = vault.HeaderVersion
+	touchHeader(hdr)
+
+	mac, err := ComputeHeaderMAC(*hdr, mek)
+	if err != nil {
+		return err
+	}
+	hdr.MAC = mac
+
+	if err := SaveVaultHeader(p, *hdr); err != nil {
+		return fmt.Errorf("save header: %w", err)
+	}
+	return markHeaderSealed(p, mek)
+}
+
+// verifyUnwrapped runs the MAC check after a successful unwrap and seals legacy headers
+// so that later edits are detected. A header without a MAC is sealed only while vault.db
+// has no seal marker; the marker is recorded for vaults sealed before it existed. On
+// failure the MEK is zeroized.
+func verifyUnwrapped(p Paths, hdr *vault.VaultHeader, mek []byte) error {
+	if err := CheckHeaderSealed(p, *hdr); err != nil {
+		zeroize(mek)
+		return err
+	}
+	if err := VerifyHeaderMAC(*hdr, mek); err != nil {
+		zeroize(mek)
+		return err
+	}
+	if hdr.MAC == "" {
+		if err := saveSealedHeader(p, hdr, mek); err != nil {
+			zeroize(mek)
+			return fmt.Errorf("seal legacy header: %w", err)
+		}
+		return nil
+	}
+	if err := markHeaderSealed(p, mek); err != nil {
+		zeroize(mek)
+		return fmt.Errorf("record header seal: %w", err)
+	}
+	return nil
+}
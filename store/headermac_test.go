@@ -0,0 +1,150 @@
+package store
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	dbpkg "github.com/Hussein-Mazeh/PasswordManager/internal/db"
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+)
+
+// newSealedVault writes a sealed header with one master slot and a migrated vault.db.
+func newSealedVault(t *testing.T, password string) Paths {
+	t.Helper()
+	p := Paths{Dir: t.TempDir()}
+
+	database, err := dbpkg.Open(p.DatabasePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dbpkg.Migrate(database); err != nil {
+		t.Fatal(err)
+	}
+	dbpkg.Close(database)
+
+	mek := make([]byte, 32)
+	salt := make([]byte, krypto.SaltLengthBytes)
+	rand.Read(mek)
+	rand.Read(salt)
+	kdf := vault.NewArgon2KDFConfig(krypto.Argon2Params{MemoryMB: 8, Time: 1, Parallelism: 1, SaltLen: krypto.SaltLengthBytes, KeyLen: 32})
+	pdk, err := DerivePassphraseKey(kdf, []byte(password), salt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slot, err := WrapKeySlot(MasterSlotLabel, kdf, salt, pdk, mek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr := vault.VaultHeader{Version: vault.HeaderVersion, User: "u", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if _, _, err := AddKeySlot(p, hdr, slot, mek); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// stripMAC rewrites header.json as a pre-MAC header would look.
+func stripMAC(t *testing.T, p Paths) {
+	t.Helper()
+	hdr, err := LoadVaultHeader(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr.MAC = ""
+	hdr.Version = vault.KeySlotHeaderVersion
+	if err := SaveVaultHeader(p, hdr); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStrippedHeaderMACIsRefused(t *testing.T) {
+	p := newSealedVault(t, "master")
+	stripMAC(t, p)
+
+	if _, _, _, err := UnlockMEK(p, []byte("master"), nil); !errors.Is(err, ErrHeaderTampered) {
+		t.Fatalf("UnlockMEK err = %v, want ErrHeaderTampered", err)
+	}
+	hdr, err := LoadVaultHeader(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.MAC != "" {
+		t.Fatal("stripped header was sealed again")
+	}
+	if err := CheckHeaderSealed(p, hdr); !errors.Is(err, ErrHeaderTampered) {
+		t.Fatalf("CheckHeaderSealed err = %v, want ErrHeaderTampered", err)
+	}
+}
+
+func TestLegacyHeaderIsSealedOnce(t *testing.T) {
+	p := newSealedVault(t, "master")
+
+	// A vault sealed before the marker existed: MAC present, marker absent.
+	raw, err := sql.Open("sqlite", p.DatabasePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := raw.Exec(`DELETE FROM vault_meta`); err != nil {
+		t.Fatal(err)
+	}
+	raw.Close()
+	stripMAC(t, p)
+
+	// Without the marker the header is taken as one from before MACs and sealed.
+	mek, hdr, _, err := UnlockMEK(p, []byte("master"), nil)
+	if err != nil {
+		t.Fatalf("UnlockMEK: %v", err)
+	}
+	if hdr.MAC == "" || hdr.Version != vault.HeaderVersion {
+		t.Fatalf("legacy header not sealed: version %d, MAC %q", hdr.Version, hdr.MAC)
+	}
+	sealed, err := headerSealed(p)
+	if err != nil || !sealed {
+		t.Fatalf("seal marker not recorded: %v, %v", sealed, err)
+	}
+	if _, err := LoadHeaderForMEK(p, mek); err != nil {
+		t.Fatalf("LoadHeaderForMEK: %v", err)
+	}
+
+	// From now on the same downgrade fails.
+	stripMAC(t, p)
+	if _, err := LoadHeaderForMEK(p, mek); !errors.Is(err, ErrHeaderTampered) {
+		t.Fatalf("LoadHeaderForMEK err = %v, want ErrHeaderTampered", err)
+	}
+	if _, _, _, err := UnlockMEK(p, []byte("master"), nil); !errors.Is(err, ErrHeaderTampered) {
+		t.Fatalf("UnlockMEK err = %v, want ErrHeaderTampered", err)
+	}
+}
+
+func TestStrippedHeaderOfRotatedVaultIsRefused(t *testing.T) {
+	p := newSealedVault(t, "master")
+
+	// A rotated vault whose seal marker was deleted along with the MAC: the MEK check
+	// value that the rotation left still shows the header was sealed.
+	raw, err := sql.Open("sqlite", p.DatabasePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := raw.Exec(`DELETE FROM vault_meta`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := raw.Exec(`INSERT INTO vault_meta (key, value) VALUES ('mek_check', x'00')`); err != nil {
+		t.Fatal(err)
+	}
+	raw.Close()
+	stripMAC(t, p)
+
+	if _, _, _, err := UnlockMEK(p, []byte("master"), nil); !errors.Is(err, ErrHeaderTampered) {
+		t.Fatalf("UnlockMEK err = %v, want ErrHeaderTampered", err)
+	}
+	hdr, err := LoadVaultHeader(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckHeaderSealed(p, hdr); !errors.Is(err, ErrHeaderTampered) {
+		t.Fatalf("CheckHeaderSealed err = %v, want ErrHeaderTampered", err)
+	}
+}
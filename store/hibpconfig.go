@@ -0,0 +1,105 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Hussein-Mazeh/PasswordManager/auth"
+)
+
+const hibpConfigFilename = "hibp.json"
+
+// Breach checkers selectable in hibp.json.
+const (
+	HIBPCheckerOnline = "online" // the HIBP range API (default)
+	HIBPCheckerFile   = "file"   // a local sorted SHA-1 list
+	HIBPCheckerFilter = "filter" // a Bloom filter from pm hibp build-filter
+	HIBPCheckerOff    = "off"
+)
+
+// What to do when the breach check itself fails.
+const (
+	HIBPOnErrorOpen   = "open"   // accept the password (default)
+	HIBPOnErrorClosed = "closed" // refuse it
+)
+
+// HIBPConfig chooses how passwords are checked against breach data. It is read from
+// hibp.json in the vault directory, e.g. {"checker": "filter", "path": "pwned.bloom", "on_error": "closed"}.
+type HIBPConfig struct {
+	Checker string `json:"checker"`
+	Path    string `json:"path,omitempty"`     // dataset for file and filter; relative to the vault directory
+	OnError string `json:"on_error,omitempty"` // open or closed
+}
+
+// HIBPConfigPath resolves the optional breach-check configuration file.
+func (p Paths) HIBPConfigPath() string {
+	return filepath.Join(p.Dir, hibpConfigFilename)
+}
+
+// LoadHIBPConfig reads hibp.json. A missing file yields the online checker failing open,
+// so setting a master password works on machines without network access.
+func LoadHIBPConfig(p Paths) (HIBPConfig, error) {
+	cfg := HIBPConfig{Checker: HIBPCheckerOnline, OnError: HIBPOnErrorOpen}
+	data, err := os.ReadFile(p.HIBPConfigPath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return cfg, nil
+		}
+		return HIBPConfig{}, fmt.Errorf("read hibp config: %w", err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return HIBPConfig{}, fmt.Errorf("decode %s: %w", hibpConfigFilename, err)
+	}
+
+	switch cfg.Checker {
+	case "":
+		cfg.Checker = HIBPCheckerOnline
+	case HIBPCheckerOnline, HIBPCheckerOff:
+	case HIBPCheckerFile, HIBPCheckerFilter:
+		if cfg.Path == "" {
+			return HIBPConfig{}, fmt.Errorf("%s: checker %q needs a path", hibpConfigFilename, cfg.Checker)
+		}
+		if !filepath.IsAbs(cfg.Path) {
+			cfg.Path = filepath.Join(p.Dir, cfg.Path)
+		}
+	default:
+		return HIBPConfig{}, fmt.Errorf("%s: unknown checker %q (use online, file, filter or off)", hibpConfigFilename, cfg.Checker)
+	}
+	switch cfg.OnError {
+	case "":
+		cfg.OnError = HIBPOnErrorOpen
+	case HIBPOnErrorOpen, HIBPOnErrorClosed:
+	default:
+		return HIBPConfig{}, fmt.Errorf("%s: on_error must be open or closed, not %q", hibpConfigFilename, cfg.OnError)
+	}
+	return cfg, nil
+}
+
+// BreachChecker returns the configured checker, or nil when checking is off.
+func (c HIBPConfig) BreachChecker() auth.BreachChecker {
+	switch c.Checker {
+	case HIBPCheckerFile:
+		return auth.FileChecker{Path: c.Path}
+	case HIBPCheckerFilter:
+		return auth.FilterChecker{Path: c.Path}
+	case HIBPCheckerOff:
+		return nil
+	}
+	return auth.OnlineChecker{}
+}
+
+// ConfigureBreachCheck points the breach check in opts at the checker hibp.json selects
+// for the vault at p, with its fail-open or fail-closed choice.
+func ConfigureBreachCheck(p Paths, opts *auth.ValidateOptions) error {
+	cfg, err := LoadHIBPConfig(p)
+	if err != nil {
+		return err
+	}
+	opts.Breach = cfg.BreachChecker()
+	opts.EnableHIBP = opts.Breach != nil
+	opts.BreachFailOpen = cfg.OnError == HIBPOnErrorOpen
+	return nil
+}
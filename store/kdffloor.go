@@ -0,0 +1,57 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+)
+
+// SetKDFFloor raises the minimum Argon2id cost for the vault's passphrase slots to params
+// and re-seals the header. The floor never goes down: where params are weaker than
+// hdr.Argon2Floor(), the current floor is kept. Slots already weaker are rewrapped by
+// UpgradeSlotKDF on their next unlock.
+func SetKDFFloor(p Paths, hdr vault.VaultHeader, params krypto.Argon2Params, mek []byte) (vault.VaultHeader, error) {
+	if err := checkMutable(hdr); err != nil {
+		return hdr, err
+	}
+
+	hdr.KDFFloor = vault.NewArgon2KDFConfig(params.Stronger(hdr.Argon2Floor()))
+
+	if err := saveSealedHeader(p, &hdr, mek); err != nil {
+		return hdr, err
+	}
+	return hdr, nil
+}
+
+// UpgradeSlotKDF rewraps the slot secret opened with hdr.Argon2Floor() when its stored
+// Argon2id parameters are weaker, keeping its keyfile requirement. Every unlock path
+// calls it right after unlocking, since only then is the secret at hand. It returns hdr
+// unchanged when the slot already meets the floor.
+func UpgradeSlotKDF(p Paths, hdr vault.VaultHeader, slotID int, secret, keyfile, mek []byte) (vault.VaultHeader, error) {
+	slot, ok := hdr.Slot(slotID)
+	if !ok || slot.KDF.Name != vault.KDFArgon2id {
+		return hdr, nil
+	}
+	floor := hdr.Argon2Floor()
+	current := slot.KDF.Argon2Params()
+	if !current.Below(floor) {
+		return hdr, nil
+	}
+
+	params := current.Stronger(floor)
+	kdf := vault.NewArgon2KDFConfig(params)
+	kdf.Keyfile = slot.KDF.Keyfile
+	salt, err := krypto.NewRandomSalt(params.SaltLen)
+	if err != nil {
+		return hdr, fmt.Errorf("generate salt: %w", err)
+	}
+
+	pdk, err := DerivePassphraseKey(kdf, secret, salt, keyfile)
+	if err != nil {
+		return hdr, fmt.Errorf("derive PDK: %w", err)
+	}
+	defer zeroize(pdk)
+
+	return RewrapKeySlot(p, hdr, slotID, kdf, salt, pdk, mek)
+}
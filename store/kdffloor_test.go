@@ -0,0 +1,80 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+)
+
+func TestUpgradeSlotKDFRaisesSlotToFloor(t *testing.T) {
+	p := newSealedVault(t, "master")
+	mek, hdr, slotID, err := UnlockMEK(p, []byte("master"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	floor := krypto.DefaultArgon2Params()
+	floor.MemoryMB += 32
+	floor.Time++
+	if hdr, err = SetKDFFloor(p, hdr, floor, mek); err != nil {
+		t.Fatalf("SetKDFFloor: %v", err)
+	}
+
+	hdr, err = UpgradeSlotKDF(p, hdr, slotID, []byte("master"), nil, mek)
+	if err != nil {
+		t.Fatalf("UpgradeSlotKDF: %v", err)
+	}
+	slot, _ := hdr.Slot(slotID)
+	got := slot.KDF.Argon2Params()
+	if got.MemoryMB != floor.MemoryMB || got.Time != floor.Time {
+		t.Fatalf("slot params %+v, want the floor %+v", got, floor)
+	}
+
+	// The rewrapped slot still opens, and is left alone from now on.
+	mek2, hdr2, _, err := UnlockMEK(p, []byte("master"), nil)
+	if err != nil {
+		t.Fatalf("unlock after upgrade: %v", err)
+	}
+	if string(mek2) != string(mek) {
+		t.Fatal("upgrade changed the MEK")
+	}
+	again, err := UpgradeSlotKDF(p, hdr2, slotID, []byte("master"), nil, mek2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := again.Slot(slotID); s.Salt != slot.Salt {
+		t.Fatal("slot at the floor was rewrapped again")
+	}
+}
+
+func TestSetKDFFloorNeverLowers(t *testing.T) {
+	p := newSealedVault(t, "master")
+	mek, hdr, _, err := UnlockMEK(p, []byte("master"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	strong := krypto.DefaultArgon2Params()
+	strong.MemoryMB += 32
+	strong.Time += 2
+	if hdr, err = SetKDFFloor(p, hdr, strong, mek); err != nil {
+		t.Fatalf("SetKDFFloor: %v", err)
+	}
+
+	// A second tune on a slower machine calibrates weaker parameters.
+	weak := krypto.DefaultArgon2Params()
+	weak.MemoryMB = 8
+	weak.Time = 1
+	if _, err = SetKDFFloor(p, hdr, weak, mek); err != nil {
+		t.Fatalf("SetKDFFloor: %v", err)
+	}
+
+	_, reloaded, _, err := UnlockMEK(p, []byte("master"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := reloaded.Argon2Floor()
+	if got.MemoryMB != strong.MemoryMB || got.Time != strong.Time {
+		t.Fatalf("floor after a weaker tune = %+v, want %+v", got, strong)
+	}
+}
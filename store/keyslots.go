@@ -0,0 +1,280 @@
+package store
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+)
+
+// MasterSlotLabel is the label given to the slot created when the master password is set.
+const MasterSlotLabel = "master password"
+
+var (
+	// ErrSlotNotFound indicates the requested key slot does not exist.
+	ErrSlotNotFound = errors.New("key slot not found")
+	// ErrLastSlot indicates an attempt to revoke the only remaining key slot.
+	ErrLastSlot = errors.New("cannot revoke the last key slot")
+	// ErrKeyfileRequired indicates the slot needs a keyfile and none was supplied.
+	ErrKeyfileRequired = errors.New("keyfile required")
+)
+
+// DerivePassphraseKey stretches secret with the Argon2id parameters in kdf and, when
+// kdf.Keyfile is set, mixes in the keyfile digest (see krypto.HashKeyfile). Callers
+// creating or rewrapping a slot use it so the PDK matches what DeriveSlotKey will compute.
+func DerivePassphraseKey(kdf vault.KDFConfig, secret, salt, keyfile []byte) ([]byte, error) {
+	if kdf.Name != vault.KDFArgon2id {
+		return nil, errors.New("unsupported kdf")
+	}
+	if kdf.Keyfile && len(keyfile) == 0 {
+		return nil, ErrKeyfileRequired
+	}
+
+	pdk, err := krypto.DeriveKeyArgon2id(secret, salt, kdf.Argon2Params())
+	if err != nil || !kdf.Keyfile {
+		return pdk, err
+	}
+	defer zeroize(pdk)
+	return krypto.MixKeyfile(pdk, keyfile)
+}
+
+// DeriveSlotKey runs the slot's KDF over secret (and keyfile, for slots that require
+// one), returning the PDK for that slot. keyfile is a digest from krypto.HashKeyfile
+// and is ignored by slots that do not require it.
+func DeriveSlotKey(slot vault.KeySlot, secret, keyfile []byte) ([]byte, error) {
+	salt, err := base64.StdEncoding.DecodeString(slot.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("decode slot salt: %w", err)
+	}
+	switch slot.KDF.Name {
+	case vault.KDFArgon2id:
+		return DerivePassphraseKey(slot.KDF, secret, salt, keyfile)
+	case vault.KDFRecovery:
+		return krypto.DeriveRecoveryKey(secret, salt)
+	default:
+		return nil, errors.New("unsupported kdf")
+	}
+}
+
+// WrapKeySlot wraps the MEK under pdk and returns an unsaved slot carrying the KDF
+// configuration and salt that produced pdk. The slot ID is assigned by AddKeySlot.
+func WrapKeySlot(label string, kdf vault.KDFConfig, salt, pdk, mek []byte) (vault.KeySlot, error) {
+	if len(pdk) != 32 {
+		return vault.KeySlot{}, errors.New("invalid PDK length")
+	}
+	if len(mek) != 32 {
+		return vault.KeySlot{}, errors.New("invalid MEK length")
+	}
+	if kdf.Name != vault.KDFArgon2id && kdf.Name != vault.KDFRecovery {
+		return vault.KeySlot{}, errors.New("unsupported kdf")
+	}
+
+	nonce, ciphertext, err := krypto.EncryptAESGCM(pdk, mek, headerMEKAAD)
+	if err != nil {
+		return vault.KeySlot{}, fmt.Errorf("wrap mek: %w", err)
+	}
+
+	return vault.KeySlot{
+		Label:      label,
+		CreatedAt:  time.Now().UTC(),
+		Salt:       base64.StdEncoding.EncodeToString(salt),
+		WrapNonce:  base64.StdEncoding.EncodeToString(nonce),
+		WrappedMEK: base64.StdEncoding.EncodeToString(ciphertext),
+		KDF:        kdf,
+	}, nil
+}
+
+// UnwrapKeySlot decrypts the MEK held by a single slot.
+func UnwrapKeySlot(slot vault.KeySlot, pdk []byte) ([]byte, error) {
+	if len(pdk) != 32 {
+		return nil, errors.New("invalid PDK length")
+	}
+	if slot.WrapNonce == "" || slot.WrappedMEK == "" {
+		return nil, ErrMEKNotWrapped
+	}
+
+	nonce, err := base64.StdEncoding.DecodeString(slot.WrapNonce)
+	if err != nil {
+		return nil, fmt.Errorf("decode wrap nonce: %w", err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(slot.WrappedMEK)
+	if err != nil {
+		return nil, fmt.Errorf("decode wrapped mek: %w", err)
+	}
+
+	mek, err := krypto.DecryptAESGCM(pdk, nonce, ciphertext, headerMEKAAD)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap mek: %w", err)
+	}
+	return mek, nil
+}
+
+// UnlockMEK tries secret against every key slot in turn and returns the MEK from the
+// first slot that opens, together with the header and the matching slot ID.
+//
+// Args:
+//
+//	p: vault paths locating header.json.
+//	secret: candidate unlock secret (master password, additional passphrase, ...).
+//	keyfile: keyfile digest from krypto.HashKeyfile, or nil when no keyfile was given.
+//
+// Returns:
+//
+//	[]byte: decrypted MEK; the caller must zeroize it.
+//	vault.VaultHeader: header as loaded from disk.
+//	int: ID of the slot that accepted the secret.
+//	error: ErrMEKNotWrapped when no slots exist, ErrNoMatchingSlot when none accept the secret,
+//	       ErrKeyfileRequired when only keyfile slots remain untried for lack of a keyfile,
+//	       ErrHeaderTampered when the header MAC does not match.
+//
+// Behavior:
+//  1. Loads (and if necessary upgrades) the header.
+//  2. Derives a PDK per slot with that slot's salt/KDF parameters and attempts to unwrap.
+//     Slots that require a keyfile are skipped when keyfile is nil.
+//  3. Zeroizes each PDK after use and stops at the first successful unwrap.
+//  4. Verifies the header MAC with the MEK, sealing headers that predate it.
+func UnlockMEK(p Paths, secret, keyfile []byte) ([]byte, vault.VaultHeader, int, error) {
+	hdr, err := LoadVaultHeader(p)
+	if err != nil {
+		return nil, hdr, -1, err
+	}
+	if err := CheckHeader(hdr); err != nil {
+		return nil, hdr, -1, err
+	}
+	if len(secret) == 0 {
+		return nil, hdr, -1, errors.New("secret is required")
+	}
+
+	skippedKeyfile := false
+	for _, slot := range hdr.KeySlots {
+		pdk, err := DeriveSlotKey(slot, secret, keyfile)
+		if err != nil {
+			if errors.Is(err, ErrKeyfileRequired) {
+				skippedKeyfile = true
+			}
+			continue
+		}
+		mek, err := UnwrapKeySlot(slot, pdk)
+		zeroize(pdk)
+		if err != nil {
+			continue
+		}
+		if err := verifyUnwrapped(p, &hdr, mek); err != nil {
+			return nil, hdr, -1, err
+		}
+		return mek, hdr, slot.ID, nil
+	}
+	if skippedKeyfile {
+		return nil, hdr, -1, ErrKeyfileRequired
+	}
+	return nil, hdr, -1, ErrNoMatchingSlot
+}
+
+// AddKeySlot assigns the next free ID to slot, appends it to the header, and saves header.json
+// sealed with a MAC keyed from mek.
+func AddKeySlot(p Paths, hdr vault.VaultHeader, slot vault.KeySlot, mek []byte) (vault.VaultHeader, int, error) {
+	if slot.WrapNonce == "" || slot.WrappedMEK == "" {
+		return hdr, -1, ErrMEKNotWrapped
+	}
+	if hdr.Pending != nil {
+		return hdr, -1, ErrRotationPending
+	}
+
+	slot.ID = hdr.NextSlotID()
+	hdr.KeySlots = append(append([]vault.KeySlot(nil), hdr.KeySlots...), slot)
+
+	if err := saveSealedHeader(p, &hdr, mek); err != nil {
+		return hdr, -1, err
+	}
+	return hdr, slot.ID, nil
+}
+
+// RewrapKeySlot replaces the secret protecting an existing slot (new salt, KDF, and wrap)
+// while keeping its ID and label.
+func RewrapKeySlot(p Paths, hdr vault.VaultHeader, id int, kdf vault.KDFConfig, salt, pdk, mek []byte) (vault.VaultHeader, error) {
+	if err := checkMutable(hdr); err != nil {
+		return hdr, err
+	}
+	hdr.KeySlots = append([]vault.KeySlot(nil), hdr.KeySlots...)
+	existing, ok := hdr.Slot(id)
+	if !ok {
+		return hdr, ErrSlotNotFound
+	}
+
+	replacement, err := WrapKeySlot(existing.Label, kdf, salt, pdk, mek)
+	if err != nil {
+		return hdr, fmt.Errorf("rewrap mek: %w", err)
+	}
+	replacement.ID = existing.ID
+	*existing = replacement
+
+	if err := saveSealedHeader(p, &hdr, mek); err != nil {
+		return hdr, err
+	}
+	return hdr, nil
+}
+
+// ListKeySlots loads header.json and returns its key slots.
+func ListKeySlots(p Paths) ([]vault.KeySlot, error) {
+	hdr, err := LoadVaultHeader(p)
+	if err != nil {
+		return nil, err
+	}
+	return hdr.KeySlots, nil
+}
+
+// RevokeKeySlot removes the slot with the given ID and saves header.json sealed with mek.
+// The last remaining slot cannot be revoked, since that would make the vault unopenable.
+func RevokeKeySlot(p Paths, hdr vault.VaultHeader, id int, mek []byte) (vault.VaultHeader, error) {
+	if err := checkMutable(hdr); err != nil {
+		return hdr, err
+	}
+	if _, ok := hdr.Slot(id); !ok {
+		return hdr, ErrSlotNotFound
+	}
+	if len(hdr.KeySlots) == 1 {
+		return hdr, ErrLastSlot
+	}
+
+	kept := make([]vault.KeySlot, 0, len(hdr.KeySlots)-1)
+	for _, slot := range hdr.KeySlots {
+		if slot.ID != id {
+			kept = append(kept, slot)
+		}
+	}
+	hdr.KeySlots = kept
+
+	if err := saveSealedHeader(p, &hdr, mek); err != nil {
+		return hdr, err
+	}
+	return hdr, nil
+}
+
+// checkMutable validates the header and refuses edits while a rotation is pending,
+// since those edits would be sealed with a MEK that is about to be replaced.
+func checkMutable(hdr vault.VaultHeader) error {
+	if err := CheckHeader(hdr); err != nil {
+		return err
+	}
+	if hdr.Pending != nil {
+		return ErrRotationPending
+	}
+	return nil
+}
+
+func touchHeader(hdr *vault.VaultHeader) {
+	now := time.Now().UTC()
+	if hdr.CreatedAt.IsZero() {
+		hdr.CreatedAt = now
+	}
+	hdr.UpdatedAt = now
+}
+
+func zeroize(buf []byte) {
+	for i := range buf {
+		buf[i] = 0
+	}
+}
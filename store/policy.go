@@ -0,0 +1,321 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Hussein-Mazeh/PasswordManager/auth"
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+)
+
+const policyFilename = "policy.json"
+
+// Enforcement modes for the policy's hibp and entries settings.
+const (
+	PolicyOff   = "off"
+	PolicyWarn  = "warn"
+	PolicyBlock = "block"
+)
+
+// Policy is the password policy for master passwords and, when Entries is not off,
+// for stored and generated entry passwords.
+type Policy struct {
+	MinLength       int
+	RequiredClasses krypto.CharClass
+	MinScore        int // zxcvbn score 0-4; 0 turns the score check off
+	BannedWords     []string
+	BanAccountNames bool          // ban the username and the site's name as well
+	MaxAge          time.Duration // age after which pm audit reports a password as old; 0 is off
+	HIBP            string        // off, warn or block
+	Entries         string        // off, warn or block; also whether generated passwords follow the policy
+}
+
+// policyFile is the JSON form of Policy. Settings left out keep their default.
+type policyFile struct {
+	MinLength       int      `json:"min_length"`
+	RequiredClasses []string `json:"required_classes"`
+	MinScore        int      `json:"min_score"`
+	BannedWords     []string `json:"banned_words"`
+	BanAccountNames bool     `json:"ban_account_names"`
+	MaxAge          string   `json:"max_age"`
+	HIBP            string   `json:"hibp"`
+	Entries         string   `json:"entries"`
+}
+
+var policyClasses = map[string]krypto.CharClass{
+	"lower":   krypto.ClassLower,
+	"upper":   krypto.ClassUpper,
+	"digit":   krypto.ClassDigit,
+	"special": krypto.ClassSymbol,
+}
+
+// DefaultPolicy matches the built-in master password rules: 12 characters, every
+// class, a zxcvbn score of 3 and a blocking breach check. Entry passwords are not checked.
+func DefaultPolicy() Policy {
+	return Policy{
+		MinLength:       12,
+		RequiredClasses: krypto.AllClasses,
+		MinScore:        3,
+		BanAccountNames: true,
+		MaxAge:          365 * 24 * time.Hour,
+		HIBP:            PolicyBlock,
+		Entries:         PolicyOff,
+	}
+}
+
+// PolicyPath resolves the vault's password policy file.
+func (p Paths) PolicyPath() string {
+	return filepath.Join(p.Dir, policyFilename)
+}
+
+// SystemPolicyPath is the machine-wide policy used when a vault has none: $PM_POLICY
+// when set, otherwise /etc/pm/policy.json (%ProgramData%\pm\policy.json on Windows).
+func SystemPolicyPath() string {
+	if path := os.Getenv("PM_POLICY"); path != "" {
+		return path
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("ProgramData"), "pm", policyFilename)
+	}
+	return filepath.Join("/etc/pm", policyFilename)
+}
+
+// LoadPolicy reads the vault's policy.json or, failing that, the system policy. With
+// neither it returns DefaultPolicy. An empty p.Dir skips the vault file.
+func LoadPolicy(p Paths) (Policy, error) {
+	var candidates []string
+	if p.Dir != "" {
+		candidates = append(candidates, p.PolicyPath())
+	}
+	candidates = append(candidates, SystemPolicyPath())
+
+	for _, path := range candidates {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return Policy{}, fmt.Errorf("read password policy: %w", err)
+		}
+		pol, err := parsePolicy(data)
+		if err != nil {
+			return Policy{}, fmt.Errorf("%s: %w", path, err)
+		}
+		return pol, nil
+	}
+	return DefaultPolicy(), nil
+}
+
+func parsePolicy(data []byte) (Policy, error) {
+	def := DefaultPolicy()
+	raw := policyFile{
+		MinLength:       def.MinLength,
+		RequiredClasses: []string{"lower", "upper", "digit", "special"},
+		MinScore:        def.MinScore,
+		BanAccountNames: def.BanAccountNames,
+		MaxAge:          "365d",
+		HIBP:            def.HIBP,
+		Entries:         def.Entries,
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return Policy{}, fmt.Errorf("decode: %w", err)
+	}
+
+	pol := Policy{
+		MinLength:       raw.MinLength,
+		MinScore:        raw.MinScore,
+		BannedWords:     raw.BannedWords,
+		BanAccountNames: raw.BanAccountNames,
+		HIBP:            raw.HIBP,
+		Entries:         raw.Entries,
+	}
+	if pol.MinLength < 1 || pol.MinLength > krypto.MaxPasswordLength {
+		return Policy{}, fmt.Errorf("min_length must be between 1 and %d", krypto.MaxPasswordLength)
+	}
+	if pol.MinScore < 0 || pol.MinScore > 4 {
+		return Policy{}, errors.New("min_score must be between 0 and 4")
+	}
+	for _, name := range raw.RequiredClasses {
+		class, ok := policyClasses[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return Policy{}, fmt.Errorf("unknown class %q in required_classes (use lower, upper, digit, special)", name)
+		}
+		pol.RequiredClasses |= class
+	}
+	age, err := ParseAge(raw.MaxAge)
+	if err != nil {
+		return Policy{}, fmt.Errorf("max_age: %w", err)
+	}
+	pol.MaxAge = age
+	for name, mode := range map[string]string{"hibp": pol.HIBP, "entries": pol.Entries} {
+		if mode != PolicyOff && mode != PolicyWarn && mode != PolicyBlock {
+			return Policy{}, fmt.Errorf("%s must be off, warn or block, not %q", name, mode)
+		}
+	}
+	return pol, nil
+}
+
+// ParseAge accepts Go durations plus a "d" suffix for whole days ("30d"); "0" is zero.
+func ParseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("%q is not a number of days", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, errors.New("must not be negative")
+	}
+	return d, nil
+}
+
+// ValidateOptions turns the policy into auth options for a password belonging to user
+// at site (either may be empty). The breach checker is not set; see PasswordOptions.
+func (pol Policy) ValidateOptions(user, site string) auth.ValidateOptions {
+	opts := auth.ValidateOptions{
+		EnableHIBP:     pol.HIBP != PolicyOff,
+		BreachWarnOnly: pol.HIBP == PolicyWarn,
+		MinLength:      pol.MinLength,
+		MinZXCVBNScore: pol.MinScore,
+		RequireClasses: pol.RequiredClasses,
+		BannedWords:    append([]string(nil), pol.BannedWords...),
+	}
+	if opts.MinZXCVBNScore == 0 {
+		opts.MinZXCVBNScore = -1
+	}
+	names := accountNames(user, site)
+	opts.UserInputs = names
+	if pol.BanAccountNames {
+		opts.BannedWords = append(opts.BannedWords, names...)
+	}
+	return opts
+}
+
+// accountNames returns the guessable words of an account: the username, its part before
+// any @, and the labels of the site's host other than www and the top-level domain.
+func accountNames(user, site string) []string {
+	var names []string
+	if user = strings.TrimSpace(user); user != "" {
+		names = append(names, user)
+		if local, _, ok := strings.Cut(user, "@"); ok && local != "" {
+			names = append(names, local)
+		}
+	}
+	if host := vault.NormalizeSite(site); host != "" {
+		labels := strings.Split(host, ".")
+		if len(labels) > 1 {
+			labels = labels[:len(labels)-1]
+		}
+		for _, l := range labels {
+			if l != "www" {
+				names = append(names, l)
+			}
+		}
+	}
+	return names
+}
+
+// PasswordOptions loads the policy for the vault at p and returns the auth options for
+// a password of user at site, with the breach checker hibp.json selects.
+func PasswordOptions(p Paths, user, site string) (Policy, auth.ValidateOptions, error) {
+	pol, err := LoadPolicy(p)
+	if err != nil {
+		return Policy{}, auth.ValidateOptions{}, err
+	}
+	opts := pol.ValidateOptions(user, site)
+	if opts.EnableHIBP {
+		warnOnly := opts.BreachWarnOnly
+		if err := ConfigureBreachCheck(p, &opts); err != nil {
+			return Policy{}, auth.ValidateOptions{}, err
+		}
+		opts.BreachWarnOnly = warnOnly
+	}
+	return pol, opts, nil
+}
+
+// CheckEntryPassword holds an entry password to the policy's entries mode.
+//
+// Args:
+//
+//	ctx: bounds the breach lookup.
+//	p: vault paths, for policy.json and hibp.json.
+//	site, user, pw: the entry; the site's and user's names count as banned words when
+//	    the policy says so.
+//
+// Returns:
+//
+//	[]auth.Violation: findings to show the user. Under warn these are all of them;
+//	    under block only the breach warnings that do not refuse the password.
+//	error: *auth.PolicyError when the mode is block and pw fails a rule, or an error
+//	    reading the policy.
+//
+// Behavior:
+//  1. Does nothing when the entries mode is off, the default.
+func CheckEntryPassword(ctx context.Context, p Paths, site, user, pw string) ([]auth.Violation, error) {
+	pol, opts, err := PasswordOptions(p, user, site)
+	if err != nil {
+		return nil, err
+	}
+	if pol.Entries == PolicyOff {
+		return nil, nil
+	}
+	violations, warnings := auth.CheckPassword(ctx, pw, opts)
+	if pol.Entries == PolicyWarn {
+		return append(violations, warnings...), nil
+	}
+	if len(violations) > 0 {
+		return warnings, &auth.PolicyError{Violations: violations}
+	}
+	return warnings, nil
+}
+
+// GeneratorRule returns the generator rule for website: the site-rules.json rule, when
+// there is one, raised to the policy's minimum length and required classes unless the
+// policy's entries mode is off. The site rule wins where they conflict, since the site
+// would refuse anything else. An empty website yields the policy alone.
+func GeneratorRule(p Paths, website string) (krypto.SiteRule, bool, error) {
+	pol, err := LoadPolicy(p)
+	if err != nil {
+		return krypto.SiteRule{}, false, err
+	}
+	var rule krypto.SiteRule
+	found := false
+	if website != "" && p.Dir != "" {
+		if rule, found, err = SiteRuleFor(p, website); err != nil {
+			return krypto.SiteRule{}, false, err
+		}
+	}
+	if pol.Entries == PolicyOff {
+		return rule, found, nil
+	}
+
+	if pol.MinLength > rule.MinLength {
+		rule.MinLength = pol.MinLength
+	}
+	if rule.MaxLength > 0 && rule.MinLength > rule.MaxLength {
+		rule.MinLength = rule.MaxLength
+	}
+	allowed := rule.Allowed | rule.Required
+	if allowed == 0 {
+		// No class limit from the site; keep it that way once Required is set.
+		allowed = krypto.AllClasses
+	}
+	rule.Allowed = allowed
+	rule.Required |= pol.RequiredClasses & allowed
+	return rule, true, nil
+}
@@ -0,0 +1,116 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+)
+
+// RecoverySlotLabel is the label stored on the recovery-code slot.
+const RecoverySlotLabel = "recovery code"
+
+// ErrNoRecovery indicates the vault header has no recovery-code slot.
+var ErrNoRecovery = errors.New("vault has no recovery code")
+
+// WrapRecoverySlot wraps the MEK under a key expanded from recovery-code entropy.
+func WrapRecoverySlot(entropy, mek []byte) (vault.KeySlot, error) {
+	kdf := vault.NewRecoveryKDFConfig()
+	salt, err := krypto.NewRandomSalt(kdf.SaltLen)
+	if err != nil {
+		return vault.KeySlot{}, fmt.Errorf("generate salt: %w", err)
+	}
+
+	key, err := krypto.DeriveRecoveryKey(entropy, salt)
+	if err != nil {
+		return vault.KeySlot{}, err
+	}
+	defer zeroize(key)
+
+	return WrapKeySlot(RecoverySlotLabel, kdf, salt, key, mek)
+}
+
+// SetRecoverySlot stores slot as the header's recovery slot, replacing any previous
+// code, and saves header.json sealed with mek.
+func SetRecoverySlot(p Paths, hdr vault.VaultHeader, slot vault.KeySlot, mek []byte) (vault.VaultHeader, error) {
+	if err := checkMutable(hdr); err != nil {
+		return hdr, err
+	}
+	if slot.KDF.Name != vault.KDFRecovery {
+		return hdr, errors.New("recovery slot must use the recovery kdf")
+	}
+
+	hdr.Recovery = &slot
+
+	if err := saveSealedHeader(p, &hdr, mek); err != nil {
+		return hdr, err
+	}
+	return hdr, nil
+}
+
+// UnlockRecovery unwraps the MEK with a printable recovery code.
+//
+// Args:
+//
+//	p: vault paths locating header.json.
+//	code: recovery code as printed by pm master set --recovery.
+//
+// Returns:
+//
+//	[]byte: decrypted MEK; the caller must zeroize it.
+//	vault.VaultHeader: header as loaded from disk.
+//	error: krypto.ErrInvalidRecoveryCode for typos, ErrNoRecovery when no code was
+//	       generated, ErrNoMatchingSlot when a well-formed code does not match,
+//	       ErrHeaderTampered when the header MAC does not match.
+func UnlockRecovery(p Paths, code string) ([]byte, vault.VaultHeader, error) {
+	entropy, err := krypto.ParseRecoveryCode(code)
+	if err != nil {
+		return nil, vault.VaultHeader{}, err
+	}
+	defer zeroize(entropy)
+
+	hdr, err := LoadVaultHeader(p)
+	if err != nil {
+		return nil, hdr, err
+	}
+	if err := CheckHeader(hdr); err != nil {
+		return nil, hdr, err
+	}
+	if hdr.Recovery == nil {
+		return nil, hdr, ErrNoRecovery
+	}
+
+	key, err := DeriveSlotKey(*hdr.Recovery, entropy, nil)
+	if err != nil {
+		return nil, hdr, fmt.Errorf("derive recovery key: %w", err)
+	}
+	defer zeroize(key)
+
+	mek, err := UnwrapKeySlot(*hdr.Recovery, key)
+	if err != nil {
+		return nil, hdr, ErrNoMatchingSlot
+	}
+	if err := verifyUnwrapped(p, &hdr, mek); err != nil {
+		return nil, hdr, err
+	}
+	return mek, hdr, nil
+}
+
+// ReplaceMasterSlot rewraps the slot labelled MasterSlotLabel under a new password-derived
+// key, or adds a fresh master slot when it was revoked. Other slots and the recovery
+// slot are left untouched.
+func ReplaceMasterSlot(p Paths, hdr vault.VaultHeader, kdf vault.KDFConfig, salt, pdk, mek []byte) (vault.VaultHeader, error) {
+	for _, slot := range hdr.KeySlots {
+		if slot.Label == MasterSlotLabel {
+			return RewrapKeySlot(p, hdr, slot.ID, kdf, salt, pdk, mek)
+		}
+	}
+
+	slot, err := WrapKeySlot(MasterSlotLabel, kdf, salt, pdk, mek)
+	if err != nil {
+		return hdr, err
+	}
+	hdr, _, err = AddKeySlot(p, hdr, slot, mek)
+	return hdr, err
+}
@@ -0,0 +1,158 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+)
+
+var (
+	// ErrRotationPending indicates a MEK rotation has not been resolved yet; the header
+	// cannot be edited until the next unlock promotes or discards the pending slot.
+	ErrRotationPending = errors.New("key rotation in progress; unlock the vault to finish it")
+	// ErrMEKMismatch indicates the database is encrypted under a different MEK than the
+	// one the header unwrapped.
+	ErrMEKMismatch = errors.New("vault database is encrypted under a different key")
+)
+
+// BeginRotation records pending (the new MEK wrapped under the rotating secret) in the
+// header while the database is re-encrypted. The header stays sealed with oldMEK and
+// every existing slot keeps working until CommitRotation.
+func BeginRotation(p Paths, hdr vault.VaultHeader, slotID int, pending vault.KeySlot, oldMEK []byte) (vault.VaultHeader, error) {
+	if err := CheckHeader(hdr); err != nil {
+		return hdr, err
+	}
+	if hdr.Pending != nil {
+		return hdr, ErrRotationPending
+	}
+	slot, ok := hdr.Slot(slotID)
+	if !ok {
+		return hdr, ErrSlotNotFound
+	}
+
+	pending.ID = slot.ID
+	pending.Label = slot.Label
+	hdr.Pending = &pending
+
+	if err := saveSealedHeader(p, &hdr, oldMEK); err != nil {
+		return hdr, err
+	}
+	return hdr, nil
+}
+
+// SlotsDroppedByRotation returns the key slots that rotating the MEK through slotID
+// removes: every other slot, since they wrap the old MEK. Callers show them and ask
+// before rotating.
+func SlotsDroppedByRotation(hdr vault.VaultHeader, slotID int) []vault.KeySlot {
+	var dropped []vault.KeySlot
+	for _, slot := range hdr.KeySlots {
+		if slot.ID != slotID {
+			dropped = append(dropped, slot)
+		}
+	}
+	return dropped
+}
+
+// CommitRotation promotes the pending slot once the database is under newMEK.
+// All other slots wrap the old MEK, so they are removed. The recovery slot is replaced
+// by recovery, a slot wrapping newMEK under a fresh code, or removed when it is nil.
+func CommitRotation(p Paths, hdr vault.VaultHeader, newMEK []byte, recovery *vault.KeySlot) (vault.VaultHeader, error) {
+	if hdr.Pending == nil {
+		return hdr, errors.New("no pending rotation")
+	}
+
+	hdr.KeySlots = []vault.KeySlot{*hdr.Pending}
+	hdr.Recovery = recovery
+	hdr.Pending = nil
+
+	if err := saveSealedHeader(p, &hdr, newMEK); err != nil {
+		return hdr, err
+	}
+	return hdr, nil
+}
+
+// AbortRotation discards the pending slot; the database is still under oldMEK.
+func AbortRotation(p Paths, hdr vault.VaultHeader, oldMEK []byte) (vault.VaultHeader, error) {
+	if hdr.Pending == nil {
+		return hdr, nil
+	}
+	hdr.Pending = nil
+
+	if err := saveSealedHeader(p, &hdr, oldMEK); err != nil {
+		return hdr, err
+	}
+	return hdr, nil
+}
+
+// ResolveRotation finishes or rolls back an interrupted rotation after an unlock and
+// returns the MEK that matches the database.
+//
+// Args:
+//
+//	p: vault paths locating header.json.
+//	hdr: header returned by UnlockMEK.
+//	secret: the secret that unlocked mek; needed to open the pending slot.
+//	keyfile: keyfile digest supplied with secret, or nil.
+//	mek: MEK unwrapped by UnlockMEK. It is zeroized if the pending MEK replaces it.
+//	dbUsesMEK: reports whether the database rows are encrypted under a given MEK.
+//
+// Returns:
+//
+//	[]byte: MEK to use for the session.
+//	vault.VaultHeader: header after any promotion or rollback.
+//	error: ErrMEKMismatch when neither key matches the database.
+//
+// Behavior:
+//  1. Without a pending slot, only confirms the database matches mek.
+//  2. If the database still matches mek, the rotation never committed: drop the pending slot.
+//  3. Otherwise the database committed: open the pending slot with secret, confirm it
+//     matches the database, and promote it.
+func ResolveRotation(p Paths, hdr vault.VaultHeader, secret, keyfile, mek []byte, dbUsesMEK func([]byte) (bool, error)) ([]byte, vault.VaultHeader, error) {
+	ok, err := dbUsesMEK(mek)
+	if err != nil {
+		return nil, hdr, err
+	}
+	if hdr.Pending == nil {
+		if !ok {
+			return nil, hdr, ErrMEKMismatch
+		}
+		return mek, hdr, nil
+	}
+
+	if ok {
+		hdr, err = AbortRotation(p, hdr, mek)
+		if err != nil {
+			return nil, hdr, fmt.Errorf("discard pending rotation: %w", err)
+		}
+		return mek, hdr, nil
+	}
+
+	pdk, err := DeriveSlotKey(*hdr.Pending, secret, keyfile)
+	if err != nil {
+		return nil, hdr, fmt.Errorf("derive pending key: %w", err)
+	}
+	defer zeroize(pdk)
+
+	newMEK, err := UnwrapKeySlot(*hdr.Pending, pdk)
+	if err != nil {
+		// A different slot's secret was used; only the rotating secret can finish.
+		return nil, hdr, ErrRotationPending
+	}
+	if ok, err := dbUsesMEK(newMEK); err != nil || !ok {
+		zeroize(newMEK)
+		if err != nil {
+			return nil, hdr, err
+		}
+		return nil, hdr, ErrMEKMismatch
+	}
+
+	// The fresh recovery code of the interrupted run was never shown, so none is kept.
+	hdr, err = CommitRotation(p, hdr, newMEK, nil)
+	if err != nil {
+		zeroize(newMEK)
+		return nil, hdr, fmt.Errorf("promote pending rotation: %w", err)
+	}
+	zeroize(mek)
+	return newMEK, hdr, nil
+}
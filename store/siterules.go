@@ -0,0 +1,68 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
+	"github.com/Hussein-Mazeh/PasswordManager/krypto"
+)
+
+const siteRulesFilename = "site-rules.json"
+
+// SiteRulesPath resolves the optional per-site generator rules file. It maps a website
+// to a passwordrules string, e.g. {"bank.example": "maxlength: 16; allowed: lower, upper, digit"}.
+// The file holds no secrets and is edited by hand.
+func (p Paths) SiteRulesPath() string {
+	return filepath.Join(p.Dir, siteRulesFilename)
+}
+
+// LoadSiteRules reads site-rules.json. A missing file yields an empty map.
+func LoadSiteRules(p Paths) (map[string]krypto.SiteRule, error) {
+	data, err := os.ReadFile(p.SiteRulesPath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return map[string]krypto.SiteRule{}, nil
+		}
+		return nil, fmt.Errorf("read site rules: %w", err)
+	}
+
+	var raw map[string]string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", siteRulesFilename, err)
+	}
+	rules := make(map[string]krypto.SiteRule, len(raw))
+	for site, s := range raw {
+		r, err := krypto.ParsePasswordRules(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", siteRulesFilename, site, err)
+		}
+		rules[vault.NormalizeSite(site)] = r
+	}
+	return rules, nil
+}
+
+// SiteRuleFor returns the generator rule for website: the rule of its host or, failing
+// that, of the closest parent domain listed (login.bank.example uses bank.example).
+func SiteRuleFor(p Paths, website string) (krypto.SiteRule, bool, error) {
+	rules, err := LoadSiteRules(p)
+	if err != nil {
+		return krypto.SiteRule{}, false, err
+	}
+	host := vault.NormalizeSite(website)
+	for host != "" {
+		if r, ok := rules[host]; ok {
+			return r, true, nil
+		}
+		_, parent, ok := strings.Cut(host, ".")
+		if !ok {
+			break
+		}
+		host = parent
+	}
+	return krypto.SiteRule{}, false, nil
+}
@@ -1,23 +1,25 @@
 package store
 
 import (
-	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"time"
 
 	"github.com/Hussein-Mazeh/PasswordManager/internal/vault"
-	"github.com/Hussein-Mazeh/PasswordManager/krypto"
 )
 
-const headerFilename = "header.json"
+const (
+	headerFilename   = "header.json"
+	databaseFilename = "vault.db"
+)
 
 var (
 	// ErrMEKNotWrapped indicates the header does not contain a wrapped MEK.
 	ErrMEKNotWrapped = errors.New("wrapped mek not present")
+	// ErrNoMatchingSlot indicates no key slot accepted the supplied secret.
+	ErrNoMatchingSlot = errors.New("no key slot matches the supplied secret")
 
 	headerMEKAAD = []byte("header.mek")
 )
@@ -32,6 +34,11 @@ func (p Paths) HeaderPath() string {
 	return filepath.Join(p.Dir, headerFilename)
 }
 
+// DatabasePath resolves the vault database path.
+func (p Paths) DatabasePath() string {
+	return filepath.Join(p.Dir, databaseFilename)
+}
+
 func (p Paths) ensureDir() error {
 	if p.Dir == "" {
 		return errors.New("vault directory not specified")
@@ -42,7 +49,9 @@ func (p Paths) ensureDir() error {
 	return nil
 }
 
-// LoadVaultHeader reads header.json from disk.
+// LoadVaultHeader reads header.json from disk. Version 1 headers are upgraded in memory
+// to the key slot layout; the upgrade is persisted by the next save. The header MAC is
+// not checked here because it needs the MEK; see VerifyHeaderMAC.
 func LoadVaultHeader(p Paths) (vault.VaultHeader, error) {
 	var hdr vault.VaultHeader
 
@@ -57,6 +66,7 @@ func LoadVaultHeader(p Paths) (vault.VaultHeader, error) {
 	if err := json.Unmarshal(data, &hdr); err != nil {
 		return hdr, fmt.Errorf("decode header: %w", err)
 	}
+	upgradeLegacyHeader(&hdr)
 
 	return hdr, nil
 }
@@ -103,43 +113,9 @@ func SaveVaultHeader(p Paths, hdr vault.VaultHeader) error {
 	return nil
 }
 
-// WrapAndSaveMEK wraps the MEK using the provided PDK and saves it into header.json.
-func WrapAndSaveMEK(p Paths, hdr vault.VaultHeader, pdk []byte, mek []byte) error {
-	if len(pdk) != 32 {
-		return errors.New("invalid PDK length")
-	}
-	if len(mek) != 32 {
-		return errors.New("invalid MEK length")
-	}
-	if hdr.Version != 1 {
-		return errors.New("unsupported header version")
-	}
-	if hdr.KDF.Name != "argon2id" {
-		return errors.New("unsupported kdf")
-	}
-
-	nonce, ciphertext, err := krypto.EncryptAESGCM(pdk, mek, headerMEKAAD)
-	if err != nil {
-		return fmt.Errorf("wrap mek: %w", err)
-	}
-
-	hdr.WrapNonce = base64.StdEncoding.EncodeToString(nonce)
-	hdr.WrappedMEK = base64.StdEncoding.EncodeToString(ciphertext)
-
-	now := time.Now().UTC()
-	if hdr.CreatedAt.IsZero() {
-		hdr.CreatedAt = now
-	}
-	hdr.UpdatedAt = now
-
-	if err := SaveVaultHeader(p, hdr); err != nil {
-		return fmt.Errorf("save header: %w", err)
-	}
-
-	return nil
-}
-
 // LoadAndUnwrapMEK loads header.json and decrypts the wrapped MEK using the provided PDK.
+// Each key slot has its own salt, so a PDK opens at most one slot; all slots are tried.
+// The header MAC is verified with the unwrapped MEK and ErrHeaderTampered is returned on mismatch.
 func LoadAndUnwrapMEK(p Paths, pdk []byte) ([]byte, vault.VaultHeader, error) {
 	if len(pdk) != 32 {
 		return nil, vault.VaultHeader{}, errors.New("invalid PDK length")
@@ -149,60 +125,78 @@ func LoadAndUnwrapMEK(p Paths, pdk []byte) ([]byte, vault.VaultHeader, error) {
 	if err != nil {
 		return nil, hdr, err
 	}
-
-	if hdr.Version != 1 {
-		return nil, hdr, errors.New("unsupported header version")
-	}
-	if hdr.KDF.Name != "argon2id" {
-		return nil, hdr, errors.New("unsupported kdf")
-	}
-	if hdr.WrapNonce == "" || hdr.WrappedMEK == "" {
-		return nil, hdr, ErrMEKNotWrapped
+	if err := CheckHeader(hdr); err != nil {
+		return nil, hdr, err
 	}
 
-	nonce, err := base64.StdEncoding.DecodeString(hdr.WrapNonce)
-	if err != nil {
-		return nil, hdr, fmt.Errorf("decode wrap nonce: %w", err)
-	}
-	ciphertext, err := base64.StdEncoding.DecodeString(hdr.WrappedMEK)
-	if err != nil {
-		return nil, hdr, fmt.Errorf("decode wrapped mek: %w", err)
+	for _, slot := range hdr.KeySlots {
+		mek, err := UnwrapKeySlot(slot, pdk)
+		if err != nil {
+			continue
+		}
+		if err := verifyUnwrapped(p, &hdr, mek); err != nil {
+			return nil, hdr, err
+		}
+		return mek, hdr, nil
 	}
+	return nil, hdr, ErrNoMatchingSlot
+}
 
-	mek, err := krypto.DecryptAESGCM(pdk, nonce, ciphertext, headerMEKAAD)
+// LoadHeaderForMEK loads header.json for a MEK obtained without a secret, such as one
+// cached by pm agent. The header MAC must verify under mek, which proves the key belongs
+// to this vault. It fails with ErrRotationPending while a rotation is unresolved, since
+// finishing one needs the unlock secret.
+func LoadHeaderForMEK(p Paths, mek []byte) (vault.VaultHeader, error) {
+	hdr, err := LoadVaultHeader(p)
 	if err != nil {
-		return nil, hdr, fmt.Errorf("unwrap mek: %w", err)
+		return hdr, err
 	}
-
-	return mek, hdr, nil
-}
-
-// RewrapMEK replaces the stored wrapped MEK using a newly derived PDK.
-func RewrapMEK(p Paths, hdr vault.VaultHeader, newPDK []byte, mek []byte) error {
-	if len(newPDK) != 32 {
-		return errors.New("invalid PDK length")
+	if err := CheckHeader(hdr); err != nil {
+		return hdr, err
 	}
-	if len(mek) != 32 {
-		return errors.New("invalid MEK length")
+	if hdr.Pending != nil {
+		return hdr, ErrRotationPending
 	}
-	if hdr.Version != 1 {
-		return errors.New("unsupported header version")
+	if err := CheckHeaderSealed(p, hdr); err != nil {
+		return hdr, err
 	}
-	if hdr.KDF.Name != "argon2id" {
-		return errors.New("unsupported kdf")
+	if err := VerifyHeaderMAC(hdr, mek); err != nil {
+		return hdr, err
 	}
+	return hdr, nil
+}
 
-	nonce, ciphertext, err := krypto.EncryptAESGCM(newPDK, mek, headerMEKAAD)
-	if err != nil {
-		return fmt.Errorf("rewrap mek: %w", err)
+// CheckHeader validates the header version and that at least one slot exists. Load
+// functions apply it before unwrapping; backup and restore use it on staged copies.
+func CheckHeader(hdr vault.VaultHeader) error {
+	if hdr.Version < vault.KeySlotHeaderVersion || hdr.Version > vault.HeaderVersion {
+		return errors.New("unsupported header version")
 	}
-
-	hdr.WrapNonce = base64.StdEncoding.EncodeToString(nonce)
-	hdr.WrappedMEK = base64.StdEncoding.EncodeToString(ciphertext)
-	hdr.UpdatedAt = time.Now().UTC()
-
-	if err := SaveVaultHeader(p, hdr); err != nil {
-		return fmt.Errorf("save header: %w", err)
+	if len(hdr.KeySlots) == 0 {
+		return ErrMEKNotWrapped
 	}
 	return nil
 }
+
+// upgradeLegacyHeader folds the inline version 1 wrap fields into key slot 0.
+func upgradeLegacyHeader(hdr *vault.VaultHeader) {
+	if hdr.Version != vault.LegacyHeaderVersion {
+		return
+	}
+	if hdr.WrapNonce != "" && hdr.WrappedMEK != "" {
+		hdr.KeySlots = []vault.KeySlot{{
+			ID:         0,
+			Label:      MasterSlotLabel,
+			CreatedAt:  hdr.CreatedAt,
+			Salt:       hdr.Salt,
+			WrapNonce:  hdr.WrapNonce,
+			WrappedMEK: hdr.WrappedMEK,
+			KDF:        hdr.KDF,
+		}}
+	}
+	hdr.Version = vault.KeySlotHeaderVersion
+	hdr.Salt = ""
+	hdr.WrapNonce = ""
+	hdr.WrappedMEK = ""
+	hdr.KDF = vault.KDFConfig{}
+}